@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"github.com/dewi911/cruda-app/internal/config"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/internal/metadata"
 	"github.com/dewi911/cruda-app/internal/repository/psql"
 	"github.com/dewi911/cruda-app/internal/service"
 	"github.com/dewi911/cruda-app/internal/transport/grpc"
 	"github.com/dewi911/cruda-app/internal/transport/rest"
 	"github.com/dewi911/cruda-app/pkg/database"
+	"github.com/dewi911/cruda-app/pkg/email"
+	"github.com/dewi911/cruda-app/pkg/encrypt"
 	"github.com/dewi911/cruda-app/pkg/hash"
+	"github.com/dewi911/cruda-app/pkg/oidc"
+	"github.com/dewi911/cruda-app/pkg/ratelimit"
 	_ "github.com/lib/pq"
 	"os"
 
@@ -53,7 +61,10 @@ func main() {
 	hasher := hash.NewSHA1Hasher("salt")
 
 	bookRepo := psql.NewBooks(db)
-	bookService := service.NewBooks(bookRepo)
+	bookService := service.NewBooks(bookRepo, newMetadataProvider(cfg), cfg.Metadata.AutoEnrich, cfg.Books.TrashRetention,
+		cfg.Books.RequirePreconditions)
+	authorsService := service.NewAuthors(psql.NewAuthors(db), bookRepo)
+	genresService := service.NewGenres(psql.NewGenres(db), psql.NewTags(db))
 
 	usersRepo := psql.NewUsers(db)
 	tokensRepo := psql.NewTokens(db)
@@ -63,9 +74,102 @@ func main() {
 		log.Fatal(err)
 	}
 
-	usersService := service.NewUsers(usersRepo, tokensRepo, auditClient, hasher, []byte("sample secret key"), cfg.Auth.TokenTTL)
+	encryptor, err := encrypt.NewAESEncryptor(cfg.Auth.EncryptionKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mfaRepo := psql.NewMFA(db)
+	mfaService := service.NewMFA(mfaRepo, usersRepo, hasher, encryptor, cfg.Auth.MFAIssuer)
+	auditRepo := psql.NewAuditEvents(db)
+	auditService := service.NewAudit(auditRepo, auditClient)
+	mailer := newEmailSender(cfg)
+
+	usersService := service.NewUsers(usersRepo, tokensRepo, psql.NewEmailVerifications(db), mfaService, auditService, mailer,
+		hasher, []byte("sample secret key"), cfg.Auth.TokenTTL, cfg.Server.PublicURL)
+
+	oidcProviders := make(map[string]service.OIDCProvider)
+	for name, p := range cfg.OIDC.Providers {
+		oidcProviders[name] = oidc.NewProvider(oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		})
+	}
+
+	identitiesRepo := psql.NewIdentities(db)
+	oidcService := service.NewOIDC(oidcProviders, identitiesRepo, usersRepo, usersService, hasher, auditService, []byte("sample secret key"))
+
+	var limiter *rest.RateLimiter
+	if cfg.RateLimit.Enabled {
+		limiter = rest.NewRateLimiter(newRateLimitStore(cfg, db), rateLimits(cfg))
+	}
+
+	apiKeysRepo := psql.NewAPIKeys(db)
+	apiKeysService := service.NewAPIKeys(apiKeysRepo)
+
+	orgsRepo := psql.NewOrgs(db)
+	orgsService := service.NewOrgs(orgsRepo, usersRepo, usersService, mailer, auditService, cfg.Server.PublicURL)
+
+	reviewsRepo := psql.NewReviews(db)
+	shelvesRepo := psql.NewShelves(db)
+	circulationRepo := psql.NewCirculation(db)
+	readingsRepo := psql.NewReadings(db)
+
+	privacyService := service.NewPrivacy(usersRepo, tokensRepo, apiKeysRepo, identitiesRepo, bookRepo, reviewsRepo, shelvesRepo,
+		readingsRepo, circulationRepo, circulationRepo, orgsRepo, auditRepo, psql.NewErasures(db), usersService, auditService)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	handler := rest.NewHandler(bookService, usersService)
+	go privacyService.RunErasureWorker(ctx)
+
+	circulationService := service.NewCirculation(circulationRepo, auditService, domain.LoanPolicy{
+		Period:       cfg.Circulation.LoanPeriod,
+		MaxRenewals:  cfg.Circulation.MaxRenewals,
+		Limits:       cfg.Circulation.LoanLimits,
+		PickupWindow: cfg.Circulation.HoldPickupWindow,
+	})
+
+	scheduler, err := service.NewScheduler(psql.NewJobs(db), auditService, jobs(cfg, map[string]service.JobFunc{
+		"session_cleanup": usersService.CleanupSessions,
+		"overdue_loans":   circulationService.MarkOverdueLoans,
+		"hold_expiry":     circulationService.ExpireHolds,
+		"book_purge":      bookService.PurgeTrash,
+	})...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.Scheduler.Enabled {
+		go scheduler.Run(ctx)
+	}
+
+	importsService := service.NewImports(bookRepo, psql.NewImports(db), auditService, cfg.Books.ImportMaxRows,
+		cfg.Books.ImportAsyncRows)
+	if err := importsService.FailInterrupted(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	handler := rest.NewHandler(rest.Services{
+		Books:       bookService,
+		Authors:     authorsService,
+		Genres:      genresService,
+		Reviews:     service.NewReviews(reviewsRepo),
+		Shelves:     service.NewShelves(shelvesRepo, readingsRepo),
+		Circulation: circulationService,
+		Users:       usersService,
+		MFA:         mfaService,
+		APIKeys:     apiKeysService,
+		OIDC:        oidcService,
+		Admin:       service.NewAdmin(usersRepo, tokensRepo, mfaRepo, auditService),
+		Privacy:     privacyService,
+		Orgs:        orgsService,
+		Scheduler:   scheduler,
+		Imports:     importsService,
+	}, limiter, cfg.Server.PublicURL)
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
@@ -78,3 +182,98 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+func newEmailSender(cfg *config.Config) service.EmailSender {
+	if cfg.Email.Driver == "smtp" {
+		return email.NewSMTPSender(email.SMTPConfig{
+			Host:     cfg.Email.SMTP.Host,
+			Port:     cfg.Email.SMTP.Port,
+			Username: cfg.Email.SMTP.Username,
+			Password: cfg.Email.SMTP.Password,
+			From:     cfg.Email.From,
+		})
+	}
+
+	return email.NewLogSender()
+}
+
+// newMetadataProvider returns nil when enrichment is not configured.
+func newMetadataProvider(cfg *config.Config) service.MetadataProvider {
+	var provider metadata.Provider
+
+	switch cfg.Metadata.Provider {
+	case "openlibrary":
+		provider = metadata.NewOpenLibrary(cfg.Metadata.BaseURL, cfg.Metadata.Timeout)
+	case "fixture":
+		fixture, err := metadata.NewFixture(cfg.Metadata.FixtureFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		provider = fixture
+	default:
+		return nil
+	}
+
+	if cfg.Metadata.CacheTTL <= 0 {
+		return provider
+	}
+
+	return metadata.NewCache(provider, cfg.Metadata.CacheTTL, cfg.Metadata.CacheSize)
+}
+
+// jobs pairs the jobs with their configuration and leaves out jobs that have no schedule.
+func jobs(cfg *config.Config, funcs map[string]service.JobFunc) []service.Job {
+	for name := range cfg.Scheduler.Jobs {
+		if _, ok := funcs[name]; !ok {
+			log.Fatalf("unknown job %s in scheduler config", name)
+		}
+	}
+
+	jobs := make([]service.Job, 0, len(funcs))
+	for name, fn := range funcs {
+		c, ok := cfg.Scheduler.Jobs[name]
+		if !ok || c.Schedule == "" {
+			continue
+		}
+
+		jobs = append(jobs, service.Job{
+			Name:     name,
+			Schedule: c.Schedule,
+			Timeout:  c.Timeout,
+			Jitter:   c.Jitter,
+			Run:      fn,
+		})
+	}
+
+	return jobs
+}
+
+func newRateLimitStore(cfg *config.Config, db *sql.DB) ratelimit.Store {
+	if cfg.RateLimit.Store == "postgres" {
+		return psql.NewRateLimits(db)
+	}
+
+	return ratelimit.NewMemoryStore()
+}
+
+func rateLimits(cfg *config.Config) rest.RateLimits {
+	limits := rest.RateLimits{
+		Global:            toLimit(cfg.RateLimit.Global),
+		Groups:            make(map[string]ratelimit.Limit),
+		TrustProxyHeaders: cfg.RateLimit.TrustProxyHeaders,
+	}
+
+	for name, l := range cfg.RateLimit.Groups {
+		limits.Groups[name] = toLimit(l)
+	}
+
+	return limits
+}
+
+func toLimit(l config.Limit) ratelimit.Limit {
+	if l.Requests <= 0 || l.Period <= 0 {
+		return ratelimit.Limit{}
+	}
+
+	return ratelimit.Every(l.Requests, l.Period, l.Burst)
+}
@@ -0,0 +1,484 @@
+package citation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var bibtexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`, `{`, `\{`, `}`, `\}`, `&`, `\&`, `%`, `\%`, `$`, `\$`, `#`, `\#`, `_`, `\_`,
+)
+
+var bibtexUnescaper = strings.NewReplacer(
+	`\textbackslash{}`, `\`, `\{`, `{`, `\}`, `}`, `\&`, `&`, `\%`, `%`, `\$`, `$`, `\#`, `#`, `\_`, `_`, `{`, ``, `}`, ``,
+)
+
+// bibtexMonths are the month macros predefined by BibTeX.
+var bibtexMonths = map[string]string{
+	"jan": "1", "feb": "2", "mar": "3", "apr": "4", "may": "5", "jun": "6",
+	"jul": "7", "aug": "8", "sep": "9", "oct": "10", "nov": "11", "dec": "12",
+}
+
+func writeBibTeX(w io.Writer, books []domain.Book) error {
+	bw := bufio.NewWriter(w)
+	keys := make(map[string]int)
+
+	for i, book := range books {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+
+		people := contributors(book)
+		fields := [][2]string{
+			{"title", book.Title},
+			{"author", strings.Join(namesWithRole(people, domain.AuthorRoleAuthor), " and ")},
+			{"editor", strings.Join(namesWithRole(people, domain.AuthorRoleEditor), " and ")},
+			{"translator", strings.Join(namesWithRole(people, domain.AuthorRoleTranslator), " and ")},
+			{"year", year(book.PublishDate)},
+			{"date", date(book.PublishDate)},
+			{"publisher", book.Publisher},
+			{"edition", book.Edition},
+			{"series", book.Series},
+			{"number", formatNumber(book.SeriesPosition)},
+			{"pagetotal", formatNumber(float64(book.PageCount))},
+			{"isbn", book.ISBN},
+			{"language", book.Language},
+			{"abstract", book.Description},
+			{"keywords", strings.Join(book.Tags, ", ")},
+		}
+
+		fmt.Fprintf(bw, "@book{%s,\n", bibtexKey(book, people, keys))
+		for _, field := range fields {
+			if field[1] != "" {
+				fmt.Fprintf(bw, "  %s = {%s},\n", field[0], bibtexEscaper.Replace(field[1]))
+			}
+		}
+		bw.WriteString("}\n")
+	}
+
+	return bw.Flush()
+}
+
+// bibtexKey builds a key from the family name of the first contributor, the
+// year and the first word of the title that is not an article, e.g.
+// tolkien1937hobbit. Keys that were already used get a numeric suffix.
+func bibtexKey(book domain.Book, people []contributor, used map[string]int) string {
+	var key strings.Builder
+	if len(people) > 0 {
+		family, _ := splitName(people[0].name)
+		key.WriteString(keyPart(family))
+	}
+
+	key.WriteString(year(book.PublishDate))
+
+	for _, word := range strings.Fields(book.Title) {
+		if part := keyPart(word); part != "" && part != "a" && part != "an" && part != "the" {
+			key.WriteString(part)
+			break
+		}
+	}
+
+	k := key.String()
+	if k == "" {
+		k = "book" + strconv.FormatInt(book.ID, 10)
+	}
+
+	used[k]++
+	if n := used[k]; n > 1 {
+		k += "_" + strconv.Itoa(n)
+	}
+
+	return k
+}
+
+// keyPart keeps the ASCII letters and digits of s in lower case.
+func keyPart(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func year(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return strconv.Itoa(t.Year())
+}
+
+func date(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.DateOnly)
+}
+
+func formatNumber(v float64) string {
+	if v <= 0 {
+		return ""
+	}
+
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// readBibTeX reads the entries of a BibTeX file. @string macros are expanded,
+// @comment and @preamble are skipped. LaTeX markup other than escaped special
+// characters and braces is kept as is.
+func readBibTeX(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &bibtexParser{s: string(data), macros: make(map[string]string)}
+	for name, month := range bibtexMonths {
+		p.macros[name] = month
+	}
+
+	entries := make([]Entry, 0)
+	for {
+		i := strings.IndexByte(p.s[p.pos:], '@')
+		if i < 0 {
+			break
+		}
+		p.pos += i + 1
+
+		entryType := strings.ToLower(p.ident())
+		p.skipSpace()
+
+		var close byte
+		switch p.next() {
+		case '{':
+			close = '}'
+		case '(':
+			close = ')'
+		default:
+			return nil, p.errorf("expected { after @%s", entryType)
+		}
+
+		switch entryType {
+		case "comment":
+			if err := p.skipBalanced(close); err != nil {
+				return nil, err
+			}
+		case "preamble":
+			if _, err := p.value(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(close); err != nil {
+				return nil, err
+			}
+		case "string":
+			name, value, err := p.field()
+			if err != nil {
+				return nil, err
+			}
+			p.macros[name] = value
+			if err := p.expect(close); err != nil {
+				return nil, err
+			}
+		default:
+			key, fields, err := p.entry(close)
+			if err != nil {
+				return nil, err
+			}
+
+			book, err := bibtexBook(fields)
+			entries = append(entries, Entry{Key: key, Book: book, Err: err})
+		}
+	}
+
+	return entries, nil
+}
+
+type bibtexParser struct {
+	s      string
+	pos    int
+	macros map[string]string
+}
+
+func (p *bibtexParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.s[:min(p.pos, len(p.s))], "\n") + 1
+	return fmt.Errorf("%w: line %d: %s", domain.ErrInvalidCitation, line, fmt.Sprintf(format, args...))
+}
+
+func (p *bibtexParser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *bibtexParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+
+	return p.s[p.pos]
+}
+
+func (p *bibtexParser) next() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	p.pos++
+
+	return p.s[p.pos-1]
+}
+
+func (p *bibtexParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+
+	return nil
+}
+
+// ident reads a name: anything up to white space or a delimiter.
+func (p *bibtexParser) ident() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" \t\r\n{}()=,#\"", rune(p.s[p.pos])) {
+		p.pos++
+	}
+
+	return p.s[start:p.pos]
+}
+
+// skipBalanced skips to after the close that matches an opening already read.
+func (p *bibtexParser) skipBalanced(close byte) error {
+	open := byte('{')
+	if close == ')' {
+		open = '('
+	}
+
+	for depth := 1; p.pos < len(p.s); p.pos++ {
+		switch p.s[p.pos] {
+		case open:
+			depth++
+		case close:
+			if depth--; depth == 0 {
+				p.pos++
+				return nil
+			}
+		}
+	}
+
+	return p.errorf("unterminated @comment")
+}
+
+// entry reads the key and fields of an entry up to its close.
+func (p *bibtexParser) entry(close byte) (string, map[string]string, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != ',' && p.s[p.pos] != close {
+		p.pos++
+	}
+	key := strings.TrimSpace(p.s[start:p.pos])
+
+	fields := make(map[string]string)
+	for {
+		switch p.peek() {
+		case close:
+			p.pos++
+			return key, fields, nil
+		case ',':
+			p.pos++
+			continue
+		case 0:
+			return "", nil, p.errorf("unterminated entry %q", key)
+		}
+
+		name, value, err := p.field()
+		if err != nil {
+			return "", nil, err
+		}
+		fields[name] = value
+
+		if c := p.peek(); c != ',' && c != close {
+			return "", nil, p.errorf("expected , or %q after field %s", close, name)
+		}
+	}
+}
+
+// field reads name = value. Names are returned in lower case, values without
+// their delimiters.
+func (p *bibtexParser) field() (string, string, error) {
+	name := strings.ToLower(p.ident())
+	if name == "" {
+		return "", "", p.errorf("expected a field name")
+	}
+
+	if err := p.expect('='); err != nil {
+		return "", "", err
+	}
+
+	value, err := p.value()
+
+	return name, value, err
+}
+
+// value reads a braced or quoted string, a number or a macro, and the parts
+// concatenated to it with #.
+func (p *bibtexParser) value() (string, error) {
+	var value strings.Builder
+	for {
+		switch c := p.peek(); {
+		case c == '{':
+			start := p.pos + 1
+			if err := p.closeBrace(); err != nil {
+				return "", err
+			}
+			value.WriteString(p.s[start : p.pos-1])
+		case c == '"':
+			p.pos++
+			start := p.pos
+			for depth := 0; ; p.pos++ {
+				if p.pos >= len(p.s) {
+					return "", p.errorf("unterminated string")
+				}
+				if b := p.s[p.pos]; b == '{' {
+					depth++
+				} else if b == '}' {
+					depth--
+				} else if b == '"' && depth == 0 && p.s[p.pos-1] != '\\' {
+					break
+				}
+			}
+			value.WriteString(p.s[start:p.pos])
+			p.pos++
+		default:
+			name := p.ident()
+			if name == "" {
+				return "", p.errorf("expected a value")
+			}
+
+			if macro, ok := p.macros[strings.ToLower(name)]; ok {
+				value.WriteString(macro)
+			} else {
+				value.WriteString(name)
+			}
+		}
+
+		if p.peek() != '#' {
+			return value.String(), nil
+		}
+		p.pos++
+	}
+}
+
+// closeBrace moves past the brace that matches the one at the position.
+func (p *bibtexParser) closeBrace() error {
+	for depth := 0; p.pos < len(p.s); p.pos++ {
+		switch p.s[p.pos] {
+		case '\\':
+			p.pos++
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				p.pos++
+				return nil
+			}
+		}
+	}
+
+	return p.errorf("unbalanced braces")
+}
+
+// bibtexText removes escapes and braces and collapses white space.
+func bibtexText(value string) string {
+	return strings.Join(strings.Fields(bibtexUnescaper.Replace(value)), " ")
+}
+
+// bibtexNames splits a name list on "and" outside of braces.
+func bibtexNames(value string) []string {
+	names := make([]string, 0)
+	depth, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+
+		end := i == len(value)-1
+		if depth == 0 && (end || i+5 <= len(value) && strings.EqualFold(value[i:i+5], " and ")) {
+			part := value[start:]
+			if !end {
+				part = value[start:i]
+				start = i + 5
+			}
+
+			if name := bibtexText(part); name != "" && name != "others" {
+				names = append(names, displayName(name))
+			}
+		}
+	}
+
+	return names
+}
+
+func bibtexBook(fields map[string]string) (domain.Book, error) {
+	text := func(name string) string { return bibtexText(fields[name]) }
+
+	book := domain.Book{
+		Title:       text("title"),
+		Publisher:   text("publisher"),
+		Edition:     text("edition"),
+		Series:      text("series"),
+		Language:    text("language"),
+		Description: text("abstract"),
+		Tags:        splitKeywords(text("keywords")),
+	}
+
+	names := bibtexNames(fields["author"])
+	if len(names) == 0 {
+		names = bibtexNames(fields["editor"])
+	}
+	book.Author = strings.Join(names, ", ")
+
+	if isbns := splitKeywords(text("isbn")); len(isbns) > 0 {
+		book.ISBN = isbns[0]
+	}
+
+	if t, ok := parseDate(text("date")); ok {
+		book.PublishDate = t
+	} else if t, ok := parseDate(text("year")); ok {
+		if month, err := strconv.Atoi(text("month")); err == nil && month >= 1 && month <= 12 {
+			t = t.AddDate(0, month-1, 0)
+		}
+		book.PublishDate = t
+	}
+
+	if number := text("number"); number != "" {
+		if v, err := strconv.ParseFloat(number, 64); err == nil {
+			book.SeriesPosition = v
+		}
+	}
+
+	if pages := text("pagetotal"); pages != "" {
+		v, err := strconv.Atoi(pages)
+		if err != nil {
+			return book, errors.New("pagetotal: expected a number")
+		}
+		book.PageCount = v
+	}
+
+	return book, nil
+}
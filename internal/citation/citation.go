@@ -0,0 +1,158 @@
+// Package citation renders books in bibliographic formats and reads them back
+// from BibTeX and RIS files.
+package citation
+
+import (
+	"github.com/dewi911/cruda-app/internal/domain"
+	"io"
+	"strings"
+	"time"
+)
+
+// MediaTypes maps the citation formats to their media types.
+var MediaTypes = map[string]string{
+	domain.CitationFormatBibTeX:  "application/x-bibtex",
+	domain.CitationFormatRIS:     "application/x-research-info-systems",
+	domain.CitationFormatMARCXML: "application/marcxml+xml",
+	domain.CitationFormatCSLJSON: "application/vnd.citationstyles.csl+json",
+}
+
+// FormatOf returns the citation format of a media type.
+func FormatOf(mediaType string) (string, bool) {
+	for format, t := range MediaTypes {
+		if t == mediaType {
+			return format, true
+		}
+	}
+
+	return "", false
+}
+
+// Write renders the books in the format.
+func Write(w io.Writer, format string, books []domain.Book) error {
+	switch format {
+	case domain.CitationFormatBibTeX:
+		return writeBibTeX(w, books)
+	case domain.CitationFormatRIS:
+		return writeRIS(w, books)
+	case domain.CitationFormatMARCXML:
+		return writeMARCXML(w, books)
+	case domain.CitationFormatCSLJSON:
+		return writeCSLJSON(w, books)
+	default:
+		return domain.ErrUnsupportedCitation
+	}
+}
+
+// Entry is a book read from a citation file, or the reason it could not be
+// read. Key is the citation key of BibTeX entries and the ID of RIS records.
+type Entry struct {
+	Key  string
+	Book domain.Book
+	Err  error
+}
+
+// Read parses a BibTeX or RIS file. Files that cannot be parsed fail as a
+// whole, entries that do not make a book are returned with their error.
+func Read(r io.Reader, format string) ([]Entry, error) {
+	switch format {
+	case domain.CitationFormatBibTeX:
+		return readBibTeX(r)
+	case domain.CitationFormatRIS:
+		return readRIS(r)
+	default:
+		return nil, domain.ErrUnsupportedCitation
+	}
+}
+
+// contributor is a linked author of a book with its role.
+type contributor struct {
+	name string
+	role string
+}
+
+// contributors returns the linked authors of a book, or the author field when
+// it has none.
+func contributors(book domain.Book) []contributor {
+	people := make([]contributor, 0, len(book.Authors))
+	for _, author := range book.Authors {
+		if author.Name == "" {
+			continue
+		}
+
+		role := author.Role
+		if role == "" {
+			role = domain.AuthorRoleAuthor
+		}
+		people = append(people, contributor{name: author.Name, role: role})
+	}
+
+	if len(people) == 0 && book.Author != "" {
+		people = append(people, contributor{name: book.Author, role: domain.AuthorRoleAuthor})
+	}
+
+	return people
+}
+
+func namesWithRole(people []contributor, role string) []string {
+	names := make([]string, 0, len(people))
+	for _, person := range people {
+		if person.role == role {
+			names = append(names, person.name)
+		}
+	}
+
+	return names
+}
+
+// splitName splits "First Last" or "Last, First" into the family and given
+// names.
+func splitName(name string) (family, given string) {
+	name = strings.TrimSpace(name)
+	if last, first, ok := strings.Cut(name, ","); ok {
+		return strings.TrimSpace(last), strings.TrimSpace(first)
+	}
+
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return name, ""
+	}
+
+	return name[i+1:], strings.TrimSpace(name[:i])
+}
+
+// displayName turns "Last, First" into "First Last".
+func displayName(name string) string {
+	family, given := splitName(name)
+	if given == "" {
+		return family
+	}
+
+	return given + " " + family
+}
+
+// parseDate reads a year, a year and month or a full date, with "-" or "/"
+// separators and an optional trailing separator as used by RIS.
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimRight(strings.TrimSpace(strings.ReplaceAll(value, "/", "-")), "-")
+
+	for _, layout := range []string{time.DateOnly, "2006-01", "2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// splitKeywords splits a keyword list on commas and semicolons.
+func splitKeywords(value string) []string {
+	keywords := make([]string, 0)
+	for _, keyword := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+
+	return keywords
+}
@@ -0,0 +1,420 @@
+package citation
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+// checkEntries compares the books field by field, the publish date with Equal.
+func checkEntries(t *testing.T, got []Entry, want []Entry) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%d entries, want %d: %+v", len(got), len(want), got)
+	}
+
+	for i := range want {
+		if got[i].Key != want[i].Key {
+			t.Errorf("entry %d key = %q, want %q", i, got[i].Key, want[i].Key)
+		}
+
+		if (got[i].Err != nil) != (want[i].Err != nil) {
+			t.Errorf("entry %d error = %v, want %v", i, got[i].Err, want[i].Err)
+		}
+
+		g, w := got[i].Book, want[i].Book
+		if !g.PublishDate.Equal(w.PublishDate) {
+			t.Errorf("entry %d publish date = %s, want %s", i, g.PublishDate, w.PublishDate)
+		}
+		g.PublishDate, w.PublishDate = time.Time{}, time.Time{}
+
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("entry %d book =\n%+v\nwant\n%+v", i, g, w)
+		}
+	}
+}
+
+func TestReadBibTeX(t *testing.T) {
+	const file = `
+@string{tolkien = "J. R. R. Tolkien"}
+@comment{ignored {nested} text with @book{fake, title = {Fake}}}
+@preamble{"\newcommand{\noop}[1]{}"}
+
+@book{tolkien1937hobbit,
+  title = {The {Hobbit}, or There \& Back Again},
+  author = tolkien,
+  publisher = "George Allen " # {\& Unwin},
+  year = 1937,
+  month = sep,
+  pagetotal = {310},
+  isbn = {978-0-261-10334-4, 0261103342},
+  keywords = {fantasy; dragons},
+  language = {en},
+}
+
+@Book(knuth,
+  title = "The {TeX}book: \{50\%\} off",
+  author = {Knuth, Donald E. and {Barnes and Noble} and others},
+  date = {1984-01-01},
+  series = {Computers   and
+            Typesetting},
+  number = {1},
+)
+
+@book{broken,
+  title = {Broken},
+  pagetotal = {many},
+}
+`
+
+	entries, err := Read(strings.NewReader(file), domain.CitationFormatBibTeX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkEntries(t, entries, []Entry{
+		{Key: "tolkien1937hobbit", Book: domain.Book{
+			Title:       "The Hobbit, or There & Back Again",
+			Author:      "J. R. R. Tolkien",
+			Publisher:   "George Allen & Unwin",
+			PublishDate: day(1937, time.September, 1),
+			PageCount:   310,
+			ISBN:        "978-0-261-10334-4",
+			Tags:        []string{"fantasy", "dragons"},
+			Language:    "en",
+		}},
+		{Key: "knuth", Book: domain.Book{
+			Title:          "The TeXbook: {50%} off",
+			Author:         "Donald E. Knuth, Barnes and Noble",
+			PublishDate:    day(1984, time.January, 1),
+			Series:         "Computers and Typesetting",
+			SeriesPosition: 1,
+			Tags:           []string{},
+		}},
+		{Key: "broken", Book: domain.Book{Title: "Broken", Tags: []string{}}, Err: errors.New("pagetotal")},
+	})
+}
+
+func TestReadBibTeXEditors(t *testing.T) {
+	entries, err := Read(strings.NewReader(`@book{x, title = {Proceedings}, editor = {Doe, Jane and John Roe}}`),
+		domain.CitationFormatBibTeX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Book.Author != "Jane Doe, John Roe" {
+		t.Errorf("entries = %+v, want the editors as authors", entries)
+	}
+}
+
+func TestReadBibTeXErrors(t *testing.T) {
+	for _, file := range []string{
+		`@book x`,
+		`@book{x, title = {unbalanced}`,
+		`@book{x, title = {unbalanced`,
+		`@book{x, title = }`,
+		`@book{x, title {missing equals}}`,
+		`@book{x, title = "unterminated}`,
+		`@book{x, title = {a} author = {b}}`,
+		`@comment{unterminated`,
+	} {
+		if _, err := Read(strings.NewReader(file), domain.CitationFormatBibTeX); !errors.Is(err, domain.ErrInvalidCitation) {
+			t.Errorf("Read(%q) error = %v, want ErrInvalidCitation", file, err)
+		}
+	}
+}
+
+func TestReadRIS(t *testing.T) {
+	const file = "\ufeffTY  - BOOK\r\n" +
+		"ID  - 42\r\n" +
+		"TI  - The Hobbit\r\n" +
+		"AU  - Tolkien, J. R. R.\r\n" +
+		"AU  - Tolkien, Christopher\r\n" +
+		"KW  - fantasy\r\n" +
+		"KW  - dragons; classics\r\n" +
+		"AB  - A long\r\n" +
+		"  description\r\n" +
+		"PY  - 1937\r\n" +
+		"DA  - 1937/09/21/\r\n" +
+		"SN  - 9780261103344 (pbk.); 0261103342\r\n" +
+		"SP  - 310\r\n" +
+		"ER  - \r\n" +
+		"\r\n" +
+		"TY  - BOOK\n" +
+		"T1  - Edited\n" +
+		"ED  - Doe, Jane\n" +
+		"Y1  - 2001///\n" +
+		"VL  - 2.5\n" +
+		"ER  - \n" +
+		"TY  - BOOK\n" +
+		"TI  - Bad pages\n" +
+		"SP  - xii\n" +
+		"ER  - \n"
+
+	entries, err := Read(strings.NewReader(file), domain.CitationFormatRIS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkEntries(t, entries, []Entry{
+		{Key: "42", Book: domain.Book{
+			Title:       "The Hobbit",
+			Author:      "J. R. R. Tolkien, Christopher Tolkien",
+			Tags:        []string{"fantasy", "dragons", "classics"},
+			Description: "A long description",
+			PublishDate: day(1937, time.September, 21),
+			ISBN:        "9780261103344",
+			PageCount:   310,
+		}},
+		{Book: domain.Book{
+			Title:          "Edited",
+			Author:         "Jane Doe",
+			PublishDate:    day(2001, time.January, 1),
+			SeriesPosition: 2.5,
+			Tags:           []string{},
+		}},
+		{Book: domain.Book{Title: "Bad pages", Tags: []string{}}, Err: errors.New("SP")},
+	})
+}
+
+func TestReadRISErrors(t *testing.T) {
+	for _, file := range []string{
+		"TY  - BOOK\nTY  - BOOK\nER  - \n",
+		"ER  - \n",
+		"AU  - Doe, Jane\n",
+		"TY  - BOOK\nTI  - Unfinished\n",
+	} {
+		if _, err := Read(strings.NewReader(file), domain.CitationFormatRIS); !errors.Is(err, domain.ErrInvalidCitation) {
+			t.Errorf("Read(%q) error = %v, want ErrInvalidCitation", file, err)
+		}
+	}
+}
+
+func TestReadUnsupported(t *testing.T) {
+	if _, err := Read(strings.NewReader(""), domain.CitationFormatMARCXML); !errors.Is(err, domain.ErrUnsupportedCitation) {
+		t.Errorf("Read error = %v, want ErrUnsupportedCitation", err)
+	}
+}
+
+// testBook has a contributor of each role and the characters the formats
+// have to escape.
+var testBook = domain.Book{
+	ID:    7,
+	Title: `Tom & Jerry: 100% {fun}_\ <again>`,
+	Authors: []domain.BookAuthor{
+		{AuthorID: 1, Name: "Tolkien, J. R. R.", Role: domain.AuthorRoleAuthor},
+		{AuthorID: 2, Name: "Christopher Tolkien", Role: domain.AuthorRoleEditor},
+		{AuthorID: 3, Name: "Anna Karenina", Role: domain.AuthorRoleTranslator},
+	},
+	PublishDate:    day(1937, time.September, 21),
+	Publisher:      "Allen & Unwin",
+	Edition:        "2nd",
+	Series:         "Middle-earth",
+	SeriesPosition: 3,
+	PageCount:      310,
+	ISBN:           "9780261103344",
+	Language:       "en",
+	Description:    "Line one\nline two",
+	Tags:           []string{"fantasy", "classics"},
+}
+
+func TestRoundTrip(t *testing.T) {
+	// the authors come back as the author field, descriptions on one line
+	want := domain.Book{
+		Title:          testBook.Title,
+		Author:         "J. R. R. Tolkien",
+		PublishDate:    testBook.PublishDate,
+		Publisher:      testBook.Publisher,
+		Edition:        testBook.Edition,
+		Series:         testBook.Series,
+		SeriesPosition: testBook.SeriesPosition,
+		PageCount:      testBook.PageCount,
+		ISBN:           testBook.ISBN,
+		Language:       testBook.Language,
+		Description:    "Line one line two",
+		Tags:           testBook.Tags,
+	}
+
+	tests := []struct {
+		format string
+		key    string
+	}{
+		{domain.CitationFormatBibTeX, "tolkien1937tom"},
+		{domain.CitationFormatRIS, "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, tt.format, []domain.Book{testBook}); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := Read(&buf, tt.format)
+			if err != nil {
+				t.Fatalf("Read: %v\n%s", err, buf.String())
+			}
+
+			checkEntries(t, entries, []Entry{{Key: tt.key, Book: want}})
+		})
+	}
+}
+
+func TestBibTeXKeys(t *testing.T) {
+	books := []domain.Book{
+		{ID: 1, Title: "The Hobbit", Author: "J. R. R. Tolkien", PublishDate: day(1937, time.September, 21)},
+		{ID: 2, Title: "The Hobbit", Author: "J. R. R. Tolkien", PublishDate: day(1937, time.September, 21)},
+		{ID: 3, Title: "A Élan", Author: "Émile Zola"},
+		{ID: 4, Title: "The"},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, domain.CitationFormatBibTeX, books); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Read(&buf, domain.CitationFormatBibTeX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"tolkien1937hobbit", "tolkien1937hobbit_2", "zolalan", "book4"}
+	for i, entry := range entries {
+		if entry.Key != want[i] {
+			t.Errorf("key %d = %q, want %q", i, entry.Key, want[i])
+		}
+	}
+}
+
+func TestWriteMARCXML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, domain.CitationFormatMARCXML, []domain.Book{testBook, {ID: 8, Title: "Edited", Authors: []domain.BookAuthor{
+		{AuthorID: 2, Name: "Christopher Tolkien", Role: domain.AuthorRoleEditor},
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), xml.Header) || !strings.Contains(buf.String(), "Tom &amp; Jerry") {
+		t.Errorf("output is not escaped XML:\n%s", buf.String())
+	}
+
+	var collection marcCollection
+	if err := xml.Unmarshal(buf.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+
+	if collection.XMLName.Space != marcNamespace || len(collection.Records) != 2 {
+		t.Fatalf("collection = %+v", collection)
+	}
+
+	type field struct{ tag, ind1, ind2, subfields string }
+	fields := func(record marcRecord) []field {
+		result := make([]field, 0)
+		for _, f := range record.DataFields {
+			var subfields []string
+			for _, s := range f.Subfields {
+				subfields = append(subfields, "$"+s.Code+s.Value)
+			}
+			result = append(result, field{f.Tag, f.Ind1, f.Ind2, strings.Join(subfields, "")})
+		}
+		return result
+	}
+
+	record := collection.Records[0]
+	if record.Leader != marcLeader || len(record.ControlFields) != 1 || record.ControlFields[0].Value != "7" {
+		t.Errorf("leader and control fields = %q, %+v", record.Leader, record.ControlFields)
+	}
+
+	want := []field{
+		{"020", " ", " ", "$a9780261103344"},
+		{"100", "1", " ", "$aTolkien, J. R. R.$eauthor"},
+		{"700", "1", " ", "$aTolkien, Christopher$eeditor"},
+		{"700", "1", " ", "$aKarenina, Anna$etranslator"},
+		{"245", "1", "0", "$a" + testBook.Title},
+		{"250", " ", " ", "$a2nd"},
+		{"264", " ", "1", "$bAllen & Unwin$c1937"},
+		{"300", " ", " ", "$a310 pages"},
+		{"490", "0", " ", "$aMiddle-earth$v3"},
+		{"520", " ", " ", "$aLine one\nline two"},
+		{"546", " ", " ", "$aen"},
+		{"653", " ", " ", "$afantasy"},
+		{"653", " ", " ", "$aclassics"},
+	}
+	if got := fields(record); !reflect.DeepEqual(got, want) {
+		t.Errorf("fields =\n%q\nwant\n%q", got, want)
+	}
+
+	// without an author the editor is an added entry and the title is the main entry
+	want = []field{
+		{"700", "1", " ", "$aTolkien, Christopher$eeditor"},
+		{"245", "0", "0", "$aEdited"},
+	}
+	if got := fields(collection.Records[1]); !reflect.DeepEqual(got, want) {
+		t.Errorf("fields =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWriteCSLJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, domain.CitationFormatCSLJSON, []domain.Book{testBook, {ID: 8, Title: "Untitled"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []map[string]interface{}
+	if err := json.Unmarshal([]byte(`[{
+		"id": "book-7",
+		"type": "book",
+		"title": "Tom & Jerry: 100% {fun}_\\ <again>",
+		"author": [{"family": "Tolkien", "given": "J. R. R."}],
+		"editor": [{"family": "Tolkien", "given": "Christopher"}],
+		"translator": [{"family": "Karenina", "given": "Anna"}],
+		"issued": {"date-parts": [[1937, 9, 21]]},
+		"publisher": "Allen & Unwin",
+		"edition": "2nd",
+		"collection-title": "Middle-earth",
+		"collection-number": "3",
+		"number-of-pages": "310",
+		"ISBN": "9780261103344",
+		"language": "en",
+		"abstract": "Line one\nline two",
+		"keyword": "fantasy, classics"
+	}, {
+		"id": "book-8",
+		"type": "book",
+		"title": "Untitled"
+	}]`), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("items =\n%v\nwant\n%v", items, want)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for format, mediaType := range MediaTypes {
+		if got, ok := FormatOf(mediaType); !ok || got != format {
+			t.Errorf("FormatOf(%s) = %q, %v, want %q", mediaType, got, ok, format)
+		}
+	}
+
+	if _, ok := FormatOf("application/json"); ok {
+		t.Error("FormatOf(application/json) is a citation format")
+	}
+}
@@ -0,0 +1,82 @@
+package citation
+
+import (
+	"encoding/json"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// cslItem is a CSL-JSON item of type book.
+type cslItem struct {
+	ID               string    `json:"id"`
+	Type             string    `json:"type"`
+	Title            string    `json:"title"`
+	Author           []cslName `json:"author,omitempty"`
+	Editor           []cslName `json:"editor,omitempty"`
+	Translator       []cslName `json:"translator,omitempty"`
+	Issued           *cslDate  `json:"issued,omitempty"`
+	Publisher        string    `json:"publisher,omitempty"`
+	Edition          string    `json:"edition,omitempty"`
+	CollectionTitle  string    `json:"collection-title,omitempty"`
+	CollectionNumber string    `json:"collection-number,omitempty"`
+	NumberOfPages    string    `json:"number-of-pages,omitempty"`
+	ISBN             string    `json:"ISBN,omitempty"`
+	Language         string    `json:"language,omitempty"`
+	Abstract         string    `json:"abstract,omitempty"`
+	Keyword          string    `json:"keyword,omitempty"`
+}
+
+type cslName struct {
+	Family string `json:"family"`
+	Given  string `json:"given,omitempty"`
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+func writeCSLJSON(w io.Writer, books []domain.Book) error {
+	items := make([]cslItem, len(books))
+	for i, book := range books {
+		people := contributors(book)
+
+		items[i] = cslItem{
+			ID:               "book-" + strconv.FormatInt(book.ID, 10),
+			Type:             "book",
+			Title:            book.Title,
+			Author:           cslNames(namesWithRole(people, domain.AuthorRoleAuthor)),
+			Editor:           cslNames(namesWithRole(people, domain.AuthorRoleEditor)),
+			Translator:       cslNames(namesWithRole(people, domain.AuthorRoleTranslator)),
+			Publisher:        book.Publisher,
+			Edition:          book.Edition,
+			CollectionTitle:  book.Series,
+			CollectionNumber: formatNumber(book.SeriesPosition),
+			NumberOfPages:    formatNumber(float64(book.PageCount)),
+			ISBN:             book.ISBN,
+			Language:         book.Language,
+			Abstract:         book.Description,
+			Keyword:          strings.Join(book.Tags, ", "),
+		}
+
+		if d := book.PublishDate; !d.IsZero() {
+			items[i].Issued = &cslDate{DateParts: [][]int{{d.Year(), int(d.Month()), d.Day()}}}
+		}
+	}
+
+	return json.NewEncoder(w).Encode(items)
+}
+
+func cslNames(names []string) []cslName {
+	if len(names) == 0 {
+		return nil
+	}
+
+	result := make([]cslName, len(names))
+	for i, name := range names {
+		result[i].Family, result[i].Given = splitName(name)
+	}
+
+	return result
+}
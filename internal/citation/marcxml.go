@@ -0,0 +1,128 @@
+package citation
+
+import (
+	"encoding/xml"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"io"
+	"strconv"
+)
+
+const marcNamespace = "http://www.loc.gov/MARC21/slim"
+
+// marcLeader describes a monograph in Unicode; the lengths are left at zero
+// as MARCXML has no record directory.
+const marcLeader = "00000nam a2200000 i 4500"
+
+type marcCollection struct {
+	XMLName xml.Name     `xml:"collection"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Records []marcRecord `xml:"record"`
+}
+
+type marcRecord struct {
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeMARCXML(w io.Writer, books []domain.Book) error {
+	collection := marcCollection{Xmlns: marcNamespace, Records: make([]marcRecord, len(books))}
+	for i, book := range books {
+		collection.Records[i] = marcBook(book)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(collection); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// marcBook maps a book to the MARC 21 bibliographic fields: the first author
+// to 100 and the other contributors to 700, both with their role in $e.
+// Tags become uncontrolled index terms in 653.
+func marcBook(book domain.Book) marcRecord {
+	record := marcRecord{
+		Leader:        marcLeader,
+		ControlFields: []marcControlField{{Tag: "001", Value: strconv.FormatInt(book.ID, 10)}},
+	}
+
+	field := func(tag, ind1, ind2 string, subfields ...string) {
+		f := marcDataField{Tag: tag, Ind1: ind1, Ind2: ind2}
+		for i := 0; i+1 < len(subfields); i += 2 {
+			if subfields[i+1] != "" {
+				f.Subfields = append(f.Subfields, marcSubfield{Code: subfields[i], Value: subfields[i+1]})
+			}
+		}
+
+		if len(f.Subfields) > 0 {
+			record.DataFields = append(record.DataFields, f)
+		}
+	}
+
+	field("020", " ", " ", "a", book.ISBN)
+
+	people := contributors(book)
+	for i, person := range people {
+		family, given := splitName(person.name)
+		name := family
+		if given != "" {
+			name += ", " + given
+		}
+
+		tag := "700"
+		if i == 0 && person.role == domain.AuthorRoleAuthor {
+			tag = "100"
+		}
+		field(tag, "1", " ", "a", name, "e", person.role)
+	}
+
+	ind1 := "0"
+	if len(people) > 0 && people[0].role == domain.AuthorRoleAuthor {
+		ind1 = "1"
+	}
+	field("245", ind1, "0", "a", book.Title)
+	field("250", " ", " ", "a", book.Edition)
+	field("264", " ", "1", "b", book.Publisher, "c", year(book.PublishDate))
+
+	if pages := formatNumber(float64(book.PageCount)); pages != "" {
+		field("300", " ", " ", "a", pages+" pages")
+	}
+
+	field("490", "0", " ", "a", book.Series, "v", formatNumber(book.SeriesPosition))
+	field("520", " ", " ", "a", book.Description)
+	field("546", " ", " ", "a", book.Language)
+	for _, tag := range book.Tags {
+		field("653", " ", " ", "a", tag)
+	}
+	if book.CoverURL != "" {
+		field("856", "4", "2", "3", "Cover image", "u", book.CoverURL)
+	}
+
+	return record
+}
@@ -0,0 +1,199 @@
+package citation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// risRoles are the RIS tags of the contributor roles.
+var risRoles = []struct{ tag, role string }{
+	{"AU", domain.AuthorRoleAuthor},
+	{"ED", domain.AuthorRoleEditor},
+	{"A4", domain.AuthorRoleTranslator},
+}
+
+func writeRIS(w io.Writer, books []domain.Book) error {
+	bw := bufio.NewWriter(w)
+
+	for _, book := range books {
+		line := func(tag, value string) {
+			// values are single lines
+			if value = strings.Join(strings.Fields(value), " "); value != "" {
+				fmt.Fprintf(bw, "%s  - %s\r\n", tag, value)
+			}
+		}
+
+		line("TY", "BOOK")
+		line("ID", strconv.FormatInt(book.ID, 10))
+		line("TI", book.Title)
+
+		people := contributors(book)
+		for _, r := range risRoles {
+			for _, name := range namesWithRole(people, r.role) {
+				family, given := splitName(name)
+				if given != "" {
+					family += ", " + given
+				}
+				line(r.tag, family)
+			}
+		}
+
+		if !book.PublishDate.IsZero() {
+			line("PY", year(book.PublishDate))
+			line("DA", book.PublishDate.Format("2006/01/02/"))
+		}
+
+		line("PB", book.Publisher)
+		line("ET", book.Edition)
+		line("T2", book.Series)
+		line("VL", formatNumber(book.SeriesPosition))
+		line("SP", formatNumber(float64(book.PageCount)))
+		line("SN", book.ISBN)
+		line("LA", book.Language)
+		line("AB", book.Description)
+		for _, tag := range book.Tags {
+			line("KW", tag)
+		}
+		bw.WriteString("ER  - \r\n\r\n")
+	}
+
+	return bw.Flush()
+}
+
+// readRIS reads the records of a RIS file. Lines that are not tagged continue
+// the value of the previous tag.
+func readRIS(r io.Reader) ([]Entry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	entries := make([]Entry, 0)
+
+	var record map[string][]string
+	var last string
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimRight(scanner.Text(), " \r")
+		if n == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+
+		tag, value, ok := risLine(text)
+		switch {
+		case ok && tag == "TY":
+			if record != nil {
+				return nil, fmt.Errorf("%w: line %d: TY before ER", domain.ErrInvalidCitation, n)
+			}
+			record = map[string][]string{"TY": {value}}
+		case ok && tag == "ER":
+			if record == nil {
+				return nil, fmt.Errorf("%w: line %d: ER without TY", domain.ErrInvalidCitation, n)
+			}
+			book, err := risBook(record)
+			entries = append(entries, Entry{Key: first(record, "ID"), Book: book, Err: err})
+			record = nil
+		case ok:
+			if record == nil {
+				return nil, fmt.Errorf("%w: line %d: %s outside of a record", domain.ErrInvalidCitation, n, tag)
+			}
+			record[tag] = append(record[tag], value)
+			last = tag
+		case record != nil && last != "" && strings.TrimSpace(text) != "":
+			values := record[last]
+			values[len(values)-1] += " " + strings.TrimSpace(text)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if record != nil {
+		return nil, fmt.Errorf("%w: record without ER", domain.ErrInvalidCitation)
+	}
+
+	return entries, nil
+}
+
+// risLine splits a line of the form "XX  - value".
+func risLine(text string) (string, string, bool) {
+	if len(text) < 5 || text[2:5] != "  -" {
+		return "", "", false
+	}
+
+	tag := text[:2]
+	if tag[0] < 'A' || tag[0] > 'Z' || !(tag[1] >= 'A' && tag[1] <= 'Z' || tag[1] >= '0' && tag[1] <= '9') {
+		return "", "", false
+	}
+
+	return tag, strings.TrimSpace(text[5:]), true
+}
+
+// first returns the first value of the first of the tags that is present.
+func first(record map[string][]string, tags ...string) string {
+	for _, tag := range tags {
+		if values := record[tag]; len(values) > 0 {
+			return values[0]
+		}
+	}
+
+	return ""
+}
+
+func risBook(record map[string][]string) (domain.Book, error) {
+	book := domain.Book{
+		Title:       first(record, "TI", "T1", "BT"),
+		Publisher:   first(record, "PB"),
+		Edition:     first(record, "ET"),
+		Series:      first(record, "T2", "T3"),
+		Language:    first(record, "LA"),
+		Description: first(record, "AB", "N2"),
+		Tags:        make([]string, 0),
+	}
+
+	names := make([]string, 0)
+	for _, tag := range []string{"AU", "A1"} {
+		for _, name := range record[tag] {
+			names = append(names, displayName(name))
+		}
+	}
+	if len(names) == 0 {
+		for _, name := range record["ED"] {
+			names = append(names, displayName(name))
+		}
+	}
+	book.Author = strings.Join(names, ", ")
+
+	if isbns := splitKeywords(first(record, "SN")); len(isbns) > 0 {
+		book.ISBN = strings.Fields(isbns[0])[0]
+	}
+
+	if t, ok := parseDate(first(record, "DA")); ok {
+		book.PublishDate = t
+	} else if t, ok := parseDate(first(record, "PY", "Y1")); ok {
+		book.PublishDate = t
+	}
+
+	if volume := first(record, "VL"); volume != "" {
+		if v, err := strconv.ParseFloat(volume, 64); err == nil {
+			book.SeriesPosition = v
+		}
+	}
+
+	if pages := first(record, "SP"); pages != "" {
+		v, err := strconv.Atoi(pages)
+		if err != nil {
+			return book, errors.New("SP: expected the number of pages")
+		}
+		book.PageCount = v
+	}
+
+	for _, keywords := range record["KW"] {
+		book.Tags = append(book.Tags, splitKeywords(keywords)...)
+	}
+
+	return book, nil
+}
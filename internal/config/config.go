@@ -10,12 +10,96 @@ import (
 type Config struct {
 	DB     Postgres
 	Server struct {
-		Port int `mapstructure:"port"`
+		Port      int    `mapstructure:"port"`
+		PublicURL string `mapstructure:"public_url"`
 	} `mapstructure:"server"`
 
 	Auth struct {
-		TokenTTL time.Duration `mapstructure:"token_ttl"`
+		TokenTTL      time.Duration `mapstructure:"token_ttl"`
+		MFAIssuer     string        `mapstructure:"mfa_issuer"`
+		EncryptionKey string        `mapstructure:"encryption_key" envconfig:"ENCRYPTION_KEY"`
 	} `mapstructure:"auth"`
+
+	Email struct {
+		Driver string `mapstructure:"driver"`
+		From   string `mapstructure:"from"`
+		SMTP   struct {
+			Host     string `mapstructure:"host"`
+			Port     int    `mapstructure:"port"`
+			Username string `mapstructure:"username"`
+			Password string `mapstructure:"password"`
+		} `mapstructure:"smtp"`
+	} `mapstructure:"email"`
+
+	OIDC struct {
+		Providers map[string]OIDCProvider `mapstructure:"providers"`
+	} `mapstructure:"oidc"`
+
+	Metadata struct {
+		// Provider is openlibrary, fixture or empty to disable enrichment.
+		Provider    string        `mapstructure:"provider"`
+		BaseURL     string        `mapstructure:"base_url"`
+		FixtureFile string        `mapstructure:"fixture_file"`
+		Timeout     time.Duration `mapstructure:"timeout"`
+		CacheTTL    time.Duration `mapstructure:"cache_ttl"`
+		CacheSize   int           `mapstructure:"cache_size"`
+		AutoEnrich  bool          `mapstructure:"auto_enrich"`
+	} `mapstructure:"metadata"`
+
+	Books struct {
+		// TrashRetention is how long deleted books can be restored before they are purged.
+		TrashRetention time.Duration `mapstructure:"trash_retention"`
+		// RequirePreconditions rejects book updates and deletes without an If-Match header.
+		RequirePreconditions bool `mapstructure:"require_preconditions"`
+		// ImportMaxRows is the largest bulk import accepted.
+		ImportMaxRows int `mapstructure:"import_max_rows"`
+		// ImportAsyncRows is the number of rows above which imports run in the background.
+		ImportAsyncRows int `mapstructure:"import_async_rows"`
+	} `mapstructure:"books"`
+
+	Circulation struct {
+		LoanPeriod  time.Duration `mapstructure:"loan_period"`
+		MaxRenewals int           `mapstructure:"max_renewals"`
+		// LoanLimits is the number of open loans per organization role.
+		LoanLimits map[string]int `mapstructure:"loan_limits"`
+		// HoldPickupWindow is how long a returned copy is kept for a hold.
+		HoldPickupWindow time.Duration `mapstructure:"hold_pickup_window"`
+	} `mapstructure:"circulation"`
+
+	Scheduler struct {
+		// Enabled runs jobs on their schedules; manual runs work regardless.
+		Enabled bool `mapstructure:"enabled"`
+		// Jobs configures jobs by name, jobs without a schedule are not registered.
+		Jobs map[string]Job `mapstructure:"jobs"`
+	} `mapstructure:"scheduler"`
+
+	RateLimit struct {
+		Enabled           bool             `mapstructure:"enabled"`
+		Store             string           `mapstructure:"store"`
+		TrustProxyHeaders bool             `mapstructure:"trust_proxy_headers"`
+		Global            Limit            `mapstructure:"global"`
+		Groups            map[string]Limit `mapstructure:"groups"`
+	} `mapstructure:"rate_limit"`
+}
+
+type OIDCProvider struct {
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	RedirectURL  string   `mapstructure:"redirect_url"`
+	Scopes       []string `mapstructure:"scopes"`
+}
+
+type Job struct {
+	Schedule string        `mapstructure:"schedule"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Jitter   time.Duration `mapstructure:"jitter"`
+}
+
+type Limit struct {
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+	Burst    int           `mapstructure:"burst"`
 }
 
 type Postgres struct {
@@ -46,5 +130,10 @@ func New(folder, filename string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := envconfig.Process("AUTH", &cfg.Auth); err != nil {
+		log.Printf("Error processing AUTH_ENCRYPTION_KEY: %v", err)
+		return nil, err
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,52 @@
+package domain
+
+import "time"
+
+const (
+	AuditActionCreate         = "CREATE"
+	AuditActionUpdate         = "UPDATE"
+	AuditActionDelete         = "DELETE"
+	AuditActionRegister       = "REGISTER"
+	AuditActionLogin          = "LOGIN"
+	AuditActionPasswordChange = "PASSWORD_CHANGE"
+	AuditActionEmailChange    = "EMAIL_CHANGE"
+	AuditActionDisable        = "DISABLE"
+	AuditActionEnable         = "ENABLE"
+	AuditActionLogout         = "LOGOUT"
+	AuditActionMFAReset       = "MFA_RESET"
+	AuditActionRoleChange     = "ROLE_CHANGE"
+	AuditActionExport         = "EXPORT"
+	AuditActionErasure        = "ERASURE"
+	AuditActionInvite         = "INVITE"
+	AuditActionJoin           = "JOIN"
+	AuditActionLeave          = "LEAVE"
+	AuditActionCheckout       = "CHECKOUT"
+	AuditActionReturn         = "RETURN"
+	AuditActionRenew          = "RENEW"
+	AuditActionHold           = "HOLD"
+	AuditActionCancel         = "CANCEL"
+	AuditActionExpire         = "EXPIRE"
+	AuditActionOverdue        = "OVERDUE"
+	AuditActionRun            = "RUN"
+	AuditActionImport         = "IMPORT"
+
+	AuditEntityUser = "USER"
+	AuditEntityBook = "BOOK"
+	AuditEntityOrg  = "ORG"
+	AuditEntityCopy = "COPY"
+	AuditEntityLoan = "LOAN"
+	AuditEntityHold = "HOLD"
+	AuditEntityJob  = "JOB"
+)
+
+// AuditEvent is kept in the local audit log and forwarded to the audit service.
+// ActorID is zero for actions done by the system.
+type AuditEvent struct {
+	ID        int64                  `json:"id"`
+	ActorID   int64                  `json:"actor_id,omitempty"`
+	Action    string                 `json:"action"`
+	Entity    string                 `json:"entity"`
+	EntityID  int64                  `json:"entity_id"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
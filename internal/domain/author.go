@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	AuthorRoleAuthor     = "author"
+	AuthorRoleEditor     = "editor"
+	AuthorRoleTranslator = "translator"
+)
+
+var ErrAuthorNotFound = errors.New("Author not found")
+
+type Author struct {
+	ID        int64      `json:"id"`
+	OrgID     int64      `json:"org_id"`
+	Name      string     `json:"name"`
+	SortName  string     `json:"sort_name"`
+	Bio       string     `json:"bio,omitempty"`
+	BirthDate *time.Time `json:"birth_date,omitempty"`
+	DeathDate *time.Time `json:"death_date,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// BookAuthor links an author to a book. Name is filled when books are read.
+type BookAuthor struct {
+	AuthorID int64  `json:"author_id" validate:"required"`
+	Name     string `json:"name,omitempty"`
+	Role     string `json:"role" validate:"omitempty,oneof=author editor translator"`
+}
+
+type AuthorFilter struct {
+	Pagination
+	Query string
+}
+
+type AuthorList struct {
+	Authors []Author `json:"authors"`
+	Total   int      `json:"total"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+}
+
+type CreateAuthorInput struct {
+	Name      string     `json:"name" validate:"required,max=255"`
+	SortName  string     `json:"sort_name" validate:"max=255"`
+	Bio       string     `json:"bio"`
+	BirthDate *time.Time `json:"birth_date"`
+	DeathDate *time.Time `json:"death_date"`
+}
+
+type UpdateAuthorInput struct {
+	Name      *string    `json:"name" validate:"omitempty,min=1,max=255"`
+	SortName  *string    `json:"sort_name" validate:"omitempty,max=255"`
+	Bio       *string    `json:"bio"`
+	BirthDate *time.Time `json:"birth_date"`
+	DeathDate *time.Time `json:"death_date"`
+}
+
+func (i CreateAuthorInput) Validate() error {
+	if err := validate.Struct(i); err != nil {
+		return err
+	}
+
+	return validateLifespan(i.BirthDate, i.DeathDate)
+}
+
+func (i UpdateAuthorInput) Validate() error {
+	if err := validate.Struct(i); err != nil {
+		return err
+	}
+
+	return validateLifespan(i.BirthDate, i.DeathDate)
+}
+
+func validateLifespan(birth, death *time.Time) error {
+	if birth != nil && death != nil && death.Before(*birth) {
+		return errors.New("death date is before birth date")
+	}
+
+	return nil
+}
+
+// SortName turns "J. R. R. Tolkien" into "Tolkien, J. R. R.".
+func SortName(name string) string {
+	name = strings.TrimSpace(name)
+
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return name
+	}
+
+	return name[i+1:] + ", " + strings.TrimSpace(name[:i])
+}
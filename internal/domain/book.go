@@ -1,20 +1,120 @@
 package domain
 
 import (
+	"errors"
 	"time"
 )
 
+const (
+	BookFormatHardcover = "hardcover"
+	BookFormatPaperback = "paperback"
+	BookFormatEbook     = "ebook"
+	BookFormatAudio     = "audio"
+)
+
+// Orders of book listings.
+const (
+	BookOrderTitle  = "title"
+	BookOrderNewest = "newest"
+)
+
+// Media types of the patches accepted for books.
+const (
+	MediaTypeMergePatch = "application/merge-patch+json"
+	MediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidISBN      = errors.New("Invalid ISBN")
+	ErrISBNTaken        = errors.New("A book with this ISBN is already catalogued")
+	ErrInvalidPatch     = errors.New("Invalid patch")
+	ErrPatchTestFailed  = errors.New("Patch test failed")
+	ErrUnsupportedPatch = errors.New("Patch must be application/merge-patch+json or application/json-patch+json")
+)
+
+// Book is a catalog entry. ISBN is stored as a bare ISBN-13. Rating is the
+// average of the visible reviews; it is maintained with the reviews and
+// ignored on writes. Version goes up with every change made by a user.
 type Book struct {
-	ID          int64     `json:"id"`
-	Title       string    `json:"title"`
-	Author      string    `json:"author"`
-	PublishDate time.Time `json:"publish_date"`
-	Rating      int       `json:"rating"`
+	ID             int64        `json:"id"`
+	OrgID          int64        `json:"org_id"`
+	Title          string       `json:"title"`
+	Author         string       `json:"author"`
+	PublishDate    time.Time    `json:"publish_date"`
+	Rating         float64      `json:"rating"`
+	RatingCount    int          `json:"rating_count"`
+	CreatedBy      *int64       `json:"created_by,omitempty"`
+	ISBN           string       `json:"isbn,omitempty"`
+	Publisher      string       `json:"publisher,omitempty" validate:"max=255"`
+	Language       string       `json:"language,omitempty" validate:"omitempty,bcp47_language_tag"`
+	PageCount      int          `json:"page_count,omitempty" validate:"gte=0"`
+	Format         string       `json:"format,omitempty" validate:"omitempty,oneof=hardcover paperback ebook audio"`
+	Edition        string       `json:"edition,omitempty" validate:"max=64"`
+	Series         string       `json:"series,omitempty" validate:"max=255"`
+	SeriesPosition float64      `json:"series_position,omitempty" validate:"gte=0"`
+	CoverURL       string       `json:"cover_url,omitempty" validate:"omitempty,url,max=1024"`
+	Description    string       `json:"description,omitempty"`
+	Authors        []BookAuthor `json:"authors" validate:"dive"`
+	Genres         []GenreRef   `json:"genres" validate:"dive"`
+	Tags           []string     `json:"tags" validate:"dive,max=64"`
+	DeletedAt      *time.Time   `json:"deleted_at,omitempty"`
+	DeletedBy      *int64       `json:"deleted_by,omitempty"`
+	Version        int          `json:"version"`
+}
+
+// BookList is a page of books.
+type BookList struct {
+	Books []Book `json:"books"`
+	Total int    `json:"total"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+}
+
+func (b Book) Validate() error {
+	return validate.Struct(b)
+}
+
+// ValidLanguage reports whether tag is a BCP 47 language tag as required for
+// Book.Language.
+func ValidLanguage(tag string) bool {
+	return validate.Var(tag, "bcp47_language_tag") == nil
 }
 
 type UpdateBookInput struct {
-	Title       *string    `json:"title"`
-	Author      *string    `json:"author"`
-	PublishDate *time.Time `json:"publish_date"`
-	Rating      *int       `json:"rating"`
+	Title          *string    `json:"title"`
+	Author         *string    `json:"author"`
+	PublishDate    *time.Time `json:"publish_date"`
+	ISBN           *string    `json:"isbn"`
+	Publisher      *string    `json:"publisher" validate:"omitempty,max=255"`
+	Language       *string    `json:"language" validate:"omitempty,bcp47_language_tag"`
+	PageCount      *int       `json:"page_count" validate:"omitempty,gte=0"`
+	Format         *string    `json:"format" validate:"omitempty,oneof=hardcover paperback ebook audio"`
+	Edition        *string    `json:"edition" validate:"omitempty,max=64"`
+	Series         *string    `json:"series" validate:"omitempty,max=255"`
+	SeriesPosition *float64   `json:"series_position" validate:"omitempty,gte=0"`
+	CoverURL       *string    `json:"cover_url" validate:"omitempty,url,max=1024"`
+	Description    *string    `json:"description"`
+	// Authors replaces the linked authors when set.
+	Authors *[]BookAuthor `json:"authors" validate:"omitempty,dive"`
+	// Genres and Tags replace the book's genres and tags when set.
+	Genres *[]GenreRef `json:"genres" validate:"omitempty,dive"`
+	Tags   *[]string   `json:"tags" validate:"omitempty,dive,max=64"`
+}
+
+func (i UpdateBookInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// BookFilter narrows book listings and facets. Zero values do not filter.
+// GenreID matches books in the genre and all of its descendants, Decade is
+// the first year of a decade and Rating a whole rating bucket.
+type BookFilter struct {
+	// Query matches the title or the author, ignoring case
+	Query    string
+	ISBN     string
+	GenreID  int64
+	Tag      string
+	AuthorID int64
+	Decade   *int
+	Rating   *int
 }
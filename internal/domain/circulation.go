@@ -0,0 +1,195 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	CopyConditionNew     = "new"
+	CopyConditionGood    = "good"
+	CopyConditionFair    = "fair"
+	CopyConditionPoor    = "poor"
+	CopyConditionDamaged = "damaged"
+)
+
+const (
+	HoldStatusWaiting   = "waiting"
+	HoldStatusReady     = "ready"
+	HoldStatusFulfilled = "fulfilled"
+	HoldStatusCancelled = "cancelled"
+	HoldStatusExpired   = "expired"
+)
+
+var (
+	ErrCopyNotFound        = errors.New("Copy not found")
+	ErrBarcodeTaken        = errors.New("A copy with this barcode already exists")
+	ErrCopyOnLoan          = errors.New("Copy is on loan")
+	ErrLoanNotFound        = errors.New("Loan not found")
+	ErrLoanReturned        = errors.New("Loan is already returned")
+	ErrLoanLimitReached    = errors.New("Borrower has reached the loan limit")
+	ErrRenewalLimitReached = errors.New("Loan has reached the renewal limit")
+	ErrNotBorrower         = errors.New("Only the borrower or a librarian can do this")
+	ErrLibrarianRequired   = errors.New("Only librarians can do this")
+	ErrInvalidDueDate      = errors.New("Due date must be in the future")
+	ErrHoldNotFound        = errors.New("Hold not found")
+	ErrHoldExists          = errors.New("You already have a hold on this book")
+	ErrHoldClosed          = errors.New("Hold is no longer active")
+	ErrNoCopies            = errors.New("Book has no copies")
+	ErrCopyAvailable       = errors.New("A copy is available for checkout")
+	ErrCopyReserved        = errors.New("Copy is kept for another member's hold")
+	ErrUserHasLoans        = errors.New("Return the books on loan before deleting the account")
+	ErrUserHasHolds        = errors.New("Cancel the active holds before deleting the account")
+	ErrAlreadyBorrowed     = errors.New("You already have this book on loan")
+	ErrHoldsWaiting        = errors.New("Loan cannot be renewed while others are waiting for the book")
+)
+
+// Copy is a physical copy of a book. Loan is the open loan of the copy, if any.
+type Copy struct {
+	ID        int64     `json:"id"`
+	BookID    int64     `json:"book_id"`
+	Barcode   string    `json:"barcode"`
+	Location  string    `json:"location,omitempty"`
+	Condition string    `json:"condition"`
+	CreatedAt time.Time `json:"created_at"`
+	Loan      *Loan     `json:"loan,omitempty"`
+}
+
+type CreateCopyInput struct {
+	Barcode   string `json:"barcode" validate:"required,max=64"`
+	Location  string `json:"location" validate:"max=255"`
+	Condition string `json:"condition" validate:"omitempty,oneof=new good fair poor damaged"`
+}
+
+func (i CreateCopyInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type UpdateCopyInput struct {
+	Barcode   *string `json:"barcode" validate:"omitempty,min=1,max=64"`
+	Location  *string `json:"location" validate:"omitempty,max=255"`
+	Condition *string `json:"condition" validate:"omitempty,oneof=new good fair poor damaged"`
+}
+
+func (i UpdateCopyInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type Loan struct {
+	ID           int64      `json:"id"`
+	CopyID       int64      `json:"copy_id"`
+	BookID       int64      `json:"book_id"`
+	Title        string     `json:"title"`
+	Barcode      string     `json:"barcode"`
+	BorrowerID   int64      `json:"borrower_id"`
+	BorrowerName string     `json:"borrower_name"`
+	CheckedOutBy *int64     `json:"checked_out_by,omitempty"`
+	CheckedOutAt time.Time  `json:"checked_out_at"`
+	DueAt        time.Time  `json:"due_at"`
+	Renewals     int        `json:"renewals"`
+	ReturnedAt   *time.Time `json:"returned_at,omitempty"`
+	ReturnedBy   *int64     `json:"returned_by,omitempty"`
+	// OverdueAt is when the overdue loans job noticed the loan was overdue.
+	OverdueAt *time.Time `json:"overdue_at,omitempty"`
+}
+
+// Overdue reports whether the loan is open past its due date.
+func (l Loan) Overdue(now time.Time) bool {
+	return l.ReturnedAt == nil && l.DueAt.Before(now)
+}
+
+// CheckoutInput lends a copy. BorrowerID defaults to the current user; lending
+// to someone else and overriding the due date are for librarians.
+type CheckoutInput struct {
+	BorrowerID int64      `json:"borrower_id" validate:"gte=0"`
+	DueAt      *time.Time `json:"due_at"`
+}
+
+func (i CheckoutInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// ReturnInput optionally records the condition of the returned copy.
+type ReturnInput struct {
+	Condition string `json:"condition" validate:"omitempty,oneof=new good fair poor damaged"`
+}
+
+func (i ReturnInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// LoanFilter narrows loan listings. Zero values do not filter.
+type LoanFilter struct {
+	Pagination
+	BorrowerID int64
+	CopyID     int64
+	Open       bool
+	Overdue    bool
+}
+
+type LoanList struct {
+	Loans []Loan `json:"loans"`
+	Total int    `json:"total"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+}
+
+// Hold is a place in the queue of a book. Holds wait in the order they were
+// placed; a returned copy is kept for the first waiting hold, which is then
+// ready until ExpiresAt. Position is set for waiting holds only.
+type Hold struct {
+	ID        int64      `json:"id"`
+	BookID    int64      `json:"book_id"`
+	Title     string     `json:"title"`
+	UserID    int64      `json:"user_id"`
+	UserName  string     `json:"user_name"`
+	Status    string     `json:"status"`
+	Position  *int       `json:"position,omitempty"`
+	CopyID    *int64     `json:"copy_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadyAt   *time.Time `json:"ready_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+}
+
+func (h Hold) Active() bool {
+	return h.Status == HoldStatusWaiting || h.Status == HoldStatusReady
+}
+
+type HoldInput struct {
+	BookID int64 `json:"book_id" validate:"required,gt=0"`
+}
+
+func (i HoldInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// HoldFilter narrows hold listings. Zero values do not filter.
+type HoldFilter struct {
+	Pagination
+	UserID int64
+	BookID int64
+	Active bool
+}
+
+type HoldList struct {
+	Holds []Hold `json:"holds"`
+	Total int    `json:"total"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+}
+
+// LoanPolicy sets how long copies are lent and how often loans can be
+// renewed. Limits is the number of open loans per organization role; roles
+// without a positive limit can borrow any number of copies. PickupWindow is
+// how long a copy is kept for a ready hold.
+type LoanPolicy struct {
+	Period       time.Duration
+	MaxRenewals  int
+	Limits       map[string]int
+	PickupWindow time.Duration
+}
+
+func (p LoanPolicy) Limit(role string) int {
+	return p.Limits[role]
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "errors"
+
+// Citation formats books can be rendered in. BibTeX and RIS files can also be
+// imported.
+const (
+	CitationFormatBibTeX  = "bibtex"
+	CitationFormatRIS     = "ris"
+	CitationFormatMARCXML = "marcxml"
+	CitationFormatCSLJSON = "csljson"
+)
+
+var (
+	ErrUnsupportedCitation = errors.New("Format must be json, bibtex, ris, marcxml or csljson")
+	ErrInvalidCitation     = errors.New("Invalid citation file")
+)
+
+// CitationImport is the report of a BibTeX or RIS import. Entries are counted
+// from 1 in the order of the file.
+type CitationImport struct {
+	Format     string              `json:"format"`
+	DryRun     bool                `json:"dry_run"`
+	Total      int                 `json:"total"`
+	Imported   int                 `json:"imported"`
+	Duplicates []CitationDuplicate `json:"duplicates"`
+	Errors     []ImportRowError    `json:"errors"`
+}
+
+// CitationDuplicate is an entry that was skipped because the book is already
+// catalogued, or appears earlier in the same file.
+type CitationDuplicate struct {
+	Entry      int    `json:"entry"`
+	Key        string `json:"key,omitempty"`
+	BookID     int64  `json:"book_id,omitempty"`
+	FirstEntry int    `json:"first_entry,omitempty"`
+}
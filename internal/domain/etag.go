@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrPreconditionFailed   = errors.New("The book was changed since it was read")
+	ErrPreconditionRequired = errors.New("If-Match header is required")
+)
+
+// ETag is a strong entity tag of the book. The version alone is not enough:
+// the rating changes with the reviews without a new version, so the tag also
+// carries a hash of the representation.
+func (b Book) ETag() string {
+	data, _ := json.Marshal(b)
+	sum := sha256.Sum256(data)
+
+	return fmt.Sprintf(`"%d-%s"`, b.Version, hex.EncodeToString(sum[:8]))
+}
+
+// FormatETag is the entity tag of the book rendered in another format, as
+// every representation needs a strong tag of its own.
+func (b Book) FormatETag(format string) string {
+	etag := b.ETag()
+
+	return etag[:len(etag)-1] + "-" + format + `"`
+}
+
+// MatchETag reports whether an If-Match or If-None-Match header value matches
+// the tag. If-Match uses the strong comparison, where weak tags never match;
+// If-None-Match uses the weak one.
+func MatchETag(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+
+		if tag == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
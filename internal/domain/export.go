@@ -0,0 +1,26 @@
+package domain
+
+import "errors"
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatJSON   = "json"
+	ExportFormatXLSX   = "xlsx"
+)
+
+var (
+	ErrUnsupportedExport    = errors.New("Export format must be csv, ndjson, json or xlsx")
+	ErrInvalidExportInclude = errors.New("Include must list authors, genres, tags or reviews")
+)
+
+// ExportOptions select the books of an export and the related data written
+// with them. Reviews adds the rating and the number of ratings.
+type ExportOptions struct {
+	Format  string
+	Filter  BookFilter
+	Authors bool
+	Genres  bool
+	Tags    bool
+	Reviews bool
+}
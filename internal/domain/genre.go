@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrGenreNotFound  = errors.New("Genre not found")
+	ErrGenreSlugTaken = errors.New("Genre slug is already in use")
+	ErrGenreCycle     = errors.New("Genre cannot be moved under itself or its descendants")
+)
+
+// Genre is a node of the genre taxonomy. Root genres have no parent.
+type Genre struct {
+	ID        int64     `json:"id"`
+	OrgID     int64     `json:"org_id"`
+	ParentID  *int64    `json:"parent_id,omitempty"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GenreRef links a genre to a book. Name is filled when books are read.
+type GenreRef struct {
+	ID   int64  `json:"id" validate:"required"`
+	Name string `json:"name,omitempty"`
+}
+
+type CreateGenreInput struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	Slug     string `json:"slug" validate:"required,max=64"`
+	ParentID *int64 `json:"parent_id" validate:"omitempty,gt=0"`
+}
+
+// UpdateGenreInput moves a genre to the root when ParentID is 0.
+type UpdateGenreInput struct {
+	Name     *string `json:"name" validate:"omitempty,min=1,max=255"`
+	Slug     *string `json:"slug" validate:"omitempty,min=1,max=64"`
+	ParentID *int64  `json:"parent_id" validate:"omitempty,gte=0"`
+}
+
+func (i CreateGenreInput) Validate() error {
+	if err := validate.Struct(i); err != nil {
+		return err
+	}
+
+	return validateSlug(i.Slug)
+}
+
+func (i UpdateGenreInput) Validate() error {
+	if err := validate.Struct(i); err != nil {
+		return err
+	}
+
+	if i.Slug != nil {
+		return validateSlug(*i.Slug)
+	}
+
+	return nil
+}
+
+func validateSlug(slug string) error {
+	if !slugRegexp.MatchString(slug) {
+		return errors.New("slug may contain only lowercase letters, digits and dashes")
+	}
+
+	return nil
+}
+
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags trims and lowercases tags and drops empty and repeated ones.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
+
+// FacetCount is one entry of a facet: genres and authors have an ID and a
+// name, tags a name and decades and ratings a value.
+type FacetCount struct {
+	ID    int64  `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Value *int   `json:"value,omitempty"`
+	Count int    `json:"count"`
+}
+
+// BookFacets are counts of the books matching a filter, grouped for
+// drill-down navigation. Genre counts include books in descendant genres.
+type BookFacets struct {
+	Total   int          `json:"total"`
+	Genres  []FacetCount `json:"genres"`
+	Tags    []FacetCount `json:"tags"`
+	Authors []FacetCount `json:"authors"`
+	Decades []FacetCount `json:"decades"`
+	Ratings []FacetCount `json:"ratings"`
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdentityNotFound     = errors.New("Identity not found")
+	ErrUnknownProvider      = errors.New("Unknown identity provider")
+	ErrInvalidOIDCState     = errors.New("Invalid or expired login state")
+	ErrEmailNotVerified     = errors.New("Identity provider did not verify the email address")
+	ErrIdentityEmailMissing = errors.New("Identity provider did not return an email address")
+)
+
+// Identity links a user to an account at an external identity provider.
+type Identity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExternalIdentity is what an identity provider asserts about the user.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatJSON   = "json"
+	ImportFormatNDJSON = "ndjson"
+
+	ImportStatusRunning   = "running"
+	ImportStatusSucceeded = "succeeded"
+	ImportStatusFailed    = "failed"
+)
+
+var (
+	ErrImportNotFound      = errors.New("Import not found")
+	ErrUnsupportedImport   = errors.New("Import must be CSV, JSON, NDJSON, BibTeX or RIS")
+	ErrInvalidImport       = errors.New("Invalid import file")
+	ErrImportTooLarge      = errors.New("Import has too many rows")
+	ErrInvalidColumnMap    = errors.New("Invalid column mapping")
+	ErrImportTitleRequired = errors.New("Title is required")
+	ErrDuplicateImportISBN = errors.New("ISBN appears more than once in the import")
+)
+
+// ImportColumns are the book fields a CSV column can be mapped to. Tags,
+// authors and genres hold lists separated by ";", the latter two of ids.
+var ImportColumns = []string{
+	"title", "author", "publish_date", "isbn", "publisher", "language", "page_count", "format", "edition",
+	"series", "series_position", "cover_url", "description", "tags", "authors", "genres",
+}
+
+// ImportOptions control a bulk import. Atomic imports nothing when any row
+// fails; otherwise the valid rows are imported. Columns maps book fields to
+// CSV headers; fields that are not mapped are read from the header of the
+// same name.
+type ImportOptions struct {
+	Format  string
+	DryRun  bool
+	Atomic  bool
+	Async   bool
+	Columns map[string]string
+}
+
+// ImportRowError reports a row that was not imported. Rows are counted from
+// 1 and do not include the CSV header.
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// BookImport is the report of a bulk import. Imported counts the rows that
+// were saved, or would have been for a dry run. Async imports are stored
+// and can be polled for their progress.
+type BookImport struct {
+	ID         int64            `json:"id,omitempty"`
+	Status     string           `json:"status"`
+	Format     string           `json:"format"`
+	DryRun     bool             `json:"dry_run"`
+	Atomic     bool             `json:"atomic"`
+	CreatedBy  *int64           `json:"created_by,omitempty"`
+	Total      int              `json:"total"`
+	Processed  int              `json:"processed"`
+	Imported   int              `json:"imported"`
+	Failed     int              `json:"failed"`
+	Errors     []ImportRowError `json:"errors"`
+	Error      string           `json:"error,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
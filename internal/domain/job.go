@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+var (
+	ErrJobNotFound = errors.New("Job not found")
+	ErrJobRunning  = errors.New("Job is already running")
+	// ErrJobRunExists is returned when another replica already ran the job for the scheduled time.
+	ErrJobRunExists = errors.New("Job already ran at the scheduled time")
+)
+
+// Job describes a registered background job.
+type Job struct {
+	Name      string     `json:"name"`
+	Schedule  string     `json:"schedule"`
+	Timeout   string     `json:"timeout"`
+	Jitter    string     `json:"jitter"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	LastRun   *JobRun    `json:"last_run,omitempty"`
+}
+
+// JobRun is one execution of a job. ScheduledAt is the activation time for
+// scheduled runs and the request time for manual ones.
+type JobRun struct {
+	ID          int64                  `json:"id"`
+	Job         string                 `json:"job"`
+	Trigger     string                 `json:"trigger"`
+	Status      string                 `json:"status"`
+	TriggeredBy *int64                 `json:"triggered_by,omitempty"`
+	ScheduledAt time.Time              `json:"scheduled_at"`
+	StartedAt   time.Time              `json:"started_at"`
+	FinishedAt  *time.Time             `json:"finished_at,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Result      map[string]interface{} `json:"result,omitempty"`
+}
+
+// JobRunFilter narrows run history listings. Zero values do not filter.
+type JobRunFilter struct {
+	Pagination
+	Job    string
+	Status string
+}
+
+type JobRunList struct {
+	Runs  []JobRun `json:"runs"`
+	Total int      `json:"total"`
+	Page  int      `json:"page"`
+	Limit int      `json:"limit"`
+}
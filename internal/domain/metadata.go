@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrMetadataNotFound    = errors.New("No metadata found for the ISBN")
+	ErrMetadataUnavailable = errors.New("Metadata provider is unavailable")
+)
+
+// BookMetadata is a bibliographic record from an external catalog. It is
+// returned as a draft that can be used to fill in a new book.
+type BookMetadata struct {
+	ISBN        string     `json:"isbn"`
+	Title       string     `json:"title,omitempty"`
+	Authors     []string   `json:"authors,omitempty"`
+	Publisher   string     `json:"publisher,omitempty"`
+	PublishDate *time.Time `json:"publish_date,omitempty"`
+	PageCount   int        `json:"page_count,omitempty"`
+	Language    string     `json:"language,omitempty"`
+	CoverURL    string     `json:"cover_url,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Source      string     `json:"source"`
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidMFACode     = errors.New("Invalid authentication code")
+	ErrInvalidMFAToken    = errors.New("Invalid or expired MFA token")
+	ErrMFANotEnrolled     = errors.New("Two-factor authentication is not enrolled")
+	ErrMFAAlreadyEnabled  = errors.New("Two-factor authentication is already enabled")
+	ErrMFANotEnabled      = errors.New("Two-factor authentication is not enabled")
+	ErrMFACodeAlreadyUsed = errors.New("Authentication code was already used")
+	ErrMFARequired        = errors.New("Two-factor authentication is enabled, use an API key instead of the password")
+	ErrMFALocked          = errors.New("Too many authentication codes tried, try again later")
+)
+
+type UserMFA struct {
+	UserID      int64
+	Secret      string
+	Enabled     bool
+	LastStep    int64
+	CreatedAt   time.Time
+	ConfirmedAt *time.Time
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// SingInResult carries either a token pair or, when the user has two-factor
+// authentication enabled, a short-lived MFA challenge token.
+type SingInResult struct {
+	AccessToken  string
+	RefreshToken string
+	MFAToken     string
+}
+
+func (r SingInResult) MFARequired() bool {
+	return r.MFAToken != ""
+}
+
+type MFACodeInput struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type MFAVerifyInput struct {
+	Token        string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+type MFADisableInput struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+func (i MFACodeInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i MFAVerifyInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i MFADisableInput) Validate() error {
+	return validate.Struct(i)
+}
@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+)
+
+const (
+	OrgRoleMember    = "member"
+	OrgRoleLibrarian = "librarian"
+	OrgRoleOwner     = "owner"
+)
+
+var (
+	ErrOrgNotFound        = errors.New("Organization not found")
+	ErrOrgRequired        = errors.New("No active organization")
+	ErrNotOrgMember       = errors.New("User is not a member of the organization")
+	ErrNotOrgOwner        = errors.New("Only organization owners can do this")
+	ErrOrgSlugTaken       = errors.New("Organization slug is already in use")
+	ErrInvitationNotFound = errors.New("Invitation not found or expired")
+	ErrInvitationEmail    = errors.New("Invitation was sent to a different email address")
+	ErrLastOwner          = errors.New("Organization must keep at least one owner")
+	ErrAlreadyOrgMember   = errors.New("User is already a member of the organization")
+)
+
+type Organization struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Membership is an organization as seen by one of its members.
+type Membership struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// HasRole reports whether the member has the role or a more privileged one.
+func (m Membership) HasRole(role string) bool {
+	return orgRoleRank[m.Role] >= orgRoleRank[role]
+}
+
+var orgRoleRank = map[string]int{
+	OrgRoleMember:    1,
+	OrgRoleLibrarian: 2,
+	OrgRoleOwner:     3,
+}
+
+type OrgMember struct {
+	UserID   int64     `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type Invitation struct {
+	ID         int64      `json:"id"`
+	OrgID      int64      `json:"org_id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	TokenHash  string     `json:"-"`
+	InvitedBy  int64      `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateOrgInput struct {
+	Name string `json:"name" validate:"required,max=255"`
+	Slug string `json:"slug" validate:"required,max=64"`
+}
+
+type InviteInput struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=member librarian owner"`
+}
+
+type SetOrgRoleInput struct {
+	Role string `json:"role" validate:"required,oneof=member librarian owner"`
+}
+
+type AcceptInvitationInput struct {
+	Token string `json:"token" validate:"required"`
+}
+
+var slugRegexp = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+func (i CreateOrgInput) Validate() error {
+	if err := validate.Struct(i); err != nil {
+		return err
+	}
+
+	return validateSlug(i.Slug)
+}
+
+func (i InviteInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i SetOrgRoleInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i AcceptInvitationInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type orgCtxKey struct{}
+
+// WithOrgID sets the active organization. Repositories of org scoped data
+// read it back with OrgIDFromContext.
+func WithOrgID(ctx context.Context, orgId int64) context.Context {
+	return context.WithValue(ctx, orgCtxKey{}, orgId)
+}
+
+func OrgIDFromContext(ctx context.Context) (int64, error) {
+	orgId, ok := ctx.Value(orgCtxKey{}).(int64)
+	if !ok || orgId == 0 {
+		return 0, ErrOrgRequired
+	}
+
+	return orgId, nil
+}
@@ -0,0 +1,30 @@
+package domain
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type Pagination struct {
+	Page  int
+	Limit int
+}
+
+// Normalize clamps paging parameters to sane defaults.
+func (p *Pagination) Normalize() {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+
+	if p.Limit < 1 {
+		p.Limit = defaultPageLimit
+	}
+
+	if p.Limit > maxPageLimit {
+		p.Limit = maxPageLimit
+	}
+}
+
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
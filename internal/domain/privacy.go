@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ErasureStatusPending   = "pending"
+	ErasureStatusRunning   = "running"
+	ErasureStatusCompleted = "completed"
+	ErasureStatusFailed    = "failed"
+)
+
+var (
+	ErrErasureJobNotFound = errors.New("Erasure job not found")
+	ErrErasureInProgress  = errors.New("Erasure is already requested")
+)
+
+// UserExport is everything stored about a user.
+type UserExport struct {
+	ExportedAt    time.Time       `json:"exported_at"`
+	Profile       User            `json:"profile"`
+	Sessions      []SessionExport `json:"sessions"`
+	APIKeys       []APIKey        `json:"api_keys"`
+	Identities    []Identity      `json:"identities"`
+	Books         []Book          `json:"books"`
+	Reviews       []Review        `json:"reviews"`
+	Shelves       []ShelfExport   `json:"shelves"`
+	Reading       []Reading       `json:"reading"`
+	Loans         []Loan          `json:"loans"`
+	Holds         []Hold          `json:"holds"`
+	Organizations []Membership    `json:"organizations"`
+	AuditEvents   []AuditEvent    `json:"audit_events"`
+}
+
+// SessionExport describes a refresh session without its secret token.
+type SessionExport struct {
+	ID        int64     `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ErasureJob anonymizes a user in steps so it can be resumed after a restart.
+type ErasureJob struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	Step        int        `json:"step"`
+	Error       string     `json:"error,omitempty"`
+	StatusToken string     `json:"-"`
+	RequestedAt time.Time  `json:"requested_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+func (j ErasureJob) Done() bool {
+	return j.Status == ErasureStatusCompleted || j.Status == ErasureStatusFailed
+}
+
+type ErasureRequestInput struct {
+	Password string `json:"password" validate:"required"`
+}
+
+func (i ErasureRequestInput) Validate() error {
+	return validate.Struct(i)
+}
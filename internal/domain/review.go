@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrReviewNotFound  = errors.New("Review not found")
+	ErrReviewExists    = errors.New("You have already reviewed this book")
+	ErrNotReviewAuthor = errors.New("Only the author can change a review")
+)
+
+// Review is a user's rating of a book. Hidden reviews are removed by a
+// moderator and do not count towards the book's rating; flagged ones were
+// reported by readers and wait for moderation.
+type Review struct {
+	ID        int64     `json:"id"`
+	BookID    int64     `json:"book_id"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name,omitempty"`
+	Rating    int       `json:"rating"`
+	Text      string    `json:"text,omitempty"`
+	Flagged   bool      `json:"flagged"`
+	Hidden    bool      `json:"hidden"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ReviewInput struct {
+	Rating int    `json:"rating" validate:"required,min=1,max=5"`
+	Text   string `json:"text" validate:"max=10000"`
+}
+
+func (i ReviewInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type ModerateReviewInput struct {
+	Hidden *bool `json:"hidden" validate:"required"`
+}
+
+func (i ModerateReviewInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type ReviewFilter struct {
+	Pagination
+	IncludeHidden bool
+}
+
+type ReviewList struct {
+	Reviews []Review `json:"reviews"`
+	Total   int      `json:"total"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+}
@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	RevisionActionCreate  = "create"
+	RevisionActionUpdate  = "update"
+	RevisionActionDelete  = "delete"
+	RevisionActionRestore = "restore"
+	RevisionActionRevert  = "revert"
+)
+
+var ErrRevisionNotFound = errors.New("Revision not found")
+
+// BookRevision is an immutable snapshot of a book taken after every change.
+// Revisions of a book are numbered from 1.
+type BookRevision struct {
+	BookID   int64    `json:"book_id"`
+	Revision int      `json:"revision"`
+	Action   string   `json:"action"`
+	ActorID  *int64   `json:"actor_id,omitempty"`
+	Changed  []string `json:"changed"`
+	// RevertedTo is the revision a revert went back to.
+	RevertedTo *int      `json:"reverted_to,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Book is the snapshot. It is left out of revision listings.
+	Book *Book `json:"book,omitempty"`
+}
+
+type BookRevisionList struct {
+	Revisions []BookRevision `json:"revisions"`
+	Total     int            `json:"total"`
+	Page      int            `json:"page"`
+	Limit     int            `json:"limit"`
+}
+
+// FieldChange is a changed book field with its JSON values. A value is null
+// when the field is empty.
+type FieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+type BookDiff struct {
+	BookID  int64         `json:"book_id"`
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// diffIgnored are fields that are not edited with the book: identifiers, the
+// version and the rating aggregates kept up to date by reviews.
+var diffIgnored = map[string]bool{
+	"id":           true,
+	"org_id":       true,
+	"rating":       true,
+	"rating_count": true,
+	"version":      true,
+}
+
+// DiffBooks compares the JSON fields of two snapshots of a book.
+func DiffBooks(from, to Book) ([]FieldChange, error) {
+	a, err := bookFields(from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := bookFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(a)+len(b))
+	for field := range a {
+		fields = append(fields, field)
+	}
+	for field := range b {
+		if _, ok := a[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]FieldChange, 0)
+	for _, field := range fields {
+		if diffIgnored[field] || bytes.Equal(a[field], b[field]) {
+			continue
+		}
+
+		changes = append(changes, FieldChange{Field: field, From: a[field], To: b[field]})
+	}
+
+	return changes, nil
+}
+
+func bookFields(book Book) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(book)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+
+	return fields, err
+}
+
+// ChangedFields returns the names of the fields in the changes.
+func ChangedFields(changes []FieldChange) []string {
+	fields := make([]string, len(changes))
+	for i, change := range changes {
+		fields[i] = change.Field
+	}
+
+	return fields
+}
+
+// Input returns an update that sets every editable field of the book to
+// the value in the snapshot.
+func (b Book) Input() UpdateBookInput {
+	authors := b.Authors
+	genres := b.Genres
+	tags := b.Tags
+
+	return UpdateBookInput{
+		Title:          &b.Title,
+		Author:         &b.Author,
+		PublishDate:    &b.PublishDate,
+		ISBN:           &b.ISBN,
+		Publisher:      &b.Publisher,
+		Language:       &b.Language,
+		PageCount:      &b.PageCount,
+		Format:         &b.Format,
+		Edition:        &b.Edition,
+		Series:         &b.Series,
+		SeriesPosition: &b.SeriesPosition,
+		CoverURL:       &b.CoverURL,
+		Description:    &b.Description,
+		Authors:        &authors,
+		Genres:         &genres,
+		Tags:           &tags,
+	}
+}
@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ReadingStatusWantToRead = "want_to_read"
+	ReadingStatusReading    = "reading"
+	ReadingStatusRead       = "read"
+)
+
+var (
+	ErrShelfNotFound   = errors.New("Shelf not found")
+	ErrShelfNameTaken  = errors.New("A shelf with this name already exists")
+	ErrReadingNotFound = errors.New("Book is not on your reading list")
+	ErrInvalidProgress = errors.New("Progress is beyond the end of the book")
+	ErrInvalidDates    = errors.New("Finished date is before the started date")
+)
+
+// Shelf is a named list of books kept by a user.
+type Shelf struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	BookCount int       `json:"book_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ShelfInput struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+func (i ShelfInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type ShelfBook struct {
+	BookID  int64     `json:"book_id"`
+	Title   string    `json:"title"`
+	Author  string    `json:"author"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type ShelfBookList struct {
+	Books []ShelfBook `json:"books"`
+	Total int         `json:"total"`
+	Page  int         `json:"page"`
+	Limit int         `json:"limit"`
+}
+
+// Reading is the user's reading status of a book. Progress is tracked in
+// pages or in percent; ProgressPercent is derived from the pages when the
+// book's page count is known.
+type Reading struct {
+	BookID          int64      `json:"book_id"`
+	Title           string     `json:"title"`
+	Author          string     `json:"author"`
+	PageCount       int        `json:"page_count,omitempty"`
+	Status          string     `json:"status"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	ProgressPages   *int       `json:"progress_pages,omitempty"`
+	ProgressPercent *int       `json:"progress_percent,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type ReadingInput struct {
+	Status          string     `json:"status" validate:"required,oneof=want_to_read reading read"`
+	StartedAt       *time.Time `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+	ProgressPages   *int       `json:"progress_pages" validate:"omitempty,gte=0,excluded_with=ProgressPercent"`
+	ProgressPercent *int       `json:"progress_percent" validate:"omitempty,gte=0,lte=100"`
+}
+
+func (i ReadingInput) Validate() error {
+	if err := validate.Struct(i); err != nil {
+		return err
+	}
+
+	if i.StartedAt != nil && i.FinishedAt != nil && i.FinishedAt.Before(*i.StartedAt) {
+		return ErrInvalidDates
+	}
+
+	return nil
+}
+
+type ReadingFilter struct {
+	Pagination
+	Status string
+}
+
+type ReadingList struct {
+	Books []Reading `json:"books"`
+	Total int       `json:"total"`
+	Page  int       `json:"page"`
+	Limit int       `json:"limit"`
+}
+
+// ReadingStats summarizes a user's reading in every organization. Books
+// count towards the year they were finished in.
+type ReadingStats struct {
+	WantToRead         int         `json:"want_to_read"`
+	Reading            int         `json:"reading"`
+	Read               int         `json:"read"`
+	PagesRead          int         `json:"pages_read"`
+	ReviewCount        int         `json:"review_count"`
+	AverageRatingGiven float64     `json:"average_rating_given"`
+	Years              []YearStats `json:"years"`
+}
+
+type YearStats struct {
+	Year  int `json:"year"`
+	Books int `json:"books"`
+	Pages int `json:"pages"`
+}
+
+// ShelfExport is a shelf with all of its books, for the data export.
+type ShelfExport struct {
+	Shelf
+	Books []ShelfBook `json:"books"`
+}
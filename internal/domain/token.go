@@ -5,6 +5,14 @@ import "time"
 type RefreshSession struct {
 	ID        int64
 	UserID    int64
+	OrgID     int64
 	Token     string
 	ExpiresAt time.Time
 }
+
+// AccessClaims is what an access token says about its bearer.
+// OrgID is zero until the user switches to an organization.
+type AccessClaims struct {
+	UserID int64
+	OrgID  int64
+}
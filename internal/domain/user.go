@@ -12,14 +12,66 @@ func init() {
 	validate = validator.New()
 }
 
-var ErrUserNotFound = errors.New("User with such credentials not found")
+var (
+	ErrUserNotFound         = errors.New("User with such credentials not found")
+	ErrEmailTaken           = errors.New("Email is already in use")
+	ErrInvalidPassword      = errors.New("Invalid password")
+	ErrVerificationNotFound = errors.New("Verification token not found or expired")
+	ErrUserDisabled         = errors.New("User is disabled")
+	ErrCannotModifySelf     = errors.New("Administrators cannot change their own account this way")
+)
+
+const (
+	RoleReader    = "reader"
+	RoleLibrarian = "librarian"
+	RoleAdmin     = "admin"
+)
 
 type User struct {
-	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	Email        string    `json:"email"`
-	Password     string    `json:"password"`
-	RegisteredAt time.Time `json:"registered_at"`
+	ID           int64      `json:"id"`
+	Name         string     `json:"name"`
+	Email        string     `json:"email"`
+	Password     string     `json:"-"`
+	Role         string     `json:"role"`
+	RegisteredAt time.Time  `json:"registered_at"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+}
+
+func (u User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// HasRole reports whether the user has the role or a more privileged one.
+func (u User) HasRole(role string) bool {
+	return roleRank[u.Role] >= roleRank[role]
+}
+
+var roleRank = map[string]int{
+	RoleReader:    1,
+	RoleLibrarian: 2,
+	RoleAdmin:     3,
+}
+
+type UserFilter struct {
+	Pagination
+	Query    string
+	Role     string
+	Disabled *bool
+}
+
+type UserList struct {
+	Users []User `json:"users"`
+	Total int    `json:"total"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+}
+
+type SetRoleInput struct {
+	Role string `json:"role" validate:"required,oneof=reader librarian admin"`
+}
+
+func (i SetRoleInput) Validate() error {
+	return validate.Struct(i)
 }
 
 type SingUpInput struct {
@@ -40,3 +92,53 @@ func (i SingUpInput) Validate() error {
 func (i SingInInput) Validate() error {
 	return validate.Struct(i)
 }
+
+type UpdateUserInput struct {
+	Name  *string `json:"name" validate:"omitempty,gte=2"`
+	Email *string `json:"email" validate:"omitempty,email"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,gte=6"`
+}
+
+type DeleteUserInput struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// EmailVerification is a pending change of a user's email address.
+type EmailVerification struct {
+	ID        int64
+	UserID    int64
+	Email     string
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// UpdateUserResult tells whether an email change is waiting for confirmation.
+type UpdateUserResult struct {
+	User         User   `json:"user"`
+	PendingEmail string `json:"pending_email,omitempty"`
+}
+
+func (i UpdateUserInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i ChangePasswordInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i DeleteUserInput) Validate() error {
+	return validate.Struct(i)
+}
+
+func (i VerifyEmailInput) Validate() error {
+	return validate.Struct(i)
+}
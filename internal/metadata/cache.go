@@ -0,0 +1,103 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"sync"
+	"time"
+)
+
+type Provider interface {
+	Lookup(ctx context.Context, isbn string) (domain.BookMetadata, error)
+}
+
+type cacheEntry struct {
+	record    domain.BookMetadata
+	notFound  bool
+	expiresAt time.Time
+}
+
+// Cache keeps provider responses in memory. Misses are cached for a shorter
+// time so that new catalog entries show up; provider failures are not cached.
+type Cache struct {
+	next        Provider
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func NewCache(next Provider, ttl time.Duration, size int) *Cache {
+	if size <= 0 {
+		size = 1000
+	}
+
+	return &Cache{
+		next:        next,
+		ttl:         ttl,
+		negativeTTL: ttl / 10,
+		size:        size,
+		entries:     make(map[string]cacheEntry),
+	}
+}
+
+func (c *Cache) Lookup(ctx context.Context, isbn string) (domain.BookMetadata, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[isbn]
+	c.mu.Unlock()
+
+	if ok && now.Before(entry.expiresAt) {
+		if entry.notFound {
+			return domain.BookMetadata{}, domain.ErrMetadataNotFound
+		}
+		return entry.record, nil
+	}
+
+	record, err := c.next.Lookup(ctx, isbn)
+	switch {
+	case err == nil:
+		c.put(isbn, cacheEntry{record: record, expiresAt: now.Add(c.ttl)})
+	case errors.Is(err, domain.ErrMetadataNotFound):
+		c.put(isbn, cacheEntry{notFound: true, expiresAt: now.Add(c.negativeTTL)})
+	}
+
+	return record, err
+}
+
+func (c *Cache) put(isbn string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		c.evict()
+	}
+
+	c.entries[isbn] = entry
+}
+
+// evict drops expired entries, or the entry closest to expiry when none is.
+func (c *Cache) evict() {
+	now := time.Now()
+
+	var oldest string
+	var oldestAt time.Time
+	for isbn, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, isbn)
+			continue
+		}
+
+		if oldest == "" || entry.expiresAt.Before(oldestAt) {
+			oldest, oldestAt = isbn, entry.expiresAt
+		}
+	}
+
+	if len(c.entries) >= c.size {
+		delete(c.entries, oldest)
+	}
+}
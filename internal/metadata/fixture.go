@@ -0,0 +1,45 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"os"
+)
+
+// Fixture serves metadata from a JSON file mapping ISBN-13 to records. It is
+// meant for development and offline tests.
+type Fixture struct {
+	records map[string]domain.BookMetadata
+}
+
+func NewFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]domain.BookMetadata)
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+
+	for isbn, record := range records {
+		record.ISBN = isbn
+		if record.Source == "" {
+			record.Source = "fixture"
+		}
+		records[isbn] = record
+	}
+
+	return &Fixture{records: records}, nil
+}
+
+func (p *Fixture) Lookup(ctx context.Context, isbn string) (domain.BookMetadata, error) {
+	record, ok := p.records[isbn]
+	if !ok {
+		return domain.BookMetadata{}, domain.ErrMetadataNotFound
+	}
+
+	return record, nil
+}
@@ -0,0 +1,148 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"testing"
+	"time"
+)
+
+const fixtureFile = "testdata/books.json"
+
+func TestFixtureLookup(t *testing.T) {
+	p, err := NewFixture(fixtureFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		isbn   string
+		title  string
+		source string
+		err    error
+	}{
+		{"9780261103344", "The Hobbit", "fixture", nil},
+		{"9780306406157", "Fundamentals of Applied Physics", "openlibrary", nil},
+		{"9780140449136", "", "", domain.ErrMetadataNotFound},
+	}
+
+	for _, tt := range tests {
+		record, err := p.Lookup(context.Background(), tt.isbn)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Lookup(%s) error = %v, want %v", tt.isbn, err, tt.err)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if record.ISBN != tt.isbn || record.Title != tt.title || record.Source != tt.source {
+			t.Errorf("Lookup(%s) = %+v, want title %q from %q", tt.isbn, record, tt.title, tt.source)
+		}
+	}
+}
+
+func TestFixtureRecord(t *testing.T) {
+	p, err := NewFixture(fixtureFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := p.Lookup(context.Background(), "9780261103344")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.PublishDate == nil || !record.PublishDate.Equal(time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("PublishDate = %v, want 1937-09-21", record.PublishDate)
+	}
+
+	if len(record.Authors) != 1 || record.Authors[0] != "J. R. R. Tolkien" || record.PageCount != 310 || record.Language != "en" {
+		t.Errorf("record = %+v", record)
+	}
+}
+
+func TestNewFixtureErrors(t *testing.T) {
+	if _, err := NewFixture("testdata/missing.json"); err == nil {
+		t.Error("NewFixture of a missing file succeeded")
+	}
+}
+
+// countingProvider counts the lookups that reach the provider behind a cache.
+type countingProvider struct {
+	Provider
+	lookups int
+	err     error
+}
+
+func (p *countingProvider) Lookup(ctx context.Context, isbn string) (domain.BookMetadata, error) {
+	p.lookups++
+	if p.err != nil {
+		return domain.BookMetadata{}, p.err
+	}
+
+	return p.Provider.Lookup(ctx, isbn)
+}
+
+func TestCache(t *testing.T) {
+	fixture, err := NewFixture(fixtureFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := &countingProvider{Provider: fixture}
+	c := NewCache(next, time.Hour, 10)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		record, err := c.Lookup(ctx, "9780261103344")
+		if err != nil || record.Title != "The Hobbit" {
+			t.Fatalf("Lookup = %+v, %v", record, err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Lookup(ctx, "9780140449136"); !errors.Is(err, domain.ErrMetadataNotFound) {
+			t.Fatalf("Lookup error = %v, want ErrMetadataNotFound", err)
+		}
+	}
+
+	// hits and misses are both cached
+	if next.lookups != 2 {
+		t.Errorf("%d lookups reached the provider, want 2", next.lookups)
+	}
+}
+
+func TestCacheSkipsFailures(t *testing.T) {
+	next := &countingProvider{err: domain.ErrMetadataUnavailable}
+	c := NewCache(next, time.Hour, 10)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Lookup(context.Background(), "9780261103344"); !errors.Is(err, domain.ErrMetadataUnavailable) {
+			t.Fatalf("Lookup error = %v, want ErrMetadataUnavailable", err)
+		}
+	}
+
+	if next.lookups != 2 {
+		t.Errorf("%d lookups reached the provider, want 2", next.lookups)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	fixture, err := NewFixture(fixtureFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCache(fixture, time.Hour, 1)
+	ctx := context.Background()
+
+	c.Lookup(ctx, "9780261103344")
+	c.Lookup(ctx, "9780306406157")
+
+	if len(c.entries) != 1 {
+		t.Errorf("%d cache entries, want 1", len(c.entries))
+	}
+}
@@ -0,0 +1,162 @@
+// Package metadata implements book metadata providers used to enrich
+// catalog records by ISBN.
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const openLibraryURL = "https://openlibrary.org"
+
+// OpenLibrary looks books up with the Open Library Books API.
+type OpenLibrary struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewOpenLibrary(baseURL string, timeout time.Duration) *OpenLibrary {
+	if baseURL == "" {
+		baseURL = openLibraryURL
+	}
+
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &OpenLibrary{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+type openLibraryBook struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	Authors  []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Publishers []struct {
+		Name string `json:"name"`
+	} `json:"publishers"`
+	PublishDate   string `json:"publish_date"`
+	NumberOfPages int    `json:"number_of_pages"`
+	Cover         struct {
+		Large  string `json:"large"`
+		Medium string `json:"medium"`
+	} `json:"cover"`
+	Excerpts []struct {
+		Text string `json:"text"`
+	} `json:"excerpts"`
+	// notes is either a string or an object with a value
+	Notes json.RawMessage `json:"notes"`
+}
+
+func (p *OpenLibrary) Lookup(ctx context.Context, isbn string) (domain.BookMetadata, error) {
+	v := url.Values{}
+	v.Set("bibkeys", "ISBN:"+isbn)
+	v.Set("format", "json")
+	v.Set("jscmd", "data")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/books?"+v.Encode(), nil)
+	if err != nil {
+		return domain.BookMetadata{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return domain.BookMetadata{}, fmt.Errorf("%w: %v", domain.ErrMetadataUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return domain.BookMetadata{}, fmt.Errorf("%w: open library returned %s", domain.ErrMetadataUnavailable, resp.Status)
+	}
+
+	var books map[string]openLibraryBook
+	if err := json.NewDecoder(resp.Body).Decode(&books); err != nil {
+		return domain.BookMetadata{}, fmt.Errorf("%w: decoding response: %v", domain.ErrMetadataUnavailable, err)
+	}
+
+	book, ok := books["ISBN:"+isbn]
+	if !ok {
+		return domain.BookMetadata{}, domain.ErrMetadataNotFound
+	}
+
+	return book.toMetadata(isbn), nil
+}
+
+func (b openLibraryBook) toMetadata(isbn string) domain.BookMetadata {
+	m := domain.BookMetadata{
+		ISBN:      isbn,
+		Title:     b.Title,
+		PageCount: b.NumberOfPages,
+		CoverURL:  b.Cover.Large,
+		Source:    "openlibrary",
+	}
+
+	if b.Subtitle != "" {
+		m.Title += ": " + b.Subtitle
+	}
+
+	for _, a := range b.Authors {
+		m.Authors = append(m.Authors, a.Name)
+	}
+
+	if len(b.Publishers) > 0 {
+		m.Publisher = b.Publishers[0].Name
+	}
+
+	if m.CoverURL == "" {
+		m.CoverURL = b.Cover.Medium
+	}
+
+	if t, ok := parsePublishDate(b.PublishDate); ok {
+		m.PublishDate = &t
+	}
+
+	var notes string
+	var notesValue struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(b.Notes, &notes) != nil && json.Unmarshal(b.Notes, &notesValue) == nil {
+		notes = notesValue.Value
+	}
+
+	m.Description = notes
+	if m.Description == "" && len(b.Excerpts) > 0 {
+		m.Description = b.Excerpts[0].Text
+	}
+
+	return m
+}
+
+var publishDateLayouts = []string{
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"January 2006",
+	"Jan 2006",
+	"2006",
+}
+
+// parsePublishDate understands the free-form dates catalogs use, from a
+// full date down to a bare year.
+func parsePublishDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range publishDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
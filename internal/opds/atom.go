@@ -0,0 +1,218 @@
+package opds
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+const (
+	atomNamespace       = "http://www.w3.org/2005/Atom"
+	dcNamespace         = "http://purl.org/dc/terms/"
+	opdsNamespace       = "http://opds-spec.org/2010/catalog"
+	openSearchNamespace = "http://a9.com/-/spec/opensearch/1.1/"
+)
+
+type atomNamespaces struct {
+	Xmlns           string `xml:"xmlns,attr,omitempty"`
+	XmlnsDC         string `xml:"xmlns:dc,attr,omitempty"`
+	XmlnsOPDS       string `xml:"xmlns:opds,attr,omitempty"`
+	XmlnsOpenSearch string `xml:"xmlns:opensearch,attr,omitempty"`
+}
+
+var namespaces = atomNamespaces{
+	Xmlns:           atomNamespace,
+	XmlnsDC:         dcNamespace,
+	XmlnsOPDS:       opdsNamespace,
+	XmlnsOpenSearch: openSearchNamespace,
+}
+
+type atomFeed struct {
+	XMLName xml.Name `xml:"feed"`
+	atomNamespaces
+	ID           string      `xml:"id"`
+	Title        string      `xml:"title"`
+	Updated      string      `xml:"updated"`
+	Links        []atomLink  `xml:"link"`
+	TotalResults *int        `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage *int        `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex   *int        `xml:"opensearch:startIndex,omitempty"`
+	Entries      []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	XMLName xml.Name `xml:"entry"`
+	atomNamespaces
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomPerson   `xml:"author"`
+	Identifier string         `xml:"dc:identifier,omitempty"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Publisher  string         `xml:"dc:publisher,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary"`
+	Content    *atomText      `xml:"content"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+// WriteAtom writes the feed as an OPDS 1.2 catalog. Paged feeds carry their
+// position as OpenSearch elements.
+func WriteAtom(w io.Writer, feed Feed) error {
+	updated := feed.Updated.UTC().Format(time.RFC3339)
+
+	doc := atomFeed{
+		atomNamespaces: namespaces,
+		ID:             feed.ID,
+		Title:          feed.Title,
+		Updated:        updated,
+		Links:          atomLinks(feed.Links),
+		Entries:        make([]atomEntry, 0, len(feed.Navigation)+len(feed.Publications)),
+	}
+
+	if feed.Limit > 0 {
+		startIndex := (feed.Page-1)*feed.Limit + 1
+		doc.TotalResults, doc.ItemsPerPage, doc.StartIndex = &feed.Total, &feed.Limit, &startIndex
+	}
+
+	for _, nav := range feed.Navigation {
+		entry := atomEntry{
+			Title:   nav.Title,
+			ID:      nav.ID,
+			Updated: updated,
+			Links:   atomLinks([]Link{nav.Link}),
+		}
+		if nav.Summary != "" {
+			entry.Content = &atomText{Type: "text", Value: nav.Summary}
+		}
+
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	for _, pub := range feed.Publications {
+		doc.Entries = append(doc.Entries, atomPublication(pub, updated))
+	}
+
+	return writeXML(w, doc)
+}
+
+// WriteAtomEntry writes a complete catalog entry for a single book.
+func WriteAtomEntry(w io.Writer, pub Publication, updated time.Time) error {
+	entry := atomPublication(pub, updated.UTC().Format(time.RFC3339))
+	entry.atomNamespaces = atomNamespaces{Xmlns: atomNamespace, XmlnsDC: dcNamespace, XmlnsOPDS: opdsNamespace}
+
+	return writeXML(w, entry)
+}
+
+func atomPublication(pub Publication, updated string) atomEntry {
+	book := pub.Book
+
+	entry := atomEntry{
+		Title:      book.Title,
+		ID:         BookID(book),
+		Updated:    updated,
+		Identifier: isbnURN(book),
+		Issued:     published(book),
+		Language:   book.Language,
+		Publisher:  book.Publisher,
+		Links:      atomLinks(pub.Links),
+	}
+
+	for _, name := range authors(book) {
+		entry.Authors = append(entry.Authors, atomPerson{Name: name})
+	}
+
+	for _, genre := range book.Genres {
+		entry.Categories = append(entry.Categories, atomCategory{Term: genre.Name, Label: genre.Name})
+	}
+
+	for _, tag := range book.Tags {
+		entry.Categories = append(entry.Categories, atomCategory{Term: tag, Label: tag})
+	}
+
+	if book.Description != "" {
+		entry.Summary = &atomText{Type: "text", Value: book.Description}
+	}
+
+	if book.CoverURL != "" {
+		entry.Links = append(entry.Links,
+			atomLink{Rel: RelImage, Href: book.CoverURL, Type: imageType(book.CoverURL)},
+			atomLink{Rel: RelThumbnail, Href: book.CoverURL, Type: imageType(book.CoverURL)},
+		)
+	}
+
+	return entry
+}
+
+func atomLinks(links []Link) []atomLink {
+	result := make([]atomLink, 0, len(links))
+	for _, link := range links {
+		if !link.Templated {
+			result = append(result, atomLink{Rel: link.Rel, Href: link.Href, Type: link.Type, Title: link.Title})
+		}
+	}
+
+	return result
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	return enc.Encode(v)
+}
+
+type openSearchDescription struct {
+	XMLName        xml.Name `xml:"OpenSearchDescription"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	ShortName      string   `xml:"ShortName"`
+	Description    string   `xml:"Description"`
+	InputEncoding  string   `xml:"InputEncoding"`
+	OutputEncoding string   `xml:"OutputEncoding"`
+	URLs           []openSearchURL
+}
+
+type openSearchURL struct {
+	XMLName  xml.Name `xml:"Url"`
+	Type     string   `xml:"type,attr"`
+	Template string   `xml:"template,attr"`
+}
+
+// WriteOpenSearch writes an OpenSearch description whose template leads to
+// an acquisition feed, with {searchTerms} in place of the query.
+func WriteOpenSearch(w io.Writer, shortName, description, template string) error {
+	return writeXML(w, openSearchDescription{
+		Xmlns:          openSearchNamespace,
+		ShortName:      shortName,
+		Description:    description,
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URLs:           []openSearchURL{{Type: TypeAcquisition, Template: template}},
+	})
+}
@@ -0,0 +1,167 @@
+package opds
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+type jsonFeed struct {
+	Metadata     jsonFeedMetadata   `json:"metadata"`
+	Links        []jsonLink         `json:"links"`
+	Navigation   *[]jsonLink        `json:"navigation,omitempty"`
+	Publications *[]jsonPublication `json:"publications,omitempty"`
+}
+
+type jsonFeedMetadata struct {
+	Title         string `json:"title"`
+	NumberOfItems *int   `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int    `json:"itemsPerPage,omitempty"`
+	CurrentPage   int    `json:"currentPage,omitempty"`
+}
+
+type jsonLink struct {
+	Rel       string `json:"rel,omitempty"`
+	Href      string `json:"href"`
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+}
+
+type jsonPublication struct {
+	Metadata jsonPublicationMetadata `json:"metadata"`
+	Links    []jsonLink              `json:"links"`
+	Images   []jsonLink              `json:"images,omitempty"`
+}
+
+type jsonPublicationMetadata struct {
+	Type          string        `json:"@type"`
+	Identifier    string        `json:"identifier,omitempty"`
+	Title         string        `json:"title"`
+	Author        []jsonName    `json:"author,omitempty"`
+	Publisher     string        `json:"publisher,omitempty"`
+	Language      string        `json:"language,omitempty"`
+	Published     string        `json:"published,omitempty"`
+	Description   string        `json:"description,omitempty"`
+	Subject       []string      `json:"subject,omitempty"`
+	NumberOfPages int           `json:"numberOfPages,omitempty"`
+	BelongsTo     *jsonBelongTo `json:"belongsTo,omitempty"`
+}
+
+type jsonName struct {
+	Name string `json:"name"`
+}
+
+type jsonBelongTo struct {
+	Series []jsonSeries `json:"series"`
+}
+
+type jsonSeries struct {
+	Name     string  `json:"name"`
+	Position float64 `json:"position,omitempty"`
+}
+
+// WriteJSON writes the feed as an OPDS 2.0 catalog.
+func WriteJSON(w io.Writer, feed Feed) error {
+	doc := jsonFeed{
+		Metadata: jsonFeedMetadata{Title: feed.Title},
+		Links:    jsonLinks(feed.Links),
+	}
+
+	if feed.Limit > 0 {
+		doc.Metadata.NumberOfItems = &feed.Total
+		doc.Metadata.ItemsPerPage = feed.Limit
+		doc.Metadata.CurrentPage = feed.Page
+	}
+
+	if feed.Navigation != nil {
+		navigation := make([]jsonLink, len(feed.Navigation))
+		for i, nav := range feed.Navigation {
+			navigation[i] = jsonLinks([]Link{nav.Link})[0]
+			navigation[i].Title = nav.Title
+		}
+		doc.Navigation = &navigation
+	} else {
+		publications := make([]jsonPublication, len(feed.Publications))
+		for i, pub := range feed.Publications {
+			publications[i] = jsonPublicationOf(pub)
+		}
+		doc.Publications = &publications
+	}
+
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// WritePublication writes a single book as an OPDS 2.0 publication.
+func WritePublication(w io.Writer, pub Publication) error {
+	return json.NewEncoder(w).Encode(jsonPublicationOf(pub))
+}
+
+func jsonPublicationOf(pub Publication) jsonPublication {
+	book := pub.Book
+
+	metadata := jsonPublicationMetadata{
+		Type:          "http://schema.org/Book",
+		Identifier:    isbnURN(book),
+		Title:         book.Title,
+		Publisher:     book.Publisher,
+		Language:      book.Language,
+		Published:     published(book),
+		Description:   book.Description,
+		NumberOfPages: book.PageCount,
+	}
+
+	if metadata.Identifier == "" {
+		metadata.Identifier = BookID(book)
+	}
+
+	for _, name := range authors(book) {
+		metadata.Author = append(metadata.Author, jsonName{Name: name})
+	}
+
+	for _, genre := range book.Genres {
+		metadata.Subject = append(metadata.Subject, genre.Name)
+	}
+	metadata.Subject = append(metadata.Subject, book.Tags...)
+
+	if book.Series != "" {
+		metadata.BelongsTo = &jsonBelongTo{Series: []jsonSeries{{Name: book.Series, Position: book.SeriesPosition}}}
+	}
+
+	result := jsonPublication{Metadata: metadata, Links: jsonLinks(pub.Links)}
+	if book.CoverURL != "" {
+		result.Images = []jsonLink{{Href: book.CoverURL, Type: imageType(book.CoverURL)}}
+	}
+
+	return result
+}
+
+func jsonLinks(links []Link) []jsonLink {
+	result := make([]jsonLink, len(links))
+	for i, link := range links {
+		result[i] = jsonLink{Rel: link.Rel, Href: link.Href, Type: link.Type, Title: link.Title, Templated: link.Templated}
+	}
+
+	return result
+}
+
+// imageType guesses the media type of a cover from its extension.
+func imageType(href string) string {
+	href = strings.ToLower(href)
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+
+	switch {
+	case strings.HasSuffix(href, ".png"):
+		return "image/png"
+	case strings.HasSuffix(href, ".gif"):
+		return "image/gif"
+	case strings.HasSuffix(href, ".webp"):
+		return "image/webp"
+	case strings.HasSuffix(href, ".jpg"), strings.HasSuffix(href, ".jpeg"):
+		return "image/jpeg"
+	default:
+		return ""
+	}
+}
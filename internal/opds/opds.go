@@ -0,0 +1,105 @@
+// Package opds renders catalog feeds for e-reader apps as OPDS 1.2 (Atom)
+// and OPDS 2.0 (JSON).
+package opds
+
+import (
+	"github.com/dewi911/cruda-app/internal/domain"
+	"strconv"
+	"time"
+)
+
+// Media types of OPDS documents.
+const (
+	TypeNavigation  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	TypeAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	TypeEntry       = "application/atom+xml;type=entry;profile=opds-catalog"
+	TypeFeed        = "application/opds+json"
+	TypePublication = "application/opds-publication+json"
+	TypeOpenSearch  = "application/opensearchdescription+xml"
+)
+
+// Link relations defined by OPDS.
+const (
+	RelBorrow    = "http://opds-spec.org/acquisition/borrow"
+	RelImage     = "http://opds-spec.org/image"
+	RelThumbnail = "http://opds-spec.org/image/thumbnail"
+	RelSortNew   = "http://opds-spec.org/sort/new"
+)
+
+// Link is a link of a feed or publication. Templated links are only written
+// to OPDS 2.0 feeds.
+type Link struct {
+	Rel       string
+	Href      string
+	Type      string
+	Title     string
+	Templated bool
+}
+
+// Navigation is an entry of a navigation feed that leads to another feed.
+type Navigation struct {
+	ID      string
+	Title   string
+	Summary string
+	Link    Link
+}
+
+// Publication is a book of an acquisition feed. The cover is linked by the
+// writers, Links holds the others.
+type Publication struct {
+	Book  domain.Book
+	Links []Link
+}
+
+// Feed is a catalog document before it is written in either version. Feeds
+// with Navigation are navigation feeds, the others acquisition feeds. Limit
+// is zero for feeds that are not paged.
+type Feed struct {
+	ID           string
+	Title        string
+	Updated      time.Time
+	Links        []Link
+	Navigation   []Navigation
+	Publications []Publication
+
+	Total int
+	Page  int
+	Limit int
+}
+
+// BookID is the permanent id of a book in feeds.
+func BookID(book domain.Book) string {
+	return "urn:cruda:book:" + strconv.FormatInt(book.ID, 10)
+}
+
+// authors returns the names of the linked authors, or the author field.
+func authors(book domain.Book) []string {
+	names := make([]string, 0, len(book.Authors))
+	for _, author := range book.Authors {
+		if author.Name != "" && (author.Role == "" || author.Role == domain.AuthorRoleAuthor) {
+			names = append(names, author.Name)
+		}
+	}
+
+	if len(names) == 0 && book.Author != "" {
+		names = append(names, book.Author)
+	}
+
+	return names
+}
+
+func published(book domain.Book) string {
+	if book.PublishDate.IsZero() {
+		return ""
+	}
+
+	return book.PublishDate.Format(time.DateOnly)
+}
+
+func isbnURN(book domain.Book) string {
+	if book.ISBN == "" {
+		return ""
+	}
+
+	return "urn:isbn:" + book.ISBN
+}
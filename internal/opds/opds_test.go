@@ -0,0 +1,492 @@
+package opds
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updated = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+
+// navigationFeed is a paged navigation feed on its first page.
+var navigationFeed = Feed{
+	ID:      "urn:cruda:opds:authors",
+	Title:   "By author",
+	Updated: updated,
+	Links: []Link{
+		{Rel: "self", Href: "/opds/authors?page=1", Type: TypeNavigation},
+		{Rel: "start", Href: "/opds", Type: TypeNavigation},
+		{Rel: "search", Href: "/opds/v2/search{?query}", Type: TypeFeed, Templated: true},
+		{Rel: "first", Href: "/opds/authors?page=1", Type: TypeNavigation},
+		{Rel: "next", Href: "/opds/authors?page=2", Type: TypeNavigation},
+		{Rel: "last", Href: "/opds/authors?page=2", Type: TypeNavigation},
+	},
+	Navigation: []Navigation{
+		{ID: "urn:cruda:opds:author:1", Title: "Tolkien & Sons", Summary: "Books by <Tolkien>",
+			Link: Link{Rel: "subsection", Href: "/opds/authors/1", Type: TypeAcquisition}},
+		{ID: "urn:cruda:opds:author:2", Title: "Herbert",
+			Link: Link{Rel: "subsection", Href: "/opds/authors/2", Type: TypeAcquisition}},
+	},
+	Total: 3,
+	Page:  1,
+	Limit: 2,
+}
+
+// acquisitionFeed is the middle page of three of a paged acquisition feed.
+var acquisitionFeed = Feed{
+	ID:      "urn:cruda:opds:books",
+	Title:   "All books",
+	Updated: updated,
+	Links: []Link{
+		{Rel: "self", Href: "/opds/books?page=2", Type: TypeAcquisition},
+		{Rel: "first", Href: "/opds/books?page=1", Type: TypeAcquisition},
+		{Rel: "previous", Href: "/opds/books?page=1", Type: TypeAcquisition},
+		{Rel: "next", Href: "/opds/books?page=3", Type: TypeAcquisition},
+		{Rel: "last", Href: "/opds/books?page=3", Type: TypeAcquisition},
+	},
+	Publications: []Publication{
+		{
+			Book: domain.Book{
+				ID:    7,
+				Title: "The Hobbit",
+				Authors: []domain.BookAuthor{
+					{Name: "J. R. R. Tolkien", Role: domain.AuthorRoleAuthor},
+					{Name: "Christopher Tolkien", Role: domain.AuthorRoleEditor},
+				},
+				Author:         "ignored",
+				PublishDate:    time.Date(1937, time.September, 21, 0, 0, 0, 0, time.UTC),
+				Publisher:      "Allen & Unwin",
+				Series:         "Middle-earth",
+				SeriesPosition: 1,
+				PageCount:      310,
+				ISBN:           "9780261103344",
+				Language:       "en",
+				Description:    "There and back again",
+				Genres:         []domain.GenreRef{{ID: 1, Name: "Fantasy"}},
+				Tags:           []string{"dragons"},
+				CoverURL:       "https://covers.example/hobbit.JPG?size=l",
+			},
+			Links: []Link{
+				{Rel: "alternate", Href: "/opds/books/7", Type: TypeEntry},
+				{Rel: RelBorrow, Href: "/opds/books/7/copies", Type: "application/json", Title: "Copies"},
+			},
+		},
+		{
+			Book: domain.Book{ID: 8, Title: "Dune", Author: "Frank Herbert"},
+			Links: []Link{
+				{Rel: "alternate", Href: "/opds/books/8", Type: TypeEntry},
+				{Rel: RelBorrow, Href: "/opds/books/8/copies", Type: "application/json", Title: "Copies"},
+			},
+		},
+	},
+	Total: 5,
+	Page:  2,
+	Limit: 2,
+}
+
+type atomLinkDoc struct {
+	Rel   string `xml:"rel,attr"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr"`
+}
+
+type atomEntryDoc struct {
+	XMLName    xml.Name       `xml:"http://www.w3.org/2005/Atom entry"`
+	Title      string         `xml:"http://www.w3.org/2005/Atom title"`
+	ID         string         `xml:"http://www.w3.org/2005/Atom id"`
+	Updated    string         `xml:"http://www.w3.org/2005/Atom updated"`
+	Authors    []string       `xml:"http://www.w3.org/2005/Atom author>name"`
+	Identifier string         `xml:"http://purl.org/dc/terms/ identifier"`
+	Issued     string         `xml:"http://purl.org/dc/terms/ issued"`
+	Language   string         `xml:"http://purl.org/dc/terms/ language"`
+	Publisher  string         `xml:"http://purl.org/dc/terms/ publisher"`
+	Categories []atomCategory `xml:"http://www.w3.org/2005/Atom category"`
+	Summary    string         `xml:"http://www.w3.org/2005/Atom summary"`
+	Content    string         `xml:"http://www.w3.org/2005/Atom content"`
+	Links      []atomLinkDoc  `xml:"http://www.w3.org/2005/Atom link"`
+}
+
+type atomFeedDoc struct {
+	XMLName      xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	ID           string         `xml:"http://www.w3.org/2005/Atom id"`
+	Title        string         `xml:"http://www.w3.org/2005/Atom title"`
+	Updated      string         `xml:"http://www.w3.org/2005/Atom updated"`
+	Links        []atomLinkDoc  `xml:"http://www.w3.org/2005/Atom link"`
+	TotalResults *int           `xml:"http://a9.com/-/spec/opensearch/1.1/ totalResults"`
+	ItemsPerPage *int           `xml:"http://a9.com/-/spec/opensearch/1.1/ itemsPerPage"`
+	StartIndex   *int           `xml:"http://a9.com/-/spec/opensearch/1.1/ startIndex"`
+	Entries      []atomEntryDoc `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+func writeAtom(t *testing.T, feed Feed) atomFeedDoc {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteAtom(&buf, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("feed does not start with the XML header:\n%s", buf.String())
+	}
+
+	var doc atomFeedDoc
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+
+	return doc
+}
+
+func ptr(n int) *int { return &n }
+
+func TestWriteAtomNavigation(t *testing.T) {
+	doc := writeAtom(t, navigationFeed)
+
+	if doc.ID != "urn:cruda:opds:authors" || doc.Title != "By author" || doc.Updated != "2024-03-01T11:00:00Z" {
+		t.Errorf("feed = %q, %q, %q", doc.ID, doc.Title, doc.Updated)
+	}
+
+	// the templated search link is left out, Atom readers use OpenSearch
+	wantLinks := []atomLinkDoc{
+		{Rel: "self", Href: "/opds/authors?page=1", Type: TypeNavigation},
+		{Rel: "start", Href: "/opds", Type: TypeNavigation},
+		{Rel: "first", Href: "/opds/authors?page=1", Type: TypeNavigation},
+		{Rel: "next", Href: "/opds/authors?page=2", Type: TypeNavigation},
+		{Rel: "last", Href: "/opds/authors?page=2", Type: TypeNavigation},
+	}
+	if !reflect.DeepEqual(doc.Links, wantLinks) {
+		t.Errorf("links =\n%+v\nwant\n%+v", doc.Links, wantLinks)
+	}
+
+	if !reflect.DeepEqual([]*int{doc.TotalResults, doc.ItemsPerPage, doc.StartIndex}, []*int{ptr(3), ptr(2), ptr(1)}) {
+		t.Errorf("totalResults, itemsPerPage, startIndex = %v, %v, %v", doc.TotalResults, doc.ItemsPerPage, doc.StartIndex)
+	}
+
+	wantEntries := []atomEntryDoc{
+		{ID: "urn:cruda:opds:author:1", Title: "Tolkien & Sons", Content: "Books by <Tolkien>",
+			Links: []atomLinkDoc{{Rel: "subsection", Href: "/opds/authors/1", Type: TypeAcquisition}}},
+		{ID: "urn:cruda:opds:author:2", Title: "Herbert",
+			Links: []atomLinkDoc{{Rel: "subsection", Href: "/opds/authors/2", Type: TypeAcquisition}}},
+	}
+	for i := range doc.Entries {
+		if doc.Entries[i].Updated != doc.Updated {
+			t.Errorf("entry %d updated = %q, want %q", i, doc.Entries[i].Updated, doc.Updated)
+		}
+		doc.Entries[i].XMLName, doc.Entries[i].Updated = xml.Name{}, ""
+	}
+	if !reflect.DeepEqual(doc.Entries, wantEntries) {
+		t.Errorf("entries =\n%+v\nwant\n%+v", doc.Entries, wantEntries)
+	}
+}
+
+func TestWriteAtomAcquisition(t *testing.T) {
+	doc := writeAtom(t, acquisitionFeed)
+
+	var rels []string
+	for _, link := range doc.Links {
+		rels = append(rels, link.Rel+" "+link.Href)
+	}
+	wantRels := []string{
+		"self /opds/books?page=2",
+		"first /opds/books?page=1",
+		"previous /opds/books?page=1",
+		"next /opds/books?page=3",
+		"last /opds/books?page=3",
+	}
+	if !reflect.DeepEqual(rels, wantRels) {
+		t.Errorf("links = %q, want %q", rels, wantRels)
+	}
+
+	// the second page of two books starts with the third
+	if doc.StartIndex == nil || *doc.StartIndex != 3 || *doc.TotalResults != 5 || *doc.ItemsPerPage != 2 {
+		t.Errorf("totalResults, itemsPerPage, startIndex = %v, %v, %v", doc.TotalResults, doc.ItemsPerPage, doc.StartIndex)
+	}
+
+	if len(doc.Entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(doc.Entries))
+	}
+
+	hobbit := doc.Entries[0]
+	hobbit.XMLName = xml.Name{}
+	want := atomEntryDoc{
+		Title:      "The Hobbit",
+		ID:         "urn:cruda:book:7",
+		Updated:    "2024-03-01T11:00:00Z",
+		Authors:    []string{"J. R. R. Tolkien"},
+		Identifier: "urn:isbn:9780261103344",
+		Issued:     "1937-09-21",
+		Language:   "en",
+		Publisher:  "Allen & Unwin",
+		Categories: []atomCategory{{Term: "Fantasy", Label: "Fantasy"}, {Term: "dragons", Label: "dragons"}},
+		Summary:    "There and back again",
+		Links: []atomLinkDoc{
+			{Rel: "alternate", Href: "/opds/books/7", Type: TypeEntry},
+			{Rel: RelBorrow, Href: "/opds/books/7/copies", Type: "application/json", Title: "Copies"},
+			{Rel: RelImage, Href: "https://covers.example/hobbit.JPG?size=l", Type: "image/jpeg"},
+			{Rel: RelThumbnail, Href: "https://covers.example/hobbit.JPG?size=l", Type: "image/jpeg"},
+		},
+	}
+	if !reflect.DeepEqual(hobbit, want) {
+		t.Errorf("entry =\n%+v\nwant\n%+v", hobbit, want)
+	}
+
+	// without linked authors the author field is used
+	if dune := doc.Entries[1]; !reflect.DeepEqual(dune.Authors, []string{"Frank Herbert"}) || dune.Identifier != "" {
+		t.Errorf("entry = %+v", dune)
+	}
+}
+
+func TestWriteAtomUnpaged(t *testing.T) {
+	feed := navigationFeed
+	feed.Limit = 0
+
+	var buf bytes.Buffer
+	if err := WriteAtom(&buf, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), "opensearch:totalResults") {
+		t.Errorf("unpaged feed has OpenSearch elements:\n%s", buf.String())
+	}
+}
+
+func TestWriteAtomEntry(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAtomEntry(&buf, acquisitionFeed.Publications[1], updated); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry atomEntryDoc
+	if err := xml.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+
+	if entry.ID != "urn:cruda:book:8" || entry.Updated != "2024-03-01T11:00:00Z" || len(entry.Links) != 2 {
+		t.Errorf("entry = %+v", entry)
+	}
+}
+
+type jsonFeedDoc struct {
+	Metadata struct {
+		Title         string `json:"title"`
+		NumberOfItems *int   `json:"numberOfItems"`
+		ItemsPerPage  int    `json:"itemsPerPage"`
+		CurrentPage   int    `json:"currentPage"`
+	} `json:"metadata"`
+	Links        []jsonLink        `json:"links"`
+	Navigation   []jsonLink        `json:"navigation"`
+	Publications []json.RawMessage `json:"publications"`
+}
+
+func writeJSON(t *testing.T, feed Feed) (jsonFeedDoc, map[string]json.RawMessage) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc jsonFeedDoc
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc, fields
+}
+
+func TestWriteJSONNavigation(t *testing.T) {
+	doc, fields := writeJSON(t, navigationFeed)
+
+	if _, ok := fields["publications"]; ok {
+		t.Error("navigation feed has publications")
+	}
+
+	if doc.Metadata.Title != "By author" || doc.Metadata.NumberOfItems == nil || *doc.Metadata.NumberOfItems != 3 ||
+		doc.Metadata.ItemsPerPage != 2 || doc.Metadata.CurrentPage != 1 {
+		t.Errorf("metadata = %+v", doc.Metadata)
+	}
+
+	// OPDS 2.0 keeps the templated search link
+	wantLinks := []jsonLink{
+		{Rel: "self", Href: "/opds/authors?page=1", Type: TypeNavigation},
+		{Rel: "start", Href: "/opds", Type: TypeNavigation},
+		{Rel: "search", Href: "/opds/v2/search{?query}", Type: TypeFeed, Templated: true},
+		{Rel: "first", Href: "/opds/authors?page=1", Type: TypeNavigation},
+		{Rel: "next", Href: "/opds/authors?page=2", Type: TypeNavigation},
+		{Rel: "last", Href: "/opds/authors?page=2", Type: TypeNavigation},
+	}
+	if !reflect.DeepEqual(doc.Links, wantLinks) {
+		t.Errorf("links =\n%+v\nwant\n%+v", doc.Links, wantLinks)
+	}
+
+	wantNavigation := []jsonLink{
+		{Rel: "subsection", Href: "/opds/authors/1", Type: TypeAcquisition, Title: "Tolkien & Sons"},
+		{Rel: "subsection", Href: "/opds/authors/2", Type: TypeAcquisition, Title: "Herbert"},
+	}
+	if !reflect.DeepEqual(doc.Navigation, wantNavigation) {
+		t.Errorf("navigation =\n%+v\nwant\n%+v", doc.Navigation, wantNavigation)
+	}
+}
+
+func TestWriteJSONAcquisition(t *testing.T) {
+	doc, fields := writeJSON(t, acquisitionFeed)
+
+	if _, ok := fields["navigation"]; ok {
+		t.Error("acquisition feed has navigation")
+	}
+
+	if *doc.Metadata.NumberOfItems != 5 || doc.Metadata.ItemsPerPage != 2 || doc.Metadata.CurrentPage != 2 {
+		t.Errorf("metadata = %+v", doc.Metadata)
+	}
+
+	var rels []string
+	for _, link := range doc.Links {
+		rels = append(rels, link.Rel+" "+link.Href)
+	}
+	wantRels := []string{
+		"self /opds/books?page=2",
+		"first /opds/books?page=1",
+		"previous /opds/books?page=1",
+		"next /opds/books?page=3",
+		"last /opds/books?page=3",
+	}
+	if !reflect.DeepEqual(rels, wantRels) {
+		t.Errorf("links = %q, want %q", rels, wantRels)
+	}
+
+	if len(doc.Publications) != 2 {
+		t.Fatalf("%d publications, want 2", len(doc.Publications))
+	}
+
+	assertJSON(t, doc.Publications[0], `{
+		"metadata": {
+			"@type": "http://schema.org/Book",
+			"identifier": "urn:isbn:9780261103344",
+			"title": "The Hobbit",
+			"author": [{"name": "J. R. R. Tolkien"}],
+			"publisher": "Allen & Unwin",
+			"language": "en",
+			"published": "1937-09-21",
+			"description": "There and back again",
+			"subject": ["Fantasy", "dragons"],
+			"numberOfPages": 310,
+			"belongsTo": {"series": [{"name": "Middle-earth", "position": 1}]}
+		},
+		"links": [
+			{"rel": "alternate", "href": "/opds/books/7", "type": "application/atom+xml;type=entry;profile=opds-catalog"},
+			{"rel": "http://opds-spec.org/acquisition/borrow", "href": "/opds/books/7/copies", "type": "application/json", "title": "Copies"}
+		],
+		"images": [{"href": "https://covers.example/hobbit.JPG?size=l", "type": "image/jpeg"}]
+	}`)
+
+	// books without an ISBN are identified by their id
+	assertJSON(t, doc.Publications[1], `{
+		"metadata": {
+			"@type": "http://schema.org/Book",
+			"identifier": "urn:cruda:book:8",
+			"title": "Dune",
+			"author": [{"name": "Frank Herbert"}]
+		},
+		"links": [
+			{"rel": "alternate", "href": "/opds/books/8", "type": "application/atom+xml;type=entry;profile=opds-catalog"},
+			{"rel": "http://opds-spec.org/acquisition/borrow", "href": "/opds/books/8/copies", "type": "application/json", "title": "Copies"}
+		]
+	}`)
+}
+
+func TestWriteJSONEmptyAcquisition(t *testing.T) {
+	feed := acquisitionFeed
+	feed.Publications = nil
+	feed.Limit = 0
+
+	_, fields := writeJSON(t, feed)
+
+	if string(fields["publications"]) != "[]" {
+		t.Errorf("publications = %s, want []", fields["publications"])
+	}
+
+	if string(fields["metadata"]) != `{"title":"All books"}` {
+		t.Errorf("metadata of an unpaged feed = %s", fields["metadata"])
+	}
+}
+
+// assertJSON compares a document with the expected one, ignoring layout.
+func assertJSON(t *testing.T, got json.RawMessage, want string) {
+	t.Helper()
+
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("document =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteOpenSearch(t *testing.T) {
+	var buf bytes.Buffer
+	template := "https://library.example/opds/search?q={searchTerms}&page={startPage?}"
+	if err := WriteOpenSearch(&buf, "Library", "Search & find", template); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		XMLName        xml.Name `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+		ShortName      string   `xml:"http://a9.com/-/spec/opensearch/1.1/ ShortName"`
+		Description    string   `xml:"http://a9.com/-/spec/opensearch/1.1/ Description"`
+		InputEncoding  string   `xml:"http://a9.com/-/spec/opensearch/1.1/ InputEncoding"`
+		OutputEncoding string   `xml:"http://a9.com/-/spec/opensearch/1.1/ OutputEncoding"`
+		URLs           []struct {
+			Type     string `xml:"type,attr"`
+			Template string `xml:"template,attr"`
+		} `xml:"http://a9.com/-/spec/opensearch/1.1/ Url"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+
+	if doc.ShortName != "Library" || doc.Description != "Search & find" ||
+		doc.InputEncoding != "UTF-8" || doc.OutputEncoding != "UTF-8" {
+		t.Errorf("description = %+v", doc)
+	}
+
+	if len(doc.URLs) != 1 || doc.URLs[0].Type != TypeAcquisition || doc.URLs[0].Template != template {
+		t.Errorf("urls = %+v", doc.URLs)
+	}
+
+	// the ampersand of the template is escaped in the attribute
+	if !strings.Contains(buf.String(), "{searchTerms}&amp;page=") {
+		t.Errorf("template is not escaped:\n%s", buf.String())
+	}
+}
+
+func TestImageType(t *testing.T) {
+	tests := map[string]string{
+		"https://covers.example/a.png":        "image/png",
+		"https://covers.example/a.jpeg#x":     "image/jpeg",
+		"https://covers.example/a.WEBP?w=100": "image/webp",
+		"https://covers.example/a.gif":        "image/gif",
+		"https://covers.example/cover":        "",
+	}
+
+	for href, want := range tests {
+		if got := imageType(href); got != want {
+			t.Errorf("imageType(%s) = %q, want %q", href, got, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/lib/pq"
+	"time"
+)
+
+type APIKeys struct {
+	db *sql.DB
+}
+
+func NewAPIKeys(db *sql.DB) *APIKeys {
+	return &APIKeys{db: db}
+}
+
+func (r *APIKeys) Create(ctx context.Context, key domain.APIKey) (int64, error) {
+	var id int64
+	err := r.db.QueryRow("INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Scopes), key.ExpiresAt, key.CreatedAt).
+		Scan(&id)
+
+	return id, err
+}
+
+func (r *APIKeys) GetByPrefix(ctx context.Context, prefix string) (domain.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow("SELECT id, user_id, name, prefix, hash, scopes, expires_at, last_used_at, created_at, revoked_at FROM api_keys WHERE prefix = $1", prefix))
+	if err == sql.ErrNoRows {
+		return key, domain.ErrAPIKeyNotFound
+	}
+
+	return key, err
+}
+
+func (r *APIKeys) GetByUser(ctx context.Context, userId int64) ([]domain.APIKey, error) {
+	rows, err := r.db.Query("SELECT id, user_id, name, prefix, hash, scopes, expires_at, last_used_at, created_at, revoked_at FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]domain.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *APIKeys) Revoke(ctx context.Context, userId, id int64) error {
+	res, err := r.db.Exec("UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL",
+		time.Now(), id, userId)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// TouchLastUsed updates last_used_at at most once a minute to avoid a write per request.
+func (r *APIKeys) TouchLastUsed(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.db.Exec("UPDATE api_keys SET last_used_at = $1 WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)",
+		at, id, at.Add(-time.Minute))
+
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (domain.APIKey, error) {
+	var key domain.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, pq.Array(&key.Scopes),
+		&key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt, &key.RevokedAt)
+
+	return key, err
+}
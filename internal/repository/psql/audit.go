@@ -0,0 +1,71 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/dewi911/cruda-app/internal/domain"
+)
+
+type AuditEvents struct {
+	db *sql.DB
+}
+
+func NewAuditEvents(db *sql.DB) *AuditEvents {
+	return &AuditEvents{db: db}
+}
+
+func (r *AuditEvents) Create(ctx context.Context, event domain.AuditEvent) error {
+	var details []byte
+	if event.Details != nil {
+		var err error
+		if details, err = json.Marshal(event.Details); err != nil {
+			return err
+		}
+	}
+
+	_, err := r.db.Exec("INSERT INTO audit_events (actor_id, action, entity, entity_id, details, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		nullInt64(event.ActorID), event.Action, event.Entity, event.EntityID, details, event.CreatedAt)
+
+	return err
+}
+
+// GetByUser returns events done by the user or done to the user.
+func (r *AuditEvents) GetByUser(ctx context.Context, userId int64) ([]domain.AuditEvent, error) {
+	rows, err := r.db.Query(`SELECT id, actor_id, action, entity, entity_id, details, created_at FROM audit_events
+		WHERE actor_id = $1 OR (entity = $2 AND entity_id = $1) ORDER BY id`, userId, domain.AuditEntityUser)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]domain.AuditEvent, 0)
+	for rows.Next() {
+		var event domain.AuditEvent
+		var actorId sql.NullInt64
+		var details []byte
+
+		if err := rows.Scan(&event.ID, &actorId, &event.Action, &event.Entity, &event.EntityID, &details, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		event.ActorID = actorId.Int64
+		if details != nil {
+			if err := json.Unmarshal(details, &event.Details); err != nil {
+				return nil, err
+			}
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
@@ -0,0 +1,169 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"strings"
+)
+
+// Authors are scoped to the organization from the context like books.
+type Authors struct {
+	db *sql.DB
+}
+
+func NewAuthors(db *sql.DB) *Authors {
+	return &Authors{db: db}
+}
+
+const authorColumns = "id, org_id, name, sort_name, bio, birth_date, death_date, created_at"
+
+func (r *Authors) Create(ctx context.Context, author domain.Author) (int64, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = r.db.QueryRow(`INSERT INTO authors (org_id, name, sort_name, bio, birth_date, death_date, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		orgId, author.Name, author.SortName, author.Bio, author.BirthDate, author.DeathDate, author.CreatedAt).Scan(&id)
+
+	return id, err
+}
+
+func (r *Authors) GetByID(ctx context.Context, id int64) (domain.Author, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Author{}, err
+	}
+
+	author, err := scanAuthor(r.db.QueryRow("SELECT "+authorColumns+" FROM authors WHERE id = $1 AND org_id = $2", id, orgId))
+	if err == sql.ErrNoRows {
+		return author, domain.ErrAuthorNotFound
+	}
+
+	return author, err
+}
+
+func (r *Authors) List(ctx context.Context, filter domain.AuthorFilter) ([]domain.Author, int, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := " WHERE org_id = $1"
+	args := []interface{}{orgId}
+
+	if filter.Query != "" {
+		args = append(args, "%"+filter.Query+"%")
+		where += fmt.Sprintf(" AND (name ILIKE $%d OR sort_name ILIKE $%d)", len(args), len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM authors"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset())
+	query := fmt.Sprintf("SELECT %s FROM authors%s ORDER BY sort_name, id LIMIT $%d OFFSET $%d", authorColumns, where, len(args)-1, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	authors := make([]domain.Author, 0)
+	for rows.Next() {
+		author, err := scanAuthor(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		authors = append(authors, author)
+	}
+
+	return authors, total, rows.Err()
+}
+
+func (r *Authors) Update(ctx context.Context, id int64, inp domain.UpdateAuthorInput) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	setValues := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setValues = append(setValues, fmt.Sprintf("%s=$%d", column, len(args)))
+	}
+
+	if inp.Name != nil {
+		set("name", *inp.Name)
+	}
+
+	if inp.SortName != nil {
+		set("sort_name", *inp.SortName)
+	}
+
+	if inp.Bio != nil {
+		set("bio", *inp.Bio)
+	}
+
+	if inp.BirthDate != nil {
+		set("birth_date", *inp.BirthDate)
+	}
+
+	if inp.DeathDate != nil {
+		set("death_date", *inp.DeathDate)
+	}
+
+	if len(setValues) == 0 {
+		_, err := r.GetByID(ctx, id)
+		return err
+	}
+
+	args = append(args, id, orgId)
+	query := fmt.Sprintf("UPDATE authors SET %s WHERE id = $%d AND org_id = $%d", strings.Join(setValues, ", "), len(args)-1, len(args))
+
+	return r.exec(query, args...)
+}
+
+// Delete removes the author and its links to books. The books stay.
+func (r *Authors) Delete(ctx context.Context, id int64) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return r.exec("DELETE FROM authors WHERE id = $1 AND org_id = $2", id, orgId)
+}
+
+func (r *Authors) exec(query string, args ...interface{}) error {
+	res, err := r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrAuthorNotFound
+	}
+
+	return nil
+}
+
+func scanAuthor(row rowScanner) (domain.Author, error) {
+	var a domain.Author
+	err := row.Scan(&a.ID, &a.OrgID, &a.Name, &a.SortName, &a.Bio, &a.BirthDate, &a.DeathDate, &a.CreatedAt)
+
+	return a, err
+}
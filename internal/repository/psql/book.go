@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/lib/pq"
 	"strings"
+	"time"
 )
 
 type Books struct {
@@ -16,83 +18,586 @@ func NewBooks(db *sql.DB) *Books {
 	return &Books{db: db}
 }
 
+// Every query is scoped to the organization from the context, see domain.WithOrgID.
+
+// ratingExpr is the average rating of a book from its review aggregates.
+const ratingExpr = "(CASE WHEN rating_count > 0 THEN rating_sum::float8 / rating_count ELSE 0 END)"
+
+const bookColumns = `id, org_id, title, author, publish_date, ` + ratingExpr + `, rating_count, created_by,
+	COALESCE(isbn, ''), publisher, language, page_count, format, edition, series, series_position, cover_url, description,
+	deleted_at, deleted_by, version`
+
 func (r *Books) Create(ctx context.Context, book domain.Book) error {
-	_, err := r.db.Exec("INSERT INTO books (title, author, publish_date, rating) values ($1, $2, $3, $4)",
-		book.Title, book.Author, book.PublishDate, book.Rating)
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
 
-	return err
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow(`INSERT INTO books (org_id, title, author, publish_date, created_by,
+		isbn, publisher, language, page_count, format, edition, series, series_position, cover_url, description)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id`,
+		orgId, book.Title, book.Author, book.PublishDate, book.CreatedBy,
+		nullString(book.ISBN), book.Publisher, book.Language, book.PageCount, book.Format, book.Edition, book.Series, book.SeriesPosition,
+		book.CoverURL, book.Description).
+		Scan(&id); err != nil {
+		return uniqueViolation(err, domain.ErrISBNTaken)
+	}
+
+	if err := setBookAuthors(tx, orgId, id, book.Authors); err != nil {
+		return err
+	}
+
+	if err := setBookGenres(tx, orgId, id, book.Genres); err != nil {
+		return err
+	}
+
+	if err := setBookTags(tx, orgId, id, book.Tags); err != nil {
+		return err
+	}
+
+	var createdBy int64
+	if book.CreatedBy != nil {
+		createdBy = *book.CreatedBy
+	}
+
+	if err := recordRevision(tx, nil, id, domain.RevisionActionCreate, createdBy, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *Books) GetByID(ctx context.Context, id int64) (domain.Book, error) {
-	var book domain.Book
-	err := r.db.QueryRow("SELECT id, title, author, publish_date, rating  FROM books WHERE id = $1", id).
-		Scan(&book.ID, &book.Title, &book.Author, &book.PublishDate, &book.Rating)
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	books, err := r.query("SELECT "+bookColumns+" FROM books WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL", id, orgId)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	if len(books) == 0 {
+		return domain.Book{}, domain.ErrBookNotFound
+	}
+
+	return books[0], nil
+}
+
+func (r *Books) GetAll(ctx context.Context, filter domain.BookFilter) ([]domain.Book, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := bookFilterWhere(orgId, filter)
+
+	return r.query("SELECT "+bookColumns+" FROM books WHERE "+where+" ORDER BY id", args...)
+}
+
+// List returns a page of the books matching the filter, by title or with
+// the newest additions first.
+func (r *Books) List(ctx context.Context, filter domain.BookFilter, order string, p domain.Pagination) ([]domain.Book, int, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where, args := bookFilterWhere(orgId, filter)
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM books WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	orderBy := "lower(title), id"
+	if order == domain.BookOrderNewest {
+		orderBy = "id DESC"
+	}
+
+	args = append(args, p.Limit, p.Offset())
+	books, err := r.query(fmt.Sprintf("SELECT "+bookColumns+" FROM books WHERE %s ORDER BY %s LIMIT $%d OFFSET $%d",
+		where, orderBy, len(args)-1, len(args)), args...)
+
+	return books, total, err
+}
+
+// GetByAuthor returns books linked to the author in any role.
+func (r *Books) GetByAuthor(ctx context.Context, authorId int64) ([]domain.Book, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.query("SELECT "+bookColumns+` FROM books WHERE org_id = $1 AND deleted_at IS NULL
+		AND id IN (SELECT book_id FROM book_authors WHERE author_id = $2) ORDER BY publish_date, id`, orgId, authorId)
+}
+
+// GetByCreator returns books the user created in any organization. It is
+// used for the user's own data export and is deliberately not org scoped.
+func (r *Books) GetByCreator(ctx context.Context, userId int64) ([]domain.Book, error) {
+	return r.query("SELECT "+bookColumns+" FROM books WHERE created_by = $1 ORDER BY id", userId)
+}
+
+// FindDuplicate returns the id of a catalogued book with the ISBN or, when
+// isbn is empty, with the same title and author ignoring case. It returns 0
+// when there is none.
+func (r *Books) FindDuplicate(ctx context.Context, isbn, title, author string) (int64, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = r.db.QueryRow(`SELECT id FROM books WHERE org_id = $1 AND deleted_at IS NULL
+		AND (isbn = $2 OR ($2 IS NULL AND lower(title) = lower($3) AND lower(author) = lower($4))) ORDER BY id LIMIT 1`,
+		orgId, nullString(isbn), title, author).Scan(&id)
 	if err == sql.ErrNoRows {
-		return book, domain.ErrBookNotFound
+		return 0, nil
 	}
 
-	return book, err
+	return id, err
+}
+
+func (r *Books) query(query string, args ...interface{}) ([]domain.Book, error) {
+	return queryBooks(r.db, query, args...)
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
 }
 
-func (r *Books) GetAll(ctx context.Context) ([]domain.Book, error) {
-	rows, err := r.db.Query("SELECT id, title, author, publish_date, rating  FROM books")
+// queryBooks loads books with their authors, genres and tags.
+func queryBooks(q queryer, query string, args ...interface{}) ([]domain.Book, error) {
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	books := make([]domain.Book, 0)
 	for rows.Next() {
-		var book domain.Book
-		if err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.PublishDate, &book.Rating); err != nil {
+		book, err := scanBook(rows)
+		if err != nil {
 			return nil, err
 		}
 
 		books = append(books, book)
 	}
 
-	return books, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := attachAuthors(q, books); err != nil {
+		return nil, err
+	}
+
+	if err := attachGenres(q, books); err != nil {
+		return nil, err
+	}
+
+	return books, attachTags(q, books)
+}
+
+func scanBook(row rowScanner) (domain.Book, error) {
+	var book domain.Book
+	err := row.Scan(&book.ID, &book.OrgID, &book.Title, &book.Author, &book.PublishDate, &book.Rating, &book.RatingCount, &book.CreatedBy,
+		&book.ISBN, &book.Publisher, &book.Language, &book.PageCount, &book.Format, &book.Edition, &book.Series, &book.SeriesPosition,
+		&book.CoverURL, &book.Description, &book.DeletedAt, &book.DeletedBy, &book.Version)
+
+	return book, err
+}
+
+// attachAuthors loads the linked authors of all books with one query.
+func attachAuthors(q queryer, books []domain.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids, index := bookIndex(books)
+	for i := range books {
+		books[i].Authors = make([]domain.BookAuthor, 0)
+	}
+
+	rows, err := q.Query(`SELECT ba.book_id, a.id, a.name, ba.role FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id WHERE ba.book_id = ANY($1) ORDER BY ba.position, a.sort_name`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookId int64
+		var author domain.BookAuthor
+		if err := rows.Scan(&bookId, &author.AuthorID, &author.Name, &author.Role); err != nil {
+			return err
+		}
+
+		i := index[bookId]
+		books[i].Authors = append(books[i].Authors, author)
+	}
+
+	return rows.Err()
 }
 
-func (r *Books) Delete(ctx context.Context, id int64) error {
-	_, err := r.db.Exec("DELETE FROM books WHERE id = $1", id)
+// setBookAuthors replaces the authors of a book. Authors must belong to the
+// same organization as the book.
+func setBookAuthors(tx *sql.Tx, orgId, bookId int64, authors []domain.BookAuthor) error {
+	if _, err := tx.Exec("DELETE FROM book_authors WHERE book_id = $1", bookId); err != nil {
+		return err
+	}
+
+	for i, author := range authors {
+		res, err := tx.Exec(`INSERT INTO book_authors (book_id, author_id, role, position)
+			SELECT $1, id, $2, $3 FROM authors WHERE id = $4 AND org_id = $5 ON CONFLICT DO NOTHING`,
+			bookId, author.Role, i, author.AuthorID, orgId)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			var exists bool
+			if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM authors WHERE id = $1 AND org_id = $2)",
+				author.AuthorID, orgId).Scan(&exists); err != nil {
+				return err
+			}
+
+			// the same author and role listed twice is not an error
+			if !exists {
+				return domain.ErrAuthorNotFound
+			}
+		}
+	}
+
+	return nil
+}
+
+// Delete moves the book to the trash. Trashed books are left out of every
+// read until they are restored or purged. A non-zero version must match the
+// current version of the book. Books with copies on loan or kept for a hold
+// stay, as purging them would take the circulation records along.
+func (r *Books) Delete(ctx context.Context, id, deletedBy int64, version int) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// copies are locked before the book, as in checkouts and returns
+	if err := lockCopies(tx, orgId, id); err != nil {
+		return err
+	}
+
+	before, err := lockLiveBook(tx, orgId, id)
+	if err != nil {
+		return err
+	}
+
+	if version == 0 {
+		version = before.Version
+	}
 
+	if err := checkNotCirculating(tx, id); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("UPDATE books SET deleted_at = $1, deleted_by = $2, version = version + 1 WHERE id = $3 AND version = $4",
+		time.Now(), deletedBy, id, version)
+	if err != nil {
+		return err
+	}
+
+	if err := versionAffected(res); err != nil {
+		return err
+	}
+
+	if err := recordRevision(tx, &before, id, domain.RevisionActionDelete, deletedBy, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTrash lists trashed books, most recently deleted first.
+func (r *Books) GetTrash(ctx context.Context, p domain.Pagination) ([]domain.Book, int, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM books WHERE org_id = $1 AND deleted_at IS NOT NULL", orgId).
+		Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	books, err := r.query("SELECT "+bookColumns+` FROM books WHERE org_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id DESC LIMIT $2 OFFSET $3`, orgId, p.Limit, p.Offset())
+
+	return books, total, err
+}
+
+// GetTrashedByID returns a book that is in the trash.
+func (r *Books) GetTrashedByID(ctx context.Context, id int64) (domain.Book, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	books, err := r.query("SELECT "+bookColumns+" FROM books WHERE id = $1 AND org_id = $2 AND deleted_at IS NOT NULL", id, orgId)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	if len(books) == 0 {
+		return domain.Book{}, domain.ErrBookNotFound
+	}
+
+	return books[0], nil
+}
+
+// Restore takes the book out of the trash. It fails with ErrISBNTaken when
+// another book got the ISBN in the meantime. A non-zero version must match
+// the current version of the book.
+func (r *Books) Restore(ctx context.Context, actorId, id int64, version int) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockedBook(tx, "SELECT "+bookColumns+" FROM books WHERE id = $1 AND org_id = $2 AND deleted_at IS NOT NULL FOR UPDATE",
+		id, orgId)
+	if err != nil {
+		return err
+	}
+
+	if version == 0 {
+		version = before.Version
+	}
+
+	res, err := tx.Exec("UPDATE books SET deleted_at = NULL, deleted_by = NULL, version = version + 1 WHERE id = $1 AND version = $2",
+		id, version)
+	if err != nil {
+		return uniqueViolation(err, domain.ErrISBNTaken)
+	}
+
+	if err := versionAffected(res); err != nil {
+		return err
+	}
+
+	if err := recordRevision(tx, &before, id, domain.RevisionActionRestore, actorId, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockCopies locks the copies of the book, so no checkout or hold can take
+// them meanwhile.
+func lockCopies(tx *sql.Tx, orgId, bookId int64) error {
+	_, err := tx.Exec("SELECT id FROM copies WHERE book_id = $1 AND org_id = $2 ORDER BY id FOR UPDATE", bookId, orgId)
 	return err
 }
 
-func (r *Books) Update(ctx context.Context, id int64, inp domain.UpdateBookInput) error {
+// checkNotCirculating fails when a copy of the book is on loan or kept for a
+// hold. The copies have to be locked with lockCopies.
+func checkNotCirculating(tx *sql.Tx, bookId int64) error {
+	var onLoan, reserved bool
+	if err := tx.QueryRow(`SELECT
+		EXISTS (SELECT 1 FROM loans l JOIN copies c ON c.id = l.copy_id WHERE c.book_id = $1 AND l.returned_at IS NULL),
+		EXISTS (SELECT 1 FROM holds WHERE book_id = $1 AND status = $2)`,
+		bookId, domain.HoldStatusReady).Scan(&onLoan, &reserved); err != nil {
+		return err
+	}
+
+	switch {
+	case onLoan:
+		return domain.ErrCopyOnLoan
+	case reserved:
+		return domain.ErrCopyReserved
+	default:
+		return nil
+	}
+}
+
+// Purge removes books of every organization that were trashed before the
+// time, together with everything that refers to them. Trashed books are not
+// lent, but a copy added while the book was being trashed can still be kept
+// for a hold, so books with open loans or ready holds are left alone.
+func (r *Books) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return deleteInBatches(ctx, r.db, `DELETE FROM books WHERE id IN (SELECT b.id FROM books b WHERE b.deleted_at < $1
+		AND NOT EXISTS (SELECT 1 FROM loans l JOIN copies c ON c.id = l.copy_id WHERE c.book_id = b.id AND l.returned_at IS NULL)
+		AND NOT EXISTS (SELECT 1 FROM holds h WHERE h.book_id = b.id AND h.status = $2)
+		LIMIT $3)`, before, domain.HoldStatusReady)
+}
+
+// Update changes the book and records the change as a revision by the actor.
+// A non-zero version must match the current version of the book.
+func (r *Books) Update(ctx context.Context, actorId, id int64, version int, inp domain.UpdateBookInput) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockLiveBook(tx, orgId, id)
+	if err != nil {
+		return err
+	}
+
+	if version == 0 {
+		version = before.Version
+	}
+
+	if err := updateBook(tx, orgId, id, version, inp); err != nil {
+		return err
+	}
+
+	if err := recordRevision(tx, &before, id, domain.RevisionActionUpdate, actorId, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateBook applies the set fields of the input to a book locked by the
+// caller if it is still at the version, and moves it to the next version.
+func updateBook(tx *sql.Tx, orgId, id int64, version int, inp domain.UpdateBookInput) error {
 	setValues := make([]string, 0)
 	args := make([]interface{}, 0)
-	argId := 1
+
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setValues = append(setValues, fmt.Sprintf("%s=$%d", column, len(args)))
+	}
 
 	if inp.Title != nil {
-		setValues = append(setValues, fmt.Sprintf("title=$%d", argId))
-		args = append(args, *inp.Title)
-		argId++
+		set("title", *inp.Title)
 	}
 
 	if inp.Author != nil {
-		setValues = append(setValues, fmt.Sprintf("author=$%d", argId))
-		args = append(args, *inp.Author)
-		argId++
+		set("author", *inp.Author)
 	}
 
 	if inp.PublishDate != nil {
-		setValues = append(setValues, fmt.Sprintf("publish_date=$%d", argId))
-		args = append(args, *inp.PublishDate)
-		argId++
+		set("publish_date", *inp.PublishDate)
+	}
+
+	if inp.ISBN != nil {
+		set("isbn", nullString(*inp.ISBN))
+	}
+
+	if inp.Publisher != nil {
+		set("publisher", *inp.Publisher)
+	}
+
+	if inp.Language != nil {
+		set("language", *inp.Language)
+	}
+
+	if inp.PageCount != nil {
+		set("page_count", *inp.PageCount)
+	}
+
+	if inp.Format != nil {
+		set("format", *inp.Format)
+	}
+
+	if inp.Edition != nil {
+		set("edition", *inp.Edition)
 	}
 
-	if inp.Rating != nil {
-		setValues = append(setValues, fmt.Sprintf("rating=$%d", argId))
-		args = append(args, *inp.Rating)
-		argId++
+	if inp.Series != nil {
+		set("series", *inp.Series)
 	}
 
+	if inp.SeriesPosition != nil {
+		set("series_position", *inp.SeriesPosition)
+	}
+
+	if inp.CoverURL != nil {
+		set("cover_url", *inp.CoverURL)
+	}
+
+	if inp.Description != nil {
+		set("description", *inp.Description)
+	}
+
+	setValues = append(setValues, "version = version + 1")
 	setQuery := strings.Join(setValues, ", ")
 
-	query := fmt.Sprintf("UPDATE books SET %s WHERE id = $%d", setQuery, argId)
-	args = append(args, id)
+	args = append(args, id, orgId, version)
+	query := fmt.Sprintf("UPDATE books SET %s WHERE id = $%d AND org_id = $%d AND version = $%d",
+		setQuery, len(args)-2, len(args)-1, len(args))
 
-	_, err := r.db.Exec(query, args...)
-	return err
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return uniqueViolation(err, domain.ErrISBNTaken)
+	}
+
+	if err := versionAffected(res); err != nil {
+		return err
+	}
+
+	if inp.Authors != nil {
+		if err := setBookAuthors(tx, orgId, id, *inp.Authors); err != nil {
+			return err
+		}
+	}
+
+	if inp.Genres != nil {
+		if err := setBookGenres(tx, orgId, id, *inp.Genres); err != nil {
+			return err
+		}
+	}
+
+	if inp.Tags != nil {
+		if err := setBookTags(tx, orgId, id, *inp.Tags); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// versionAffected reports a failed compare and swap on the book version.
+func versionAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrPreconditionFailed
+	}
+
+	return nil
 }
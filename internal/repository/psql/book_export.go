@@ -0,0 +1,90 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+)
+
+// exportBatchSize is the number of books fetched from the cursor at a time.
+const exportBatchSize = 500
+
+// Export calls fn with every book matching the filter in id order. Books are
+// read through a server side cursor, so only one batch is held in memory, and
+// the links of a batch are only loaded when the options ask for them.
+func (r *Books) Export(ctx context.Context, opts domain.ExportOptions, fn func(domain.Book) error) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the cursor and the link queries read the same snapshot
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where, args := bookFilterWhere(orgId, opts.Filter)
+	if _, err := tx.Exec("DECLARE book_export NO SCROLL CURSOR FOR SELECT "+bookColumns+
+		" FROM books WHERE "+where+" ORDER BY id", args...); err != nil {
+		return err
+	}
+
+	for {
+		books, err := fetchBooks(tx, "book_export", exportBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if opts.Authors {
+			if err := attachAuthors(tx, books); err != nil {
+				return err
+			}
+		}
+
+		if opts.Genres {
+			if err := attachGenres(tx, books); err != nil {
+				return err
+			}
+		}
+
+		if opts.Tags {
+			if err := attachTags(tx, books); err != nil {
+				return err
+			}
+		}
+
+		for _, book := range books {
+			if err := fn(book); err != nil {
+				return err
+			}
+		}
+
+		if len(books) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// fetchBooks reads the next books from a cursor over bookColumns.
+func fetchBooks(tx *sql.Tx, cursor string, n int) ([]domain.Book, error) {
+	rows, err := tx.Query(fmt.Sprintf("FETCH %d FROM %s", n, cursor))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := make([]domain.Book, 0, n)
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		books = append(books, book)
+	}
+
+	return books, rows.Err()
+}
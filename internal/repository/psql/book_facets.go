@@ -0,0 +1,145 @@
+package psql
+
+import (
+	"context"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+)
+
+// genreSubtree selects the genre with the id in the parameter and all of its descendants.
+const genreSubtree = `WITH RECURSIVE subtree AS (
+	SELECT id FROM genres WHERE id = $%d AND org_id = $1
+	UNION ALL
+	SELECT g.id FROM genres g JOIN subtree s ON g.parent_id = s.id
+) SELECT id FROM subtree`
+
+// bookFilterWhere builds the conditions of a book filter. The organization is
+// always the first argument and trashed books are left out.
+func bookFilterWhere(orgId int64, filter domain.BookFilter) (string, []interface{}) {
+	where := "org_id = $1 AND deleted_at IS NULL"
+	args := []interface{}{orgId}
+
+	if filter.Query != "" {
+		args = append(args, "%"+filter.Query+"%")
+		where += fmt.Sprintf(" AND (title ILIKE $%d OR author ILIKE $%d)", len(args), len(args))
+	}
+
+	if filter.ISBN != "" {
+		args = append(args, filter.ISBN)
+		where += fmt.Sprintf(" AND isbn = $%d", len(args))
+	}
+
+	if filter.GenreID != 0 {
+		args = append(args, filter.GenreID)
+		where += " AND id IN (SELECT book_id FROM book_genres WHERE genre_id IN (" + fmt.Sprintf(genreSubtree, len(args)) + "))"
+	}
+
+	if filter.Tag != "" {
+		args = append(args, filter.Tag)
+		where += fmt.Sprintf(" AND id IN (SELECT bt.book_id FROM book_tags bt JOIN tags t ON t.id = bt.tag_id WHERE t.org_id = $1 AND t.name = $%d)", len(args))
+	}
+
+	if filter.AuthorID != 0 {
+		args = append(args, filter.AuthorID)
+		where += fmt.Sprintf(" AND id IN (SELECT book_id FROM book_authors WHERE author_id = $%d)", len(args))
+	}
+
+	if filter.Decade != nil {
+		args = append(args, *filter.Decade)
+		where += fmt.Sprintf(" AND "+decadeExpr+" = $%d", len(args))
+	}
+
+	if filter.Rating != nil {
+		args = append(args, *filter.Rating)
+		where += fmt.Sprintf(" AND "+ratingBucketExpr+" = $%d", len(args))
+	}
+
+	return where, args
+}
+
+const (
+	decadeExpr       = "(EXTRACT(YEAR FROM publish_date)::int / 10 * 10)"
+	ratingBucketExpr = "FLOOR" + ratingExpr + "::int"
+)
+
+// Facets counts the books matching the filter by genre, tag, author, decade
+// and rating bucket.
+func (r *Books) Facets(ctx context.Context, filter domain.BookFilter) (domain.BookFacets, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.BookFacets{}, err
+	}
+
+	where, args := bookFilterWhere(orgId, filter)
+	filtered := "filtered AS (SELECT id, publish_date, rating_sum, rating_count FROM books WHERE " + where + ")"
+
+	var facets domain.BookFacets
+
+	if err := r.db.QueryRow("WITH "+filtered+" SELECT COUNT(*) FROM filtered", args...).Scan(&facets.Total); err != nil {
+		return facets, err
+	}
+
+	// every genre is counted with the books of its whole subtree
+	if facets.Genres, err = r.facet(`WITH RECURSIVE `+filtered+`, closure AS (
+			SELECT id AS ancestor, id AS descendant FROM genres WHERE org_id = $1
+			UNION ALL
+			SELECT c.ancestor, g.id FROM closure c JOIN genres g ON g.parent_id = c.descendant
+		)
+		SELECT g.id, g.name, NULL::int, COUNT(DISTINCT f.id) AS n FROM closure c
+		JOIN genres g ON g.id = c.ancestor
+		JOIN book_genres bg ON bg.genre_id = c.descendant
+		JOIN filtered f ON f.id = bg.book_id
+		GROUP BY g.id, g.name ORDER BY n DESC, g.name`, args...); err != nil {
+		return facets, err
+	}
+
+	if facets.Tags, err = r.facet(`WITH `+filtered+`
+		SELECT 0, t.name, NULL::int, COUNT(*) AS n FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		JOIN filtered f ON f.id = bt.book_id
+		GROUP BY t.name ORDER BY n DESC, t.name`, args...); err != nil {
+		return facets, err
+	}
+
+	if facets.Authors, err = r.facet(`WITH `+filtered+`
+		SELECT a.id, a.name, NULL::int, COUNT(DISTINCT f.id) AS n FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		JOIN filtered f ON f.id = ba.book_id
+		GROUP BY a.id, a.name, a.sort_name ORDER BY n DESC, a.sort_name`, args...); err != nil {
+		return facets, err
+	}
+
+	if facets.Decades, err = r.facet(`WITH `+filtered+`
+		SELECT 0, '', `+decadeExpr+` AS v, COUNT(*) FROM filtered GROUP BY v ORDER BY v`, args...); err != nil {
+		return facets, err
+	}
+
+	if facets.Ratings, err = r.facet(`WITH `+filtered+`
+		SELECT 0, '', `+ratingBucketExpr+` AS v, COUNT(*) FROM filtered GROUP BY v ORDER BY v DESC`, args...); err != nil {
+		return facets, err
+	}
+
+	return facets, nil
+}
+
+// facet runs a query returning id, name, value and count columns. Facets
+// that are not about an entity return NULL values.
+func (r *Books) facet(query string, args ...interface{}) ([]domain.FacetCount, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]domain.FacetCount, 0)
+	for rows.Next() {
+		var c domain.FacetCount
+		if err := rows.Scan(&c.ID, &c.Name, &c.Value, &c.Count); err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
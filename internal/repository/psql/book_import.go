@@ -0,0 +1,304 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// importBatchSize keeps the parameters of a multi-row insert well below the
+// limit of the protocol.
+const importBatchSize = 500
+
+// Import inserts the books in batches within one transaction and reports the
+// rows that could not be inserted by their index. Atomic imports and dry runs
+// are rolled back when a row fails or at the end; otherwise the valid rows
+// are committed. progress is called with the number of rows processed after
+// each batch.
+func (r *Books) Import(ctx context.Context, books []domain.Book, opts domain.ImportOptions, progress func(processed int)) (map[int]error, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rowErrs := make(map[int]error)
+	for start := 0; start < len(books); start += importBatchSize {
+		end := min(start+importBatchSize, len(books))
+
+		if err := importBatch(tx, orgId, books[start:end], start, rowErrs); err != nil {
+			return nil, err
+		}
+
+		if progress != nil {
+			progress(end)
+		}
+	}
+
+	if opts.DryRun || (opts.Atomic && len(rowErrs) > 0) {
+		return rowErrs, nil
+	}
+
+	return rowErrs, tx.Commit()
+}
+
+// importBatch inserts the books that link existing authors and genres of the
+// organization with one statement, then their links and first revisions.
+// Books with a catalogued ISBN are skipped.
+func importBatch(tx *sql.Tx, orgId int64, books []domain.Book, offset int, rowErrs map[int]error) error {
+	authorIds := make([]int64, 0)
+	genreIds := make([]int64, 0)
+	for _, book := range books {
+		for _, author := range book.Authors {
+			authorIds = append(authorIds, author.AuthorID)
+		}
+		for _, genre := range book.Genres {
+			genreIds = append(genreIds, genre.ID)
+		}
+	}
+
+	authors, err := existingIds(tx, "SELECT id FROM authors WHERE id = ANY($1) AND org_id = $2", authorIds, orgId)
+	if err != nil {
+		return err
+	}
+
+	genres, err := existingIds(tx, "SELECT id FROM genres WHERE id = ANY($1) AND org_id = $2", genreIds, orgId)
+	if err != nil {
+		return err
+	}
+
+	valid := make([]int, 0, len(books))
+	for i, book := range books {
+		if err := checkImportLinks(book, authors, genres); err != nil {
+			rowErrs[offset+i] = err
+			continue
+		}
+
+		valid = append(valid, i)
+	}
+
+	if len(valid) == 0 {
+		return nil
+	}
+
+	// ids are taken up front so the inserted rows can be told apart from the
+	// skipped ones
+	ids, err := queryIds(tx, "SELECT nextval(pg_get_serial_sequence('books', 'id')) FROM generate_series(1, $1)", len(valid))
+	if err != nil {
+		return err
+	}
+
+	values := make([]string, 0, len(valid))
+	args := make([]interface{}, 0, len(valid)*16)
+	for k, i := range valid {
+		book := books[i]
+		args = append(args, ids[k], orgId, book.Title, book.Author, book.PublishDate, book.CreatedBy,
+			nullString(book.ISBN), book.Publisher, book.Language, book.PageCount, book.Format, book.Edition, book.Series,
+			book.SeriesPosition, book.CoverURL, book.Description)
+		values = append(values, valuesRow(len(args)-15, 16))
+	}
+
+	inserted, err := queryIds(tx, `INSERT INTO books (id, org_id, title, author, publish_date, created_by,
+		isbn, publisher, language, page_count, format, edition, series, series_position, cover_url, description)
+		VALUES `+strings.Join(values, ", ")+` ON CONFLICT DO NOTHING RETURNING id`, args...)
+	if err != nil {
+		return err
+	}
+
+	done := make(map[int64]bool, len(inserted))
+	for _, id := range inserted {
+		done[id] = true
+	}
+
+	linked := make([]domain.Book, 0, len(inserted))
+	for k, i := range valid {
+		if !done[ids[k]] {
+			rowErrs[offset+i] = domain.ErrISBNTaken
+			continue
+		}
+
+		book := books[i]
+		book.ID = ids[k]
+		linked = append(linked, book)
+	}
+
+	if err := insertImportLinks(tx, orgId, linked); err != nil {
+		return err
+	}
+
+	return insertImportRevisions(tx, inserted, linked)
+}
+
+func checkImportLinks(book domain.Book, authors, genres map[int64]bool) error {
+	for _, author := range book.Authors {
+		if !authors[author.AuthorID] {
+			return domain.ErrAuthorNotFound
+		}
+	}
+
+	for _, genre := range book.Genres {
+		if !genres[genre.ID] {
+			return domain.ErrGenreNotFound
+		}
+	}
+
+	return nil
+}
+
+func insertImportLinks(tx *sql.Tx, orgId int64, books []domain.Book) error {
+	var authorBooks, authorIds, positions, genreBooks, genreIds, tagBooks []int64
+	var roles, tags []string
+
+	for _, book := range books {
+		for i, author := range book.Authors {
+			authorBooks = append(authorBooks, book.ID)
+			authorIds = append(authorIds, author.AuthorID)
+			roles = append(roles, author.Role)
+			positions = append(positions, int64(i))
+		}
+
+		for _, genre := range book.Genres {
+			genreBooks = append(genreBooks, book.ID)
+			genreIds = append(genreIds, genre.ID)
+		}
+
+		for _, tag := range book.Tags {
+			tagBooks = append(tagBooks, book.ID)
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(authorBooks) > 0 {
+		if _, err := tx.Exec(`INSERT INTO book_authors (book_id, author_id, role, position)
+			SELECT * FROM unnest($1::int[], $2::int[], $3::text[], $4::int[]) ON CONFLICT DO NOTHING`,
+			pq.Array(authorBooks), pq.Array(authorIds), pq.Array(roles), pq.Array(positions)); err != nil {
+			return err
+		}
+	}
+
+	if len(genreBooks) > 0 {
+		if _, err := tx.Exec(`INSERT INTO book_genres (book_id, genre_id)
+			SELECT * FROM unnest($1::int[], $2::int[]) ON CONFLICT DO NOTHING`,
+			pq.Array(genreBooks), pq.Array(genreIds)); err != nil {
+			return err
+		}
+	}
+
+	if len(tagBooks) > 0 {
+		if _, err := tx.Exec("INSERT INTO tags (org_id, name) SELECT DISTINCT $1::int, unnest($2::text[]) ON CONFLICT DO NOTHING",
+			orgId, pq.Array(tags)); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`INSERT INTO book_tags (book_id, tag_id)
+			SELECT u.book_id, t.id FROM unnest($1::int[], $2::text[]) AS u(book_id, name)
+			JOIN tags t ON t.org_id = $3 AND t.name = u.name ON CONFLICT DO NOTHING`,
+			pq.Array(tagBooks), pq.Array(tags), orgId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertImportRevisions records the first revision of the imported books.
+func insertImportRevisions(tx *sql.Tx, ids []int64, imported []domain.Book) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	books, err := queryBooks(tx, "SELECT "+bookColumns+" FROM books WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	actors := make(map[int64]int64, len(imported))
+	for _, book := range imported {
+		if book.CreatedBy != nil {
+			actors[book.ID] = *book.CreatedBy
+		}
+	}
+
+	now := time.Now()
+	values := make([]string, 0, len(books))
+	args := make([]interface{}, 0, len(books)*6)
+	for _, book := range books {
+		changes, err := domain.DiffBooks(domain.Book{}, book)
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := json.Marshal(book)
+		if err != nil {
+			return err
+		}
+
+		args = append(args, book.ID, domain.RevisionActionCreate, nullInt64(actors[book.ID]),
+			pq.Array(domain.ChangedFields(changes)), snapshot, now)
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, 1, $%d, $%d, $%d, $%d, $%d)", n-5, n-4, n-3, n-2, n-1, n))
+	}
+
+	_, err = tx.Exec(`INSERT INTO book_revisions (book_id, revision, action, actor_id, changed, snapshot, created_at)
+		VALUES `+strings.Join(values, ", "), args...)
+
+	return err
+}
+
+func existingIds(tx *sql.Tx, query string, ids []int64, orgId int64) (map[int64]bool, error) {
+	existing := make(map[int64]bool)
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	found, err := queryIds(tx, query, pq.Array(distinct(ids)), orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range found {
+		existing[id] = true
+	}
+
+	return existing, nil
+}
+
+func queryIds(tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// valuesRow returns a row of n placeholders starting at $first.
+func valuesRow(first, n int) string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", first+i)
+	}
+
+	return "(" + strings.Join(placeholders, ", ") + ")"
+}
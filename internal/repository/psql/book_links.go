@@ -0,0 +1,149 @@
+package psql
+
+import (
+	"database/sql"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/lib/pq"
+)
+
+// attachGenres loads the genres of all books with one query.
+func attachGenres(q queryer, books []domain.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids, index := bookIndex(books)
+	for i := range books {
+		books[i].Genres = make([]domain.GenreRef, 0)
+	}
+
+	rows, err := q.Query(`SELECT bg.book_id, g.id, g.name FROM book_genres bg
+		JOIN genres g ON g.id = bg.genre_id WHERE bg.book_id = ANY($1) ORDER BY g.name`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookId int64
+		var genre domain.GenreRef
+		if err := rows.Scan(&bookId, &genre.ID, &genre.Name); err != nil {
+			return err
+		}
+
+		i := index[bookId]
+		books[i].Genres = append(books[i].Genres, genre)
+	}
+
+	return rows.Err()
+}
+
+// attachTags loads the tags of all books with one query.
+func attachTags(q queryer, books []domain.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids, index := bookIndex(books)
+	for i := range books {
+		books[i].Tags = make([]string, 0)
+	}
+
+	rows, err := q.Query(`SELECT bt.book_id, t.name FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id WHERE bt.book_id = ANY($1) ORDER BY t.name`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookId int64
+		var tag string
+		if err := rows.Scan(&bookId, &tag); err != nil {
+			return err
+		}
+
+		i := index[bookId]
+		books[i].Tags = append(books[i].Tags, tag)
+	}
+
+	return rows.Err()
+}
+
+func bookIndex(books []domain.Book) ([]int64, map[int64]int) {
+	ids := make([]int64, len(books))
+	index := make(map[int64]int, len(books))
+	for i := range books {
+		ids[i] = books[i].ID
+		index[books[i].ID] = i
+	}
+
+	return ids, index
+}
+
+// setBookGenres replaces the genres of a book. Genres must belong to the
+// same organization as the book.
+func setBookGenres(tx *sql.Tx, orgId, bookId int64, genres []domain.GenreRef) error {
+	if _, err := tx.Exec("DELETE FROM book_genres WHERE book_id = $1", bookId); err != nil {
+		return err
+	}
+
+	if len(genres) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(genres))
+	for i, genre := range genres {
+		ids[i] = genre.ID
+	}
+
+	var found int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM genres WHERE id = ANY($1) AND org_id = $2", pq.Array(ids), orgId).
+		Scan(&found); err != nil {
+		return err
+	}
+
+	if found != len(distinct(ids)) {
+		return domain.ErrGenreNotFound
+	}
+
+	_, err := tx.Exec("INSERT INTO book_genres (book_id, genre_id) SELECT $1, unnest($2::int[]) ON CONFLICT DO NOTHING",
+		bookId, pq.Array(ids))
+
+	return err
+}
+
+// setBookTags replaces the tags of a book, creating tags that do not exist yet.
+func setBookTags(tx *sql.Tx, orgId, bookId int64, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM book_tags WHERE book_id = $1", bookId); err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec("INSERT INTO tags (org_id, name) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING",
+		orgId, pq.Array(tags)); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`INSERT INTO book_tags (book_id, tag_id)
+		SELECT $1, id FROM tags WHERE org_id = $2 AND name = ANY($3) ON CONFLICT DO NOTHING`,
+		bookId, orgId, pq.Array(tags))
+
+	return err
+}
+
+func distinct(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
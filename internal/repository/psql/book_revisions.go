@@ -0,0 +1,204 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/lib/pq"
+	"time"
+)
+
+const revisionColumns = "book_id, revision, action, actor_id, changed, reverted_to, created_at"
+
+// lockLiveBook loads a book that is not in the trash and locks its row until
+// the transaction ends.
+func lockLiveBook(tx *sql.Tx, orgId, id int64) (domain.Book, error) {
+	return lockedBook(tx, "SELECT "+bookColumns+" FROM books WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL FOR UPDATE",
+		id, orgId)
+}
+
+func lockedBook(tx *sql.Tx, query string, args ...interface{}) (domain.Book, error) {
+	books, err := queryBooks(tx, query, args...)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	if len(books) == 0 {
+		return domain.Book{}, domain.ErrBookNotFound
+	}
+
+	return books[0], nil
+}
+
+// recordRevision snapshots the book as it is now in the transaction. before
+// is the state the changes are listed against, nil for a new book. Updates
+// that change nothing are not recorded.
+func recordRevision(tx *sql.Tx, before *domain.Book, bookId int64, action string, actorId int64, revertedTo *int) error {
+	after, err := lockedBook(tx, "SELECT "+bookColumns+" FROM books WHERE id = $1", bookId)
+	if err != nil {
+		return err
+	}
+
+	if before == nil {
+		return insertRevision(tx, domain.Book{}, after, action, actorId, revertedTo)
+	}
+
+	// books created before revisions were kept get their previous state as
+	// the first revision, so the change does not lose it
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM book_revisions WHERE book_id = $1)", bookId).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		var createdBy int64
+		if before.CreatedBy != nil {
+			createdBy = *before.CreatedBy
+		}
+
+		if err := insertRevision(tx, domain.Book{}, *before, domain.RevisionActionCreate, createdBy, nil); err != nil {
+			return err
+		}
+	}
+
+	return insertRevision(tx, *before, after, action, actorId, revertedTo)
+}
+
+func insertRevision(tx *sql.Tx, before, after domain.Book, action string, actorId int64, revertedTo *int) error {
+	changes, err := domain.DiffBooks(before, after)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 && action == domain.RevisionActionUpdate {
+		return nil
+	}
+
+	snapshot, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	// the book row is locked, so numbers cannot be taken twice
+	_, err = tx.Exec(`INSERT INTO book_revisions (book_id, revision, action, actor_id, changed, reverted_to, snapshot, created_at)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5, $6, $7 FROM book_revisions WHERE book_id = $1`,
+		after.ID, action, nullInt64(actorId), pq.Array(domain.ChangedFields(changes)), revertedTo, snapshot, time.Now())
+
+	return err
+}
+
+// GetRevisions lists the revisions of a book that is not in the trash, newest first.
+func (r *Books) GetRevisions(ctx context.Context, bookId int64, p domain.Pagination) ([]domain.BookRevision, int, error) {
+	if _, err := r.GetByID(ctx, bookId); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM book_revisions WHERE book_id = $1", bookId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query("SELECT "+revisionColumns+` FROM book_revisions WHERE book_id = $1
+		ORDER BY revision DESC LIMIT $2 OFFSET $3`, bookId, p.Limit, p.Offset())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	revisions := make([]domain.BookRevision, 0)
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, total, rows.Err()
+}
+
+// GetRevision returns a revision with the snapshot of the book.
+func (r *Books) GetRevision(ctx context.Context, bookId int64, revision int) (domain.BookRevision, error) {
+	if _, err := r.GetByID(ctx, bookId); err != nil {
+		return domain.BookRevision{}, err
+	}
+
+	return getRevision(r.db.QueryRow("SELECT "+revisionColumns+", snapshot FROM book_revisions WHERE book_id = $1 AND revision = $2",
+		bookId, revision))
+}
+
+// GetLatestRevision returns the newest revision with the snapshot of the book.
+func (r *Books) GetLatestRevision(ctx context.Context, bookId int64) (domain.BookRevision, error) {
+	if _, err := r.GetByID(ctx, bookId); err != nil {
+		return domain.BookRevision{}, err
+	}
+
+	return getRevision(r.db.QueryRow("SELECT "+revisionColumns+`, snapshot FROM book_revisions WHERE book_id = $1
+		ORDER BY revision DESC LIMIT 1`, bookId))
+}
+
+// Revert sets the editable fields of the book back to their values in the
+// revision and records that as a new revision.
+func (r *Books) Revert(ctx context.Context, actorId, id int64, revision, version int) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockLiveBook(tx, orgId, id)
+	if err != nil {
+		return err
+	}
+
+	rev, err := getRevision(tx.QueryRow("SELECT "+revisionColumns+", snapshot FROM book_revisions WHERE book_id = $1 AND revision = $2",
+		id, revision))
+	if err != nil {
+		return err
+	}
+
+	if version == 0 {
+		version = before.Version
+	}
+
+	if err := updateBook(tx, orgId, id, version, rev.Book.Input()); err != nil {
+		return err
+	}
+
+	if err := recordRevision(tx, &before, id, domain.RevisionActionRevert, actorId, &revision); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func getRevision(row rowScanner) (domain.BookRevision, error) {
+	var snapshot []byte
+	rev, err := scanRevision(row, &snapshot)
+	if err == sql.ErrNoRows {
+		return rev, domain.ErrRevisionNotFound
+	}
+
+	if err != nil {
+		return rev, err
+	}
+
+	rev.Book = new(domain.Book)
+
+	return rev, json.Unmarshal(snapshot, rev.Book)
+}
+
+func scanRevision(row rowScanner, extra ...interface{}) (domain.BookRevision, error) {
+	var rev domain.BookRevision
+	err := row.Scan(append([]interface{}{&rev.BookID, &rev.Revision, &rev.Action, &rev.ActorID, pq.Array(&rev.Changed),
+		&rev.RevertedTo, &rev.CreatedAt}, extra...)...)
+
+	return rev, err
+}
@@ -0,0 +1,516 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// Circulation stores copies and their loans, scoped to the organization from
+// the context. Changes of loans lock the copy, so a copy is never lent twice.
+type Circulation struct {
+	db *sql.DB
+}
+
+func NewCirculation(db *sql.DB) *Circulation {
+	return &Circulation{db: db}
+}
+
+const copyColumns = "id, book_id, barcode, location, condition, created_at"
+
+// The borrower of a returned loan is cleared when their account is deleted,
+// so the history of the copy stays.
+const loanColumns = `l.id, l.copy_id, c.book_id, b.title, c.barcode, COALESCE(l.borrower_id, 0), COALESCE(u.name, ''),
+	l.checked_out_by, l.checked_out_at, l.due_at, l.renewals, l.returned_at, l.returned_by, l.overdue_at`
+
+const loanFrom = ` FROM loans l JOIN copies c ON c.id = l.copy_id JOIN books b ON b.id = c.book_id
+	LEFT JOIN users u ON u.id = l.borrower_id`
+
+// CreateCopy adds a copy of a book. A new copy of a book with waiting holds
+// is kept for the first of them right away.
+func (r *Circulation) CreateCopy(ctx context.Context, c domain.Copy, pickupWindow time.Duration) (int64, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO copies (org_id, book_id, barcode, location, condition, created_at)
+		SELECT org_id, id, $1, $2, $3, $4 FROM books WHERE id = $5 AND org_id = $6 AND deleted_at IS NULL RETURNING id`,
+		c.Barcode, c.Location, c.Condition, c.CreatedAt, c.BookID, orgId).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, domain.ErrBookNotFound
+	}
+	if err != nil {
+		return 0, uniqueViolation(err, domain.ErrBarcodeTaken)
+	}
+
+	if _, err := assignCopy(tx, c.BookID, id, pickupWindow); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *Circulation) GetCopy(ctx context.Context, id int64) (domain.Copy, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Copy{}, err
+	}
+
+	copies, err := r.copies("SELECT "+copyColumns+" FROM copies WHERE id = $1 AND org_id = $2", id, orgId)
+	if err != nil {
+		return domain.Copy{}, err
+	}
+
+	if len(copies) == 0 {
+		return domain.Copy{}, domain.ErrCopyNotFound
+	}
+
+	return copies[0], nil
+}
+
+func (r *Circulation) GetCopies(ctx context.Context, bookId int64) ([]domain.Copy, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	if err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL)", bookId, orgId).
+		Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, domain.ErrBookNotFound
+	}
+
+	return r.copies("SELECT "+copyColumns+" FROM copies WHERE book_id = $1 AND org_id = $2 ORDER BY barcode", bookId, orgId)
+}
+
+func (r *Circulation) UpdateCopy(ctx context.Context, id int64, inp domain.UpdateCopyInput) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	setValues := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setValues = append(setValues, fmt.Sprintf("%s=$%d", column, len(args)))
+	}
+
+	if inp.Barcode != nil {
+		set("barcode", *inp.Barcode)
+	}
+
+	if inp.Location != nil {
+		set("location", *inp.Location)
+	}
+
+	if inp.Condition != nil {
+		set("condition", *inp.Condition)
+	}
+
+	if len(setValues) == 0 {
+		_, err := r.GetCopy(ctx, id)
+		return err
+	}
+
+	args = append(args, id, orgId)
+	res, err := r.db.Exec(fmt.Sprintf("UPDATE copies SET %s WHERE id = $%d AND org_id = $%d",
+		strings.Join(setValues, ", "), len(args)-1, len(args)), args...)
+	if err != nil {
+		return uniqueViolation(err, domain.ErrBarcodeTaken)
+	}
+
+	return copyAffected(res)
+}
+
+// DeleteCopy removes a copy that is neither on loan nor kept for a hold,
+// together with its loan history.
+func (r *Circulation) DeleteCopy(ctx context.Context, id int64) error {
+	return r.inTx(ctx, id, func(tx *sql.Tx, c lockedCopy) error {
+		if c.onLoan {
+			return domain.ErrCopyOnLoan
+		}
+
+		var reserved bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM holds WHERE copy_id = $1 AND status = $2)",
+			id, domain.HoldStatusReady).Scan(&reserved); err != nil {
+			return err
+		}
+
+		if reserved {
+			return domain.ErrCopyReserved
+		}
+
+		_, err := tx.Exec("DELETE FROM copies WHERE id = $1", id)
+		return err
+	})
+}
+
+// Checkout lends the copy to the borrower, who must be a member of the
+// organization. The membership is locked while the open loans are counted
+// against the limit of the borrower's role, so concurrent checkouts cannot
+// exceed it. A copy kept for a hold can only be lent to the holder, and the
+// borrower's hold on the book is fulfilled. Copies of trashed books are not
+// lent.
+func (r *Circulation) Checkout(ctx context.Context, loan domain.Loan, policy domain.LoanPolicy) (int64, error) {
+	var id int64
+
+	err := r.inTx(ctx, loan.CopyID, func(tx *sql.Tx, c lockedCopy) error {
+		if c.trashed {
+			return domain.ErrBookNotFound
+		}
+
+		if c.onLoan {
+			return domain.ErrCopyOnLoan
+		}
+
+		orgId := c.orgId
+
+		var role string
+		if err := tx.QueryRow("SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2 FOR UPDATE",
+			orgId, loan.BorrowerID).Scan(&role); err != nil {
+			if err == sql.ErrNoRows {
+				return domain.ErrNotOrgMember
+			}
+			return err
+		}
+
+		if limit := policy.Limit(role); limit > 0 {
+			var open int
+			if err := tx.QueryRow("SELECT COUNT(*) FROM loans WHERE org_id = $1 AND borrower_id = $2 AND returned_at IS NULL",
+				orgId, loan.BorrowerID).Scan(&open); err != nil {
+				return err
+			}
+
+			if open >= limit {
+				return domain.ErrLoanLimitReached
+			}
+		}
+
+		if err := fulfillHold(tx, c.bookId, loan.CopyID, loan.BorrowerID, policy.PickupWindow); err != nil {
+			return err
+		}
+
+		err := tx.QueryRow(`INSERT INTO loans (org_id, copy_id, borrower_id, checked_out_by, checked_out_at, due_at)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			orgId, loan.CopyID, loan.BorrowerID, loan.CheckedOutBy, loan.CheckedOutAt, loan.DueAt).Scan(&id)
+
+		return uniqueViolation(err, domain.ErrCopyOnLoan)
+	})
+
+	return id, err
+}
+
+// Return closes the loan and records the condition of the copy when it is
+// set. The copy is then kept for the first waiting hold on the book, whose id
+// is returned, or 0 when nobody is waiting.
+func (r *Circulation) Return(ctx context.Context, loan domain.Loan, returnedBy int64, condition string, pickupWindow time.Duration) (int64, error) {
+	var holdId int64
+
+	err := r.inTx(ctx, loan.CopyID, func(tx *sql.Tx, c lockedCopy) error {
+		res, err := tx.Exec("UPDATE loans SET returned_at = $1, returned_by = $2 WHERE id = $3 AND returned_at IS NULL",
+			time.Now(), returnedBy, loan.ID)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return domain.ErrLoanReturned
+		}
+
+		if condition != "" {
+			if _, err := tx.Exec("UPDATE copies SET condition = $1 WHERE id = $2", condition, loan.CopyID); err != nil {
+				return err
+			}
+		}
+
+		holdId, err = assignCopy(tx, c.bookId, loan.CopyID, pickupWindow)
+		return err
+	})
+
+	return holdId, err
+}
+
+// Renew moves the due date of an open loan unless it was renewed maxRenewals
+// times already or others are waiting for the book.
+func (r *Circulation) Renew(ctx context.Context, id int64, dueAt time.Time, maxRenewals int) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.db.Exec(`UPDATE loans l SET due_at = $1, renewals = renewals + 1
+		WHERE l.id = $2 AND l.org_id = $3 AND l.returned_at IS NULL AND l.renewals < $4
+		AND NOT EXISTS (SELECT 1 FROM holds h JOIN copies c ON c.book_id = h.book_id WHERE c.id = l.copy_id AND h.status = $5)`,
+		dueAt, id, orgId, maxRenewals, domain.HoldStatusWaiting)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	loan, err := r.GetLoan(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if loan.ReturnedAt != nil {
+		return domain.ErrLoanReturned
+	}
+
+	if loan.Renewals >= maxRenewals {
+		return domain.ErrRenewalLimitReached
+	}
+
+	return domain.ErrHoldsWaiting
+}
+
+func (r *Circulation) GetLoan(ctx context.Context, id int64) (domain.Loan, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+
+	loans, err := r.loans("SELECT "+loanColumns+loanFrom+" WHERE l.id = $1 AND l.org_id = $2", id, orgId)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+
+	if len(loans) == 0 {
+		return domain.Loan{}, domain.ErrLoanNotFound
+	}
+
+	return loans[0], nil
+}
+
+// GetOpenLoan returns the loan the copy is currently on.
+func (r *Circulation) GetOpenLoan(ctx context.Context, copyId int64) (domain.Loan, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+
+	loans, err := r.loans("SELECT "+loanColumns+loanFrom+" WHERE l.copy_id = $1 AND l.org_id = $2 AND l.returned_at IS NULL",
+		copyId, orgId)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+
+	if len(loans) == 0 {
+		return domain.Loan{}, domain.ErrLoanNotFound
+	}
+
+	return loans[0], nil
+}
+
+// GetLoans lists loans, most recent first, or by due date for overdue loans.
+func (r *Circulation) GetLoans(ctx context.Context, filter domain.LoanFilter) ([]domain.Loan, int, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := " WHERE l.org_id = $1"
+	args := []interface{}{orgId}
+	order := "l.checked_out_at DESC, l.id DESC"
+
+	if filter.BorrowerID != 0 {
+		args = append(args, filter.BorrowerID)
+		where += fmt.Sprintf(" AND l.borrower_id = $%d", len(args))
+	}
+
+	if filter.CopyID != 0 {
+		args = append(args, filter.CopyID)
+		where += fmt.Sprintf(" AND l.copy_id = $%d", len(args))
+	}
+
+	if filter.Open || filter.Overdue {
+		where += " AND l.returned_at IS NULL"
+	}
+
+	if filter.Overdue {
+		args = append(args, time.Now())
+		where += fmt.Sprintf(" AND l.due_at < $%d", len(args))
+		order = "l.due_at, l.id"
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+loanFrom+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset())
+	loans, err := r.loans(fmt.Sprintf("SELECT %s%s%s ORDER BY %s LIMIT $%d OFFSET $%d",
+		loanColumns, loanFrom, where, order, len(args)-1, len(args)), args...)
+
+	return loans, total, err
+}
+
+// GetByUser returns the user's loans in every organization for the data export.
+func (r *Circulation) GetByUser(ctx context.Context, userId int64) ([]domain.Loan, error) {
+	return r.loans("SELECT "+loanColumns+loanFrom+" WHERE l.borrower_id = $1 ORDER BY l.id", userId)
+}
+
+// MarkOverdue flags open loans of every organization that are past due and
+// were not flagged yet, and returns them.
+func (r *Circulation) MarkOverdue(ctx context.Context, now time.Time) ([]domain.Loan, error) {
+	loans, err := r.loans(`WITH marked AS (
+			UPDATE loans SET overdue_at = $1 WHERE returned_at IS NULL AND due_at < $1 AND overdue_at IS NULL RETURNING id
+		) SELECT `+loanColumns+loanFrom+` WHERE l.id IN (SELECT id FROM marked) ORDER BY l.id`, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// the select sees the rows as they were before the update
+	for i := range loans {
+		loans[i].OverdueAt = &now
+	}
+
+	return loans, nil
+}
+
+// lockedCopy is the state of the copy locked by inTx.
+type lockedCopy struct {
+	orgId   int64
+	bookId  int64
+	onLoan  bool
+	trashed bool
+}
+
+// inTx runs fn with the copy locked. The book is read after the lock is
+// taken, so a book trashed meanwhile is seen as trashed.
+func (r *Circulation) inTx(ctx context.Context, copyId int64, fn func(tx *sql.Tx, c lockedCopy) error) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	c := lockedCopy{orgId: orgId}
+	if err := tx.QueryRow("SELECT book_id FROM copies WHERE id = $1 AND org_id = $2 FOR UPDATE", copyId, orgId).
+		Scan(&c.bookId); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrCopyNotFound
+		}
+		return err
+	}
+
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM loans WHERE copy_id = $1 AND returned_at IS NULL),
+		(SELECT deleted_at IS NOT NULL FROM books WHERE id = $2)`, copyId, c.bookId).Scan(&c.onLoan, &c.trashed); err != nil {
+		return err
+	}
+
+	if err := fn(tx, c); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Circulation) copies(query string, args ...interface{}) ([]domain.Copy, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	copies := make([]domain.Copy, 0)
+	for rows.Next() {
+		var c domain.Copy
+		if err := rows.Scan(&c.ID, &c.BookID, &c.Barcode, &c.Location, &c.Condition, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		copies = append(copies, c)
+	}
+
+	if err := rows.Err(); err != nil || len(copies) == 0 {
+		return copies, err
+	}
+
+	return copies, r.attachLoans(copies)
+}
+
+// attachLoans sets the open loan of each copy.
+func (r *Circulation) attachLoans(copies []domain.Copy) error {
+	ids := make([]int64, 0, len(copies))
+	index := make(map[int64]int, len(copies))
+	for i, c := range copies {
+		ids = append(ids, c.ID)
+		index[c.ID] = i
+	}
+
+	loans, err := r.loans("SELECT "+loanColumns+loanFrom+" WHERE l.copy_id = ANY($1) AND l.returned_at IS NULL", pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	for i := range loans {
+		copies[index[loans[i].CopyID]].Loan = &loans[i]
+	}
+
+	return nil
+}
+
+func (r *Circulation) loans(query string, args ...interface{}) ([]domain.Loan, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loans := make([]domain.Loan, 0)
+	for rows.Next() {
+		var l domain.Loan
+		if err := rows.Scan(&l.ID, &l.CopyID, &l.BookID, &l.Title, &l.Barcode, &l.BorrowerID, &l.BorrowerName, &l.CheckedOutBy,
+			&l.CheckedOutAt, &l.DueAt, &l.Renewals, &l.ReturnedAt, &l.ReturnedBy, &l.OverdueAt); err != nil {
+			return nil, err
+		}
+
+		loans = append(loans, l)
+	}
+
+	return loans, rows.Err()
+}
+
+func copyAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrCopyNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+type Erasures struct {
+	db *sql.DB
+}
+
+func NewErasures(db *sql.DB) *Erasures {
+	return &Erasures{db: db}
+}
+
+const erasureColumns = "id, user_id, status, step, error, status_token, requested_at, updated_at, completed_at"
+
+// Create adds a job and disables the user in one transaction, unless an
+// unfinished job for the user already exists.
+func (r *Erasures) Create(ctx context.Context, job domain.ErasureJob) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the user row serializes concurrent requests of the same user
+	if _, err := tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", job.UserID); err != nil {
+		return 0, err
+	}
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM erasure_jobs WHERE user_id = $1 AND status IN ($2, $3))",
+		job.UserID, domain.ErasureStatusPending, domain.ErasureStatusRunning).Scan(&exists); err != nil {
+		return 0, err
+	}
+
+	if exists {
+		return 0, domain.ErrErasureInProgress
+	}
+
+	if _, err := tx.Exec("UPDATE users SET disabled_at = COALESCE(disabled_at, $1) WHERE id = $2", job.RequestedAt, job.UserID); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	if err := tx.QueryRow("INSERT INTO erasure_jobs (user_id, status, status_token, requested_at, updated_at) VALUES ($1, $2, $3, $4, $4) RETURNING id",
+		job.UserID, domain.ErasureStatusPending, job.StatusToken, job.RequestedAt).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *Erasures) GetByID(ctx context.Context, id int64) (domain.ErasureJob, error) {
+	return r.get("SELECT "+erasureColumns+" FROM erasure_jobs WHERE id = $1", id)
+}
+
+func (r *Erasures) GetByToken(ctx context.Context, token string) (domain.ErasureJob, error) {
+	return r.get("SELECT "+erasureColumns+" FROM erasure_jobs WHERE status_token = $1", token)
+}
+
+// Claim takes the oldest unfinished job whose lease has run out, so jobs
+// interrupted by a restart are picked up again.
+func (r *Erasures) Claim(ctx context.Context, lease time.Duration) (domain.ErasureJob, error) {
+	now := time.Now()
+
+	return r.get(fmt.Sprintf(`UPDATE erasure_jobs SET status = $1, locked_until = $2, updated_at = $3
+		WHERE id = (
+			SELECT id FROM erasure_jobs
+			WHERE status IN ($4, $1) AND (locked_until IS NULL OR locked_until < $3)
+			ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED
+		) RETURNING %s`, erasureColumns),
+		domain.ErasureStatusRunning, now.Add(lease), now, domain.ErasureStatusPending)
+}
+
+func (r *Erasures) SetStep(ctx context.Context, id int64, step int, lease time.Duration) error {
+	now := time.Now()
+	_, err := r.db.Exec("UPDATE erasure_jobs SET step = $1, locked_until = $2, updated_at = $3 WHERE id = $4",
+		step, now.Add(lease), now, id)
+
+	return err
+}
+
+func (r *Erasures) Complete(ctx context.Context, id int64) error {
+	now := time.Now()
+	_, err := r.db.Exec("UPDATE erasure_jobs SET status = $1, locked_until = NULL, updated_at = $2, completed_at = $2 WHERE id = $3",
+		domain.ErasureStatusCompleted, now, id)
+
+	return err
+}
+
+func (r *Erasures) Fail(ctx context.Context, id int64, reason string) error {
+	_, err := r.db.Exec("UPDATE erasure_jobs SET status = $1, error = $2, locked_until = NULL, updated_at = $3 WHERE id = $4",
+		domain.ErasureStatusFailed, reason, time.Now(), id)
+
+	return err
+}
+
+// RevokeAccess removes everything that lets the user sign in.
+func (r *Erasures) RevokeAccess(ctx context.Context, userId int64) error {
+	return r.inTx(
+		"DELETE FROM refresh_tokens WHERE user_id = $1",
+		"DELETE FROM api_keys WHERE user_id = $1",
+		"DELETE FROM user_identities WHERE user_id = $1",
+		"DELETE FROM mfa_recovery_codes WHERE user_id = $1",
+		"DELETE FROM user_mfa WHERE user_id = $1",
+		"DELETE FROM email_verifications WHERE user_id = $1",
+		"DELETE FROM org_members WHERE user_id = $1",
+	)(userId)
+}
+
+// DetachOwnership drops references from catalog data to the user and removes
+// the user's reviews, shelves and reading history. Waiting holds are
+// cancelled and ready ones left to lapse, so their copies go to the next hold.
+func (r *Erasures) DetachOwnership(ctx context.Context, userId int64) error {
+	return r.inTx(
+		"UPDATE books SET created_by = NULL WHERE created_by = $1",
+		"UPDATE books SET deleted_by = NULL WHERE deleted_by = $1",
+		"UPDATE book_revisions SET actor_id = NULL WHERE actor_id = $1",
+		"UPDATE book_imports SET created_by = NULL WHERE created_by = $1",
+		"UPDATE org_invitations SET invited_by = NULL WHERE invited_by = $1",
+		deleteUserReviews,
+		"DELETE FROM shelves WHERE user_id = $1",
+		"DELETE FROM reading_status WHERE user_id = $1",
+		"UPDATE holds SET status = 'cancelled', closed_at = NOW() WHERE user_id = $1 AND status = 'waiting'",
+		"UPDATE holds SET expires_at = NOW() WHERE user_id = $1 AND status = 'ready'",
+	)(userId)
+}
+
+// Anonymize overwrites personal data in the users row. The row itself stays
+// so that audit events keep pointing at a valid, now anonymous, user.
+func (r *Erasures) Anonymize(ctx context.Context, userId int64) error {
+	now := time.Now()
+	_, err := r.db.Exec(`UPDATE users SET name = 'Erased user', email = 'erased-' || id || '@erased.invalid', password = '!',
+		disabled_at = COALESCE(disabled_at, $1), erased_at = $1 WHERE id = $2`, now, userId)
+
+	return err
+}
+
+func (r *Erasures) inTx(queries ...string) func(userId int64) error {
+	return func(userId int64) error {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, query := range queries {
+			if _, err := tx.Exec(query, userId); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+}
+
+func (r *Erasures) get(query string, args ...interface{}) (domain.ErasureJob, error) {
+	var job domain.ErasureJob
+	err := r.db.QueryRow(query, args...).
+		Scan(&job.ID, &job.UserID, &job.Status, &job.Step, &job.Error, &job.StatusToken, &job.RequestedAt, &job.UpdatedAt, &job.CompletedAt)
+	if err == sql.ErrNoRows {
+		return job, domain.ErrErasureJobNotFound
+	}
+
+	return job, err
+}
@@ -0,0 +1,209 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"strings"
+)
+
+// Genres are scoped to the organization from the context like books.
+type Genres struct {
+	db *sql.DB
+}
+
+func NewGenres(db *sql.DB) *Genres {
+	return &Genres{db: db}
+}
+
+const genreColumns = "id, org_id, parent_id, name, slug, created_at"
+
+func (r *Genres) Create(ctx context.Context, genre domain.Genre) (int64, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if genre.ParentID != nil {
+		if _, err := r.GetByID(ctx, *genre.ParentID); err != nil {
+			return 0, err
+		}
+	}
+
+	var id int64
+	err = r.db.QueryRow("INSERT INTO genres (org_id, parent_id, name, slug, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		orgId, genre.ParentID, genre.Name, genre.Slug, genre.CreatedAt).Scan(&id)
+
+	return id, uniqueViolation(err, domain.ErrGenreSlugTaken)
+}
+
+func (r *Genres) GetByID(ctx context.Context, id int64) (domain.Genre, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Genre{}, err
+	}
+
+	var g domain.Genre
+	err = r.db.QueryRow("SELECT "+genreColumns+" FROM genres WHERE id = $1 AND org_id = $2", id, orgId).
+		Scan(&g.ID, &g.OrgID, &g.ParentID, &g.Name, &g.Slug, &g.CreatedAt)
+	if err == sql.ErrNoRows {
+		return g, domain.ErrGenreNotFound
+	}
+
+	return g, err
+}
+
+// GetAll returns the whole taxonomy ordered by name. Clients build the tree
+// from parent ids.
+func (r *Genres) GetAll(ctx context.Context) ([]domain.Genre, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query("SELECT "+genreColumns+" FROM genres WHERE org_id = $1 ORDER BY name, id", orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := make([]domain.Genre, 0)
+	for rows.Next() {
+		var g domain.Genre
+		if err := rows.Scan(&g.ID, &g.OrgID, &g.ParentID, &g.Name, &g.Slug, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, g)
+	}
+
+	return genres, rows.Err()
+}
+
+func (r *Genres) Update(ctx context.Context, id int64, inp domain.UpdateGenreInput) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// lock the taxonomy so that concurrent moves cannot build a cycle
+	if _, err := tx.Exec("SELECT id FROM genres WHERE org_id = $1 FOR UPDATE", orgId); err != nil {
+		return err
+	}
+
+	setValues := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setValues = append(setValues, fmt.Sprintf("%s=$%d", column, len(args)))
+	}
+
+	if inp.Name != nil {
+		set("name", *inp.Name)
+	}
+
+	if inp.Slug != nil {
+		set("slug", *inp.Slug)
+	}
+
+	if inp.ParentID != nil {
+		if *inp.ParentID == 0 {
+			set("parent_id", nil)
+		} else {
+			if err := checkGenreParent(tx, orgId, id, *inp.ParentID); err != nil {
+				return err
+			}
+			set("parent_id", *inp.ParentID)
+		}
+	}
+
+	if len(setValues) == 0 {
+		if _, err := r.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	args = append(args, id, orgId)
+	query := fmt.Sprintf("UPDATE genres SET %s WHERE id = $%d AND org_id = $%d", strings.Join(setValues, ", "), len(args)-1, len(args))
+
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return uniqueViolation(err, domain.ErrGenreSlugTaken)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return domain.ErrGenreNotFound
+	}
+
+	return tx.Commit()
+}
+
+// checkGenreParent makes sure the new parent exists and is not the genre itself
+// or one of its descendants.
+func checkGenreParent(tx *sql.Tx, orgId, id, parentId int64) error {
+	var exists, cycle bool
+	err := tx.QueryRow(`WITH RECURSIVE subtree AS (
+			SELECT id FROM genres WHERE id = $1 AND org_id = $3
+			UNION ALL
+			SELECT g.id FROM genres g JOIN subtree s ON g.parent_id = s.id
+		)
+		SELECT EXISTS (SELECT 1 FROM genres WHERE id = $2 AND org_id = $3),
+			EXISTS (SELECT 1 FROM subtree WHERE id = $2)`, id, parentId, orgId).Scan(&exists, &cycle)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return domain.ErrGenreNotFound
+	}
+
+	if cycle {
+		return domain.ErrGenreCycle
+	}
+
+	return nil
+}
+
+// Delete removes the genre and moves its children up to its parent.
+func (r *Genres) Delete(ctx context.Context, id int64) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentId sql.NullInt64
+	if err := tx.QueryRow("SELECT parent_id FROM genres WHERE id = $1 AND org_id = $2 FOR UPDATE", id, orgId).
+		Scan(&parentId); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrGenreNotFound
+		}
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE genres SET parent_id = $1 WHERE parent_id = $2", parentId, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM genres WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,313 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+// The book row is the lock of its hold queue: every change that hands a copy
+// to the queue or checks whether one is free locks it, after any copy and
+// hold rows it needs. Waiting holds are picked with SKIP LOCKED, so a hold
+// that is being cancelled concurrently is passed over instead of waited for.
+
+// Like loans, closed holds stay without a user when the account is deleted.
+const holdColumns = `h.id, h.book_id, b.title, COALESCE(h.user_id, 0), COALESCE(u.name, ''), h.status,
+	CASE WHEN h.status = 'waiting' THEN (SELECT COUNT(*) FROM holds w WHERE w.book_id = h.book_id AND w.status = 'waiting'
+		AND (w.created_at, w.id) <= (h.created_at, h.id)) END,
+	h.copy_id, h.created_at, h.ready_at, h.expires_at, h.closed_at`
+
+const holdFrom = " FROM holds h JOIN books b ON b.id = h.book_id LEFT JOIN users u ON u.id = h.user_id"
+
+// PlaceHold queues the user for a book whose copies are all on loan or kept
+// for other holds.
+func (r *Circulation) PlaceHold(ctx context.Context, hold domain.Hold) (int64, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockBook(ctx, tx, hold.BookID); err != nil {
+		return 0, err
+	}
+
+	var held, borrowed bool
+	if err := tx.QueryRow(`SELECT
+			EXISTS (SELECT 1 FROM holds WHERE book_id = $1 AND user_id = $2 AND status IN ($3, $4)),
+			EXISTS (SELECT 1 FROM loans l JOIN copies c ON c.id = l.copy_id
+				WHERE c.book_id = $1 AND l.borrower_id = $2 AND l.returned_at IS NULL)`,
+		hold.BookID, hold.UserID, domain.HoldStatusWaiting, domain.HoldStatusReady).Scan(&held, &borrowed); err != nil {
+		return 0, err
+	}
+
+	if held {
+		return 0, domain.ErrHoldExists
+	}
+
+	if borrowed {
+		return 0, domain.ErrAlreadyBorrowed
+	}
+
+	var total, available int
+	if err := tx.QueryRow(`SELECT COUNT(*), COUNT(*) FILTER (WHERE
+			NOT EXISTS (SELECT 1 FROM loans l WHERE l.copy_id = c.id AND l.returned_at IS NULL)
+			AND NOT EXISTS (SELECT 1 FROM holds h WHERE h.copy_id = c.id AND h.status = $2))
+		FROM copies c WHERE c.book_id = $1`, hold.BookID, domain.HoldStatusReady).Scan(&total, &available); err != nil {
+		return 0, err
+	}
+
+	if total == 0 {
+		return 0, domain.ErrNoCopies
+	}
+
+	if available > 0 {
+		return 0, domain.ErrCopyAvailable
+	}
+
+	var id int64
+	if err := tx.QueryRow(`INSERT INTO holds (org_id, book_id, user_id, status, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		orgId, hold.BookID, hold.UserID, domain.HoldStatusWaiting, hold.CreatedAt).Scan(&id); err != nil {
+		return 0, uniqueViolation(err, domain.ErrHoldExists)
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *Circulation) GetHold(ctx context.Context, id int64) (domain.Hold, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	holds, err := r.holds("SELECT "+holdColumns+holdFrom+" WHERE h.id = $1 AND h.org_id = $2", id, orgId)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	if len(holds) == 0 {
+		return domain.Hold{}, domain.ErrHoldNotFound
+	}
+
+	return holds[0], nil
+}
+
+// GetHolds lists holds, active ones in queue order and closed ones after them.
+func (r *Circulation) GetHolds(ctx context.Context, filter domain.HoldFilter) ([]domain.Hold, int, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := " WHERE h.org_id = $1"
+	args := []interface{}{orgId}
+
+	if filter.UserID != 0 {
+		args = append(args, filter.UserID)
+		where += fmt.Sprintf(" AND h.user_id = $%d", len(args))
+	}
+
+	if filter.BookID != 0 {
+		args = append(args, filter.BookID)
+		where += fmt.Sprintf(" AND h.book_id = $%d", len(args))
+	}
+
+	if filter.Active {
+		args = append(args, domain.HoldStatusWaiting, domain.HoldStatusReady)
+		where += fmt.Sprintf(" AND h.status IN ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+holdFrom+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset())
+	holds, err := r.holds(fmt.Sprintf(`SELECT %s%s%s ORDER BY h.closed_at IS NOT NULL, h.closed_at DESC, h.created_at, h.id
+		LIMIT $%d OFFSET $%d`, holdColumns, holdFrom, where, len(args)-1, len(args)), args...)
+
+	return holds, total, err
+}
+
+// GetHoldsByUser returns the user's holds in every organization for the data export.
+func (r *Circulation) GetHoldsByUser(ctx context.Context, userId int64) ([]domain.Hold, error) {
+	return r.holds("SELECT "+holdColumns+holdFrom+" WHERE h.user_id = $1 ORDER BY h.id", userId)
+}
+
+// CancelHold closes an active hold. A copy kept for it goes to the next hold.
+func (r *Circulation) CancelHold(ctx context.Context, id int64, pickupWindow time.Duration) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := closeHold(tx, "h.id = $1 AND h.org_id = $2", []interface{}{id, orgId}, domain.HoldStatusCancelled, pickupWindow); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrHoldNotFound
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ExpireHolds lapses ready holds that were not picked up in time in every
+// organization, one per transaction, and passes their copies on. It returns
+// the lapsed holds.
+func (r *Circulation) ExpireHolds(ctx context.Context, pickupWindow time.Duration) ([]int64, error) {
+	expired := make([]int64, 0)
+
+	for {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return expired, err
+		}
+
+		id, err := closeHold(tx, `h.id = (SELECT id FROM holds WHERE status = $1 AND expires_at < $2
+			ORDER BY expires_at LIMIT 1 FOR UPDATE SKIP LOCKED)`,
+			[]interface{}{domain.HoldStatusReady, time.Now()}, domain.HoldStatusExpired, pickupWindow)
+		if err == nil {
+			err = tx.Commit()
+		}
+		tx.Rollback()
+
+		if err == sql.ErrNoRows {
+			return expired, nil
+		}
+
+		if err != nil {
+			return expired, err
+		}
+
+		expired = append(expired, id)
+	}
+}
+
+// closeHold locks the hold matched by where, closes it with the status and
+// hands a copy kept for it to the queue. It returns sql.ErrNoRows when no
+// hold matches.
+func closeHold(tx *sql.Tx, where string, args []interface{}, status string, pickupWindow time.Duration) (int64, error) {
+	var id, bookId int64
+	var current string
+	var copyId sql.NullInt64
+
+	if err := tx.QueryRow("SELECT h.id, h.book_id, h.status, h.copy_id FROM holds h WHERE "+where+" FOR UPDATE", args...).
+		Scan(&id, &bookId, &current, &copyId); err != nil {
+		return 0, err
+	}
+
+	if current != domain.HoldStatusWaiting && current != domain.HoldStatusReady {
+		return 0, domain.ErrHoldClosed
+	}
+
+	if _, err := tx.Exec("UPDATE holds SET status = $1, closed_at = $2 WHERE id = $3", status, time.Now(), id); err != nil {
+		return 0, err
+	}
+
+	if current == domain.HoldStatusReady && copyId.Valid {
+		if _, err := assignCopy(tx, bookId, copyId.Int64, pickupWindow); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// fulfillHold checks that the copy is not kept for someone other than the
+// borrower and closes the borrower's active hold on the book. When the hold
+// kept a different copy, that copy goes to the next hold.
+func fulfillHold(tx *sql.Tx, bookId, copyId, borrowerId int64, pickupWindow time.Duration) error {
+	var holder int64
+	err := tx.QueryRow("SELECT user_id FROM holds WHERE copy_id = $1 AND status = $2 FOR UPDATE", copyId, domain.HoldStatusReady).
+		Scan(&holder)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if err == nil && holder != borrowerId {
+		return domain.ErrCopyReserved
+	}
+
+	var id int64
+	var kept sql.NullInt64
+	err = tx.QueryRow("SELECT id, copy_id FROM holds WHERE book_id = $1 AND user_id = $2 AND status IN ($3, $4) FOR UPDATE",
+		bookId, borrowerId, domain.HoldStatusWaiting, domain.HoldStatusReady).Scan(&id, &kept)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE holds SET status = $1, copy_id = $2, closed_at = $3 WHERE id = $4",
+		domain.HoldStatusFulfilled, copyId, time.Now(), id); err != nil {
+		return err
+	}
+
+	if !kept.Valid || kept.Int64 == copyId {
+		return nil
+	}
+
+	_, err = assignCopy(tx, bookId, kept.Int64, pickupWindow)
+	return err
+}
+
+// assignCopy keeps a free copy for the first waiting hold on the book and
+// returns the hold, or 0 when nobody is waiting.
+func assignCopy(tx *sql.Tx, bookId, copyId int64, pickupWindow time.Duration) (int64, error) {
+	if _, err := tx.Exec("SELECT id FROM books WHERE id = $1 FOR UPDATE", bookId); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM holds WHERE book_id = $1 AND status = $2
+		ORDER BY created_at, id LIMIT 1 FOR UPDATE SKIP LOCKED`, bookId, domain.HoldStatusWaiting).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec("UPDATE holds SET status = $1, copy_id = $2, ready_at = $3, expires_at = $4 WHERE id = $5",
+		domain.HoldStatusReady, copyId, now, now.Add(pickupWindow), id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *Circulation) holds(query string, args ...interface{}) ([]domain.Hold, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := make([]domain.Hold, 0)
+	for rows.Next() {
+		var h domain.Hold
+		if err := rows.Scan(&h.ID, &h.BookID, &h.Title, &h.UserID, &h.UserName, &h.Status, &h.Position, &h.CopyID,
+			&h.CreatedAt, &h.ReadyAt, &h.ExpiresAt, &h.ClosedAt); err != nil {
+			return nil, err
+		}
+
+		holds = append(holds, h)
+	}
+
+	return holds, rows.Err()
+}
@@ -0,0 +1,53 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dewi911/cruda-app/internal/domain"
+)
+
+type Identities struct {
+	db *sql.DB
+}
+
+func NewIdentities(db *sql.DB) *Identities {
+	return &Identities{db: db}
+}
+
+func (r *Identities) Create(ctx context.Context, identity domain.Identity) error {
+	_, err := r.db.Exec("INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES ($1, $2, $3, $4, $5)",
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt)
+
+	return err
+}
+
+func (r *Identities) Get(ctx context.Context, provider, subject string) (domain.Identity, error) {
+	var identity domain.Identity
+	err := r.db.QueryRow("SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE provider = $1 AND subject = $2", provider, subject).
+		Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if err == sql.ErrNoRows {
+		return identity, domain.ErrIdentityNotFound
+	}
+
+	return identity, err
+}
+
+func (r *Identities) GetByUser(ctx context.Context, userId int64) ([]domain.Identity, error) {
+	rows, err := r.db.Query("SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE user_id = $1 ORDER BY id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make([]domain.Identity, 0)
+	for rows.Next() {
+		var identity domain.Identity
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
@@ -0,0 +1,95 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+// Imports stores the progress and reports of async bulk imports in the
+// organization from the context.
+type Imports struct {
+	db *sql.DB
+}
+
+func NewImports(db *sql.DB) *Imports {
+	return &Imports{db: db}
+}
+
+// Create stores a running import that holds the lease until it makes progress.
+func (r *Imports) Create(ctx context.Context, imp domain.BookImport, lease time.Duration) (int64, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = r.db.QueryRow(`INSERT INTO book_imports (org_id, created_by, status, format, dry_run, atomic, total, created_at,
+		locked_until) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		orgId, imp.CreatedBy, imp.Status, imp.Format, imp.DryRun, imp.Atomic, imp.Total, imp.CreatedAt,
+		imp.CreatedAt.Add(lease)).Scan(&id)
+
+	return id, err
+}
+
+// SetProgress records the processed rows and renews the lease.
+func (r *Imports) SetProgress(ctx context.Context, id int64, processed int, lease time.Duration) error {
+	_, err := r.db.Exec("UPDATE book_imports SET processed = $1, locked_until = $2 WHERE id = $3",
+		processed, time.Now().Add(lease), id)
+
+	return err
+}
+
+// FailInterrupted fails running imports of every organization whose lease
+// ran out, as the process that ran them is gone.
+func (r *Imports) FailInterrupted(ctx context.Context) (int64, error) {
+	now := time.Now()
+
+	res, err := r.db.Exec(`UPDATE book_imports SET status = $1, error = 'interrupted', finished_at = $2
+		WHERE status = $3 AND (locked_until IS NULL OR locked_until < $2)`,
+		domain.ImportStatusFailed, now, domain.ImportStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// Finish stores the report of a finished import.
+func (r *Imports) Finish(ctx context.Context, imp domain.BookImport) error {
+	errs, err := json.Marshal(imp.Errors)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`UPDATE book_imports SET status = $1, processed = $2, imported = $3, failed = $4, errors = $5,
+		error = $6, finished_at = $7 WHERE id = $8`,
+		imp.Status, imp.Processed, imp.Imported, imp.Failed, errs, imp.Error, imp.FinishedAt, imp.ID)
+
+	return err
+}
+
+func (r *Imports) Get(ctx context.Context, id int64) (domain.BookImport, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.BookImport{}, err
+	}
+
+	var imp domain.BookImport
+	var errs []byte
+	err = r.db.QueryRow(`SELECT id, status, format, dry_run, atomic, created_by, total, processed, imported, failed,
+		errors, error, created_at, finished_at FROM book_imports WHERE id = $1 AND org_id = $2`, id, orgId).
+		Scan(&imp.ID, &imp.Status, &imp.Format, &imp.DryRun, &imp.Atomic, &imp.CreatedBy, &imp.Total, &imp.Processed,
+			&imp.Imported, &imp.Failed, &errs, &imp.Error, &imp.CreatedAt, &imp.FinishedAt)
+	if err == sql.ErrNoRows {
+		return imp, domain.ErrImportNotFound
+	}
+
+	if err != nil {
+		return imp, err
+	}
+
+	return imp, json.Unmarshal(errs, &imp.Errors)
+}
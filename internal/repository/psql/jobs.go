@@ -0,0 +1,195 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+)
+
+// jobLockSpace is the first key of the job advisory locks, the second one is
+// the hash of the job name.
+const jobLockSpace = 4201
+
+type Jobs struct {
+	db *sql.DB
+}
+
+func NewJobs(db *sql.DB) *Jobs {
+	return &Jobs{db: db}
+}
+
+const jobRunColumns = "id, job, trigger, status, triggered_by, scheduled_at, started_at, finished_at, error, result"
+
+// TryLock takes the session level advisory lock of the job on a dedicated
+// connection, so only one replica runs the job at a time. The lock is held
+// until unlock is called or the connection is lost.
+func (r *Jobs) TryLock(ctx context.Context, job string) (unlock func(), ok bool, err error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, hashtext($2))", jobLockSpace, job).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1, hashtext($2))", jobLockSpace, job); err != nil {
+			// drop the connection instead of returning it to the pool with the lock held
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, true, nil
+}
+
+// StartRun records a run of a job whose lock the caller holds. Runs left
+// running by a crashed process are failed first. Scheduled runs return
+// ErrJobRunExists when the job already ran at the scheduled time.
+func (r *Jobs) StartRun(ctx context.Context, run domain.JobRun) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE job_runs SET status = $1, error = 'interrupted', finished_at = $2 WHERE job = $3 AND status = $4",
+		domain.JobStatusFailed, run.StartedAt, run.Job, domain.JobStatusRunning); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO job_runs (job, trigger, status, triggered_by, scheduled_at, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (job, scheduled_at) WHERE trigger = 'schedule' DO NOTHING RETURNING id`,
+		run.Job, run.Trigger, run.Status, run.TriggeredBy, run.ScheduledAt, run.StartedAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, domain.ErrJobRunExists
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *Jobs) FinishRun(ctx context.Context, run domain.JobRun) error {
+	var result []byte
+	if run.Result != nil {
+		var err error
+		if result, err = json.Marshal(run.Result); err != nil {
+			return err
+		}
+	}
+
+	_, err := r.db.Exec("UPDATE job_runs SET status = $1, finished_at = $2, error = $3, result = $4 WHERE id = $5",
+		run.Status, run.FinishedAt, run.Error, result, run.ID)
+
+	return err
+}
+
+func (r *Jobs) GetRuns(ctx context.Context, filter domain.JobRunFilter) ([]domain.JobRun, int, error) {
+	where := " WHERE TRUE"
+	args := make([]interface{}, 0)
+
+	if filter.Job != "" {
+		args = append(args, filter.Job)
+		where += fmt.Sprintf(" AND job = $%d", len(args))
+	}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM job_runs"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset())
+	runs, err := r.runs(fmt.Sprintf("SELECT %s FROM job_runs%s ORDER BY id DESC LIMIT $%d OFFSET $%d",
+		jobRunColumns, where, len(args)-1, len(args)), args...)
+
+	return runs, total, err
+}
+
+// GetLastRuns returns the latest run of every job that ran at least once.
+func (r *Jobs) GetLastRuns(ctx context.Context) (map[string]domain.JobRun, error) {
+	runs, err := r.runs("SELECT DISTINCT ON (job) " + jobRunColumns + " FROM job_runs ORDER BY job, id DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	last := make(map[string]domain.JobRun, len(runs))
+	for _, run := range runs {
+		last[run.Job] = run
+	}
+
+	return last, nil
+}
+
+func (r *Jobs) runs(query string, args ...interface{}) ([]domain.JobRun, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]domain.JobRun, 0)
+	for rows.Next() {
+		var run domain.JobRun
+		var result []byte
+
+		if err := rows.Scan(&run.ID, &run.Job, &run.Trigger, &run.Status, &run.TriggeredBy, &run.ScheduledAt, &run.StartedAt,
+			&run.FinishedAt, &run.Error, &result); err != nil {
+			return nil, err
+		}
+
+		if result != nil {
+			if err := json.Unmarshal(result, &run.Result); err != nil {
+				return nil, err
+			}
+		}
+
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// deleteBatchSize keeps cleanup statements short so they do not hold locks
+// for long and can be interrupted by the job timeout.
+const deleteBatchSize = 1000
+
+// deleteInBatches runs a DELETE limited by deleteBatchSize until nothing is
+// left and returns the number of deleted rows.
+func deleteInBatches(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int64, error) {
+	var deleted int64
+
+	for {
+		res, err := db.ExecContext(ctx, query, append(args, deleteBatchSize)...)
+		if err != nil {
+			return deleted, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted += n
+		if n < deleteBatchSize {
+			return deleted, nil
+		}
+	}
+}
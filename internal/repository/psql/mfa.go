@@ -0,0 +1,176 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+type MFA struct {
+	db *sql.DB
+}
+
+func NewMFA(db *sql.DB) *MFA {
+	return &MFA{db: db}
+}
+
+// Save stores a new, not yet confirmed secret, replacing an unconfirmed one.
+func (r *MFA) Save(ctx context.Context, mfa domain.UserMFA) error {
+	_, err := r.db.Exec(`INSERT INTO user_mfa (user_id, secret, enabled, created_at) VALUES ($1, $2, FALSE, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, enabled = FALSE, last_step = 0,
+		attempts = 0, locked_until = NULL, created_at = EXCLUDED.created_at, confirmed_at = NULL`,
+		mfa.UserID, mfa.Secret, mfa.CreatedAt)
+
+	return err
+}
+
+func (r *MFA) Get(ctx context.Context, userId int64) (domain.UserMFA, error) {
+	var mfa domain.UserMFA
+	err := r.db.QueryRow("SELECT user_id, secret, enabled, last_step, created_at, confirmed_at FROM user_mfa WHERE user_id = $1", userId).
+		Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastStep, &mfa.CreatedAt, &mfa.ConfirmedAt)
+	if err == sql.ErrNoRows {
+		return mfa, domain.ErrMFANotEnrolled
+	}
+
+	return mfa, err
+}
+
+func (r *MFA) Enable(ctx context.Context, userId int64, step int64, recoveryCodes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE user_mfa SET enabled = TRUE, last_step = $1, confirmed_at = $2 WHERE user_id = $3",
+		step, time.Now(), userId); err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userId, recoveryCodes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records the time step of an accepted code. It fails if a code
+// from the same or a later step was already accepted.
+func (r *MFA) UseStep(ctx context.Context, userId int64, step int64) error {
+	res, err := r.db.Exec("UPDATE user_mfa SET last_step = $1 WHERE user_id = $2 AND last_step < $1", step, userId)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrMFACodeAlreadyUsed
+	}
+
+	return nil
+}
+
+func (r *MFA) ReplaceRecoveryCodes(ctx context.Context, userId int64, codes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userId, codes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code as used.
+func (r *MFA) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error {
+	res, err := r.db.Exec("UPDATE mfa_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL",
+		time.Now(), userId, codeHash)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// TakeAttempt counts a code about to be checked. The attempt that reaches
+// max locks verification until the lockout has passed; attempts while locked
+// fail with ErrMFALocked.
+func (r *MFA) TakeAttempt(ctx context.Context, userId int64, max int, lockout time.Duration) error {
+	now := time.Now()
+	res, err := r.db.Exec(`UPDATE user_mfa SET
+		attempts = CASE WHEN attempts + 1 >= $1 THEN 0 ELSE attempts + 1 END,
+		locked_until = CASE WHEN attempts + 1 >= $1 THEN $2::timestamp END
+		WHERE user_id = $3 AND (locked_until IS NULL OR locked_until <= $4)`,
+		max, now.Add(lockout), userId, now)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrMFALocked
+	}
+
+	return nil
+}
+
+// ResetAttempts clears the attempts after a code was accepted, including the
+// lockout when it was the last attempt allowed.
+func (r *MFA) ResetAttempts(ctx context.Context, userId int64) error {
+	_, err := r.db.Exec("UPDATE user_mfa SET attempts = 0, locked_until = NULL WHERE user_id = $1", userId)
+
+	return err
+}
+
+func (r *MFA) Delete(ctx context.Context, userId int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = $1", userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userId int64, codes []string) error {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userId); err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userId, code); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
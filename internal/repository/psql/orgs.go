@@ -0,0 +1,206 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"strings"
+	"time"
+)
+
+type Orgs struct {
+	db *sql.DB
+}
+
+func NewOrgs(db *sql.DB) *Orgs {
+	return &Orgs{db: db}
+}
+
+// Create adds an organization with the creator as its owner.
+func (r *Orgs) Create(ctx context.Context, org domain.Organization, ownerId int64) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow("INSERT INTO organizations (name, slug, created_at) VALUES ($1, $2, $3) RETURNING id",
+		org.Name, org.Slug, org.CreatedAt).Scan(&id); err != nil {
+		return 0, uniqueViolation(err, domain.ErrOrgSlugTaken)
+	}
+
+	if _, err := tx.Exec("INSERT INTO org_members (org_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)",
+		id, ownerId, domain.OrgRoleOwner, org.CreatedAt); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *Orgs) GetByID(ctx context.Context, id int64) (domain.Organization, error) {
+	var org domain.Organization
+	err := r.db.QueryRow("SELECT id, name, slug, created_at FROM organizations WHERE id = $1", id).
+		Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt)
+	if err == sql.ErrNoRows {
+		return org, domain.ErrOrgNotFound
+	}
+
+	return org, err
+}
+
+func (r *Orgs) GetMembership(ctx context.Context, orgId, userId int64) (domain.Membership, error) {
+	var m domain.Membership
+	err := r.db.QueryRow(`SELECT o.id, o.name, o.slug, o.created_at, m.role FROM organizations o
+		JOIN org_members m ON m.org_id = o.id WHERE o.id = $1 AND m.user_id = $2`, orgId, userId).
+		Scan(&m.ID, &m.Name, &m.Slug, &m.CreatedAt, &m.Role)
+	if err == sql.ErrNoRows {
+		return m, domain.ErrNotOrgMember
+	}
+
+	return m, err
+}
+
+// GetByUser returns the user's organizations, oldest membership first.
+func (r *Orgs) GetByUser(ctx context.Context, userId int64) ([]domain.Membership, error) {
+	rows, err := r.db.Query(`SELECT o.id, o.name, o.slug, o.created_at, m.role FROM organizations o
+		JOIN org_members m ON m.org_id = o.id WHERE m.user_id = $1 ORDER BY m.joined_at, o.id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := make([]domain.Membership, 0)
+	for rows.Next() {
+		var m domain.Membership
+		if err := rows.Scan(&m.ID, &m.Name, &m.Slug, &m.CreatedAt, &m.Role); err != nil {
+			return nil, err
+		}
+
+		memberships = append(memberships, m)
+	}
+
+	return memberships, rows.Err()
+}
+
+func (r *Orgs) GetMembers(ctx context.Context, orgId int64) ([]domain.OrgMember, error) {
+	rows, err := r.db.Query(`SELECT u.id, u.name, u.email, m.role, m.joined_at FROM org_members m
+		JOIN users u ON u.id = m.user_id WHERE m.org_id = $1 ORDER BY m.joined_at, u.id`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]domain.OrgMember, 0)
+	for rows.Next() {
+		var m domain.OrgMember
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Email, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+func (r *Orgs) SetMemberRole(ctx context.Context, orgId, userId int64, role string) error {
+	return r.changeMember(orgId, userId, role != domain.OrgRoleOwner,
+		"UPDATE org_members SET role = $3 WHERE org_id = $1 AND user_id = $2", role)
+}
+
+func (r *Orgs) RemoveMember(ctx context.Context, orgId, userId int64) error {
+	return r.changeMember(orgId, userId, true, "DELETE FROM org_members WHERE org_id = $1 AND user_id = $2")
+}
+
+// changeMember runs a change of a membership. When the change may take away
+// an owner role it makes sure another owner is left.
+func (r *Orgs) changeMember(orgId, userId int64, demotes bool, query string, args ...interface{}) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var role string
+	if err := tx.QueryRow("SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2 FOR UPDATE", orgId, userId).
+		Scan(&role); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrNotOrgMember
+		}
+		return err
+	}
+
+	if demotes && role == domain.OrgRoleOwner {
+		var owners int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM (SELECT 1 FROM org_members WHERE org_id = $1 AND role = $2 FOR UPDATE) o",
+			orgId, domain.OrgRoleOwner).Scan(&owners); err != nil {
+			return err
+		}
+
+		if owners <= 1 {
+			return domain.ErrLastOwner
+		}
+	}
+
+	if _, err := tx.Exec(query, append([]interface{}{orgId, userId}, args...)...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Orgs) CreateInvitation(ctx context.Context, inv domain.Invitation) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(`INSERT INTO org_invitations (org_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		inv.OrgID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt, inv.CreatedAt).Scan(&id)
+
+	return id, err
+}
+
+// AcceptInvitation adds the user to the organization if the invitation is
+// still open and was sent to the user's email address.
+func (r *Orgs) AcceptInvitation(ctx context.Context, tokenHash string, userId int64, email string) (domain.Invitation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return domain.Invitation{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var inv domain.Invitation
+	err = tx.QueryRow(`SELECT id, org_id, email, role, token_hash, COALESCE(invited_by, 0), expires_at, created_at FROM org_invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > $2 FOR UPDATE`, tokenHash, now).
+		Scan(&inv.ID, &inv.OrgID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return inv, domain.ErrInvitationNotFound
+		}
+		return inv, err
+	}
+
+	if !strings.EqualFold(inv.Email, email) {
+		return inv, domain.ErrInvitationEmail
+	}
+
+	res, err := tx.Exec("INSERT INTO org_members (org_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+		inv.OrgID, userId, inv.Role, now)
+	if err != nil {
+		return inv, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return inv, err
+	} else if n == 0 {
+		return inv, domain.ErrAlreadyOrgMember
+	}
+
+	if _, err := tx.Exec("UPDATE org_invitations SET accepted_at = $1 WHERE id = $2", now, inv.ID); err != nil {
+		return inv, err
+	}
+	inv.AcceptedAt = &now
+
+	return inv, tx.Commit()
+}
@@ -0,0 +1,68 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dewi911/cruda-app/pkg/ratelimit"
+	"sync"
+	"time"
+)
+
+// RateLimits is a ratelimit.Store shared by every replica that uses the same database.
+type RateLimits struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewRateLimits(db *sql.DB) *RateLimits {
+	return &RateLimits{db: db, lastSweep: time.Now()}
+}
+
+func (r *RateLimits) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	now := time.Now().UTC()
+
+	if err := r.sweep(now); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	defer tx.Rollback()
+
+	// the no-op update locks an existing row, so a sweep can't drop it before it is written back
+	var b ratelimit.Bucket
+	if err := tx.QueryRow(`INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key RETURNING tokens, updated_at`,
+		key, float64(limit.Burst), now).Scan(&b.Tokens, &b.UpdatedAt); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	res := b.Take(limit, now)
+
+	if _, err := tx.Exec("UPDATE rate_limit_buckets SET tokens = $1, updated_at = $2, full_at = $3 WHERE key = $4",
+		b.Tokens, b.UpdatedAt, b.FullAt(limit), key); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return res, tx.Commit()
+}
+
+// sweep drops buckets that have refilled completely. Every replica sweeps
+// on its own; deleting the same rows twice is harmless.
+func (r *RateLimits) sweep(now time.Time) error {
+	r.mu.Lock()
+	if now.Sub(r.lastSweep) < ratelimit.SweepInterval {
+		r.mu.Unlock()
+		return nil
+	}
+	r.lastSweep = now
+	r.mu.Unlock()
+
+	_, err := r.db.Exec("DELETE FROM rate_limit_buckets WHERE full_at <= $1", now)
+
+	return err
+}
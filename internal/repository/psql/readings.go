@@ -0,0 +1,201 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+// Readings stores the reading status of users. Entries are reached through
+// their book, which is scoped to the organization from the context; the
+// statistics cover every organization.
+type Readings struct {
+	db *sql.DB
+}
+
+func NewReadings(db *sql.DB) *Readings {
+	return &Readings{db: db}
+}
+
+const readingColumns = `rs.book_id, b.title, b.author, b.page_count, rs.status, rs.started_at, rs.finished_at, rs.progress_pages,
+	COALESCE(rs.progress_percent, CASE WHEN b.page_count > 0 THEN LEAST(100, rs.progress_pages * 100 / b.page_count) END),
+	rs.updated_at`
+
+func (r *Readings) GetByBook(ctx context.Context, userId, bookId int64) (domain.Reading, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Reading{}, err
+	}
+
+	reading, err := scanReading(r.db.QueryRow(`SELECT `+readingColumns+` FROM reading_status rs JOIN books b ON b.id = rs.book_id
+		WHERE rs.user_id = $1 AND rs.book_id = $2 AND b.org_id = $3 AND b.deleted_at IS NULL`, userId, bookId, orgId))
+	if err == sql.ErrNoRows {
+		return reading, domain.ErrReadingNotFound
+	}
+
+	return reading, err
+}
+
+// GetAll lists the user's books, most recently updated first.
+func (r *Readings) GetAll(ctx context.Context, userId int64, filter domain.ReadingFilter) ([]domain.Reading, int, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	from := " FROM reading_status rs JOIN books b ON b.id = rs.book_id WHERE rs.user_id = $1 AND b.org_id = $2 AND b.deleted_at IS NULL"
+	args := []interface{}{userId, orgId}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		from += " AND rs.status = $3"
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset())
+	readings, err := r.query(fmt.Sprintf("SELECT %s%s ORDER BY rs.updated_at DESC, rs.book_id LIMIT $%d OFFSET $%d",
+		readingColumns, from, len(args)-1, len(args)), args...)
+
+	return readings, total, err
+}
+
+// GetByUser returns the user's reading status in every organization for the
+// data export.
+func (r *Readings) GetByUser(ctx context.Context, userId int64) ([]domain.Reading, error) {
+	return r.query(`SELECT `+readingColumns+` FROM reading_status rs JOIN books b ON b.id = rs.book_id
+		WHERE rs.user_id = $1 ORDER BY rs.book_id`, userId)
+}
+
+// Set creates or replaces the user's reading status of a book in the
+// organization from the context.
+func (r *Readings) Set(ctx context.Context, userId, bookId int64, inp domain.ReadingInput) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pageCount int
+	if err := r.db.QueryRow("SELECT page_count FROM books WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL", bookId, orgId).
+		Scan(&pageCount); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrBookNotFound
+		}
+		return err
+	}
+
+	if inp.ProgressPages != nil && pageCount > 0 && *inp.ProgressPages > pageCount {
+		return domain.ErrInvalidProgress
+	}
+
+	_, err = r.db.Exec(`INSERT INTO reading_status (user_id, book_id, status, started_at, finished_at, progress_pages, progress_percent, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id, book_id) DO UPDATE SET status = EXCLUDED.status, started_at = EXCLUDED.started_at,
+			finished_at = EXCLUDED.finished_at, progress_pages = EXCLUDED.progress_pages,
+			progress_percent = EXCLUDED.progress_percent, updated_at = EXCLUDED.updated_at`,
+		userId, bookId, inp.Status, inp.StartedAt, inp.FinishedAt, inp.ProgressPages, inp.ProgressPercent, time.Now())
+
+	return err
+}
+
+func (r *Readings) Delete(ctx context.Context, userId, bookId int64) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.db.Exec(`DELETE FROM reading_status WHERE user_id = $1 AND book_id = $2
+		AND book_id IN (SELECT id FROM books WHERE org_id = $3)`, userId, bookId, orgId)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrReadingNotFound
+	}
+
+	return nil
+}
+
+// Stats counts finished books towards the pages read in full and books being
+// read up to the current progress.
+func (r *Readings) Stats(ctx context.Context, userId int64) (domain.ReadingStats, error) {
+	var stats domain.ReadingStats
+
+	if err := r.db.QueryRow(`SELECT
+			COUNT(*) FILTER (WHERE rs.status = $2),
+			COUNT(*) FILTER (WHERE rs.status = $3),
+			COUNT(*) FILTER (WHERE rs.status = $4),
+			COALESCE(SUM(CASE
+				WHEN rs.status = $4 THEN b.page_count
+				WHEN rs.status = $3 THEN COALESCE(rs.progress_pages, rs.progress_percent * b.page_count / 100, 0)
+				ELSE 0 END), 0)
+		FROM reading_status rs JOIN books b ON b.id = rs.book_id WHERE rs.user_id = $1`,
+		userId, domain.ReadingStatusWantToRead, domain.ReadingStatusReading, domain.ReadingStatusRead).
+		Scan(&stats.WantToRead, &stats.Reading, &stats.Read, &stats.PagesRead); err != nil {
+		return stats, err
+	}
+
+	if err := r.db.QueryRow("SELECT COUNT(*), COALESCE(AVG(rating), 0) FROM reviews WHERE user_id = $1", userId).
+		Scan(&stats.ReviewCount, &stats.AverageRatingGiven); err != nil {
+		return stats, err
+	}
+
+	rows, err := r.db.Query(`SELECT EXTRACT(YEAR FROM rs.finished_at)::int AS year, COUNT(*), COALESCE(SUM(b.page_count), 0)
+		FROM reading_status rs JOIN books b ON b.id = rs.book_id
+		WHERE rs.user_id = $1 AND rs.status = $2 AND rs.finished_at IS NOT NULL
+		GROUP BY year ORDER BY year`, userId, domain.ReadingStatusRead)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	stats.Years = make([]domain.YearStats, 0)
+	for rows.Next() {
+		var year domain.YearStats
+		if err := rows.Scan(&year.Year, &year.Books, &year.Pages); err != nil {
+			return stats, err
+		}
+
+		stats.Years = append(stats.Years, year)
+	}
+
+	return stats, rows.Err()
+}
+
+func (r *Readings) query(query string, args ...interface{}) ([]domain.Reading, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := make([]domain.Reading, 0)
+	for rows.Next() {
+		reading, err := scanReading(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		readings = append(readings, reading)
+	}
+
+	return readings, rows.Err()
+}
+
+func scanReading(row rowScanner) (domain.Reading, error) {
+	var r domain.Reading
+	err := row.Scan(&r.BookID, &r.Title, &r.Author, &r.PageCount, &r.Status, &r.StartedAt, &r.FinishedAt,
+		&r.ProgressPages, &r.ProgressPercent, &r.UpdatedAt)
+
+	return r, err
+}
@@ -0,0 +1,251 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+// Reviews keeps the rating aggregates of books in step with visible reviews.
+// Reviews are reached through their book, which is scoped to the organization
+// from the context.
+type Reviews struct {
+	db *sql.DB
+}
+
+func NewReviews(db *sql.DB) *Reviews {
+	return &Reviews{db: db}
+}
+
+// deleteUserReviews removes all reviews of the user in $1 and takes them out
+// of the rating aggregates.
+const deleteUserReviews = `WITH deleted AS (
+		DELETE FROM reviews WHERE user_id = $1 RETURNING book_id, rating, hidden
+	)
+	UPDATE books b SET rating_sum = b.rating_sum - d.sum, rating_count = b.rating_count - d.count
+	FROM (SELECT book_id, SUM(rating) AS sum, COUNT(*) AS count FROM deleted WHERE NOT hidden GROUP BY book_id) d
+	WHERE b.id = d.book_id`
+
+const reviewColumns = "r.id, r.book_id, r.user_id, u.name, r.rating, r.text, r.flagged, r.hidden, r.created_at, r.updated_at"
+
+func (r *Reviews) Create(ctx context.Context, review domain.Review) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockBook(ctx, tx, review.BookID); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	if err := tx.QueryRow(`INSERT INTO reviews (book_id, user_id, rating, text, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5) RETURNING id`,
+		review.BookID, review.UserID, review.Rating, review.Text, review.CreatedAt).Scan(&id); err != nil {
+		return 0, uniqueViolation(err, domain.ErrReviewExists)
+	}
+
+	if err := addRating(tx, review.BookID, review.Rating, 1); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *Reviews) GetByID(ctx context.Context, bookId, id int64) (domain.Review, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Review{}, err
+	}
+
+	review, err := scanReview(r.db.QueryRow(`SELECT `+reviewColumns+` FROM reviews r
+		JOIN users u ON u.id = r.user_id JOIN books b ON b.id = r.book_id
+		WHERE r.id = $1 AND r.book_id = $2 AND b.org_id = $3 AND b.deleted_at IS NULL`, id, bookId, orgId))
+	if err == sql.ErrNoRows {
+		return review, domain.ErrReviewNotFound
+	}
+
+	return review, err
+}
+
+func (r *Reviews) List(ctx context.Context, bookId int64, filter domain.ReviewFilter) ([]domain.Review, int, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := " WHERE r.book_id = $1 AND b.org_id = $2 AND b.deleted_at IS NULL"
+	if !filter.IncludeHidden {
+		where += " AND NOT r.hidden"
+	}
+
+	from := " FROM reviews r JOIN users u ON u.id = r.user_id JOIN books b ON b.id = r.book_id"
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+from+where, bookId, orgId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query("SELECT "+reviewColumns+from+where+" ORDER BY r.created_at DESC, r.id DESC LIMIT $3 OFFSET $4",
+		bookId, orgId, filter.Limit, filter.Offset())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	reviews := make([]domain.Review, 0)
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		reviews = append(reviews, review)
+	}
+
+	return reviews, total, rows.Err()
+}
+
+// GetByUser returns the user's reviews in every organization for the data export.
+func (r *Reviews) GetByUser(ctx context.Context, userId int64) ([]domain.Review, error) {
+	rows, err := r.db.Query(`SELECT `+reviewColumns+` FROM reviews r
+		JOIN users u ON u.id = r.user_id WHERE r.user_id = $1 ORDER BY r.id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make([]domain.Review, 0)
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, review)
+	}
+
+	return reviews, rows.Err()
+}
+
+func (r *Reviews) Update(ctx context.Context, bookId, id int64, inp domain.ReviewInput) error {
+	return r.change(ctx, bookId, id, func(tx *sql.Tx, review domain.Review) error {
+		if _, err := tx.Exec("UPDATE reviews SET rating = $1, text = $2, updated_at = $3 WHERE id = $4",
+			inp.Rating, inp.Text, time.Now(), id); err != nil {
+			return err
+		}
+
+		if review.Hidden {
+			return nil
+		}
+
+		return addRating(tx, bookId, inp.Rating-review.Rating, 0)
+	})
+}
+
+func (r *Reviews) Delete(ctx context.Context, bookId, id int64) error {
+	return r.change(ctx, bookId, id, func(tx *sql.Tx, review domain.Review) error {
+		if _, err := tx.Exec("DELETE FROM reviews WHERE id = $1", id); err != nil {
+			return err
+		}
+
+		if review.Hidden {
+			return nil
+		}
+
+		return addRating(tx, bookId, -review.Rating, -1)
+	})
+}
+
+func (r *Reviews) SetFlagged(ctx context.Context, bookId, id int64, flagged bool) error {
+	return r.change(ctx, bookId, id, func(tx *sql.Tx, review domain.Review) error {
+		_, err := tx.Exec("UPDATE reviews SET flagged = $1 WHERE id = $2", flagged, id)
+		return err
+	})
+}
+
+// SetHidden hides or restores a review and clears its flag.
+func (r *Reviews) SetHidden(ctx context.Context, bookId, id int64, hidden bool) error {
+	return r.change(ctx, bookId, id, func(tx *sql.Tx, review domain.Review) error {
+		if _, err := tx.Exec("UPDATE reviews SET hidden = $1, flagged = FALSE WHERE id = $2", hidden, id); err != nil {
+			return err
+		}
+
+		switch {
+		case hidden && !review.Hidden:
+			return addRating(tx, bookId, -review.Rating, -1)
+		case !hidden && review.Hidden:
+			return addRating(tx, bookId, review.Rating, 1)
+		}
+
+		return nil
+	})
+}
+
+// change runs a change of a review with the review row locked.
+func (r *Reviews) change(ctx context.Context, bookId, id int64, fn func(tx *sql.Tx, review domain.Review) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockBook(ctx, tx, bookId); err != nil {
+		return err
+	}
+
+	var review domain.Review
+	if err := tx.QueryRow("SELECT rating, hidden FROM reviews WHERE id = $1 AND book_id = $2 FOR UPDATE", id, bookId).
+		Scan(&review.Rating, &review.Hidden); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrReviewNotFound
+		}
+		return err
+	}
+
+	if err := fn(tx, review); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockBook checks that the book is in the organization from the context and
+// locks it for the aggregate update.
+func lockBook(ctx context.Context, tx *sql.Tx, bookId int64) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var id int64
+	if err := tx.QueryRow("SELECT id FROM books WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL FOR UPDATE", bookId, orgId).
+		Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return domain.ErrBookNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func addRating(tx *sql.Tx, bookId int64, sum, count int) error {
+	if sum == 0 && count == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec("UPDATE books SET rating_sum = rating_sum + $1, rating_count = rating_count + $2 WHERE id = $3",
+		sum, count, bookId)
+
+	return err
+}
+
+func scanReview(row rowScanner) (domain.Review, error) {
+	var r domain.Review
+	err := row.Scan(&r.ID, &r.BookID, &r.UserID, &r.UserName, &r.Rating, &r.Text, &r.Flagged, &r.Hidden, &r.CreatedAt, &r.UpdatedAt)
+
+	return r, err
+}
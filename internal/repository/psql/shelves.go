@@ -0,0 +1,249 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+// Shelves belong to a user. Books on them are listed and counted only when
+// they are in the organization from the context.
+type Shelves struct {
+	db *sql.DB
+}
+
+func NewShelves(db *sql.DB) *Shelves {
+	return &Shelves{db: db}
+}
+
+const shelfColumns = `s.id, s.name, (SELECT COUNT(*) FROM shelf_books sb JOIN books b ON b.id = sb.book_id
+	WHERE sb.shelf_id = s.id AND b.org_id = $1 AND b.deleted_at IS NULL), s.created_at`
+
+func (r *Shelves) Create(ctx context.Context, userId int64, inp domain.ShelfInput) (int64, error) {
+	var id int64
+	err := r.db.QueryRow("INSERT INTO shelves (user_id, name, created_at) VALUES ($1, $2, $3) RETURNING id",
+		userId, inp.Name, time.Now()).Scan(&id)
+
+	return id, uniqueViolation(err, domain.ErrShelfNameTaken)
+}
+
+func (r *Shelves) GetAll(ctx context.Context, userId int64) ([]domain.Shelf, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query("SELECT "+shelfColumns+" FROM shelves s WHERE s.user_id = $2 ORDER BY LOWER(s.name)", orgId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shelves := make([]domain.Shelf, 0)
+	for rows.Next() {
+		var shelf domain.Shelf
+		if err := rows.Scan(&shelf.ID, &shelf.Name, &shelf.BookCount, &shelf.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		shelves = append(shelves, shelf)
+	}
+
+	return shelves, rows.Err()
+}
+
+func (r *Shelves) GetByID(ctx context.Context, userId, id int64) (domain.Shelf, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.Shelf{}, err
+	}
+
+	var shelf domain.Shelf
+	err = r.db.QueryRow("SELECT "+shelfColumns+" FROM shelves s WHERE s.user_id = $2 AND s.id = $3", orgId, userId, id).
+		Scan(&shelf.ID, &shelf.Name, &shelf.BookCount, &shelf.CreatedAt)
+	if err == sql.ErrNoRows {
+		return shelf, domain.ErrShelfNotFound
+	}
+
+	return shelf, err
+}
+
+func (r *Shelves) Rename(ctx context.Context, userId, id int64, inp domain.ShelfInput) error {
+	res, err := r.db.Exec("UPDATE shelves SET name = $1 WHERE id = $2 AND user_id = $3", inp.Name, id, userId)
+	if err != nil {
+		return uniqueViolation(err, domain.ErrShelfNameTaken)
+	}
+
+	return shelfAffected(res)
+}
+
+// Delete removes the shelf; the books on it stay in the catalog.
+func (r *Shelves) Delete(ctx context.Context, userId, id int64) error {
+	res, err := r.db.Exec("DELETE FROM shelves WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return err
+	}
+
+	return shelfAffected(res)
+}
+
+// AddBook puts a book of the organization from the context on the shelf.
+// Adding a book that is already on the shelf is not an error.
+func (r *Shelves) AddBook(ctx context.Context, userId, id, bookId int64) error {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := r.checkShelf(userId, id); err != nil {
+		return err
+	}
+
+	res, err := r.db.Exec(`INSERT INTO shelf_books (shelf_id, book_id, added_at)
+		SELECT $1, id, $2 FROM books WHERE id = $3 AND org_id = $4 AND deleted_at IS NULL
+		ON CONFLICT (shelf_id, book_id) DO NOTHING`, id, time.Now(), bookId, orgId)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	// nothing was inserted: the book is either missing or already on the shelf
+	var exists bool
+	if err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL)", bookId, orgId).
+		Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return domain.ErrBookNotFound
+	}
+
+	return nil
+}
+
+func (r *Shelves) RemoveBook(ctx context.Context, userId, id, bookId int64) error {
+	if err := r.checkShelf(userId, id); err != nil {
+		return err
+	}
+
+	res, err := r.db.Exec("DELETE FROM shelf_books WHERE shelf_id = $1 AND book_id = $2", id, bookId)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	return domain.ErrBookNotFound
+}
+
+// GetBooks lists the books on the shelf, most recently added first.
+func (r *Shelves) GetBooks(ctx context.Context, userId, id int64, p domain.Pagination) ([]domain.ShelfBook, int, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := r.checkShelf(userId, id); err != nil {
+		return nil, 0, err
+	}
+
+	from := " FROM shelf_books sb JOIN books b ON b.id = sb.book_id WHERE sb.shelf_id = $1 AND b.org_id = $2 AND b.deleted_at IS NULL"
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+from, id, orgId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	books, err := r.books("SELECT b.id, b.title, b.author, sb.added_at"+from+" ORDER BY sb.added_at DESC, b.id LIMIT $3 OFFSET $4",
+		id, orgId, p.Limit, p.Offset())
+
+	return books, total, err
+}
+
+// GetByUser returns the user's shelves with all of their books for the data
+// export. It is deliberately not org scoped.
+func (r *Shelves) GetByUser(ctx context.Context, userId int64) ([]domain.ShelfExport, error) {
+	rows, err := r.db.Query("SELECT id, name, created_at FROM shelves WHERE user_id = $1 ORDER BY id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shelves := make([]domain.ShelfExport, 0)
+	for rows.Next() {
+		var shelf domain.ShelfExport
+		if err := rows.Scan(&shelf.ID, &shelf.Name, &shelf.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		shelves = append(shelves, shelf)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range shelves {
+		if shelves[i].Books, err = r.books(`SELECT b.id, b.title, b.author, sb.added_at FROM shelf_books sb
+			JOIN books b ON b.id = sb.book_id WHERE sb.shelf_id = $1 ORDER BY sb.added_at`, shelves[i].ID); err != nil {
+			return nil, err
+		}
+
+		shelves[i].BookCount = len(shelves[i].Books)
+	}
+
+	return shelves, nil
+}
+
+func (r *Shelves) books(query string, args ...interface{}) ([]domain.ShelfBook, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := make([]domain.ShelfBook, 0)
+	for rows.Next() {
+		var book domain.ShelfBook
+		if err := rows.Scan(&book.BookID, &book.Title, &book.Author, &book.AddedAt); err != nil {
+			return nil, err
+		}
+
+		books = append(books, book)
+	}
+
+	return books, rows.Err()
+}
+
+func (r *Shelves) checkShelf(userId, id int64) error {
+	var exists bool
+	if err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM shelves WHERE id = $1 AND user_id = $2)", id, userId).
+		Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return domain.ErrShelfNotFound
+	}
+
+	return nil
+}
+
+func shelfAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrShelfNotFound
+	}
+
+	return nil
+}
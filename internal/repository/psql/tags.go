@@ -0,0 +1,45 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dewi911/cruda-app/internal/domain"
+)
+
+// Tags are created on the fly when books are tagged, see setBookTags.
+type Tags struct {
+	db *sql.DB
+}
+
+func NewTags(db *sql.DB) *Tags {
+	return &Tags{db: db}
+}
+
+// GetAll returns the organization's tags with the number of tagged books.
+func (r *Tags) GetAll(ctx context.Context) ([]domain.TagCount, error) {
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`SELECT t.name, COUNT(b.id) AS n FROM tags t
+		LEFT JOIN book_tags bt ON bt.tag_id = t.id
+		LEFT JOIN books b ON b.id = bt.book_id AND b.deleted_at IS NULL WHERE t.org_id = $1
+		GROUP BY t.id, t.name ORDER BY n DESC, t.name`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]domain.TagCount, 0)
+	for rows.Next() {
+		var t domain.TagCount
+		if err := rows.Scan(&t.Name, &t.Count); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
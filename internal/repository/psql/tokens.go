@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
 )
 
 type Tokens struct {
@@ -15,16 +16,16 @@ func NewTokens(db *sql.DB) *Tokens {
 }
 
 func (r *Tokens) Create(ctx context.Context, token domain.RefreshSession) error {
-	_, err := r.db.Exec("INSERT INTO refresh_tokens (user_id, token, expires_at) VALUES ($1, $2, $3)",
-		token.UserID, token.Token, token.ExpiresAt)
+	_, err := r.db.Exec("INSERT INTO refresh_tokens (user_id, org_id, token, expires_at) VALUES ($1, $2, $3, $4)",
+		token.UserID, nullInt64(token.OrgID), token.Token, token.ExpiresAt)
 
 	return err
 }
 
 func (r *Tokens) Get(ctx context.Context, token string) (domain.RefreshSession, error) {
 	var t domain.RefreshSession
-	err := r.db.QueryRow("SELECT id, user_id, token, expires_at FROM refresh_tokens WHERE token=$1", token).
-		Scan(&t.ID, &t.UserID, &t.Token, &t.ExpiresAt)
+	err := r.db.QueryRow("SELECT id, user_id, COALESCE(org_id, 0), token, expires_at FROM refresh_tokens WHERE token=$1", token).
+		Scan(&t.ID, &t.UserID, &t.OrgID, &t.Token, &t.ExpiresAt)
 	if err != nil {
 		return t, err
 	}
@@ -43,3 +44,35 @@ func (r *Tokens) Delete(ctx context.Context, id int, token domain.RefreshSession
 
 	return err
 }
+
+func (r *Tokens) DeleteByUser(ctx context.Context, userId int64) error {
+	_, err := r.db.Exec("DELETE FROM refresh_tokens WHERE user_id=$1", userId)
+
+	return err
+}
+
+// DeleteExpired removes sessions that expired before the time.
+func (r *Tokens) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	return deleteInBatches(ctx, r.db,
+		"DELETE FROM refresh_tokens WHERE id IN (SELECT id FROM refresh_tokens WHERE expires_at < $1 LIMIT $2)", before)
+}
+
+func (r *Tokens) GetByUser(ctx context.Context, userId int64) ([]domain.RefreshSession, error) {
+	rows, err := r.db.Query("SELECT id, user_id, COALESCE(org_id, 0), token, expires_at FROM refresh_tokens WHERE user_id=$1 ORDER BY id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]domain.RefreshSession, 0)
+	for rows.Next() {
+		var t domain.RefreshSession
+		if err := rows.Scan(&t.ID, &t.UserID, &t.OrgID, &t.Token, &t.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, t)
+	}
+
+	return sessions, rows.Err()
+}
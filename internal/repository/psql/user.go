@@ -3,7 +3,11 @@ package psql
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/lib/pq"
+	"strings"
+	"time"
 )
 
 type Users struct {
@@ -18,13 +22,206 @@ func (r *Users) Create(ctx context.Context, user domain.User) error {
 	_, err := r.db.Exec("INSERT INTO users (name, email, password, registered_at) VALUES ($1, $2, $3, $4)",
 		user.Name, user.Email, user.Password, user.RegisteredAt)
 
-	return err
+	return uniqueViolation(err, domain.ErrEmailTaken)
+}
+
+const userColumns = "id, name, email, role, registered_at, disabled_at"
+
+func (r *Users) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	user, err := scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id=$1", id))
+	if err == sql.ErrNoRows {
+		return user, domain.ErrUserNotFound
+	}
+
+	return user, err
+}
+
+func (r *Users) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	user, err := scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email=$1", email))
+	if err == sql.ErrNoRows {
+		return user, domain.ErrUserNotFound
+	}
+
+	return user, err
 }
 
 func (r *Users) GetByCredential(ctx context.Context, email, password string) (domain.User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email=$1 AND password=$2", email, password))
+}
+
+// List searches users by name or email.
+func (r *Users) List(ctx context.Context, filter domain.UserFilter) ([]domain.User, int, error) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if filter.Query != "" {
+		args = append(args, "%"+filter.Query+"%")
+		conditions = append(conditions, fmt.Sprintf("(name ILIKE $%d OR email ILIKE $%d)", len(args), len(args)))
+	}
+
+	if filter.Role != "" {
+		args = append(args, filter.Role)
+		conditions = append(conditions, fmt.Sprintf("role = $%d", len(args)))
+	}
+
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			conditions = append(conditions, "disabled_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "disabled_at IS NULL")
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset())
+	query := fmt.Sprintf("SELECT %s FROM users%s ORDER BY id LIMIT $%d OFFSET $%d", userColumns, where, len(args)-1, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := make([]domain.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+func (r *Users) SetDisabled(ctx context.Context, id int64, disabledAt *time.Time) error {
+	return r.exec("UPDATE users SET disabled_at=$1 WHERE id=$2", disabledAt, id)
+}
+
+func (r *Users) SetRole(ctx context.Context, id int64, role string) error {
+	return r.exec("UPDATE users SET role=$1 WHERE id=$2", role, id)
+}
+
+// exec runs an update of a single user and reports a missing one.
+func (r *Users) exec(query string, args ...interface{}) error {
+	res, err := r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func scanUser(row rowScanner) (domain.User, error) {
 	var user domain.User
-	err := r.db.QueryRow("SELECT id, name, email, registered_at FROM users WHERE email=$1 AND password=$2", email, password).
-		Scan(&user.ID, &user.Name, &user.Email, &user.RegisteredAt)
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.RegisteredAt, &user.DisabledAt)
 
 	return user, err
 }
+
+func (r *Users) Update(ctx context.Context, id int64, inp domain.UpdateUserInput) error {
+	setValues := make([]string, 0)
+	args := make([]interface{}, 0)
+	argId := 1
+
+	if inp.Name != nil {
+		setValues = append(setValues, fmt.Sprintf("name=$%d", argId))
+		args = append(args, *inp.Name)
+		argId++
+	}
+
+	if inp.Email != nil {
+		setValues = append(setValues, fmt.Sprintf("email=$%d", argId))
+		args = append(args, *inp.Email)
+		argId++
+	}
+
+	if len(setValues) == 0 {
+		return nil
+	}
+
+	setQuery := strings.Join(setValues, ", ")
+
+	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d", setQuery, argId)
+	args = append(args, id)
+
+	_, err := r.db.Exec(query, args...)
+	return uniqueViolation(err, domain.ErrEmailTaken)
+}
+
+func (r *Users) UpdatePassword(ctx context.Context, id int64, password string) error {
+	_, err := r.db.Exec("UPDATE users SET password=$1 WHERE id=$2", password, id)
+
+	return err
+}
+
+// Delete removes the user together with their refresh sessions, unless they
+// still have books on loan or active holds. The user row is locked first, so
+// no checkout or hold can slip in before it is gone.
+func (r *Users) Delete(ctx context.Context, id int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT id FROM users WHERE id=$1 FOR UPDATE", id); err != nil {
+		return err
+	}
+
+	var onLoan, holding bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM loans WHERE borrower_id=$1 AND returned_at IS NULL),
+		EXISTS (SELECT 1 FROM holds WHERE user_id=$1 AND status IN ($2, $3))`,
+		id, domain.HoldStatusWaiting, domain.HoldStatusReady).Scan(&onLoan, &holding); err != nil {
+		return err
+	}
+
+	switch {
+	case onLoan:
+		return domain.ErrUserHasLoans
+	case holding:
+		return domain.ErrUserHasHolds
+	}
+
+	if _, err := tx.Exec("DELETE FROM refresh_tokens WHERE user_id=$1", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(deleteUserReviews, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM users WHERE id=$1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// uniqueViolation replaces a unique constraint violation with a domain error.
+func uniqueViolation(err error, domainErr error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return domainErr
+	}
+
+	return err
+}
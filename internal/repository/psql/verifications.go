@@ -0,0 +1,49 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+type EmailVerifications struct {
+	db *sql.DB
+}
+
+func NewEmailVerifications(db *sql.DB) *EmailVerifications {
+	return &EmailVerifications{db: db}
+}
+
+// Create replaces any pending verification of the user.
+func (r *EmailVerifications) Create(ctx context.Context, v domain.EmailVerification) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM email_verifications WHERE user_id = $1", v.UserID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("INSERT INTO email_verifications (user_id, email, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)",
+		v.UserID, v.Email, v.TokenHash, v.ExpiresAt, v.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Take returns a not yet expired verification and deletes it.
+func (r *EmailVerifications) Take(ctx context.Context, tokenHash string) (domain.EmailVerification, error) {
+	var v domain.EmailVerification
+	err := r.db.QueryRow("DELETE FROM email_verifications WHERE token_hash = $1 AND expires_at > $2 RETURNING id, user_id, email, token_hash, expires_at, created_at",
+		tokenHash, time.Now()).
+		Scan(&v.ID, &v.UserID, &v.Email, &v.TokenHash, &v.ExpiresAt, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return v, domain.ErrVerificationNotFound
+	}
+
+	return v, err
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const apiKeyPrefix = "cruda"
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key domain.APIKey) (int64, error)
+	GetByPrefix(ctx context.Context, prefix string) (domain.APIKey, error)
+	GetByUser(ctx context.Context, userId int64) ([]domain.APIKey, error)
+	Revoke(ctx context.Context, userId, id int64) error
+	TouchLastUsed(ctx context.Context, id int64, at time.Time) error
+}
+
+type APIKeys struct {
+	repo APIKeyRepository
+}
+
+func NewAPIKeys(repo APIKeyRepository) *APIKeys {
+	return &APIKeys{repo: repo}
+}
+
+// Create issues a key of the form cruda_<prefix>_<secret>. Only the visible
+// prefix and a hash of the whole key are stored.
+func (s *APIKeys) Create(ctx context.Context, userId int64, inp domain.CreateAPIKeyInput) (domain.CreatedAPIKey, error) {
+	prefix, err := randomHex(4)
+	if err != nil {
+		return domain.CreatedAPIKey{}, err
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		return domain.CreatedAPIKey{}, err
+	}
+
+	key := domain.APIKey{
+		UserID:    userId,
+		Name:      inp.Name,
+		Prefix:    apiKeyPrefix + "_" + prefix,
+		Scopes:    inp.Scopes,
+		ExpiresAt: inp.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	raw := key.Prefix + "_" + secret
+	key.Hash = hashAPIKey(raw)
+
+	key.ID, err = s.repo.Create(ctx, key)
+	if err != nil {
+		return domain.CreatedAPIKey{}, err
+	}
+
+	return domain.CreatedAPIKey{APIKey: key, Key: raw}, nil
+}
+
+func (s *APIKeys) List(ctx context.Context, userId int64) ([]domain.APIKey, error) {
+	return s.repo.GetByUser(ctx, userId)
+}
+
+func (s *APIKeys) Revoke(ctx context.Context, userId, id int64) error {
+	return s.repo.Revoke(ctx, userId, id)
+}
+
+// Authenticate resolves a raw key to the stored key it was issued as.
+func (s *APIKeys) Authenticate(ctx context.Context, raw string) (domain.APIKey, error) {
+	idx := strings.LastIndex(raw, "_")
+	if idx <= 0 || !strings.HasPrefix(raw, apiKeyPrefix+"_") {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.GetByPrefix(ctx, raw[:idx])
+	if err != nil {
+		if err == domain.ErrAPIKeyNotFound {
+			return domain.APIKey{}, domain.ErrInvalidAPIKey
+		}
+		return domain.APIKey{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashAPIKey(raw))) != 1 || key.RevokedAt != nil {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.Expired(now) {
+		return domain.APIKey{}, domain.ErrAPIKeyExpired
+	}
+
+	if err := s.repo.TouchLastUsed(ctx, key.ID, now); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"method": "APIKeys.Authenticate",
+		}).Error("Failed to update last used timestamp", err)
+	}
+
+	return key, nil
+}
+
+func hashAPIKey(raw string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(raw)))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", b), nil
+}
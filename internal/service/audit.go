@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/internal/domain"
+	audit "github.com/dewi911/cruda-audit-log/pkg/domain"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+type AuditRepository interface {
+	Create(ctx context.Context, event domain.AuditEvent) error
+}
+
+type Auditor interface {
+	Log(ctx context.Context, event domain.AuditEvent)
+}
+
+// Audit stores events in the local audit log and forwards them to the audit
+// service. Failures are logged and never fail the audited operation.
+type Audit struct {
+	repo   AuditRepository
+	client AuditClient
+}
+
+func NewAudit(repo AuditRepository, client AuditClient) *Audit {
+	return &Audit{
+		repo:   repo,
+		client: client,
+	}
+}
+
+func (s *Audit) Log(ctx context.Context, event domain.AuditEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if err := s.repo.Create(ctx, event); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"method": "Audit.Log",
+			"action": event.Action,
+		}).Error("Failed to store audit event", err)
+	}
+
+	if _, err := audit.ToPbEntity(event.Entity); err != nil {
+		return
+	}
+
+	if err := s.client.SendLogRequest(ctx, audit.LogItem{
+		Action:    remoteAction(event.Action),
+		Entity:    event.Entity,
+		EntityID:  event.EntityID,
+		Timestamp: event.CreatedAt,
+	}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"method": "Audit.Log",
+			"action": event.Action,
+		}).Error("Failed to send audit event", err)
+	}
+}
+
+// remoteAction maps actions the audit service does not know to a plain update.
+func remoteAction(action string) string {
+	if _, err := audit.ToPbAction(action); err != nil {
+		return audit.ACTION_UODATE
+	}
+
+	return action
+}
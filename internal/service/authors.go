@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"strings"
+	"time"
+)
+
+type AuthorRepository interface {
+	Create(ctx context.Context, author domain.Author) (int64, error)
+	GetByID(ctx context.Context, id int64) (domain.Author, error)
+	List(ctx context.Context, filter domain.AuthorFilter) ([]domain.Author, int, error)
+	Update(ctx context.Context, id int64, inp domain.UpdateAuthorInput) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type AuthorBooksRepository interface {
+	GetByAuthor(ctx context.Context, authorId int64) ([]domain.Book, error)
+}
+
+type Authors struct {
+	repo      AuthorRepository
+	booksRepo AuthorBooksRepository
+}
+
+func NewAuthors(repo AuthorRepository, booksRepo AuthorBooksRepository) *Authors {
+	return &Authors{
+		repo:      repo,
+		booksRepo: booksRepo,
+	}
+}
+
+func (s *Authors) Create(ctx context.Context, inp domain.CreateAuthorInput) (domain.Author, error) {
+	author := domain.Author{
+		Name:      strings.TrimSpace(inp.Name),
+		SortName:  strings.TrimSpace(inp.SortName),
+		Bio:       inp.Bio,
+		BirthDate: inp.BirthDate,
+		DeathDate: inp.DeathDate,
+		CreatedAt: time.Now(),
+	}
+
+	if author.SortName == "" {
+		author.SortName = domain.SortName(author.Name)
+	}
+
+	id, err := s.repo.Create(ctx, author)
+	if err != nil {
+		return domain.Author{}, err
+	}
+
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Authors) GetByID(ctx context.Context, id int64) (domain.Author, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Authors) List(ctx context.Context, filter domain.AuthorFilter) (domain.AuthorList, error) {
+	filter.Normalize()
+
+	authors, total, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return domain.AuthorList{}, err
+	}
+
+	return domain.AuthorList{
+		Authors: authors,
+		Total:   total,
+		Page:    filter.Page,
+		Limit:   filter.Limit,
+	}, nil
+}
+
+func (s *Authors) Update(ctx context.Context, id int64, inp domain.UpdateAuthorInput) (domain.Author, error) {
+	if err := s.repo.Update(ctx, id, inp); err != nil {
+		return domain.Author{}, err
+	}
+
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Authors) Delete(ctx context.Context, id int64) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *Authors) Books(ctx context.Context, id int64) ([]domain.Book, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return s.booksRepo.GetByAuthor(ctx, id)
+}
@@ -2,32 +2,87 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/pkg/isbn"
+	"github.com/dewi911/cruda-app/pkg/jsonpatch"
+	"github.com/sirupsen/logrus"
+	"strings"
 	"time"
 )
 
 type BookRepository interface {
 	Create(ctx context.Context, book domain.Book) error
 	GetByID(ctx context.Context, id int64) (domain.Book, error)
-	GetAll(ctx context.Context) ([]domain.Book, error)
-	Delete(ctx context.Context, id int64) error
-	Update(ctx context.Context, id int64, inp domain.UpdateBookInput) error
+	GetAll(ctx context.Context, filter domain.BookFilter) ([]domain.Book, error)
+	List(ctx context.Context, filter domain.BookFilter, order string, p domain.Pagination) ([]domain.Book, int, error)
+	Delete(ctx context.Context, id, deletedBy int64, version int) error
+	GetTrash(ctx context.Context, p domain.Pagination) ([]domain.Book, int, error)
+	GetTrashedByID(ctx context.Context, id int64) (domain.Book, error)
+	Restore(ctx context.Context, actorId, id int64, version int) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+
+	GetRevisions(ctx context.Context, bookId int64, p domain.Pagination) ([]domain.BookRevision, int, error)
+	GetRevision(ctx context.Context, bookId int64, revision int) (domain.BookRevision, error)
+	GetLatestRevision(ctx context.Context, bookId int64) (domain.BookRevision, error)
+	Revert(ctx context.Context, actorId, id int64, revision, version int) error
+	Update(ctx context.Context, actorId, id int64, version int, inp domain.UpdateBookInput) error
+	Facets(ctx context.Context, filter domain.BookFilter) (domain.BookFacets, error)
+	Export(ctx context.Context, opts domain.ExportOptions, fn func(domain.Book) error) error
+	FindDuplicate(ctx context.Context, isbn, title, author string) (int64, error)
+}
+
+type MetadataProvider interface {
+	Lookup(ctx context.Context, isbn string) (domain.BookMetadata, error)
 }
 
 type Books struct {
 	repo BookRepository
+
+	// metadata is nil when enrichment is not configured
+	metadata   MetadataProvider
+	autoEnrich bool
+
+	// trashRetention is how long trashed books are kept before they are purged
+	trashRetention time.Duration
+
+	// requirePreconditions rejects writes without an If-Match header
+	requirePreconditions bool
 }
 
-func NewBooks(repo BookRepository) *Books {
+func NewBooks(repo BookRepository, metadata MetadataProvider, autoEnrich bool, trashRetention time.Duration,
+	requirePreconditions bool) *Books {
 	return &Books{
-		repo: repo,
+		repo:                 repo,
+		metadata:             metadata,
+		autoEnrich:           autoEnrich && metadata != nil,
+		trashRetention:       trashRetention,
+		requirePreconditions: requirePreconditions,
 	}
 }
+
 func (s *Books) Create(ctx context.Context, book domain.Book) error {
+	if book.ISBN != "" {
+		normalized, err := normalizeISBN(book.ISBN)
+		if err != nil {
+			return err
+		}
+		book.ISBN = normalized
+
+		if s.autoEnrich {
+			s.enrich(ctx, &book)
+		}
+	}
+
 	if book.PublishDate.IsZero() {
 		book.PublishDate = time.Now()
 	}
 
+	defaultAuthorRoles(book.Authors)
+	book.Tags = domain.NormalizeTags(book.Tags)
+
 	return s.repo.Create(ctx, book)
 }
 
@@ -35,10 +90,310 @@ func (s *Books) GetByID(ctx context.Context, id int64) (domain.Book, error) {
 	return s.repo.GetByID(ctx, id)
 }
 
-func (s *Books) GetAll(ctx context.Context) ([]domain.Book, error) { return s.repo.GetAll(ctx) }
+func (s *Books) GetAll(ctx context.Context, filter domain.BookFilter) ([]domain.Book, error) {
+	filter, err := normalizeBookFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetAll(ctx, filter)
+}
+
+// List returns a page of the books matching the filter.
+func (s *Books) List(ctx context.Context, filter domain.BookFilter, order string, p domain.Pagination) (domain.BookList, error) {
+	filter, err := normalizeBookFilter(filter)
+	if err != nil {
+		return domain.BookList{}, err
+	}
+
+	p.Normalize()
+
+	books, total, err := s.repo.List(ctx, filter, order, p)
+	if err != nil {
+		return domain.BookList{}, err
+	}
+
+	return domain.BookList{Books: books, Total: total, Page: p.Page, Limit: p.Limit}, nil
+}
+
+func (s *Books) Facets(ctx context.Context, filter domain.BookFilter) (domain.BookFacets, error) {
+	filter, err := normalizeBookFilter(filter)
+	if err != nil {
+		return domain.BookFacets{}, err
+	}
+
+	return s.repo.Facets(ctx, filter)
+}
+
+func normalizeBookFilter(filter domain.BookFilter) (domain.BookFilter, error) {
+	if filter.ISBN != "" {
+		normalized, err := normalizeISBN(filter.ISBN)
+		if err != nil {
+			return filter, err
+		}
+		filter.ISBN = normalized
+	}
+
+	if filter.Tag != "" {
+		if tags := domain.NormalizeTags([]string{filter.Tag}); len(tags) > 0 {
+			filter.Tag = tags[0]
+		}
+	}
+
+	return filter, nil
+}
+
+// Delete moves the book to the trash if it still matches the If-Match header.
+func (s *Books) Delete(ctx context.Context, userId, id int64, ifMatch string) error {
+	version, err := s.precondition(ctx, id, ifMatch)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, id, userId, version)
+}
+
+func (s *Books) GetTrash(ctx context.Context, p domain.Pagination) (domain.BookList, error) {
+	p.Normalize()
+
+	books, total, err := s.repo.GetTrash(ctx, p)
+	if err != nil {
+		return domain.BookList{}, err
+	}
+
+	return domain.BookList{
+		Books: books,
+		Total: total,
+		Page:  p.Page,
+		Limit: p.Limit,
+	}, nil
+}
+
+func (s *Books) GetTrashedByID(ctx context.Context, id int64) (domain.Book, error) {
+	return s.repo.GetTrashedByID(ctx, id)
+}
+
+// Restore takes the book out of the trash if it still matches the If-Match
+// header, which refers to the trashed book.
+func (s *Books) Restore(ctx context.Context, userId, id int64, ifMatch string) (domain.Book, error) {
+	version, err := s.matchPrecondition(ifMatch, func() (domain.Book, error) {
+		return s.repo.GetTrashedByID(ctx, id)
+	})
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	if err := s.repo.Restore(ctx, userId, id, version); err != nil {
+		return domain.Book{}, err
+	}
+
+	return s.repo.GetByID(ctx, id)
+}
+
+// PurgeTrash is a scheduled job that removes books that were trashed longer
+// than the retention period ago.
+func (s *Books) PurgeTrash(ctx context.Context) (map[string]interface{}, error) {
+	purged, err := s.repo.Purge(ctx, time.Now().Add(-s.trashRetention))
+
+	return map[string]interface{}{"purged": purged}, err
+}
+
+// Replace overwrites every editable field of the book if it still matches
+// the If-Match header and returns the new version of it. Fields left out are
+// cleared, except the publish date, which is set the way Create sets it.
+func (s *Books) Replace(ctx context.Context, userId, id int64, book domain.Book, ifMatch string) (domain.Book, error) {
+	version, err := s.precondition(ctx, id, ifMatch)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	if book.PublishDate.IsZero() {
+		book.PublishDate = time.Now()
+	}
+
+	return s.update(ctx, userId, id, version, book.Input())
+}
+
+// Patch applies a JSON merge patch or a JSON patch, depending on the media
+// type, to the representation of the book and saves the result once it is
+// a valid book. Read-only fields like the rating are ignored in the result.
+func (s *Books) Patch(ctx context.Context, userId, id int64, mediaType string, patch []byte, ifMatch string) (domain.Book, error) {
+	if ifMatch == "" && s.requirePreconditions {
+		return domain.Book{}, domain.ErrPreconditionRequired
+	}
+
+	current, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	if ifMatch != "" && !domain.MatchETag(ifMatch, current.ETag(), false) {
+		return domain.Book{}, domain.ErrPreconditionFailed
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	var patched []byte
+	switch mediaType {
+	case domain.MediaTypeMergePatch:
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	case domain.MediaTypeJSONPatch:
+		patched, err = jsonpatch.Apply(doc, patch)
+	default:
+		return domain.Book{}, domain.ErrUnsupportedPatch
+	}
+
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return domain.Book{}, fmt.Errorf("%w: %v", domain.ErrPatchTestFailed, err)
+		}
+		return domain.Book{}, fmt.Errorf("%w: %v", domain.ErrInvalidPatch, err)
+	}
+
+	var book domain.Book
+	if err := json.Unmarshal(patched, &book); err != nil {
+		return domain.Book{}, fmt.Errorf("%w: %v", domain.ErrInvalidPatch, err)
+	}
+
+	if err := book.Validate(); err != nil {
+		return domain.Book{}, fmt.Errorf("%w: %v", domain.ErrInvalidPatch, err)
+	}
+
+	// the book was patched as it was read, so it must not have changed since
+	return s.update(ctx, userId, id, current.Version, book.Input())
+}
+
+func (s *Books) update(ctx context.Context, userId, id int64, version int, inp domain.UpdateBookInput) (domain.Book, error) {
+	if inp.ISBN != nil && *inp.ISBN != "" {
+		normalized, err := normalizeISBN(*inp.ISBN)
+		if err != nil {
+			return domain.Book{}, err
+		}
+		inp.ISBN = &normalized
+	}
+
+	if inp.Authors != nil {
+		defaultAuthorRoles(*inp.Authors)
+	}
+
+	if inp.Tags != nil {
+		tags := domain.NormalizeTags(*inp.Tags)
+		inp.Tags = &tags
+	}
+
+	if err := s.repo.Update(ctx, userId, id, version, inp); err != nil {
+		return domain.Book{}, err
+	}
+
+	return s.repo.GetByID(ctx, id)
+}
+
+// precondition checks the If-Match header of a write against the book and
+// returns the version the write must apply to, 0 for any version. The
+// repository compares the version again, so a change made after the check
+// still fails the write.
+func (s *Books) precondition(ctx context.Context, id int64, ifMatch string) (int, error) {
+	return s.matchPrecondition(ifMatch, func() (domain.Book, error) {
+		return s.repo.GetByID(ctx, id)
+	})
+}
+
+// matchPrecondition is precondition for a book loaded by get.
+func (s *Books) matchPrecondition(ifMatch string, get func() (domain.Book, error)) (int, error) {
+	if ifMatch == "" {
+		if s.requirePreconditions {
+			return 0, domain.ErrPreconditionRequired
+		}
+		return 0, nil
+	}
+
+	book, err := get()
+	if err != nil {
+		return 0, err
+	}
+
+	if !domain.MatchETag(ifMatch, book.ETag(), false) {
+		return 0, domain.ErrPreconditionFailed
+	}
+
+	return book.Version, nil
+}
+
+// Enrich looks the ISBN up with the metadata provider and returns the record
+// as a draft for a new book.
+func (s *Books) Enrich(ctx context.Context, isbn string) (domain.BookMetadata, error) {
+	if s.metadata == nil {
+		return domain.BookMetadata{}, domain.ErrMetadataUnavailable
+	}
+
+	normalized, err := normalizeISBN(isbn)
+	if err != nil {
+		return domain.BookMetadata{}, err
+	}
+
+	return s.metadata.Lookup(ctx, normalized)
+}
+
+// enrich fills in fields the librarian left empty. A failed lookup does not
+// stop the book from being created.
+func (s *Books) enrich(ctx context.Context, book *domain.Book) {
+	m, err := s.metadata.Lookup(ctx, book.ISBN)
+	if err != nil {
+		if !errors.Is(err, domain.ErrMetadataNotFound) {
+			logrus.WithField("isbn", book.ISBN).WithError(err).Warn("book enrichment failed")
+		}
+		return
+	}
+
+	if book.Title == "" {
+		book.Title = m.Title
+	}
+
+	if book.Author == "" {
+		book.Author = strings.Join(m.Authors, "; ")
+	}
+
+	if book.Publisher == "" {
+		book.Publisher = m.Publisher
+	}
+
+	if book.PublishDate.IsZero() && m.PublishDate != nil {
+		book.PublishDate = *m.PublishDate
+	}
+
+	if book.PageCount == 0 {
+		book.PageCount = m.PageCount
+	}
+
+	if book.Language == "" {
+		book.Language = m.Language
+	}
+
+	if book.CoverURL == "" {
+		book.CoverURL = m.CoverURL
+	}
+
+	if book.Description == "" {
+		book.Description = m.Description
+	}
+}
+
+func defaultAuthorRoles(authors []domain.BookAuthor) {
+	for i := range authors {
+		if authors[i].Role == "" {
+			authors[i].Role = domain.AuthorRoleAuthor
+		}
+	}
+}
 
-func (s *Books) Delete(ctx context.Context, id int64) error { return s.repo.Delete(ctx, id) }
+func normalizeISBN(s string) (string, error) {
+	normalized, err := isbn.Normalize(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", domain.ErrInvalidISBN, err)
+	}
 
-func (s *Books) Update(ctx context.Context, id int64, inp domain.UpdateBookInput) error {
-	return s.repo.Update(ctx, id, inp)
+	return normalized, nil
 }
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/citation"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"io"
+	"strings"
+)
+
+// maxCitationEntries is the most entries a BibTeX or RIS import may have.
+const maxCitationEntries = 10000
+
+// ImportCitations creates the books of a BibTeX or RIS file one by one with
+// Create. An entry is a duplicate when a catalogued book or an earlier entry
+// has the same ISBN or, for entries without one, the same title and author.
+// Duplicates are reported and skipped.
+func (s *Books) ImportCitations(ctx context.Context, userId int64, r io.Reader, format string, dryRun bool) (domain.CitationImport, error) {
+	entries, err := citation.Read(r, format)
+	if err != nil {
+		return domain.CitationImport{}, err
+	}
+
+	if len(entries) > maxCitationEntries {
+		return domain.CitationImport{}, domain.ErrImportTooLarge
+	}
+
+	report := domain.CitationImport{
+		Format:     format,
+		DryRun:     dryRun,
+		Total:      len(entries),
+		Duplicates: make([]domain.CitationDuplicate, 0),
+		Errors:     make([]domain.ImportRowError, 0),
+	}
+
+	seen := make(map[string]int)
+	for i, entry := range entries {
+		n := i + 1
+
+		book, err := entry.Book, entry.Err
+		if err == nil {
+			err = prepareCitationBook(&book, userId)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, domain.ImportRowError{Row: n, Error: err.Error()})
+			continue
+		}
+
+		key := book.ISBN
+		if key == "" {
+			key = strings.ToLower(book.Title) + "\x00" + strings.ToLower(book.Author)
+		}
+
+		if first, ok := seen[key]; ok {
+			report.Duplicates = append(report.Duplicates, domain.CitationDuplicate{Entry: n, Key: entry.Key, FirstEntry: first})
+			continue
+		}
+		seen[key] = n
+
+		id, err := s.repo.FindDuplicate(ctx, book.ISBN, book.Title, book.Author)
+		if err != nil {
+			return domain.CitationImport{}, err
+		}
+
+		if id != 0 {
+			report.Duplicates = append(report.Duplicates, domain.CitationDuplicate{Entry: n, Key: entry.Key, BookID: id})
+			continue
+		}
+
+		if !dryRun {
+			if err := s.Create(ctx, book); err != nil {
+				// another book can take the ISBN between the check and the insert
+				if errors.Is(err, domain.ErrISBNTaken) {
+					report.Errors = append(report.Errors, domain.ImportRowError{Row: n, Error: err.Error()})
+					continue
+				}
+				return domain.CitationImport{}, err
+			}
+		}
+
+		report.Imported++
+	}
+
+	return report, nil
+}
+
+// prepareCitationBook checks an entry before it is created. Languages given
+// as names, as is common in BibTeX, are dropped instead of failing the entry.
+func prepareCitationBook(book *domain.Book, userId int64) error {
+	if book.Title == "" {
+		return domain.ErrImportTitleRequired
+	}
+
+	if book.Language != "" && !domain.ValidLanguage(book.Language) {
+		book.Language = ""
+	}
+
+	if err := book.Validate(); err != nil {
+		return err
+	}
+
+	if book.ISBN != "" {
+		normalized, err := normalizeISBN(book.ISBN)
+		if err != nil {
+			return err
+		}
+		book.ISBN = normalized
+	}
+
+	book.CreatedBy = &userId
+
+	return nil
+}
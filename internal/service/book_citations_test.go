@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// catalogued is a BookRepository whose catalogue holds one book by ISBN.
+type catalogued struct {
+	createdBooks
+	isbn string
+	id   int64
+}
+
+func (r *catalogued) FindDuplicate(ctx context.Context, isbn, title, author string) (int64, error) {
+	if isbn != "" && isbn == r.isbn {
+		return r.id, nil
+	}
+
+	return 0, nil
+}
+
+const citationImportFile = `TY  - BOOK
+TI  - Numbers
+SN  - 9780140449136
+ER  -
+TY  - BOOK
+TI  - Numbers, again
+SN  - 978-0-14-044913-6
+ER  -
+TY  - BOOK
+TI  - Catalogued
+SN  - 978-0-306-40615-7
+ER  -
+TY  - BOOK
+ID  - dune
+TI  - Dune
+AU  - Herbert, Frank
+ER  -
+TY  - BOOK
+ID  - dune-again
+TI  - DUNE
+AU  - herbert, frank
+ER  -
+TY  - BOOK
+AU  - Nobody
+ER  -
+`
+
+func TestBooksImportCitations(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		repo := &catalogued{isbn: "9780306406157", id: 9}
+		s := NewBooks(repo, nil, false, 0, false)
+
+		report, err := s.ImportCitations(context.Background(), 3, strings.NewReader(citationImportFile),
+			domain.CitationFormatRIS, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := domain.CitationImport{
+			Format:   domain.CitationFormatRIS,
+			DryRun:   dryRun,
+			Total:    6,
+			Imported: 2,
+			Duplicates: []domain.CitationDuplicate{
+				{Entry: 2, FirstEntry: 1},
+				{Entry: 3, BookID: 9},
+				{Entry: 5, Key: "dune-again", FirstEntry: 4},
+			},
+			Errors: []domain.ImportRowError{{Row: 6, Error: domain.ErrImportTitleRequired.Error()}},
+		}
+		if !reflect.DeepEqual(report, want) {
+			t.Errorf("dry run %v: report =\n%+v\nwant\n%+v", dryRun, report, want)
+		}
+
+		var titles []string
+		for _, book := range repo.books {
+			titles = append(titles, book.Title)
+			if book.CreatedBy == nil || *book.CreatedBy != 3 {
+				t.Errorf("%s created by %v, want user 3", book.Title, book.CreatedBy)
+			}
+		}
+
+		if dryRun && len(titles) != 0 {
+			t.Errorf("dry run created %q", titles)
+		}
+		if !dryRun && !reflect.DeepEqual(titles, []string{"Numbers", "Dune"}) {
+			t.Errorf("created %q, want Numbers and Dune", titles)
+		}
+	}
+}
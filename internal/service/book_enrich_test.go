@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/internal/metadata"
+	"testing"
+	"time"
+)
+
+// createdBooks is a BookRepository that only records created books.
+type createdBooks struct {
+	BookRepository
+	books []domain.Book
+}
+
+func (r *createdBooks) Create(ctx context.Context, book domain.Book) error {
+	r.books = append(r.books, book)
+	return nil
+}
+
+func newFixtureBooks(t *testing.T, autoEnrich bool) (*Books, *createdBooks) {
+	t.Helper()
+
+	fixture, err := metadata.NewFixture("../metadata/testdata/books.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &createdBooks{}
+
+	return NewBooks(repo, fixture, autoEnrich, 0, false), repo
+}
+
+func TestBooksEnrich(t *testing.T) {
+	s, _ := newFixtureBooks(t, false)
+
+	tests := []struct {
+		isbn  string
+		title string
+		err   error
+	}{
+		{"978-0-261-10334-4", "The Hobbit", nil},
+		{"0261103342", "The Hobbit", nil},
+		{"9780140449136", "", domain.ErrMetadataNotFound},
+		{"9780261103345", "", domain.ErrInvalidISBN},
+	}
+
+	for _, tt := range tests {
+		record, err := s.Enrich(context.Background(), tt.isbn)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Enrich(%s) error = %v, want %v", tt.isbn, err, tt.err)
+			continue
+		}
+
+		if record.Title != tt.title {
+			t.Errorf("Enrich(%s) title = %q, want %q", tt.isbn, record.Title, tt.title)
+		}
+	}
+}
+
+func TestBooksEnrichWithoutProvider(t *testing.T) {
+	s := NewBooks(&createdBooks{}, nil, true, 0, false)
+
+	if _, err := s.Enrich(context.Background(), "9780261103344"); !errors.Is(err, domain.ErrMetadataUnavailable) {
+		t.Errorf("Enrich error = %v, want ErrMetadataUnavailable", err)
+	}
+}
+
+func TestBooksCreateEnriches(t *testing.T) {
+	s, repo := newFixtureBooks(t, true)
+
+	err := s.Create(context.Background(), domain.Book{ISBN: "0-261-10334-2", Title: "The Hobbit, or There and Back Again"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book := repo.books[0]
+
+	// fields the librarian set are kept, the others come from the record
+	if book.Title != "The Hobbit, or There and Back Again" {
+		t.Errorf("Title = %q", book.Title)
+	}
+
+	if book.ISBN != "9780261103344" || book.Author != "J. R. R. Tolkien" || book.Publisher != "HarperCollins" ||
+		book.PageCount != 310 || book.Language != "en" || book.CoverURL == "" || book.Description == "" {
+		t.Errorf("book = %+v", book)
+	}
+
+	if !book.PublishDate.Equal(time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("PublishDate = %s, want 1937-09-21", book.PublishDate)
+	}
+}
+
+func TestBooksCreateWithoutRecord(t *testing.T) {
+	s, repo := newFixtureBooks(t, true)
+
+	if err := s.Create(context.Background(), domain.Book{ISBN: "9780140449136", Title: "The Odyssey"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if book := repo.books[0]; book.Title != "The Odyssey" || book.Author != "" || book.PublishDate.IsZero() {
+		t.Errorf("book = %+v", book)
+	}
+}
+
+func TestBooksCreateWithoutAutoEnrich(t *testing.T) {
+	s, repo := newFixtureBooks(t, false)
+
+	if err := s.Create(context.Background(), domain.Book{ISBN: "9780261103344", Title: "The Hobbit"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if book := repo.books[0]; book.Author != "" || book.Publisher != "" {
+		t.Errorf("book was enriched: %+v", book)
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/pkg/xlsx"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export writes the books matching the filter to w as they are read from the
+// catalog.
+func (s *Books) Export(ctx context.Context, w io.Writer, opts domain.ExportOptions) error {
+	filter, err := normalizeBookFilter(opts.Filter)
+	if err != nil {
+		return err
+	}
+	opts.Filter = filter
+
+	enc, err := newExportEncoder(w, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Export(ctx, opts, enc.Write); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+type exportEncoder interface {
+	Write(book domain.Book) error
+	Close() error
+}
+
+// exportColumn is a field of the exported books. The value is written as is
+// to JSON and flattened for CSV and XLSX.
+type exportColumn struct {
+	name  string
+	value func(b domain.Book) interface{}
+}
+
+// exportColumns are the columns of an export in order. Authors and genres
+// are flattened to their ids, so CSV exports can be imported again.
+func exportColumns(opts domain.ExportOptions) []exportColumn {
+	columns := []exportColumn{
+		{"id", func(b domain.Book) interface{} { return b.ID }},
+		{"title", func(b domain.Book) interface{} { return b.Title }},
+		{"author", func(b domain.Book) interface{} { return b.Author }},
+		{"publish_date", func(b domain.Book) interface{} { return b.PublishDate }},
+		{"isbn", func(b domain.Book) interface{} { return b.ISBN }},
+		{"publisher", func(b domain.Book) interface{} { return b.Publisher }},
+		{"language", func(b domain.Book) interface{} { return b.Language }},
+		{"page_count", func(b domain.Book) interface{} { return b.PageCount }},
+		{"format", func(b domain.Book) interface{} { return b.Format }},
+		{"edition", func(b domain.Book) interface{} { return b.Edition }},
+		{"series", func(b domain.Book) interface{} { return b.Series }},
+		{"series_position", func(b domain.Book) interface{} { return b.SeriesPosition }},
+		{"cover_url", func(b domain.Book) interface{} { return b.CoverURL }},
+		{"description", func(b domain.Book) interface{} { return b.Description }},
+	}
+
+	if opts.Authors {
+		columns = append(columns, exportColumn{"authors", func(b domain.Book) interface{} { return b.Authors }})
+	}
+
+	if opts.Genres {
+		columns = append(columns, exportColumn{"genres", func(b domain.Book) interface{} { return b.Genres }})
+	}
+
+	if opts.Tags {
+		columns = append(columns, exportColumn{"tags", func(b domain.Book) interface{} { return b.Tags }})
+	}
+
+	if opts.Reviews {
+		columns = append(columns,
+			exportColumn{"rating", func(b domain.Book) interface{} { return b.Rating }},
+			exportColumn{"rating_count", func(b domain.Book) interface{} { return b.RatingCount }},
+		)
+	}
+
+	return columns
+}
+
+func newExportEncoder(w io.Writer, opts domain.ExportOptions) (exportEncoder, error) {
+	columns := exportColumns(opts)
+
+	switch opts.Format {
+	case domain.ExportFormatCSV:
+		return newCSVExport(w, columns)
+	case domain.ExportFormatXLSX:
+		return newXLSXExport(w, columns)
+	case domain.ExportFormatJSON:
+		return newJSONExport(w, columns, false)
+	case domain.ExportFormatNDJSON:
+		return newJSONExport(w, columns, true)
+	default:
+		return nil, domain.ErrUnsupportedExport
+	}
+}
+
+// flatValue turns a value into a spreadsheet cell. Numbers are kept, lists
+// are joined with "; ".
+func flatValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format(time.DateOnly)
+	case []domain.BookAuthor:
+		ids := make([]string, len(v))
+		for i, author := range v {
+			ids[i] = strconv.FormatInt(author.AuthorID, 10)
+		}
+		return strings.Join(ids, "; ")
+	case []domain.GenreRef:
+		ids := make([]string, len(v))
+		for i, genre := range v {
+			ids[i] = strconv.FormatInt(genre.ID, 10)
+		}
+		return strings.Join(ids, "; ")
+	case []string:
+		return strings.Join(v, "; ")
+	default:
+		return v
+	}
+}
+
+type csvExport struct {
+	w       *csv.Writer
+	columns []exportColumn
+}
+
+func newCSVExport(w io.Writer, columns []exportColumn) (*csvExport, error) {
+	e := &csvExport{w: csv.NewWriter(w), columns: columns}
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+
+	return e, e.w.Write(header)
+}
+
+func (e *csvExport) Write(book domain.Book) error {
+	record := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		record[i] = fmt.Sprint(flatValue(column.value(book)))
+	}
+
+	return e.w.Write(record)
+}
+
+func (e *csvExport) Close() error {
+	e.w.Flush()
+
+	return e.w.Error()
+}
+
+type xlsxExport struct {
+	w       *xlsx.Writer
+	columns []exportColumn
+}
+
+func newXLSXExport(w io.Writer, columns []exportColumn) (*xlsxExport, error) {
+	xw, err := xlsx.NewWriter(w, "Books")
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+
+	return &xlsxExport{w: xw, columns: columns}, xw.WriteRow(header...)
+}
+
+func (e *xlsxExport) Write(book domain.Book) error {
+	row := make([]interface{}, len(e.columns))
+	for i, column := range e.columns {
+		row[i] = flatValue(column.value(book))
+	}
+
+	return e.w.WriteRow(row...)
+}
+
+func (e *xlsxExport) Close() error {
+	return e.w.Close()
+}
+
+// jsonExport writes a JSON array of books, or one book per line for NDJSON.
+// Keys keep the order of the columns.
+type jsonExport struct {
+	w       *bufio.Writer
+	columns []exportColumn
+	lines   bool
+	count   int
+}
+
+func newJSONExport(w io.Writer, columns []exportColumn, lines bool) (*jsonExport, error) {
+	e := &jsonExport{w: bufio.NewWriter(w), columns: columns, lines: lines}
+	if lines {
+		return e, nil
+	}
+
+	_, err := e.w.WriteString("[")
+
+	return e, err
+}
+
+func (e *jsonExport) Write(book domain.Book) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range e.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		value, err := json.Marshal(column.value(book))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&buf, "%q:", column.name)
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	switch {
+	case e.lines:
+		buf.WriteByte('\n')
+	case e.count > 0:
+		e.w.WriteByte(',')
+	}
+	e.count++
+
+	_, err := e.w.Write(buf.Bytes())
+
+	return err
+}
+
+func (e *jsonExport) Close() error {
+	if !e.lines {
+		e.w.WriteString("]")
+	}
+
+	return e.w.Flush()
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"time"
+)
+
+type BookImportRepository interface {
+	Import(ctx context.Context, books []domain.Book, opts domain.ImportOptions, progress func(processed int)) (map[int]error, error)
+}
+
+type ImportRepository interface {
+	Create(ctx context.Context, imp domain.BookImport, lease time.Duration) (int64, error)
+	SetProgress(ctx context.Context, id int64, processed int, lease time.Duration) error
+	Finish(ctx context.Context, imp domain.BookImport) error
+	Get(ctx context.Context, id int64) (domain.BookImport, error)
+	FailInterrupted(ctx context.Context) (int64, error)
+}
+
+// importLease is how long a background import may go without progress
+// before it counts as interrupted.
+const importLease = 10 * time.Minute
+
+// Imports adds books to the catalog in bulk.
+type Imports struct {
+	books   BookImportRepository
+	repo    ImportRepository
+	auditor Auditor
+
+	// maxRows is the largest import accepted
+	maxRows int
+	// asyncThreshold is the number of rows above which imports run in the background
+	asyncThreshold int
+}
+
+func NewImports(books BookImportRepository, repo ImportRepository, auditor Auditor, maxRows, asyncThreshold int) *Imports {
+	return &Imports{
+		books:          books,
+		repo:           repo,
+		auditor:        auditor,
+		maxRows:        maxRows,
+		asyncThreshold: asyncThreshold,
+	}
+}
+
+// Import reads the books from r and imports them. Imports that ask for it or
+// have more rows than the async threshold are stored and run in the
+// background; their report only has the id and the row count until they
+// finish.
+func (s *Imports) Import(ctx context.Context, userId int64, r io.Reader, opts domain.ImportOptions) (domain.BookImport, error) {
+	rows, err := decodeImport(r, opts, s.maxRows)
+	if err != nil {
+		return domain.BookImport{}, err
+	}
+
+	imp := domain.BookImport{
+		Status:    domain.ImportStatusRunning,
+		Format:    opts.Format,
+		DryRun:    opts.DryRun,
+		Atomic:    opts.Atomic,
+		CreatedBy: &userId,
+		Total:     len(rows),
+		Errors:    make([]domain.ImportRowError, 0),
+		CreatedAt: time.Now(),
+	}
+
+	books, rowNumbers, rowErrs := prepareImport(userId, rows)
+
+	if !opts.Async && len(rows) <= s.asyncThreshold {
+		if err := s.run(ctx, &imp, books, rowNumbers, rowErrs, opts, nil); err != nil {
+			return domain.BookImport{}, err
+		}
+
+		return imp, nil
+	}
+
+	if imp.ID, err = s.repo.Create(ctx, imp, importLease); err != nil {
+		return domain.BookImport{}, err
+	}
+
+	orgId, err := domain.OrgIDFromContext(ctx)
+	if err != nil {
+		return domain.BookImport{}, err
+	}
+
+	// the import outlives the request
+	go func(imp domain.BookImport) {
+		ctx := domain.WithOrgID(context.Background(), orgId)
+		invalid := len(rows) - len(books)
+
+		err := s.run(ctx, &imp, books, rowNumbers, rowErrs, opts, func(processed int) {
+			if err := s.repo.SetProgress(ctx, imp.ID, invalid+processed, importLease); err != nil {
+				logrus.WithField("import", imp.ID).WithError(err).Warn("failed to record import progress")
+			}
+		})
+		if err != nil {
+			imp.Status = domain.ImportStatusFailed
+			imp.Error = err.Error()
+
+			logrus.WithFields(logrus.Fields{
+				"method": "Imports.Import",
+				"import": imp.ID,
+			}).Error("Import failed", err)
+		}
+
+		if err := s.repo.Finish(ctx, imp); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"method": "Imports.Import",
+				"import": imp.ID,
+			}).Error("Failed to record import", err)
+		}
+	}(imp)
+
+	return imp, nil
+}
+
+// FailInterrupted fails the background imports a stopped process left
+// running, so their progress doesn't show them as running forever.
+func (s *Imports) FailInterrupted(ctx context.Context) error {
+	failed, err := s.repo.FailInterrupted(ctx)
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		logrus.WithField("imports", failed).Warn("Failed interrupted imports")
+	}
+
+	return nil
+}
+
+func (s *Imports) Get(ctx context.Context, id int64) (domain.BookImport, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// prepareImport validates and normalizes the decoded rows. It returns the
+// books to insert with their row numbers and the errors of the other rows.
+func prepareImport(userId int64, rows []importRow) ([]domain.Book, []int, []domain.ImportRowError) {
+	books := make([]domain.Book, 0, len(rows))
+	rowNumbers := make([]int, 0, len(rows))
+	rowErrs := make([]domain.ImportRowError, 0)
+	isbns := make(map[string]int)
+
+	now := time.Now()
+	for i, row := range rows {
+		book, err := row.book, row.err
+		if err == nil {
+			err = prepareImportBook(&book, userId, now)
+		}
+
+		if err == nil && book.ISBN != "" {
+			if _, ok := isbns[book.ISBN]; ok {
+				err = domain.ErrDuplicateImportISBN
+			}
+			isbns[book.ISBN] = i
+		}
+
+		if err != nil {
+			rowErrs = append(rowErrs, domain.ImportRowError{Row: i + 1, Error: err.Error()})
+			continue
+		}
+
+		books = append(books, book)
+		rowNumbers = append(rowNumbers, i+1)
+	}
+
+	return books, rowNumbers, rowErrs
+}
+
+// prepareImportBook applies the rules of Create to an imported book. Fields
+// that are not written by users are dropped.
+func prepareImportBook(book *domain.Book, userId int64, now time.Time) error {
+	if book.Title == "" {
+		return domain.ErrImportTitleRequired
+	}
+
+	if err := book.Validate(); err != nil {
+		return err
+	}
+
+	if book.ISBN != "" {
+		normalized, err := normalizeISBN(book.ISBN)
+		if err != nil {
+			return err
+		}
+		book.ISBN = normalized
+	}
+
+	if book.PublishDate.IsZero() {
+		book.PublishDate = now
+	}
+
+	defaultAuthorRoles(book.Authors)
+	book.Tags = domain.NormalizeTags(book.Tags)
+
+	*book = domain.Book{
+		Title:          book.Title,
+		Author:         book.Author,
+		PublishDate:    book.PublishDate,
+		CreatedBy:      &userId,
+		ISBN:           book.ISBN,
+		Publisher:      book.Publisher,
+		Language:       book.Language,
+		PageCount:      book.PageCount,
+		Format:         book.Format,
+		Edition:        book.Edition,
+		Series:         book.Series,
+		SeriesPosition: book.SeriesPosition,
+		CoverURL:       book.CoverURL,
+		Description:    book.Description,
+		Authors:        book.Authors,
+		Genres:         book.Genres,
+		Tags:           book.Tags,
+	}
+
+	return nil
+}
+
+// run inserts the books and completes the report. An atomic import with
+// invalid rows still checks the valid ones against the catalog, so the report
+// lists every failing row, but saves nothing.
+func (s *Imports) run(ctx context.Context, imp *domain.BookImport, books []domain.Book, rowNumbers []int,
+	rowErrs []domain.ImportRowError, opts domain.ImportOptions, progress func(processed int)) error {
+	insertOpts := opts
+	if opts.Atomic && len(rowErrs) > 0 {
+		insertOpts.DryRun = true
+	}
+
+	failed, err := s.books.Import(ctx, books, insertOpts, progress)
+	if err != nil {
+		return err
+	}
+
+	for i, err := range failed {
+		rowErrs = append(rowErrs, domain.ImportRowError{Row: rowNumbers[i], Error: err.Error()})
+	}
+	sort.Slice(rowErrs, func(i, j int) bool { return rowErrs[i].Row < rowErrs[j].Row })
+
+	finishedAt := time.Now()
+	imp.FinishedAt = &finishedAt
+	imp.Processed = imp.Total
+	imp.Errors = rowErrs
+	imp.Failed = len(rowErrs)
+	imp.Imported = len(books) - len(failed)
+	imp.Status = domain.ImportStatusSucceeded
+
+	if opts.Atomic && len(rowErrs) > 0 {
+		imp.Imported = 0
+		imp.Status = domain.ImportStatusFailed
+	}
+
+	if !opts.DryRun && imp.Imported > 0 {
+		s.auditor.Log(ctx, domain.AuditEvent{
+			ActorID:  *imp.CreatedBy,
+			Action:   domain.AuditActionImport,
+			Entity:   domain.AuditEntityBook,
+			EntityID: imp.ID,
+			Details: map[string]interface{}{
+				"format":   imp.Format,
+				"imported": imp.Imported,
+				"failed":   imp.Failed,
+			},
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/internal/domain"
+)
+
+func (s *Books) GetRevisions(ctx context.Context, bookId int64, p domain.Pagination) (domain.BookRevisionList, error) {
+	p.Normalize()
+
+	revisions, total, err := s.repo.GetRevisions(ctx, bookId, p)
+	if err != nil {
+		return domain.BookRevisionList{}, err
+	}
+
+	return domain.BookRevisionList{
+		Revisions: revisions,
+		Total:     total,
+		Page:      p.Page,
+		Limit:     p.Limit,
+	}, nil
+}
+
+// GetRevision returns the book as it was after the revision.
+func (s *Books) GetRevision(ctx context.Context, bookId int64, revision int) (domain.BookRevision, error) {
+	return s.repo.GetRevision(ctx, bookId, revision)
+}
+
+// Diff compares two revisions of a book. A zero to compares with the latest revision.
+func (s *Books) Diff(ctx context.Context, bookId int64, from, to int) (domain.BookDiff, error) {
+	a, err := s.repo.GetRevision(ctx, bookId, from)
+	if err != nil {
+		return domain.BookDiff{}, err
+	}
+
+	var b domain.BookRevision
+	if to == 0 {
+		b, err = s.repo.GetLatestRevision(ctx, bookId)
+	} else {
+		b, err = s.repo.GetRevision(ctx, bookId, to)
+	}
+	if err != nil {
+		return domain.BookDiff{}, err
+	}
+
+	changes, err := domain.DiffBooks(*a.Book, *b.Book)
+	if err != nil {
+		return domain.BookDiff{}, err
+	}
+
+	return domain.BookDiff{
+		BookID:  bookId,
+		From:    a.Revision,
+		To:      b.Revision,
+		Changes: changes,
+	}, nil
+}
+
+// Revert sets the book back to how it was after the revision if it still
+// matches the If-Match header. The revert is recorded as a new revision, so
+// it can be undone as well.
+func (s *Books) Revert(ctx context.Context, userId, id int64, revision int, ifMatch string) (domain.Book, error) {
+	version, err := s.precondition(ctx, id, ifMatch)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	if err := s.repo.Revert(ctx, userId, id, revision, version); err != nil {
+		return domain.Book{}, err
+	}
+
+	return s.repo.GetByID(ctx, id)
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+type CirculationRepository interface {
+	CreateCopy(ctx context.Context, c domain.Copy, pickupWindow time.Duration) (int64, error)
+	GetCopy(ctx context.Context, id int64) (domain.Copy, error)
+	GetCopies(ctx context.Context, bookId int64) ([]domain.Copy, error)
+	UpdateCopy(ctx context.Context, id int64, inp domain.UpdateCopyInput) error
+	DeleteCopy(ctx context.Context, id int64) error
+
+	Checkout(ctx context.Context, loan domain.Loan, policy domain.LoanPolicy) (int64, error)
+	Return(ctx context.Context, loan domain.Loan, returnedBy int64, condition string, pickupWindow time.Duration) (int64, error)
+	Renew(ctx context.Context, id int64, dueAt time.Time, maxRenewals int) error
+	GetLoan(ctx context.Context, id int64) (domain.Loan, error)
+	GetOpenLoan(ctx context.Context, copyId int64) (domain.Loan, error)
+	GetLoans(ctx context.Context, filter domain.LoanFilter) ([]domain.Loan, int, error)
+	MarkOverdue(ctx context.Context, now time.Time) ([]domain.Loan, error)
+
+	PlaceHold(ctx context.Context, hold domain.Hold) (int64, error)
+	GetHold(ctx context.Context, id int64) (domain.Hold, error)
+	GetHolds(ctx context.Context, filter domain.HoldFilter) ([]domain.Hold, int, error)
+	CancelHold(ctx context.Context, id int64, pickupWindow time.Duration) error
+	ExpireHolds(ctx context.Context, pickupWindow time.Duration) ([]int64, error)
+}
+
+// Circulation manages the physical copies of books and lends them to the
+// members of an organization.
+type Circulation struct {
+	repo    CirculationRepository
+	auditor Auditor
+	policy  domain.LoanPolicy
+}
+
+func NewCirculation(repo CirculationRepository, auditor Auditor, policy domain.LoanPolicy) *Circulation {
+	return &Circulation{
+		repo:    repo,
+		auditor: auditor,
+		policy:  policy,
+	}
+}
+
+func (s *Circulation) CreateCopy(ctx context.Context, userId, bookId int64, inp domain.CreateCopyInput) (domain.Copy, error) {
+	c := domain.Copy{
+		BookID:    bookId,
+		Barcode:   inp.Barcode,
+		Location:  inp.Location,
+		Condition: inp.Condition,
+		CreatedAt: time.Now(),
+	}
+
+	if c.Condition == "" {
+		c.Condition = domain.CopyConditionGood
+	}
+
+	id, err := s.repo.CreateCopy(ctx, c, s.policy.PickupWindow)
+	if err != nil {
+		return domain.Copy{}, err
+	}
+
+	s.log(ctx, userId, domain.AuditActionCreate, domain.AuditEntityCopy, id, map[string]interface{}{
+		"book_id": bookId,
+		"barcode": c.Barcode,
+	})
+
+	return s.repo.GetCopy(ctx, id)
+}
+
+func (s *Circulation) GetCopy(ctx context.Context, id int64) (domain.Copy, error) {
+	return s.repo.GetCopy(ctx, id)
+}
+
+func (s *Circulation) GetCopies(ctx context.Context, bookId int64) ([]domain.Copy, error) {
+	return s.repo.GetCopies(ctx, bookId)
+}
+
+func (s *Circulation) UpdateCopy(ctx context.Context, userId, id int64, inp domain.UpdateCopyInput) (domain.Copy, error) {
+	if err := s.repo.UpdateCopy(ctx, id, inp); err != nil {
+		return domain.Copy{}, err
+	}
+
+	s.log(ctx, userId, domain.AuditActionUpdate, domain.AuditEntityCopy, id, nil)
+
+	return s.repo.GetCopy(ctx, id)
+}
+
+func (s *Circulation) DeleteCopy(ctx context.Context, userId, id int64) error {
+	if err := s.repo.DeleteCopy(ctx, id); err != nil {
+		return err
+	}
+
+	s.log(ctx, userId, domain.AuditActionDelete, domain.AuditEntityCopy, id, nil)
+
+	return nil
+}
+
+// Checkout lends a copy for the loan period of the policy. Librarians can
+// lend to other members and choose the due date.
+func (s *Circulation) Checkout(ctx context.Context, userId, copyId int64, inp domain.CheckoutInput, librarian bool) (domain.Loan, error) {
+	now := time.Now()
+
+	loan := domain.Loan{
+		CopyID:       copyId,
+		BorrowerID:   userId,
+		CheckedOutBy: &userId,
+		CheckedOutAt: now,
+		DueAt:        now.Add(s.policy.Period),
+	}
+
+	if inp.BorrowerID != 0 && inp.BorrowerID != userId {
+		if !librarian {
+			return domain.Loan{}, domain.ErrLibrarianRequired
+		}
+		loan.BorrowerID = inp.BorrowerID
+	}
+
+	if inp.DueAt != nil {
+		if !librarian {
+			return domain.Loan{}, domain.ErrLibrarianRequired
+		}
+
+		if !inp.DueAt.After(now) {
+			return domain.Loan{}, domain.ErrInvalidDueDate
+		}
+		loan.DueAt = *inp.DueAt
+	}
+
+	id, err := s.repo.Checkout(ctx, loan, s.policy)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+
+	s.log(ctx, userId, domain.AuditActionCheckout, domain.AuditEntityLoan, id, map[string]interface{}{
+		"copy_id":     copyId,
+		"borrower_id": loan.BorrowerID,
+		"due_at":      loan.DueAt,
+	})
+
+	return s.repo.GetLoan(ctx, id)
+}
+
+// Return closes the open loan of the copy and keeps the copy for the first
+// waiting hold. Only the borrower and librarians can return a copy.
+func (s *Circulation) Return(ctx context.Context, userId, copyId int64, inp domain.ReturnInput, librarian bool) (domain.Loan, error) {
+	loan, err := s.repo.GetOpenLoan(ctx, copyId)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+
+	if loan.BorrowerID != userId && !librarian {
+		return domain.Loan{}, domain.ErrNotBorrower
+	}
+
+	holdId, err := s.repo.Return(ctx, loan, userId, inp.Condition, s.policy.PickupWindow)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+
+	details := map[string]interface{}{
+		"copy_id":     copyId,
+		"borrower_id": loan.BorrowerID,
+		"overdue":     loan.Overdue(time.Now()),
+	}
+	if inp.Condition != "" {
+		details["condition"] = inp.Condition
+	}
+	if holdId != 0 {
+		details["hold_id"] = holdId
+	}
+
+	s.log(ctx, userId, domain.AuditActionReturn, domain.AuditEntityLoan, loan.ID, details)
+
+	return s.repo.GetLoan(ctx, loan.ID)
+}
+
+// Renew extends an open loan by the loan period from now, never moving the
+// due date back, up to the renewal limit of the policy.
+func (s *Circulation) Renew(ctx context.Context, userId, id int64, librarian bool) (domain.Loan, error) {
+	loan, err := s.GetLoan(ctx, userId, id, librarian)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+
+	if loan.ReturnedAt != nil {
+		return domain.Loan{}, domain.ErrLoanReturned
+	}
+
+	dueAt := time.Now().Add(s.policy.Period)
+	if dueAt.Before(loan.DueAt) {
+		dueAt = loan.DueAt
+	}
+
+	if err := s.repo.Renew(ctx, id, dueAt, s.policy.MaxRenewals); err != nil {
+		return domain.Loan{}, err
+	}
+
+	s.log(ctx, userId, domain.AuditActionRenew, domain.AuditEntityLoan, id, map[string]interface{}{
+		"due_at":   dueAt,
+		"renewals": loan.Renewals + 1,
+	})
+
+	return s.repo.GetLoan(ctx, id)
+}
+
+// GetLoan returns a loan. Members only see their own loans.
+func (s *Circulation) GetLoan(ctx context.Context, userId, id int64, librarian bool) (domain.Loan, error) {
+	loan, err := s.repo.GetLoan(ctx, id)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+
+	if loan.BorrowerID != userId && !librarian {
+		return domain.Loan{}, domain.ErrLoanNotFound
+	}
+
+	return loan, nil
+}
+
+func (s *Circulation) GetLoans(ctx context.Context, filter domain.LoanFilter) (domain.LoanList, error) {
+	filter.Normalize()
+
+	loans, total, err := s.repo.GetLoans(ctx, filter)
+	if err != nil {
+		return domain.LoanList{}, err
+	}
+
+	return domain.LoanList{
+		Loans: loans,
+		Total: total,
+		Page:  filter.Page,
+		Limit: filter.Limit,
+	}, nil
+}
+
+// MarkOverdueLoans is a scheduled job that flags loans once they are past
+// due and records an audit event for each of them.
+func (s *Circulation) MarkOverdueLoans(ctx context.Context) (map[string]interface{}, error) {
+	loans, err := s.repo.MarkOverdue(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, loan := range loans {
+		s.log(ctx, 0, domain.AuditActionOverdue, domain.AuditEntityLoan, loan.ID, map[string]interface{}{
+			"copy_id":     loan.CopyID,
+			"borrower_id": loan.BorrowerID,
+			"due_at":      loan.DueAt,
+		})
+	}
+
+	return map[string]interface{}{"overdue": len(loans)}, nil
+}
+
+func (s *Circulation) log(ctx context.Context, actorId int64, action, entity string, id int64, details map[string]interface{}) {
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  actorId,
+		Action:   action,
+		Entity:   entity,
+		EntityID: id,
+		Details:  details,
+	})
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"strings"
+	"time"
+)
+
+type GenreRepository interface {
+	Create(ctx context.Context, genre domain.Genre) (int64, error)
+	GetByID(ctx context.Context, id int64) (domain.Genre, error)
+	GetAll(ctx context.Context) ([]domain.Genre, error)
+	Update(ctx context.Context, id int64, inp domain.UpdateGenreInput) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type TagRepository interface {
+	GetAll(ctx context.Context) ([]domain.TagCount, error)
+}
+
+// Genres manages the genre taxonomy and lists tags.
+type Genres struct {
+	repo     GenreRepository
+	tagsRepo TagRepository
+}
+
+func NewGenres(repo GenreRepository, tagsRepo TagRepository) *Genres {
+	return &Genres{
+		repo:     repo,
+		tagsRepo: tagsRepo,
+	}
+}
+
+func (s *Genres) Create(ctx context.Context, inp domain.CreateGenreInput) (domain.Genre, error) {
+	id, err := s.repo.Create(ctx, domain.Genre{
+		ParentID:  inp.ParentID,
+		Name:      strings.TrimSpace(inp.Name),
+		Slug:      inp.Slug,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return domain.Genre{}, err
+	}
+
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Genres) GetByID(ctx context.Context, id int64) (domain.Genre, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Genres) GetAll(ctx context.Context) ([]domain.Genre, error) {
+	return s.repo.GetAll(ctx)
+}
+
+func (s *Genres) Update(ctx context.Context, id int64, inp domain.UpdateGenreInput) (domain.Genre, error) {
+	if err := s.repo.Update(ctx, id, inp); err != nil {
+		return domain.Genre{}, err
+	}
+
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Genres) Delete(ctx context.Context, id int64) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *Genres) Tags(ctx context.Context) ([]domain.TagCount, error) {
+	return s.tagsRepo.GetAll(ctx)
+}
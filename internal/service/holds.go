@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+// PlaceHold queues the user for a book that has no copy to check out.
+func (s *Circulation) PlaceHold(ctx context.Context, userId int64, inp domain.HoldInput) (domain.Hold, error) {
+	id, err := s.repo.PlaceHold(ctx, domain.Hold{
+		BookID:    inp.BookID,
+		UserID:    userId,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	s.log(ctx, userId, domain.AuditActionHold, domain.AuditEntityHold, id, map[string]interface{}{
+		"book_id": inp.BookID,
+	})
+
+	return s.repo.GetHold(ctx, id)
+}
+
+// GetHold returns a hold. Members only see their own holds.
+func (s *Circulation) GetHold(ctx context.Context, userId, id int64, librarian bool) (domain.Hold, error) {
+	hold, err := s.repo.GetHold(ctx, id)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	if hold.UserID != userId && !librarian {
+		return domain.Hold{}, domain.ErrHoldNotFound
+	}
+
+	return hold, nil
+}
+
+func (s *Circulation) GetHolds(ctx context.Context, filter domain.HoldFilter) (domain.HoldList, error) {
+	filter.Normalize()
+
+	holds, total, err := s.repo.GetHolds(ctx, filter)
+	if err != nil {
+		return domain.HoldList{}, err
+	}
+
+	return domain.HoldList{
+		Holds: holds,
+		Total: total,
+		Page:  filter.Page,
+		Limit: filter.Limit,
+	}, nil
+}
+
+// CancelHold closes the user's hold; librarians can cancel any hold. A copy
+// kept for the hold goes to the next one in the queue.
+func (s *Circulation) CancelHold(ctx context.Context, userId, id int64, librarian bool) error {
+	hold, err := s.GetHold(ctx, userId, id, librarian)
+	if err != nil {
+		return err
+	}
+
+	if !hold.Active() {
+		return domain.ErrHoldClosed
+	}
+
+	if err := s.repo.CancelHold(ctx, id, s.policy.PickupWindow); err != nil {
+		return err
+	}
+
+	s.log(ctx, userId, domain.AuditActionCancel, domain.AuditEntityHold, id, map[string]interface{}{
+		"book_id": hold.BookID,
+		"status":  hold.Status,
+	})
+
+	return nil
+}
+
+// ExpireHolds is a scheduled job that lapses ready holds that were not
+// picked up within the pickup window.
+func (s *Circulation) ExpireHolds(ctx context.Context) (map[string]interface{}, error) {
+	expired, err := s.repo.ExpireHolds(ctx, s.policy.PickupWindow)
+
+	// holds expired before a failure are committed and audited all the same
+	for _, id := range expired {
+		s.log(ctx, 0, domain.AuditActionExpire, domain.AuditEntityHold, id, nil)
+	}
+
+	return map[string]interface{}{"expired": len(expired)}, err
+}
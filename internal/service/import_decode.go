@@ -0,0 +1,298 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importRow is a decoded row of an import, or the reason it could not be decoded.
+type importRow struct {
+	book domain.Book
+	err  error
+}
+
+// decodeImport reads the rows of an upload as they arrive. Malformed files
+// fail as a whole, rows that do not decode into a book are reported with the
+// row. Reading stops once there are more than limit rows.
+func decodeImport(r io.Reader, opts domain.ImportOptions, limit int) ([]importRow, error) {
+	var rows []importRow
+	var err error
+
+	switch opts.Format {
+	case domain.ImportFormatCSV:
+		rows, err = decodeCSV(r, opts.Columns, limit)
+	case domain.ImportFormatJSON:
+		rows, err = decodeJSON(r, limit)
+	case domain.ImportFormatNDJSON:
+		rows, err = decodeNDJSON(r, limit)
+	default:
+		return nil, domain.ErrUnsupportedImport
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) > limit {
+		return nil, domain.ErrImportTooLarge
+	}
+
+	return rows, nil
+}
+
+func decodeJSON(r io.Reader, limit int) ([]importRow, error) {
+	dec := json.NewDecoder(r)
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("%w: expected a JSON array of books", domain.ErrInvalidImport)
+	}
+
+	rows := make([]importRow, 0)
+	for dec.More() && len(rows) <= limit {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("%w: %v", domain.ErrInvalidImport, err)
+		}
+
+		rows = append(rows, jsonRow(raw))
+	}
+
+	return rows, nil
+}
+
+func decodeNDJSON(r io.Reader, limit int) ([]importRow, error) {
+	br := bufio.NewReader(r)
+
+	rows := make([]importRow, 0)
+	for len(rows) <= limit {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%w: %v", domain.ErrInvalidImport, err)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			rows = append(rows, jsonRow(line))
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return rows, nil
+}
+
+func jsonRow(raw []byte) importRow {
+	var book domain.Book
+	if err := json.Unmarshal(raw, &book); err != nil {
+		return importRow{err: err}
+	}
+
+	return importRow{book: book}
+}
+
+func decodeCSV(r io.Reader, columns map[string]string, limit int) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return []importRow{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidImport, err)
+	}
+
+	index, err := csvIndex(header, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]importRow, 0)
+	for len(rows) <= limit {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", domain.ErrInvalidImport, err)
+		}
+
+		if len(record) != len(header) {
+			rows = append(rows, importRow{err: fmt.Errorf("expected %d fields, got %d", len(header), len(record))})
+			continue
+		}
+
+		book, err := csvBook(record, index)
+		rows = append(rows, importRow{book: book, err: err})
+	}
+
+	return rows, nil
+}
+
+// csvIndex maps book fields to the position of their column in the header.
+func csvIndex(header []string, columns map[string]string) (map[string]int, error) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for field := range columns {
+		if !isImportColumn(field) {
+			return nil, fmt.Errorf("%w: unknown field %q", domain.ErrInvalidColumnMap, field)
+		}
+	}
+
+	index := make(map[string]int)
+	for _, field := range domain.ImportColumns {
+		name, mapped := columns[field]
+		if !mapped {
+			name = field
+		}
+
+		i, ok := positions[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			if mapped {
+				return nil, fmt.Errorf("%w: no column %q for %s", domain.ErrInvalidColumnMap, name, field)
+			}
+			continue
+		}
+
+		index[field] = i
+	}
+
+	if _, ok := index["title"]; !ok {
+		return nil, fmt.Errorf("%w: no title column", domain.ErrInvalidColumnMap)
+	}
+
+	return index, nil
+}
+
+func isImportColumn(field string) bool {
+	for _, column := range domain.ImportColumns {
+		if column == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+func csvBook(record []string, index map[string]int) (domain.Book, error) {
+	var book domain.Book
+
+	for field, i := range index {
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+
+		if err := setCSVField(&book, field, value); err != nil {
+			return domain.Book{}, fmt.Errorf("%s: %w", field, err)
+		}
+	}
+
+	return book, nil
+}
+
+func setCSVField(book *domain.Book, field, value string) error {
+	var err error
+
+	switch field {
+	case "title":
+		book.Title = value
+	case "author":
+		book.Author = value
+	case "publish_date":
+		book.PublishDate, err = parseImportDate(value)
+	case "isbn":
+		book.ISBN = value
+	case "publisher":
+		book.Publisher = value
+	case "language":
+		book.Language = value
+	case "page_count":
+		book.PageCount, err = strconv.Atoi(value)
+	case "format":
+		book.Format = value
+	case "edition":
+		book.Edition = value
+	case "series":
+		book.Series = value
+	case "series_position":
+		book.SeriesPosition, err = strconv.ParseFloat(value, 64)
+	case "cover_url":
+		book.CoverURL = value
+	case "description":
+		book.Description = value
+	case "tags":
+		book.Tags = splitList(value)
+	case "authors":
+		var ids []int64
+		if ids, err = parseIds(value); err == nil {
+			for _, id := range ids {
+				book.Authors = append(book.Authors, domain.BookAuthor{AuthorID: id})
+			}
+		}
+	case "genres":
+		var ids []int64
+		if ids, err = parseIds(value); err == nil {
+			for _, id := range ids {
+				book.Genres = append(book.Genres, domain.GenreRef{ID: id})
+			}
+		}
+	}
+
+	return err
+}
+
+// parseImportDate accepts a date or an RFC 3339 timestamp.
+func parseImportDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("expected YYYY-MM-DD or an RFC 3339 timestamp")
+	}
+
+	return t, nil
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func parseIds(value string) ([]int64, error) {
+	items := splitList(value)
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		id, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", item)
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/pkg/totp"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodesCount = 10
+	totpSkew           = 1
+
+	// After mfaMaxAttempts codes without an accepted one, verification is
+	// locked for mfaLockout. The lockout outlasts the MFA token, so the
+	// challenge that hit the limit is spent and a new one needs the password.
+	mfaMaxAttempts = 5
+	mfaLockout     = 15 * time.Minute
+)
+
+type MFARepository interface {
+	Save(ctx context.Context, mfa domain.UserMFA) error
+	Get(ctx context.Context, userId int64) (domain.UserMFA, error)
+	Enable(ctx context.Context, userId int64, step int64, recoveryCodes []string) error
+	UseStep(ctx context.Context, userId int64, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userId int64, codes []string) error
+	UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error
+	TakeAttempt(ctx context.Context, userId int64, max int, lockout time.Duration) error
+	ResetAttempts(ctx context.Context, userId int64) error
+	Delete(ctx context.Context, userId int64) error
+}
+
+type Encryptor interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+}
+
+type MFA struct {
+	repo      MFARepository
+	usersRepo UserRepository
+	hasher    PasswordHasher
+	encryptor Encryptor
+
+	issuer string
+}
+
+func NewMFA(repo MFARepository, usersRepo UserRepository, hasher PasswordHasher, encryptor Encryptor, issuer string) *MFA {
+	return &MFA{
+		repo:      repo,
+		usersRepo: usersRepo,
+		hasher:    hasher,
+		encryptor: encryptor,
+		issuer:    issuer,
+	}
+}
+
+// Enroll generates a new secret. Two-factor authentication is not enabled
+// until the user confirms it with a code from the authenticator app.
+func (s *MFA) Enroll(ctx context.Context, userId int64) (domain.MFAEnrollment, error) {
+	current, err := s.repo.Get(ctx, userId)
+	if err != nil && !errors.Is(err, domain.ErrMFANotEnrolled) {
+		return domain.MFAEnrollment{}, err
+	}
+
+	if current.Enabled {
+		return domain.MFAEnrollment{}, domain.ErrMFAAlreadyEnabled
+	}
+
+	user, err := s.usersRepo.GetByID(ctx, userId)
+	if err != nil {
+		return domain.MFAEnrollment{}, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return domain.MFAEnrollment{}, err
+	}
+
+	encrypted, err := s.encryptor.Encrypt(secret)
+	if err != nil {
+		return domain.MFAEnrollment{}, err
+	}
+
+	if err := s.repo.Save(ctx, domain.UserMFA{
+		UserID:    userId,
+		Secret:    encrypted,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return domain.MFAEnrollment{}, err
+	}
+
+	return domain.MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+func (s *MFA) Confirm(ctx context.Context, userId int64, code string) (domain.RecoveryCodes, error) {
+	mfa, err := s.repo.Get(ctx, userId)
+	if err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	if mfa.Enabled {
+		return domain.RecoveryCodes{}, domain.ErrMFAAlreadyEnabled
+	}
+
+	step, err := s.validateCode(mfa, code)
+	if err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	codes, hashes, err := s.newRecoveryCodes()
+	if err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	if err := s.repo.Enable(ctx, userId, step, hashes); err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	return domain.RecoveryCodes{Codes: codes}, nil
+}
+
+func (s *MFA) Enabled(ctx context.Context, userId int64) (bool, error) {
+	mfa, err := s.repo.Get(ctx, userId)
+	if err != nil {
+		if errors.Is(err, domain.ErrMFANotEnrolled) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return mfa.Enabled, nil
+}
+
+// Verify accepts either a TOTP code or one of the recovery codes.
+// Each of them can be used only once. Every code counts as an attempt until
+// one is accepted, so guesses are limited however they are spread.
+func (s *MFA) Verify(ctx context.Context, userId int64, code, recoveryCode string) error {
+	mfa, err := s.repo.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if !mfa.Enabled {
+		return domain.ErrMFANotEnabled
+	}
+
+	if err := s.repo.TakeAttempt(ctx, userId, mfaMaxAttempts, mfaLockout); err != nil {
+		return err
+	}
+
+	if err := s.useCode(ctx, mfa, code, recoveryCode); err != nil {
+		return err
+	}
+
+	return s.repo.ResetAttempts(ctx, userId)
+}
+
+func (s *MFA) useCode(ctx context.Context, mfa domain.UserMFA, code, recoveryCode string) error {
+	if code != "" {
+		step, err := s.validateCode(mfa, code)
+		if err != nil {
+			return err
+		}
+
+		return s.repo.UseStep(ctx, mfa.UserID, step)
+	}
+
+	hash, err := s.hasher.Hash(normalizeRecoveryCode(recoveryCode))
+	if err != nil {
+		return err
+	}
+
+	return s.repo.UseRecoveryCode(ctx, mfa.UserID, hash)
+}
+
+func (s *MFA) Disable(ctx context.Context, userId int64, inp domain.MFADisableInput) error {
+	if err := s.Verify(ctx, userId, inp.Code, inp.RecoveryCode); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, userId)
+}
+
+func (s *MFA) RegenerateRecoveryCodes(ctx context.Context, userId int64, code string) (domain.RecoveryCodes, error) {
+	if err := s.Verify(ctx, userId, code, ""); err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	codes, hashes, err := s.newRecoveryCodes()
+	if err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	return domain.RecoveryCodes{Codes: codes}, nil
+}
+
+func (s *MFA) validateCode(mfa domain.UserMFA, code string) (int64, error) {
+	secret, err := s.encryptor.Decrypt(mfa.Secret)
+	if err != nil {
+		return 0, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return 0, domain.ErrInvalidMFACode
+	}
+
+	if step <= mfa.LastStep {
+		return 0, domain.ErrMFACodeAlreadyUsed
+	}
+
+	return step, nil
+}
+
+func (s *MFA) newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		raw := fmt.Sprintf("%x", b)
+		codes[i] = raw[:5] + "-" + raw[5:]
+
+		hash, err := s.hasher.Hash(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		hashes[i] = hash
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
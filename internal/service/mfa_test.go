@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/pkg/totp"
+	"testing"
+	"time"
+)
+
+const mfaSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// memoryMFA is an MFARepository for one enabled user that counts attempts
+// the way the user_mfa table does.
+type memoryMFA struct {
+	MFARepository
+	mfa         domain.UserMFA
+	attempts    int
+	lockedUntil time.Time
+}
+
+func (r *memoryMFA) Get(ctx context.Context, userId int64) (domain.UserMFA, error) {
+	return r.mfa, nil
+}
+
+func (r *memoryMFA) UseStep(ctx context.Context, userId int64, step int64) error {
+	if step <= r.mfa.LastStep {
+		return domain.ErrMFACodeAlreadyUsed
+	}
+
+	r.mfa.LastStep = step
+	return nil
+}
+
+func (r *memoryMFA) TakeAttempt(ctx context.Context, userId int64, max int, lockout time.Duration) error {
+	if time.Now().Before(r.lockedUntil) {
+		return domain.ErrMFALocked
+	}
+
+	r.attempts++
+	if r.attempts >= max {
+		r.attempts = 0
+		r.lockedUntil = time.Now().Add(lockout)
+	}
+
+	return nil
+}
+
+func (r *memoryMFA) ResetAttempts(ctx context.Context, userId int64) error {
+	r.attempts = 0
+	r.lockedUntil = time.Time{}
+	return nil
+}
+
+type plainEncryptor struct{}
+
+func (plainEncryptor) Encrypt(plaintext string) (string, error)  { return plaintext, nil }
+func (plainEncryptor) Decrypt(ciphertext string) (string, error) { return ciphertext, nil }
+
+func newTestMFA() (*MFA, *memoryMFA) {
+	repo := &memoryMFA{mfa: domain.UserMFA{UserID: 1, Secret: mfaSecret, Enabled: true}}
+	return NewMFA(repo, nil, plainHasher{}, plainEncryptor{}, "cruda"), repo
+}
+
+func currentCode(t *testing.T, offset int64) string {
+	t.Helper()
+
+	code, err := totp.Code(mfaSecret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+// wrongCode returns a code outside the accepted window.
+func wrongCode(t *testing.T) string {
+	t.Helper()
+
+	for offset := int64(10); ; offset++ {
+		code := currentCode(t, offset)
+		if _, ok := totp.Validate(mfaSecret, code, time.Now(), totpSkew); !ok {
+			return code
+		}
+	}
+}
+
+func TestMFAVerifyLocksOut(t *testing.T) {
+	s, repo := newTestMFA()
+	ctx := context.Background()
+	wrong := wrongCode(t)
+
+	for i := 0; i < mfaMaxAttempts; i++ {
+		if err := s.Verify(ctx, 1, wrong, ""); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Fatalf("attempt %d error = %v, want ErrInvalidMFACode", i, err)
+		}
+	}
+
+	// even the right code is refused once the limit is reached
+	if err := s.Verify(ctx, 1, currentCode(t, 0), ""); !errors.Is(err, domain.ErrMFALocked) {
+		t.Fatalf("Verify error = %v, want ErrMFALocked", err)
+	}
+
+	repo.lockedUntil = time.Now()
+	if err := s.Verify(ctx, 1, currentCode(t, 0), ""); err != nil {
+		t.Errorf("Verify after the lockout: %v", err)
+	}
+}
+
+func TestMFAVerifyResetsAttempts(t *testing.T) {
+	s, repo := newTestMFA()
+	ctx := context.Background()
+	wrong := wrongCode(t)
+
+	for i := 0; i < mfaMaxAttempts-1; i++ {
+		s.Verify(ctx, 1, wrong, "")
+	}
+
+	// the last attempt allowed is the right code
+	if err := s.Verify(ctx, 1, currentCode(t, 0), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if repo.attempts != 0 || !repo.lockedUntil.IsZero() {
+		t.Errorf("%d attempts, locked until %s after an accepted code", repo.attempts, repo.lockedUntil)
+	}
+
+	if err := s.Verify(ctx, 1, wrong, ""); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Errorf("Verify error = %v, want ErrInvalidMFACode", err)
+	}
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/pkg/oidc"
+	"github.com/golang-jwt/jwt"
+	"strings"
+	"time"
+)
+
+const oidcStateTtl = 10 * time.Minute
+
+type OIDCProvider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	Exchange(ctx context.Context, code, verifier, nonce string) (oidc.Claims, error)
+}
+
+type IdentityRepository interface {
+	Create(ctx context.Context, identity domain.Identity) error
+	Get(ctx context.Context, provider, subject string) (domain.Identity, error)
+}
+
+type TokenIssuer interface {
+	SingInByID(ctx context.Context, userId int64) (domain.SingInResult, error)
+}
+
+// oidcState travels in a signed cookie between the login redirect and the
+// callback. Its type keeps it from passing for an access token and back.
+type oidcState struct {
+	jwt.StandardClaims
+	Type     string `json:"typ"`
+	Provider string `json:"prv"`
+	State    string `json:"st"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"cv"`
+}
+
+type OIDC struct {
+	providers  map[string]OIDCProvider
+	identities IdentityRepository
+	usersRepo  UserRepository
+	issuer     TokenIssuer
+	hasher     PasswordHasher
+	auditor    Auditor
+
+	stateSecret []byte
+}
+
+// NewOIDC signs states with a key derived from the secret, so the secret can
+// be shared with access tokens without the two being interchangeable.
+func NewOIDC(providers map[string]OIDCProvider, identities IdentityRepository, usersRepo UserRepository, issuer TokenIssuer,
+	hasher PasswordHasher, auditor Auditor, secret []byte) *OIDC {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(tokenTypeOIDCState))
+
+	return &OIDC{
+		providers:   providers,
+		identities:  identities,
+		usersRepo:   usersRepo,
+		issuer:      issuer,
+		hasher:      hasher,
+		auditor:     auditor,
+		stateSecret: mac.Sum(nil),
+	}
+}
+
+// Begin returns the provider URL to redirect to and the signed state that
+// has to be presented again on callback.
+func (s *OIDC) Begin(ctx context.Context, provider string) (string, string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", "", domain.ErrUnknownProvider
+	}
+
+	st := oidcState{
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(oidcStateTtl).Unix()},
+		Type:           tokenTypeOIDCState,
+		Provider:       provider,
+	}
+
+	var err error
+	if st.State, err = oidc.NewNonce(); err != nil {
+		return "", "", err
+	}
+	if st.Nonce, err = oidc.NewNonce(); err != nil {
+		return "", "", err
+	}
+	if st.Verifier, err = oidc.NewVerifier(); err != nil {
+		return "", "", err
+	}
+
+	url, err := p.AuthCodeURL(ctx, st.State, st.Nonce, st.Verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, st).SignedString(s.stateSecret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return url, signed, nil
+}
+
+// Complete handles the provider callback, links or creates the local user
+// and signs them in.
+func (s *OIDC) Complete(ctx context.Context, provider, signedState, state, code string) (domain.SingInResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return domain.SingInResult{}, domain.ErrUnknownProvider
+	}
+
+	st, err := s.parseState(signedState)
+	if err != nil || st.Provider != provider || st.State != state {
+		return domain.SingInResult{}, domain.ErrInvalidOIDCState
+	}
+
+	claims, err := p.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		return domain.SingInResult{}, err
+	}
+
+	userId, err := s.resolveUser(ctx, domain.ExternalIdentity{
+		Provider:      provider,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	})
+	if err != nil {
+		return domain.SingInResult{}, err
+	}
+
+	return s.issuer.SingInByID(ctx, userId)
+}
+
+func (s *OIDC) parseState(signed string) (*oidcState, error) {
+	st := &oidcState{}
+
+	t, err := jwt.ParseWithClaims(signed, st, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+
+		return s.stateSecret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.Valid || st.Type != tokenTypeOIDCState {
+		return nil, errors.New("invalid state")
+	}
+
+	return st, nil
+}
+
+// resolveUser finds the user linked to the identity. Unknown identities are
+// linked to an existing user by verified email, or a new user is created.
+func (s *OIDC) resolveUser(ctx context.Context, ext domain.ExternalIdentity) (int64, error) {
+	identity, err := s.identities.Get(ctx, ext.Provider, ext.Subject)
+	if err == nil {
+		return identity.UserID, nil
+	}
+
+	if !errors.Is(err, domain.ErrIdentityNotFound) {
+		return 0, err
+	}
+
+	if ext.Email == "" {
+		return 0, domain.ErrIdentityEmailMissing
+	}
+
+	if !ext.EmailVerified {
+		return 0, domain.ErrEmailNotVerified
+	}
+
+	user, err := s.usersRepo.GetByEmail(ctx, ext.Email)
+	if err != nil {
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			return 0, err
+		}
+
+		user, err = s.createUser(ctx, ext)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := s.identities.Create(ctx, domain.Identity{
+		UserID:    user.ID,
+		Provider:  ext.Provider,
+		Subject:   ext.Subject,
+		Email:     ext.Email,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+func (s *OIDC) createUser(ctx context.Context, ext domain.ExternalIdentity) (domain.User, error) {
+	name := ext.Name
+	if name == "" {
+		name = strings.Split(ext.Email, "@")[0]
+	}
+
+	// the user signs in through the provider, the local password is unusable
+	secret, err := randomHex(32)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	password, err := s.hasher.Hash(secret)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	if err := s.usersRepo.Create(ctx, domain.User{
+		Name:         name,
+		Email:        ext.Email,
+		Password:     password,
+		RegisteredAt: time.Now(),
+	}); err != nil {
+		return domain.User{}, err
+	}
+
+	user, err := s.usersRepo.GetByEmail(ctx, ext.Email)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  user.ID,
+		Action:   domain.AuditActionRegister,
+		Entity:   domain.AuditEntityUser,
+		EntityID: user.ID,
+		Details:  map[string]interface{}{"provider": ext.Provider},
+	})
+
+	return user, nil
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/pkg/oidc"
+	"github.com/dewi911/cruda-app/pkg/oidc/oidctest"
+	"strconv"
+	"testing"
+)
+
+// memoryIdentities is an IdentityRepository kept in a map.
+type memoryIdentities struct {
+	identities map[string]domain.Identity
+}
+
+func (r *memoryIdentities) Create(ctx context.Context, identity domain.Identity) error {
+	r.identities[identity.Provider+"/"+identity.Subject] = identity
+	return nil
+}
+
+func (r *memoryIdentities) Get(ctx context.Context, provider, subject string) (domain.Identity, error) {
+	identity, ok := r.identities[provider+"/"+subject]
+	if !ok {
+		return domain.Identity{}, domain.ErrIdentityNotFound
+	}
+
+	return identity, nil
+}
+
+// memoryUsers is a UserRepository that only finds and creates users by email.
+type memoryUsers struct {
+	UserRepository
+	users []domain.User
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user domain.User) error {
+	user.ID = int64(len(r.users) + 1)
+	r.users = append(r.users, user)
+	return nil
+}
+
+func (r *memoryUsers) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return domain.User{}, domain.ErrUserNotFound
+}
+
+type userTokens struct{}
+
+func (userTokens) SingInByID(ctx context.Context, userId int64) (domain.SingInResult, error) {
+	return domain.SingInResult{AccessToken: strconv.FormatInt(userId, 10)}, nil
+}
+
+type plainHasher struct{}
+
+func (plainHasher) Hash(password string) (string, error) {
+	return password, nil
+}
+
+type discardAuditor struct{}
+
+func (discardAuditor) Log(ctx context.Context, event domain.AuditEvent) {}
+
+type oidcTest struct {
+	s          *OIDC
+	srv        *oidctest.Server
+	identities *memoryIdentities
+	users      *memoryUsers
+}
+
+func newOIDCTest(t *testing.T, users ...domain.User) *oidcTest {
+	t.Helper()
+
+	srv, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:      srv.URL,
+		ClientID:    "library",
+		RedirectURL: "https://library.example/auth/oidc/mock/callback",
+	})
+
+	tt := &oidcTest{
+		srv:        srv,
+		identities: &memoryIdentities{identities: map[string]domain.Identity{}},
+		users:      &memoryUsers{users: users},
+	}
+	tt.s = NewOIDC(map[string]OIDCProvider{"mock": provider}, tt.identities, tt.users, userTokens{},
+		plainHasher{}, discardAuditor{}, []byte("secret"))
+
+	return tt
+}
+
+// login runs the flow from Begin to Complete with the user signing in at the issuer.
+func (tt *oidcTest) login(t *testing.T, user oidctest.User) (domain.SingInResult, error) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	authURL, signed, err := tt.s.Begin(ctx, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state, err := tt.srv.Authorize(authURL, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tt.s.Complete(ctx, "mock", signed, state, code)
+}
+
+var mockUser = oidctest.User{Subject: "sub-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+
+func TestOIDCStateMismatch(t *testing.T) {
+	tt := newOIDCTest(t)
+	ctx := context.Background()
+
+	authURL, signed, err := tt.s.Begin(ctx, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state, err := tt.srv.Authorize(authURL, mockUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, other, err := tt.s.Begin(ctx, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		signed   string
+		state    string
+		err      error
+	}{
+		{"state of another login", "mock", signed, state + "x", domain.ErrInvalidOIDCState},
+		{"cookie of another login", "mock", other, state, domain.ErrInvalidOIDCState},
+		{"tampered cookie", "mock", signed + "x", state, domain.ErrInvalidOIDCState},
+		{"unknown provider", "other", signed, state, domain.ErrUnknownProvider},
+	}
+
+	for _, tc := range tests {
+		if _, err := tt.s.Complete(ctx, tc.provider, tc.signed, tc.state, code); !errors.Is(err, tc.err) {
+			t.Errorf("%s: Complete error = %v, want %v", tc.name, err, tc.err)
+		}
+	}
+
+	// the code was never redeemed
+	if v := tt.srv.Verifiers(); len(v) != 0 {
+		t.Errorf("token endpoint was called %d times", len(v))
+	}
+}
+
+func TestOIDCWrongNonce(t *testing.T) {
+	tt := newOIDCTest(t)
+	tt.srv.Nonce = "replayed"
+
+	if _, err := tt.login(t, mockUser); err == nil {
+		t.Fatal("Complete accepted an ID token with another nonce")
+	}
+
+	if len(tt.users.users) != 0 || len(tt.identities.identities) != 0 {
+		t.Errorf("users %v, identities %v after a failed login", tt.users.users, tt.identities.identities)
+	}
+}
+
+func TestOIDCSendsVerifier(t *testing.T) {
+	tt := newOIDCTest(t)
+
+	// the mock issuer only redeems the code with the verifier of its challenge
+	if _, err := tt.login(t, mockUser); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := tt.srv.Verifiers(); len(v) != 1 || v[0] == "" {
+		t.Errorf("token endpoint got verifiers %q", v)
+	}
+}
+
+func TestOIDCLinksVerifiedEmail(t *testing.T) {
+	tt := newOIDCTest(t, domain.User{ID: 7, Name: "Alice", Email: "alice@example.com"})
+
+	res, err := tt.login(t, mockUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.AccessToken != "7" {
+		t.Errorf("signed in as %q, want user 7", res.AccessToken)
+	}
+
+	if len(tt.users.users) != 1 {
+		t.Errorf("%d users, want the existing one only", len(tt.users.users))
+	}
+
+	if identity, err := tt.identities.Get(context.Background(), "mock", "sub-1"); err != nil || identity.UserID != 7 {
+		t.Errorf("identity = %+v, %v, want it linked to user 7", identity, err)
+	}
+}
+
+func TestOIDCRefusesUnverifiedEmail(t *testing.T) {
+	tt := newOIDCTest(t, domain.User{ID: 7, Name: "Alice", Email: "alice@example.com"})
+
+	user := mockUser
+	user.EmailVerified = false
+
+	if _, err := tt.login(t, user); !errors.Is(err, domain.ErrEmailNotVerified) {
+		t.Errorf("Complete error = %v, want ErrEmailNotVerified", err)
+	}
+
+	if len(tt.identities.identities) != 0 {
+		t.Errorf("identities %v, want none", tt.identities.identities)
+	}
+}
+
+func TestOIDCCreatesUser(t *testing.T) {
+	tt := newOIDCTest(t)
+
+	res, err := tt.login(t, mockUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tt.users.users) != 1 {
+		t.Fatalf("%d users, want 1", len(tt.users.users))
+	}
+
+	user := tt.users.users[0]
+	if user.Name != "Alice" || user.Email != "alice@example.com" || user.Password == "" || res.AccessToken != "1" {
+		t.Errorf("user = %+v, signed in as %q", user, res.AccessToken)
+	}
+
+	// the next login goes through the identity even with the email changed
+	next := mockUser
+	next.Email = "alice@example.org"
+
+	if res, err := tt.login(t, next); err != nil || res.AccessToken != "1" {
+		t.Errorf("second login = %+v, %v, want user 1", res, err)
+	}
+
+	if len(tt.users.users) != 1 {
+		t.Errorf("%d users after the second login, want 1", len(tt.users.users))
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+const invitationTtl = 7 * 24 * time.Hour
+
+type OrgsRepository interface {
+	Create(ctx context.Context, org domain.Organization, ownerId int64) (int64, error)
+	GetByID(ctx context.Context, id int64) (domain.Organization, error)
+	GetMembership(ctx context.Context, orgId, userId int64) (domain.Membership, error)
+	GetByUser(ctx context.Context, userId int64) ([]domain.Membership, error)
+	GetMembers(ctx context.Context, orgId int64) ([]domain.OrgMember, error)
+	SetMemberRole(ctx context.Context, orgId, userId int64, role string) error
+	RemoveMember(ctx context.Context, orgId, userId int64) error
+	CreateInvitation(ctx context.Context, inv domain.Invitation) (int64, error)
+	AcceptInvitation(ctx context.Context, tokenHash string, userId int64, email string) (domain.Invitation, error)
+}
+
+type OrgTokenIssuer interface {
+	IssueForOrg(ctx context.Context, userId, orgId int64) (string, string, error)
+}
+
+type Orgs struct {
+	repo      OrgsRepository
+	usersRepo UserRepository
+	tokens    OrgTokenIssuer
+	mailer    EmailSender
+	auditor   Auditor
+	publicURL string
+}
+
+func NewOrgs(repo OrgsRepository, usersRepo UserRepository, tokens OrgTokenIssuer, mailer EmailSender, auditor Auditor, publicURL string) *Orgs {
+	return &Orgs{
+		repo:      repo,
+		usersRepo: usersRepo,
+		tokens:    tokens,
+		mailer:    mailer,
+		auditor:   auditor,
+		publicURL: publicURL,
+	}
+}
+
+func (s *Orgs) Create(ctx context.Context, userId int64, inp domain.CreateOrgInput) (domain.Organization, error) {
+	org := domain.Organization{
+		Name:      inp.Name,
+		Slug:      inp.Slug,
+		CreatedAt: time.Now(),
+	}
+
+	id, err := s.repo.Create(ctx, org, userId)
+	if err != nil {
+		return domain.Organization{}, err
+	}
+	org.ID = id
+
+	s.log(ctx, userId, domain.AuditActionCreate, id, map[string]interface{}{"slug": org.Slug})
+
+	return org, nil
+}
+
+func (s *Orgs) List(ctx context.Context, userId int64) ([]domain.Membership, error) {
+	return s.repo.GetByUser(ctx, userId)
+}
+
+func (s *Orgs) Get(ctx context.Context, userId, orgId int64) (domain.Membership, error) {
+	return s.repo.GetMembership(ctx, orgId, userId)
+}
+
+func (s *Orgs) Members(ctx context.Context, userId, orgId int64) ([]domain.OrgMember, error) {
+	if _, err := s.repo.GetMembership(ctx, orgId, userId); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetMembers(ctx, orgId)
+}
+
+func (s *Orgs) SetMemberRole(ctx context.Context, userId, orgId, memberId int64, role string) error {
+	if err := s.requireOwner(ctx, orgId, userId); err != nil {
+		return err
+	}
+
+	if err := s.repo.SetMemberRole(ctx, orgId, memberId, role); err != nil {
+		return err
+	}
+
+	s.log(ctx, userId, domain.AuditActionRoleChange, orgId, map[string]interface{}{"user_id": memberId, "role": role})
+
+	return nil
+}
+
+// RemoveMember removes a member. Owners can remove anyone, other members
+// can only leave the organization themselves.
+func (s *Orgs) RemoveMember(ctx context.Context, userId, orgId, memberId int64) error {
+	if userId != memberId {
+		if err := s.requireOwner(ctx, orgId, userId); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.RemoveMember(ctx, orgId, memberId); err != nil {
+		return err
+	}
+
+	s.log(ctx, userId, domain.AuditActionLeave, orgId, map[string]interface{}{"user_id": memberId})
+
+	return nil
+}
+
+// Invite emails a one-time token that lets the recipient join the organization.
+func (s *Orgs) Invite(ctx context.Context, userId, orgId int64, inp domain.InviteInput) (domain.Invitation, error) {
+	if err := s.requireOwner(ctx, orgId, userId); err != nil {
+		return domain.Invitation{}, err
+	}
+
+	org, err := s.repo.GetByID(ctx, orgId)
+	if err != nil {
+		return domain.Invitation{}, err
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return domain.Invitation{}, err
+	}
+
+	inv := domain.Invitation{
+		OrgID:     orgId,
+		Email:     inp.Email,
+		Role:      inp.Role,
+		TokenHash: hashToken(token),
+		InvitedBy: userId,
+		ExpiresAt: time.Now().Add(invitationTtl),
+		CreatedAt: time.Now(),
+	}
+
+	if inv.ID, err = s.repo.CreateInvitation(ctx, inv); err != nil {
+		return domain.Invitation{}, err
+	}
+
+	body := fmt.Sprintf("Hi,\n\nyou were invited to join %s. Sign in and post this token to %s/orgs/invitations/accept:\n\n%s\n\nThe invitation expires in 7 days.",
+		org.Name, s.publicURL, token)
+
+	if err := s.mailer.Send(ctx, inp.Email, fmt.Sprintf("Invitation to %s", org.Name), body); err != nil {
+		return domain.Invitation{}, err
+	}
+
+	s.log(ctx, userId, domain.AuditActionInvite, orgId, map[string]interface{}{"email": inp.Email, "role": inp.Role})
+
+	return inv, nil
+}
+
+func (s *Orgs) AcceptInvitation(ctx context.Context, userId int64, token string) (domain.Membership, error) {
+	user, err := s.usersRepo.GetByID(ctx, userId)
+	if err != nil {
+		return domain.Membership{}, err
+	}
+
+	inv, err := s.repo.AcceptInvitation(ctx, hashToken(token), userId, user.Email)
+	if err != nil {
+		return domain.Membership{}, err
+	}
+
+	s.log(ctx, userId, domain.AuditActionJoin, inv.OrgID, map[string]interface{}{"role": inv.Role})
+
+	return s.repo.GetMembership(ctx, inv.OrgID, userId)
+}
+
+// Switch issues tokens with the organization as the active one.
+func (s *Orgs) Switch(ctx context.Context, userId, orgId int64) (string, string, error) {
+	if _, err := s.repo.GetMembership(ctx, orgId, userId); err != nil {
+		return "", "", err
+	}
+
+	return s.tokens.IssueForOrg(ctx, userId, orgId)
+}
+
+// ResolveActive picks the active organization of a request: the requested
+// one if set, otherwise the user's oldest membership.
+func (s *Orgs) ResolveActive(ctx context.Context, userId, orgId int64) (domain.Membership, error) {
+	if orgId != 0 {
+		return s.repo.GetMembership(ctx, orgId, userId)
+	}
+
+	memberships, err := s.repo.GetByUser(ctx, userId)
+	if err != nil {
+		return domain.Membership{}, err
+	}
+
+	if len(memberships) == 0 {
+		return domain.Membership{}, domain.ErrOrgRequired
+	}
+
+	return memberships[0], nil
+}
+
+func (s *Orgs) requireOwner(ctx context.Context, orgId, userId int64) error {
+	m, err := s.repo.GetMembership(ctx, orgId, userId)
+	if err != nil {
+		return err
+	}
+
+	if !m.HasRole(domain.OrgRoleOwner) {
+		return domain.ErrNotOrgOwner
+	}
+
+	return nil
+}
+
+func (s *Orgs) log(ctx context.Context, actorId int64, action string, orgId int64, details map[string]interface{}) {
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  actorId,
+		Action:   action,
+		Entity:   domain.AuditEntityOrg,
+		EntityID: orgId,
+		Details:  details,
+	})
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	erasureLease        = 5 * time.Minute
+	erasurePollInterval = 10 * time.Second
+)
+
+type ExportSessionRepository interface {
+	GetByUser(ctx context.Context, userId int64) ([]domain.RefreshSession, error)
+}
+
+type ExportAPIKeyRepository interface {
+	GetByUser(ctx context.Context, userId int64) ([]domain.APIKey, error)
+}
+
+type ExportIdentityRepository interface {
+	GetByUser(ctx context.Context, userId int64) ([]domain.Identity, error)
+}
+
+type ExportBookRepository interface {
+	GetByCreator(ctx context.Context, userId int64) ([]domain.Book, error)
+}
+
+type ExportReviewRepository interface {
+	GetByUser(ctx context.Context, userId int64) ([]domain.Review, error)
+}
+
+type ExportShelfRepository interface {
+	GetByUser(ctx context.Context, userId int64) ([]domain.ShelfExport, error)
+}
+
+type ExportReadingRepository interface {
+	GetByUser(ctx context.Context, userId int64) ([]domain.Reading, error)
+}
+
+type ExportLoanRepository interface {
+	GetByUser(ctx context.Context, userId int64) ([]domain.Loan, error)
+}
+
+type ExportHoldRepository interface {
+	GetHoldsByUser(ctx context.Context, userId int64) ([]domain.Hold, error)
+}
+
+type ExportOrgRepository interface {
+	GetByUser(ctx context.Context, userId int64) ([]domain.Membership, error)
+}
+
+type ExportAuditRepository interface {
+	GetByUser(ctx context.Context, userId int64) ([]domain.AuditEvent, error)
+}
+
+type ErasureRepository interface {
+	Create(ctx context.Context, job domain.ErasureJob) (int64, error)
+	GetByID(ctx context.Context, id int64) (domain.ErasureJob, error)
+	GetByToken(ctx context.Context, token string) (domain.ErasureJob, error)
+	Claim(ctx context.Context, lease time.Duration) (domain.ErasureJob, error)
+	SetStep(ctx context.Context, id int64, step int, lease time.Duration) error
+	Complete(ctx context.Context, id int64) error
+	Fail(ctx context.Context, id int64, reason string) error
+
+	RevokeAccess(ctx context.Context, userId int64) error
+	DetachOwnership(ctx context.Context, userId int64) error
+	Anonymize(ctx context.Context, userId int64) error
+}
+
+type PasswordChecker interface {
+	CheckPassword(ctx context.Context, id int64, password string) error
+}
+
+// Privacy implements data export and the right to erasure.
+type Privacy struct {
+	usersRepo      UserRepository
+	sessionsRepo   ExportSessionRepository
+	apiKeysRepo    ExportAPIKeyRepository
+	identitiesRepo ExportIdentityRepository
+	booksRepo      ExportBookRepository
+	reviewsRepo    ExportReviewRepository
+	shelvesRepo    ExportShelfRepository
+	readingsRepo   ExportReadingRepository
+	loansRepo      ExportLoanRepository
+	holdsRepo      ExportHoldRepository
+	orgsRepo       ExportOrgRepository
+	auditRepo      ExportAuditRepository
+	erasureRepo    ErasureRepository
+
+	passwords PasswordChecker
+	auditor   Auditor
+}
+
+func NewPrivacy(usersRepo UserRepository, sessionsRepo ExportSessionRepository, apiKeysRepo ExportAPIKeyRepository,
+	identitiesRepo ExportIdentityRepository, booksRepo ExportBookRepository, reviewsRepo ExportReviewRepository,
+	shelvesRepo ExportShelfRepository, readingsRepo ExportReadingRepository, loansRepo ExportLoanRepository,
+	holdsRepo ExportHoldRepository, orgsRepo ExportOrgRepository, auditRepo ExportAuditRepository,
+	erasureRepo ErasureRepository, passwords PasswordChecker, auditor Auditor) *Privacy {
+	return &Privacy{
+		usersRepo:      usersRepo,
+		sessionsRepo:   sessionsRepo,
+		apiKeysRepo:    apiKeysRepo,
+		identitiesRepo: identitiesRepo,
+		booksRepo:      booksRepo,
+		reviewsRepo:    reviewsRepo,
+		shelvesRepo:    shelvesRepo,
+		readingsRepo:   readingsRepo,
+		loansRepo:      loansRepo,
+		holdsRepo:      holdsRepo,
+		orgsRepo:       orgsRepo,
+		auditRepo:      auditRepo,
+		erasureRepo:    erasureRepo,
+		passwords:      passwords,
+		auditor:        auditor,
+	}
+}
+
+func (s *Privacy) Export(ctx context.Context, userId int64) (domain.UserExport, error) {
+	var export domain.UserExport
+	var err error
+
+	export.ExportedAt = time.Now()
+
+	if export.Profile, err = s.usersRepo.GetByID(ctx, userId); err != nil {
+		return export, err
+	}
+
+	sessions, err := s.sessionsRepo.GetByUser(ctx, userId)
+	if err != nil {
+		return export, err
+	}
+
+	export.Sessions = make([]domain.SessionExport, 0, len(sessions))
+	for _, session := range sessions {
+		export.Sessions = append(export.Sessions, domain.SessionExport{ID: session.ID, ExpiresAt: session.ExpiresAt})
+	}
+
+	if export.APIKeys, err = s.apiKeysRepo.GetByUser(ctx, userId); err != nil {
+		return export, err
+	}
+
+	if export.Identities, err = s.identitiesRepo.GetByUser(ctx, userId); err != nil {
+		return export, err
+	}
+
+	if export.Books, err = s.booksRepo.GetByCreator(ctx, userId); err != nil {
+		return export, err
+	}
+
+	if export.Reviews, err = s.reviewsRepo.GetByUser(ctx, userId); err != nil {
+		return export, err
+	}
+
+	if export.Shelves, err = s.shelvesRepo.GetByUser(ctx, userId); err != nil {
+		return export, err
+	}
+
+	if export.Reading, err = s.readingsRepo.GetByUser(ctx, userId); err != nil {
+		return export, err
+	}
+
+	if export.Loans, err = s.loansRepo.GetByUser(ctx, userId); err != nil {
+		return export, err
+	}
+
+	if export.Holds, err = s.holdsRepo.GetHoldsByUser(ctx, userId); err != nil {
+		return export, err
+	}
+
+	if export.Organizations, err = s.orgsRepo.GetByUser(ctx, userId); err != nil {
+		return export, err
+	}
+
+	if export.AuditEvents, err = s.auditRepo.GetByUser(ctx, userId); err != nil {
+		return export, err
+	}
+
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  userId,
+		Action:   domain.AuditActionExport,
+		Entity:   domain.AuditEntityUser,
+		EntityID: userId,
+	})
+
+	return export, nil
+}
+
+// RequestErasure disables the user right away and queues the erasure job.
+func (s *Privacy) RequestErasure(ctx context.Context, userId int64, inp domain.ErasureRequestInput) (domain.ErasureJob, error) {
+	if err := s.passwords.CheckPassword(ctx, userId, inp.Password); err != nil {
+		return domain.ErasureJob{}, err
+	}
+
+	token, err := randomHex(24)
+	if err != nil {
+		return domain.ErasureJob{}, err
+	}
+
+	job := domain.ErasureJob{
+		UserID:      userId,
+		Status:      domain.ErasureStatusPending,
+		StatusToken: token,
+		RequestedAt: time.Now(),
+	}
+	job.UpdatedAt = job.RequestedAt
+
+	if job.ID, err = s.erasureRepo.Create(ctx, job); err != nil {
+		return domain.ErasureJob{}, err
+	}
+
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  userId,
+		Action:   domain.AuditActionErasure,
+		Entity:   domain.AuditEntityUser,
+		EntityID: userId,
+		Details:  map[string]interface{}{"job_id": job.ID, "status": job.Status},
+	})
+
+	return job, nil
+}
+
+func (s *Privacy) GetErasureJob(ctx context.Context, id int64) (domain.ErasureJob, error) {
+	return s.erasureRepo.GetByID(ctx, id)
+}
+
+func (s *Privacy) GetErasureJobByToken(ctx context.Context, token string) (domain.ErasureJob, error) {
+	return s.erasureRepo.GetByToken(ctx, token)
+}
+
+// RunErasureWorker processes erasure jobs until the context is cancelled.
+func (s *Privacy) RunErasureWorker(ctx context.Context) {
+	ticker := time.NewTicker(erasurePollInterval)
+	defer ticker.Stop()
+
+	for {
+		for s.processNextErasure(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNextErasure runs one job and reports whether there was one.
+func (s *Privacy) processNextErasure(ctx context.Context) bool {
+	job, err := s.erasureRepo.Claim(ctx, erasureLease)
+	if err != nil {
+		if !errors.Is(err, domain.ErrErasureJobNotFound) {
+			logrus.WithFields(logrus.Fields{
+				"method": "Privacy.processNextErasure",
+			}).Error("Failed to claim erasure job", err)
+		}
+		return false
+	}
+
+	steps := []func(ctx context.Context, userId int64) error{
+		s.erasureRepo.RevokeAccess,
+		s.erasureRepo.DetachOwnership,
+		s.erasureRepo.Anonymize,
+	}
+
+	// every step is idempotent, a resumed job repeats at most the interrupted one
+	for step := job.Step; step < len(steps); step++ {
+		if err := steps[step](ctx, job.UserID); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"method": "Privacy.processNextErasure",
+				"job":    job.ID,
+				"step":   step,
+			}).Error("Erasure step failed", err)
+
+			if err := s.erasureRepo.Fail(ctx, job.ID, err.Error()); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"method": "Privacy.processNextErasure",
+				}).Error("Failed to mark erasure job as failed", err)
+			}
+			return true
+		}
+
+		if err := s.erasureRepo.SetStep(ctx, job.ID, step+1, erasureLease); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"method": "Privacy.processNextErasure",
+			}).Error("Failed to record erasure progress", err)
+			return true
+		}
+	}
+
+	if err := s.erasureRepo.Complete(ctx, job.ID); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"method": "Privacy.processNextErasure",
+		}).Error("Failed to complete erasure job", err)
+		return true
+	}
+
+	s.auditor.Log(ctx, domain.AuditEvent{
+		Action:   domain.AuditActionErasure,
+		Entity:   domain.AuditEntityUser,
+		EntityID: job.UserID,
+		Details:  map[string]interface{}{"job_id": job.ID, "status": domain.ErasureStatusCompleted},
+	})
+
+	return true
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+type ReviewRepository interface {
+	Create(ctx context.Context, review domain.Review) (int64, error)
+	GetByID(ctx context.Context, bookId, id int64) (domain.Review, error)
+	List(ctx context.Context, bookId int64, filter domain.ReviewFilter) ([]domain.Review, int, error)
+	Update(ctx context.Context, bookId, id int64, inp domain.ReviewInput) error
+	Delete(ctx context.Context, bookId, id int64) error
+	SetFlagged(ctx context.Context, bookId, id int64, flagged bool) error
+	SetHidden(ctx context.Context, bookId, id int64, hidden bool) error
+}
+
+type Reviews struct {
+	repo ReviewRepository
+}
+
+func NewReviews(repo ReviewRepository) *Reviews {
+	return &Reviews{repo: repo}
+}
+
+func (s *Reviews) Create(ctx context.Context, userId, bookId int64, inp domain.ReviewInput) (domain.Review, error) {
+	id, err := s.repo.Create(ctx, domain.Review{
+		BookID:    bookId,
+		UserID:    userId,
+		Rating:    inp.Rating,
+		Text:      inp.Text,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return domain.Review{}, err
+	}
+
+	return s.repo.GetByID(ctx, bookId, id)
+}
+
+// List returns the reviews of a book, newest first. Hidden reviews are only
+// listed for moderators.
+func (s *Reviews) List(ctx context.Context, bookId int64, filter domain.ReviewFilter) (domain.ReviewList, error) {
+	filter.Normalize()
+
+	reviews, total, err := s.repo.List(ctx, bookId, filter)
+	if err != nil {
+		return domain.ReviewList{}, err
+	}
+
+	return domain.ReviewList{
+		Reviews: reviews,
+		Total:   total,
+		Page:    filter.Page,
+		Limit:   filter.Limit,
+	}, nil
+}
+
+func (s *Reviews) Get(ctx context.Context, bookId, id int64, moderator bool) (domain.Review, error) {
+	review, err := s.repo.GetByID(ctx, bookId, id)
+	if err != nil {
+		return domain.Review{}, err
+	}
+
+	if review.Hidden && !moderator {
+		return domain.Review{}, domain.ErrReviewNotFound
+	}
+
+	return review, nil
+}
+
+func (s *Reviews) Update(ctx context.Context, userId, bookId, id int64, inp domain.ReviewInput) (domain.Review, error) {
+	if err := s.checkAuthor(ctx, userId, bookId, id); err != nil {
+		return domain.Review{}, err
+	}
+
+	if err := s.repo.Update(ctx, bookId, id, inp); err != nil {
+		return domain.Review{}, err
+	}
+
+	return s.repo.GetByID(ctx, bookId, id)
+}
+
+// Delete removes a review. Moderators can delete any review.
+func (s *Reviews) Delete(ctx context.Context, userId, bookId, id int64, moderator bool) error {
+	if !moderator {
+		if err := s.checkAuthor(ctx, userId, bookId, id); err != nil {
+			return err
+		}
+	}
+
+	return s.repo.Delete(ctx, bookId, id)
+}
+
+// Flag reports a review to the moderators.
+func (s *Reviews) Flag(ctx context.Context, bookId, id int64) error {
+	if _, err := s.Get(ctx, bookId, id, false); err != nil {
+		return err
+	}
+
+	return s.repo.SetFlagged(ctx, bookId, id, true)
+}
+
+func (s *Reviews) Moderate(ctx context.Context, bookId, id int64, hidden bool) (domain.Review, error) {
+	if err := s.repo.SetHidden(ctx, bookId, id, hidden); err != nil {
+		return domain.Review{}, err
+	}
+
+	return s.repo.GetByID(ctx, bookId, id)
+}
+
+func (s *Reviews) checkAuthor(ctx context.Context, userId, bookId, id int64) error {
+	review, err := s.repo.GetByID(ctx, bookId, id)
+	if err != nil {
+		return err
+	}
+
+	if review.UserID != userId {
+		return domain.ErrNotReviewAuthor
+	}
+
+	return nil
+}
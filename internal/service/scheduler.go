@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/pkg/cron"
+	"github.com/sirupsen/logrus"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultJobTimeout = 10 * time.Minute
+
+type JobRepository interface {
+	TryLock(ctx context.Context, job string) (unlock func(), ok bool, err error)
+	StartRun(ctx context.Context, run domain.JobRun) (int64, error)
+	FinishRun(ctx context.Context, run domain.JobRun) error
+	GetRuns(ctx context.Context, filter domain.JobRunFilter) ([]domain.JobRun, int, error)
+	GetLastRuns(ctx context.Context) (map[string]domain.JobRun, error)
+}
+
+// JobFunc does the work of a job. The result is stored with the run.
+type JobFunc func(ctx context.Context) (map[string]interface{}, error)
+
+// Job is a background job run on a cron schedule. Jitter delays every run by
+// a random duration up to its value to spread the load of jobs sharing a schedule.
+type Job struct {
+	Name     string
+	Schedule string
+	Timeout  time.Duration
+	Jitter   time.Duration
+	Run      JobFunc
+}
+
+type scheduledJob struct {
+	Job
+	schedule cron.Schedule
+}
+
+// Scheduler runs jobs in process. Schedules are evaluated in UTC, and every
+// run takes a database lock, so with several replicas each scheduled run
+// happens once and runs of the same job never overlap.
+type Scheduler struct {
+	repo    JobRepository
+	auditor Auditor
+	jobs    map[string]scheduledJob
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func NewScheduler(repo JobRepository, auditor Auditor, jobs ...Job) (*Scheduler, error) {
+	s := &Scheduler{
+		repo:    repo,
+		auditor: auditor,
+		jobs:    make(map[string]scheduledJob, len(jobs)),
+		next:    make(map[string]time.Time, len(jobs)),
+	}
+
+	for _, job := range jobs {
+		if _, ok := s.jobs[job.Name]; ok {
+			return nil, fmt.Errorf("job %s: registered twice", job.Name)
+		}
+
+		schedule, err := cron.Parse(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+
+		if job.Timeout <= 0 {
+			job.Timeout = defaultJobTimeout
+		}
+
+		s.jobs[job.Name] = scheduledJob{Job: job, schedule: schedule}
+	}
+
+	return s, nil
+}
+
+// Run runs the jobs on their schedules until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job scheduledJob) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job scheduledJob) {
+	for {
+		at := job.schedule.Next(time.Now().UTC())
+		if at.IsZero() {
+			logrus.WithFields(logrus.Fields{
+				"method": "Scheduler.loop",
+				"job":    job.Name,
+			}).Error("Job schedule never fires")
+			return
+		}
+
+		s.mu.Lock()
+		s.next[job.Name] = at
+		s.mu.Unlock()
+
+		delay := time.Until(at)
+		if job.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(job.Jitter)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		_, done, err := s.start(ctx, job, domain.JobRun{Trigger: domain.JobTriggerSchedule, ScheduledAt: at})
+		if err != nil {
+			// another replica has the run
+			if !errors.Is(err, domain.ErrJobRunning) && !errors.Is(err, domain.ErrJobRunExists) {
+				logrus.WithFields(logrus.Fields{
+					"method": "Scheduler.loop",
+					"job":    job.Name,
+				}).Error("Failed to start job", err)
+			}
+			continue
+		}
+
+		done(ctx)
+	}
+}
+
+// Trigger starts a run of the job right away and returns without waiting for it.
+func (s *Scheduler) Trigger(ctx context.Context, actorId int64, name string) (domain.JobRun, error) {
+	job, ok := s.jobs[name]
+	if !ok {
+		return domain.JobRun{}, domain.ErrJobNotFound
+	}
+
+	run, done, err := s.start(ctx, job, domain.JobRun{
+		Trigger:     domain.JobTriggerManual,
+		TriggeredBy: &actorId,
+		ScheduledAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return domain.JobRun{}, err
+	}
+
+	// the run outlives the request
+	go done(context.Background())
+
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  actorId,
+		Action:   domain.AuditActionRun,
+		Entity:   domain.AuditEntityJob,
+		EntityID: run.ID,
+		Details:  map[string]interface{}{"job": name},
+	})
+
+	return run, nil
+}
+
+// start takes the job lock and records the run. The returned function runs
+// the job and releases the lock.
+func (s *Scheduler) start(ctx context.Context, job scheduledJob, run domain.JobRun) (domain.JobRun, func(ctx context.Context), error) {
+	unlock, ok, err := s.repo.TryLock(ctx, job.Name)
+	if err != nil {
+		return run, nil, err
+	}
+
+	if !ok {
+		return run, nil, domain.ErrJobRunning
+	}
+
+	run.Job = job.Name
+	run.Status = domain.JobStatusRunning
+	run.StartedAt = time.Now().UTC()
+
+	if run.ID, err = s.repo.StartRun(ctx, run); err != nil {
+		unlock()
+		return run, nil, err
+	}
+
+	return run, func(ctx context.Context) {
+		defer unlock()
+		s.execute(ctx, job, run)
+	}, nil
+}
+
+func (s *Scheduler) execute(ctx context.Context, job scheduledJob, run domain.JobRun) {
+	ctx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+
+	result, err := safeRun(ctx, job.Run)
+
+	finishedAt := time.Now().UTC()
+	run.FinishedAt = &finishedAt
+	run.Result = result
+	run.Status = domain.JobStatusSucceeded
+
+	if err != nil {
+		run.Status = domain.JobStatusFailed
+		run.Error = err.Error()
+
+		logrus.WithFields(logrus.Fields{
+			"method": "Scheduler.execute",
+			"job":    job.Name,
+			"run":    run.ID,
+		}).Error("Job failed", err)
+	}
+
+	if err := s.repo.FinishRun(context.Background(), run); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"method": "Scheduler.execute",
+			"job":    job.Name,
+			"run":    run.ID,
+		}).Error("Failed to record job run", err)
+	}
+}
+
+// safeRun turns a panic of the job into an error so a failing job does not
+// take the process down.
+func safeRun(ctx context.Context, fn JobFunc) (result map[string]interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+// Jobs lists the registered jobs with their latest runs.
+func (s *Scheduler) Jobs(ctx context.Context) ([]domain.Job, error) {
+	last, err := s.repo.GetLastRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]domain.Job, 0, len(s.jobs))
+	for name, job := range s.jobs {
+		info := domain.Job{
+			Name:     name,
+			Schedule: job.Schedule,
+			Timeout:  job.Timeout.String(),
+			Jitter:   job.Jitter.String(),
+		}
+
+		if next, ok := s.next[name]; ok {
+			info.NextRunAt = &next
+		}
+
+		if run, ok := last[name]; ok {
+			info.LastRun = &run
+		}
+
+		jobs = append(jobs, info)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+
+	return jobs, nil
+}
+
+func (s *Scheduler) GetRuns(ctx context.Context, filter domain.JobRunFilter) (domain.JobRunList, error) {
+	if _, ok := s.jobs[filter.Job]; filter.Job != "" && !ok {
+		return domain.JobRunList{}, domain.ErrJobNotFound
+	}
+
+	filter.Normalize()
+
+	runs, total, err := s.repo.GetRuns(ctx, filter)
+	if err != nil {
+		return domain.JobRunList{}, err
+	}
+
+	return domain.JobRunList{
+		Runs:  runs,
+		Total: total,
+		Page:  filter.Page,
+		Limit: filter.Limit,
+	}, nil
+}
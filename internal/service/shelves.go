@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"time"
+)
+
+type ShelfRepository interface {
+	Create(ctx context.Context, userId int64, inp domain.ShelfInput) (int64, error)
+	GetAll(ctx context.Context, userId int64) ([]domain.Shelf, error)
+	GetByID(ctx context.Context, userId, id int64) (domain.Shelf, error)
+	Rename(ctx context.Context, userId, id int64, inp domain.ShelfInput) error
+	Delete(ctx context.Context, userId, id int64) error
+	AddBook(ctx context.Context, userId, id, bookId int64) error
+	RemoveBook(ctx context.Context, userId, id, bookId int64) error
+	GetBooks(ctx context.Context, userId, id int64, p domain.Pagination) ([]domain.ShelfBook, int, error)
+}
+
+type ReadingRepository interface {
+	GetByBook(ctx context.Context, userId, bookId int64) (domain.Reading, error)
+	GetAll(ctx context.Context, userId int64, filter domain.ReadingFilter) ([]domain.Reading, int, error)
+	Set(ctx context.Context, userId, bookId int64, inp domain.ReadingInput) error
+	Delete(ctx context.Context, userId, bookId int64) error
+	Stats(ctx context.Context, userId int64) (domain.ReadingStats, error)
+}
+
+// Shelves manages the personal shelves and the reading status of users.
+type Shelves struct {
+	repo         ShelfRepository
+	readingsRepo ReadingRepository
+}
+
+func NewShelves(repo ShelfRepository, readingsRepo ReadingRepository) *Shelves {
+	return &Shelves{
+		repo:         repo,
+		readingsRepo: readingsRepo,
+	}
+}
+
+func (s *Shelves) Create(ctx context.Context, userId int64, inp domain.ShelfInput) (domain.Shelf, error) {
+	id, err := s.repo.Create(ctx, userId, inp)
+	if err != nil {
+		return domain.Shelf{}, err
+	}
+
+	return s.repo.GetByID(ctx, userId, id)
+}
+
+func (s *Shelves) GetAll(ctx context.Context, userId int64) ([]domain.Shelf, error) {
+	return s.repo.GetAll(ctx, userId)
+}
+
+func (s *Shelves) GetByID(ctx context.Context, userId, id int64) (domain.Shelf, error) {
+	return s.repo.GetByID(ctx, userId, id)
+}
+
+func (s *Shelves) Rename(ctx context.Context, userId, id int64, inp domain.ShelfInput) (domain.Shelf, error) {
+	if err := s.repo.Rename(ctx, userId, id, inp); err != nil {
+		return domain.Shelf{}, err
+	}
+
+	return s.repo.GetByID(ctx, userId, id)
+}
+
+func (s *Shelves) Delete(ctx context.Context, userId, id int64) error {
+	return s.repo.Delete(ctx, userId, id)
+}
+
+func (s *Shelves) AddBook(ctx context.Context, userId, id, bookId int64) error {
+	return s.repo.AddBook(ctx, userId, id, bookId)
+}
+
+func (s *Shelves) RemoveBook(ctx context.Context, userId, id, bookId int64) error {
+	return s.repo.RemoveBook(ctx, userId, id, bookId)
+}
+
+func (s *Shelves) GetBooks(ctx context.Context, userId, id int64, p domain.Pagination) (domain.ShelfBookList, error) {
+	p.Normalize()
+
+	books, total, err := s.repo.GetBooks(ctx, userId, id, p)
+	if err != nil {
+		return domain.ShelfBookList{}, err
+	}
+
+	return domain.ShelfBookList{
+		Books: books,
+		Total: total,
+		Page:  p.Page,
+		Limit: p.Limit,
+	}, nil
+}
+
+func (s *Shelves) GetReading(ctx context.Context, userId, bookId int64) (domain.Reading, error) {
+	return s.readingsRepo.GetByBook(ctx, userId, bookId)
+}
+
+func (s *Shelves) ListReading(ctx context.Context, userId int64, filter domain.ReadingFilter) (domain.ReadingList, error) {
+	filter.Normalize()
+
+	books, total, err := s.readingsRepo.GetAll(ctx, userId, filter)
+	if err != nil {
+		return domain.ReadingList{}, err
+	}
+
+	return domain.ReadingList{
+		Books: books,
+		Total: total,
+		Page:  filter.Page,
+		Limit: filter.Limit,
+	}, nil
+}
+
+// SetReading sets the reading status of a book. Dates left out are kept from
+// the previous status; starting a book defaults the started date to today and
+// finishing it the finished date. Moving a book back from read clears the
+// finished date.
+func (s *Shelves) SetReading(ctx context.Context, userId, bookId int64, inp domain.ReadingInput) (domain.Reading, error) {
+	current, err := s.readingsRepo.GetByBook(ctx, userId, bookId)
+	if err != nil && !errors.Is(err, domain.ErrReadingNotFound) {
+		return domain.Reading{}, err
+	}
+
+	if inp.StartedAt == nil {
+		inp.StartedAt = current.StartedAt
+	}
+
+	if inp.FinishedAt == nil {
+		inp.FinishedAt = current.FinishedAt
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	switch inp.Status {
+	case domain.ReadingStatusReading:
+		if inp.StartedAt == nil {
+			inp.StartedAt = &today
+		}
+		inp.FinishedAt = nil
+	case domain.ReadingStatusRead:
+		if inp.FinishedAt == nil {
+			inp.FinishedAt = &today
+		}
+	case domain.ReadingStatusWantToRead:
+		inp.FinishedAt = nil
+	}
+
+	if err := inp.Validate(); err != nil {
+		return domain.Reading{}, err
+	}
+
+	if err := s.readingsRepo.Set(ctx, userId, bookId, inp); err != nil {
+		return domain.Reading{}, err
+	}
+
+	return s.readingsRepo.GetByBook(ctx, userId, bookId)
+}
+
+func (s *Shelves) DeleteReading(ctx context.Context, userId, bookId int64) error {
+	return s.readingsRepo.Delete(ctx, userId, bookId)
+}
+
+func (s *Shelves) Stats(ctx context.Context, userId int64) (domain.ReadingStats, error) {
+	return s.readingsRepo.Stats(ctx, userId)
+}
@@ -2,13 +2,13 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/dewi911/cruda-app/internal/domain"
 	audit "github.com/dewi911/cruda-audit-log/pkg/domain"
 	"github.com/golang-jwt/jwt"
-	"github.com/sirupsen/logrus"
 	"math/rand"
 	"strconv"
 	"time"
@@ -20,37 +20,83 @@ type PasswordHasher interface {
 
 type UserRepository interface {
 	Create(ctx context.Context, user domain.User) error
+	GetByID(ctx context.Context, id int64) (domain.User, error)
+	GetByEmail(ctx context.Context, email string) (domain.User, error)
 	GetByCredential(ctx context.Context, email, password string) (domain.User, error)
+	Update(ctx context.Context, id int64, inp domain.UpdateUserInput) error
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	Delete(ctx context.Context, id int64) error
 }
 
 type SessionsRepository interface {
 	Create(ctx context.Context, user domain.RefreshSession) error
 	Get(ctx context.Context, token string) (domain.RefreshSession, error)
+	DeleteByUser(ctx context.Context, userId int64) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, v domain.EmailVerification) error
+	Take(ctx context.Context, tokenHash string) (domain.EmailVerification, error)
+}
+
+type EmailSender interface {
+	Send(ctx context.Context, to, subject, body string) error
 }
 
 type AuditClient interface {
 	SendLogRequest(ctx context.Context, req audit.LogItem) error
 }
 
+type MFAVerifier interface {
+	Enabled(ctx context.Context, userId int64) (bool, error)
+	Verify(ctx context.Context, userId int64, code, recoveryCode string) error
+}
+
+const (
+	tokenTypeAccess    = "access"
+	tokenTypeMFA       = "mfa"
+	tokenTypeOIDCState = "oidc_state"
+
+	mfaTokenTtl = 5 * time.Minute
+
+	emailVerificationTtl = 24 * time.Hour
+)
+
+type tokenClaims struct {
+	jwt.StandardClaims
+	Type  string `json:"typ,omitempty"`
+	OrgID int64  `json:"org,omitempty"`
+}
+
 type Users struct {
-	repo         UserRepository
-	sessionsRepo SessionsRepository
-	hasher       PasswordHasher
+	repo              UserRepository
+	sessionsRepo      SessionsRepository
+	verificationsRepo EmailVerificationRepository
+	hasher            PasswordHasher
+	mfa               MFAVerifier
 
-	auditClient AuditClient
+	auditor Auditor
+	mailer  EmailSender
 
 	hmaSecret []byte
 	tokenTtl  time.Duration
+	publicURL string
 }
 
-func NewUsers(repo UserRepository, sessionsRepo SessionsRepository, auditClient AuditClient, hasher PasswordHasher, secret []byte, ttl time.Duration) *Users {
+func NewUsers(repo UserRepository, sessionsRepo SessionsRepository, verificationsRepo EmailVerificationRepository, mfa MFAVerifier,
+	auditor Auditor, mailer EmailSender, hasher PasswordHasher, secret []byte, ttl time.Duration, publicURL string) *Users {
 	return &Users{
-		repo:         repo,
-		sessionsRepo: sessionsRepo,
-		hasher:       hasher,
-		auditClient:  auditClient,
-		hmaSecret:    secret,
-		tokenTtl:     ttl,
+		repo:              repo,
+		sessionsRepo:      sessionsRepo,
+		verificationsRepo: verificationsRepo,
+		hasher:            hasher,
+		mfa:               mfa,
+		auditor:           auditor,
+		mailer:            mailer,
+		hmaSecret:         secret,
+		tokenTtl:          ttl,
+		publicURL:         publicURL,
 	}
 }
 
@@ -76,40 +122,122 @@ func (s *Users) SingUp(ctx context.Context, inp domain.SingUpInput) error {
 		return err
 	}
 
-	if err := s.auditClient.SendLogRequest(ctx, audit.LogItem{
-		Action:    audit.ACTION_REGISTER,
-		Entity:    audit.ENTITY_USER,
-		EntityID:  user.ID,
-		Timestamp: time.Now(),
-	}); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"method": "Users.SingUp",
-		}).Error("Failed to register user", err)
-	}
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  user.ID,
+		Action:   domain.AuditActionRegister,
+		Entity:   domain.AuditEntityUser,
+		EntityID: user.ID,
+	})
 
 	return nil
 }
 
-func (s *Users) SingIn(ctx context.Context, inp domain.SingInInput) (string, string, error) {
-	password, err := s.hasher.Hash(inp.Password)
+func (s *Users) SingIn(ctx context.Context, inp domain.SingInInput) (domain.SingInResult, error) {
+	userId, err := s.checkCredentials(ctx, inp.Email, inp.Password)
 	if err != nil {
-		return "", "", err
+		return domain.SingInResult{}, err
 	}
 
-	user, err := s.repo.GetByCredential(ctx, inp.Email, password)
+	return s.SingInByID(ctx, userId)
+}
+
+// Authenticate checks the sing-in credentials without issuing tokens, for
+// clients that send them with every request. It fails with ErrMFARequired
+// for users with a second factor, as there is no way to send it.
+func (s *Users) Authenticate(ctx context.Context, email, password string) (int64, error) {
+	userId, err := s.checkCredentials(ctx, email, password)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.checkEnabled(ctx, userId); err != nil {
+		return 0, err
+	}
+
+	mfaEnabled, err := s.mfa.Enabled(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	if mfaEnabled {
+		return 0, domain.ErrMFARequired
+	}
+
+	return userId, nil
+}
+
+func (s *Users) checkCredentials(ctx context.Context, email, password string) (int64, error) {
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		return 0, err
+	}
+
+	user, err := s.repo.GetByCredential(ctx, email, hashed)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", "", domain.ErrUserNotFound
+			return 0, domain.ErrUserNotFound
 		}
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+// SingInByID issues tokens for an already authenticated user, or an MFA
+// challenge when the user has a second factor enabled.
+func (s *Users) SingInByID(ctx context.Context, userId int64) (domain.SingInResult, error) {
+	if err := s.checkEnabled(ctx, userId); err != nil {
+		return domain.SingInResult{}, err
+	}
+
+	mfaEnabled, err := s.mfa.Enabled(ctx, userId)
+	if err != nil {
+		return domain.SingInResult{}, err
+	}
+
+	if mfaEnabled {
+		mfaToken, err := s.signToken(userId, 0, tokenTypeMFA, mfaTokenTtl)
+		if err != nil {
+			return domain.SingInResult{}, err
+		}
+
+		return domain.SingInResult{MFAToken: mfaToken}, nil
+	}
+
+	accessToken, refreshToken, err := s.generateTokens(ctx, userId, 0)
+	if err != nil {
+		return domain.SingInResult{}, err
+	}
+
+	return domain.SingInResult{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// VerifyMFA finishes a sing-in that was answered with an MFA challenge.
+func (s *Users) VerifyMFA(ctx context.Context, inp domain.MFAVerifyInput) (string, string, error) {
+	claims, err := s.parseToken(inp.Token, tokenTypeMFA)
+	if err != nil {
+		return "", "", domain.ErrInvalidMFAToken
+	}
+
+	if err := s.mfa.Verify(ctx, claims.UserID, inp.Code, inp.RecoveryCode); err != nil {
 		return "", "", err
 	}
 
-	return s.generateTokens(ctx, user.ID)
+	return s.generateTokens(ctx, claims.UserID, 0)
+}
 
+func (s *Users) ParseToken(ctx context.Context, tokenString string) (domain.AccessClaims, error) {
+	return s.parseToken(tokenString, tokenTypeAccess)
 }
 
-func (s *Users) ParseToken(ctx context.Context, tokenString string) (int64, error) {
-	t, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+// IssueForOrg issues tokens with the organization as the active one.
+// The caller checks the membership.
+func (s *Users) IssueForOrg(ctx context.Context, userId, orgId int64) (string, string, error) {
+	return s.generateTokens(ctx, userId, orgId)
+}
+
+func (s *Users) parseToken(tokenString, tokenType string) (domain.AccessClaims, error) {
+	t, err := jwt.ParseWithClaims(tokenString, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
@@ -117,39 +245,51 @@ func (s *Users) ParseToken(ctx context.Context, tokenString string) (int64, erro
 		return s.hmaSecret, nil
 	})
 	if err != nil {
-		return 0, err
+		return domain.AccessClaims{}, err
 	}
 
 	if !t.Valid {
-		return 0, errors.New("invalid token")
+		return domain.AccessClaims{}, errors.New("invalid token")
 	}
 
-	claims, ok := t.Claims.(jwt.MapClaims)
+	claims, ok := t.Claims.(*tokenClaims)
 	if !ok {
-		return 0, errors.New("invalid claims")
+		return domain.AccessClaims{}, errors.New("invalid claims")
 	}
 
-	subject, ok := claims["sub"].(string)
-	if !ok {
-		return 0, errors.New("invalid subject")
+	// access tokens issued before token types were introduced carry no type
+	if claims.Type != tokenType && !(tokenType == tokenTypeAccess && claims.Type == "") {
+		return domain.AccessClaims{}, errors.New("invalid token type")
 	}
 
-	id, err := strconv.Atoi(subject)
+	id, err := strconv.Atoi(claims.Subject)
 	if err != nil {
-		return 0, errors.New("invalid subject")
+		return domain.AccessClaims{}, errors.New("invalid subject")
 	}
 
-	return int64(id), nil
+	return domain.AccessClaims{UserID: int64(id), OrgID: claims.OrgID}, nil
 }
 
-func (s *Users) generateTokens(ctx context.Context, userId int64) (string, string, error) {
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		Subject:   strconv.Itoa(int(userId)),
-		IssuedAt:  time.Now().Unix(),
-		ExpiresAt: time.Now().Add(s.tokenTtl).Unix(),
+func (s *Users) signToken(userId, orgId int64, tokenType string, ttl time.Duration) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.Itoa(int(userId)),
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+		Type:  tokenType,
+		OrgID: orgId,
 	})
 
-	accessToken, err := t.SignedString(s.hmaSecret)
+	return t.SignedString(s.hmaSecret)
+}
+
+func (s *Users) generateTokens(ctx context.Context, userId, orgId int64) (string, string, error) {
+	if err := s.checkEnabled(ctx, userId); err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := s.signToken(userId, orgId, tokenTypeAccess, s.tokenTtl)
 	if err != nil {
 		return "", "", err
 	}
@@ -161,6 +301,7 @@ func (s *Users) generateTokens(ctx context.Context, userId int64) (string, strin
 
 	if err := s.sessionsRepo.Create(ctx, domain.RefreshSession{
 		UserID:    userId,
+		OrgID:     orgId,
 		Token:     refreshToken,
 		ExpiresAt: time.Now().Add(time.Hour * 24 * 30),
 	}); err != nil {
@@ -193,5 +334,204 @@ func (s *Users) RefreshTokens(ctx context.Context, refreshToken string) (string,
 		return "", "", domain.ErrRefreshTokenExpired
 	}
 
-	return s.generateTokens(ctx, session.UserID)
+	return s.generateTokens(ctx, session.UserID, session.OrgID)
+}
+
+// CleanupSessions is a scheduled job that removes expired refresh sessions.
+func (s *Users) CleanupSessions(ctx context.Context) (map[string]interface{}, error) {
+	deleted, err := s.sessionsRepo.DeleteExpired(ctx, time.Now())
+
+	return map[string]interface{}{"deleted": deleted}, err
+}
+
+func (s *Users) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// Update changes the profile. A new email address is not applied until it is
+// confirmed with the token sent to it.
+func (s *Users) Update(ctx context.Context, id int64, inp domain.UpdateUserInput) (domain.UpdateUserResult, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return domain.UpdateUserResult{}, err
+	}
+
+	var pendingEmail string
+	if inp.Email != nil && *inp.Email != user.Email {
+		pendingEmail = *inp.Email
+	}
+	inp.Email = nil
+
+	if inp.Name != nil && *inp.Name != user.Name {
+		if err := s.repo.Update(ctx, id, inp); err != nil {
+			return domain.UpdateUserResult{}, err
+		}
+
+		s.auditor.Log(ctx, domain.AuditEvent{
+			ActorID:  id,
+			Action:   domain.AuditActionUpdate,
+			Entity:   domain.AuditEntityUser,
+			EntityID: id,
+			Details:  map[string]interface{}{"fields": []string{"name"}},
+		})
+
+		user.Name = *inp.Name
+	}
+
+	if pendingEmail != "" {
+		if err := s.requestEmailChange(ctx, user, pendingEmail); err != nil {
+			return domain.UpdateUserResult{}, err
+		}
+	}
+
+	return domain.UpdateUserResult{User: user, PendingEmail: pendingEmail}, nil
+}
+
+func (s *Users) requestEmailChange(ctx context.Context, user domain.User, email string) error {
+	if _, err := s.repo.GetByEmail(ctx, email); err == nil {
+		return domain.ErrEmailTaken
+	} else if !errors.Is(err, domain.ErrUserNotFound) {
+		return err
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	if err := s.verificationsRepo.Create(ctx, domain.EmailVerification{
+		UserID:    user.ID,
+		Email:     email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(emailVerificationTtl),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nconfirm your new email address by posting this token to %s/auth/verify-email:\n\n%s\n\nThe token expires in 24 hours.",
+		user.Name, s.publicURL, token)
+
+	if err := s.mailer.Send(ctx, email, "Confirm your email address", body); err != nil {
+		return err
+	}
+
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  user.ID,
+		Action:   domain.AuditActionEmailChange,
+		Entity:   domain.AuditEntityUser,
+		EntityID: user.ID,
+		Details:  map[string]interface{}{"status": "requested"},
+	})
+
+	return nil
+}
+
+// VerifyEmail applies a pending email change.
+func (s *Users) VerifyEmail(ctx context.Context, token string) error {
+	v, err := s.verificationsRepo.Take(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Update(ctx, v.UserID, domain.UpdateUserInput{Email: &v.Email}); err != nil {
+		return err
+	}
+
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  v.UserID,
+		Action:   domain.AuditActionEmailChange,
+		Entity:   domain.AuditEntityUser,
+		EntityID: v.UserID,
+		Details:  map[string]interface{}{"status": "confirmed"},
+	})
+
+	return nil
+}
+
+// ChangePassword requires the current password and ends all refresh sessions.
+func (s *Users) ChangePassword(ctx context.Context, id int64, inp domain.ChangePasswordInput) error {
+	if err := s.CheckPassword(ctx, id, inp.CurrentPassword); err != nil {
+		return err
+	}
+
+	password, err := s.hasher.Hash(inp.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdatePassword(ctx, id, password); err != nil {
+		return err
+	}
+
+	if err := s.sessionsRepo.DeleteByUser(ctx, id); err != nil {
+		return err
+	}
+
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  id,
+		Action:   domain.AuditActionPasswordChange,
+		Entity:   domain.AuditEntityUser,
+		EntityID: id,
+	})
+
+	return nil
+}
+
+func (s *Users) Delete(ctx context.Context, id int64, inp domain.DeleteUserInput) error {
+	if err := s.CheckPassword(ctx, id, inp.Password); err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.auditor.Log(ctx, domain.AuditEvent{
+		ActorID:  id,
+		Action:   domain.AuditActionDelete,
+		Entity:   domain.AuditEntityUser,
+		EntityID: id,
+	})
+
+	return nil
+}
+
+// CheckPassword verifies the password of a signed in user.
+func (s *Users) CheckPassword(ctx context.Context, id int64, password string) error {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.repo.GetByCredential(ctx, user.Email, hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrInvalidPassword
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *Users) checkEnabled(ctx context.Context, userId int64) error {
+	user, err := s.repo.GetByID(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if user.Disabled() {
+		return domain.ErrUserDisabled
+	}
+
+	return nil
+}
+
+func hashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
 }
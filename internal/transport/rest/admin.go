@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) listUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := domain.UserFilter{
+		Query: query.Get("q"),
+		Role:  query.Get("role"),
+	}
+
+	var err error
+	if filter.Pagination, err = getPagination(r); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if disabled := query.Get("disabled"); disabled != "" {
+		v, err := strconv.ParseBool(disabled)
+		if err != nil {
+			handleError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.Disabled = &v
+	}
+
+	users, err := h.adminService.ListUsers(r.Context(), filter)
+	if err != nil {
+		logError("listUsers", "listing users", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "listUsers", http.StatusOK, users)
+}
+
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getUser", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.adminService.GetUser(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			handleNotFoundError(w, err)
+			return
+		}
+
+		logError("getUser", "getting user", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getUser", http.StatusOK, user)
+}
+
+func (h *Handler) disableUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "disableUser", h.adminService.DisableUser)
+}
+
+func (h *Handler) enableUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "enableUser", h.adminService.EnableUser)
+}
+
+func (h *Handler) logoutUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "logoutUser", h.adminService.LogoutUser)
+}
+
+func (h *Handler) resetUserMFA(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "resetUserMFA", h.adminService.ResetMFA)
+}
+
+func (h *Handler) setUserRole(w http.ResponseWriter, r *http.Request) {
+	var inp domain.SetRoleInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("setUserRole", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.adminAction(w, r, "setUserRole", func(ctx context.Context, actorId, id int64) error {
+		return h.adminService.SetRole(ctx, actorId, id, inp.Role)
+	})
+}
+
+// adminAction runs an action of the current administrator against the user from the path.
+func (h *Handler) adminAction(w http.ResponseWriter, r *http.Request, handler string, action func(ctx context.Context, actorId, id int64) error) {
+	actorId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError(handler, "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError(handler, "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := action(r.Context(), actorId, id); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUserNotFound):
+			handleNotFoundError(w, err)
+		case errors.Is(err, domain.ErrCannotModifySelf):
+			handleError(w, http.StatusConflict, err)
+		default:
+			logError(handler, "running admin action", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
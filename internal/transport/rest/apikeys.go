@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+)
+
+func (h *Handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("createAPIKey", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.CreateAPIKeyInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("createAPIKey", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	key, err := h.apiKeysService.Create(r.Context(), userId, inp)
+	if err != nil {
+		logError("createAPIKey", "creating api key", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "createAPIKey", http.StatusCreated, key)
+}
+
+func (h *Handler) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("getAPIKeys", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := h.apiKeysService.List(r.Context(), userId)
+	if err != nil {
+		logError("getAPIKeys", "getting api keys", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getAPIKeys", http.StatusOK, keys)
+}
+
+func (h *Handler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("revokeAPIKey", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("revokeAPIKey", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.apiKeysService.Revoke(r.Context(), userId, id); err != nil {
+		if errors.Is(err, domain.ErrAPIKeyNotFound) {
+			handleNotFoundError(w, err)
+			return
+		}
+
+		logError("revokeAPIKey", "revoking api key", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
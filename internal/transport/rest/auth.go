@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"github.com/dewi911/cruda-app/internal/domain"
-	"github.com/sirupsen/logrus"
 	"io"
 	"net/http"
 )
@@ -33,6 +32,11 @@ func (h *Handler) SingUp(w http.ResponseWriter, r *http.Request) {
 
 	err = h.usersService.SingUp(r.Context(), inp)
 	if err != nil {
+		if errors.Is(err, domain.ErrEmailTaken) {
+			handleError(w, http.StatusConflict, err)
+			return
+		}
+
 		logError("SingUp", "singing up", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -62,30 +66,40 @@ func (h *Handler) SingIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, err := h.usersService.SingIn(r.Context(), inp)
+	res, err := h.usersService.SingIn(r.Context(), inp)
 	if err != nil {
 		if errors.Is(err, domain.ErrUserNotFound) {
 			handleNotFoundError(w, err)
 			return
 		}
 
+		if errors.Is(err, domain.ErrUserDisabled) {
+			handleError(w, http.StatusForbidden, err)
+			return
+		}
+
 		logError("SingIn", "token sing-in", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	response, err := json.Marshal(map[string]string{
-		"token": accessToken,
-	})
-	if err != nil {
-		logError("SingIn", "marshalling response body", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	if res.MFARequired() {
+		response, err := json.Marshal(map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    res.MFAToken,
+		})
+		if err != nil {
+			logError("SingIn", "marshalling response body", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(response)
 		return
 	}
 
-	w.Header().Add("Set-Cookie", fmt.Sprintf("refresh_token=%s; HttpOnly", refreshToken))
-	w.Header().Add("Content-Type", "application/json")
-	w.Write(response)
+	writeTokens(w, "SingIn", res.AccessToken, res.RefreshToken)
 }
 
 func (h *Handler) refresh(w http.ResponseWriter, r *http.Request) {
@@ -96,21 +110,28 @@ func (h *Handler) refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logrus.Info("%s", cookie.Value)
-
 	accessToken, refreshToken, err := h.usersService.RefreshTokens(r.Context(), cookie.Value)
 	if err != nil {
+		if errors.Is(err, domain.ErrUserDisabled) {
+			handleError(w, http.StatusForbidden, err)
+			return
+		}
+
 		logError("refresh", "getting refresh token", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	writeTokens(w, "refresh", accessToken, refreshToken)
+}
+
+// writeTokens responds with the access token and sets the refresh token cookie.
+func writeTokens(w http.ResponseWriter, handler, accessToken, refreshToken string) {
 	response, err := json.Marshal(map[string]string{
 		"token": accessToken,
 	})
-
 	if err != nil {
-		logError("refresh", "marshalling response body", err)
+		logError(handler, "marshalling response body", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -121,11 +142,28 @@ func (h *Handler) refresh(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleNotFoundError(w http.ResponseWriter, err error) {
+	handleError(w, http.StatusNotFound, err)
+}
+
+func handleError(w http.ResponseWriter, status int, err error) {
 	response, _ := json.Marshal(map[string]string{
 		"error": err.Error(),
 	})
 
 	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+func writeJSON(w http.ResponseWriter, handler string, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		logError(handler, "marshalling response body", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
 	w.Write(response)
 }
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+)
+
+func (h *Handler) createAuthor(w http.ResponseWriter, r *http.Request) {
+	var inp domain.CreateAuthorInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("createAuthor", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	author, err := h.authorsService.Create(r.Context(), inp)
+	if err != nil {
+		logError("createAuthor", "creating author", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "createAuthor", http.StatusCreated, author)
+}
+
+func (h *Handler) getAuthors(w http.ResponseWriter, r *http.Request) {
+	filter := domain.AuthorFilter{Query: r.URL.Query().Get("q")}
+
+	var err error
+	if filter.Pagination, err = getPagination(r); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	authors, err := h.authorsService.List(r.Context(), filter)
+	if err != nil {
+		logError("getAuthors", "listing authors", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getAuthors", http.StatusOK, authors)
+}
+
+func (h *Handler) getAuthorByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getAuthorByID", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	author, err := h.authorsService.GetByID(r.Context(), id)
+	if err != nil {
+		handleAuthorError(w, "getAuthorByID", err)
+		return
+	}
+
+	writeJSON(w, "getAuthorByID", http.StatusOK, author)
+}
+
+func (h *Handler) updateAuthor(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("updateAuthor", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var inp domain.UpdateAuthorInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("updateAuthor", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	author, err := h.authorsService.Update(r.Context(), id, inp)
+	if err != nil {
+		handleAuthorError(w, "updateAuthor", err)
+		return
+	}
+
+	writeJSON(w, "updateAuthor", http.StatusOK, author)
+}
+
+func (h *Handler) deleteAuthor(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("deleteAuthor", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authorsService.Delete(r.Context(), id); err != nil {
+		handleAuthorError(w, "deleteAuthor", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getAuthorBooks(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getAuthorBooks", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	format, err := getCitationFormat(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	books, err := h.authorsService.Books(r.Context(), id)
+	if err != nil {
+		handleAuthorError(w, "getAuthorBooks", err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if format != "" {
+		writeCitation(w, "getAuthorBooks", format, books)
+		return
+	}
+
+	writeJSON(w, "getAuthorBooks", http.StatusOK, books)
+}
+
+func handleAuthorError(w http.ResponseWriter, handler string, err error) {
+	if errors.Is(err, domain.ErrAuthorNotFound) {
+		handleNotFoundError(w, err)
+		return
+	}
+
+	logError(handler, "author request", err)
+	w.WriteHeader(http.StatusInternalServerError)
+}
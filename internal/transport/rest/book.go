@@ -1,12 +1,13 @@
 package rest
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"github.com/dewi911/cruda-app/internal/domain"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 )
 
 func (h *Handler) getBookByID(w http.ResponseWriter, r *http.Request) {
@@ -17,7 +18,13 @@ func (h *Handler) getBookByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	book, err := h.booksService.GetByID(context.TODO(), id)
+	format, err := getCitationFormat(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	book, err := h.booksService.GetByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, domain.ErrBookNotFound) {
 			w.WriteHeader(http.StatusNotFound)
@@ -28,6 +35,24 @@ func (h *Handler) getBookByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	etag := book.ETag()
+	if format != "" {
+		etag = book.FormatETag(format)
+	}
+	w.Header().Set("ETag", etag)
+
+	w.Header().Add("Vary", "Accept")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && domain.MatchETag(match, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if format != "" {
+		writeCitation(w, "getBookByID", format, []domain.Book{book})
+		return
+	}
+
 	response, err := json.Marshal(book)
 	if err != nil {
 		logError("getBookByID", "marshalling book", err)
@@ -54,10 +79,22 @@ func (h *Handler) createBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.booksService.Create(context.TODO(), book)
+	if err := book.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	userId, err := getUserIdFromContext(r)
 	if err != nil {
-		logError("createBook", "creating book", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		logError("createBook", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	book.CreatedBy = &userId
+
+	err = h.booksService.Create(r.Context(), book)
+	if err != nil {
+		handleBookWriteError(w, "createBook", err)
 		return
 	}
 
@@ -65,13 +102,35 @@ func (h *Handler) createBook(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) getAllBooks(w http.ResponseWriter, r *http.Request) {
-	books, err := h.booksService.GetAll(context.TODO())
+	filter, err := getBookFilter(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	format, err := getCitationFormat(r)
 	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	books, err := h.booksService.GetAll(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidISBN) {
+			handleError(w, http.StatusBadRequest, err)
+			return
+		}
 		logError("getAllBooks", "getting all books", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Add("Vary", "Accept")
+	if format != "" {
+		writeCitation(w, "getAllBooks", format, books)
+		return
+	}
+
 	response, err := json.Marshal(books)
 	if err != nil {
 		logError("getAllBooks", "marshalling books", err)
@@ -91,16 +150,91 @@ func (h *Handler) deleteBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.booksService.Delete(context.TODO(), id)
+	userId, err := getUserIdFromContext(r)
 	if err != nil {
-		logError("deleteBook", "deleting book", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		logError("deleteBook", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err = h.booksService.Delete(r.Context(), userId, id, r.Header.Get("If-Match"))
+	if err != nil {
+		handleBookWriteError(w, "deleteBook", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// getTrash lists books that were deleted and can still be restored.
+func (h *Handler) getTrash(w http.ResponseWriter, r *http.Request) {
+	p, err := getPagination(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	books, err := h.booksService.GetTrash(r.Context(), p)
+	if err != nil {
+		logError("getTrash", "listing trashed books", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getTrash", http.StatusOK, books)
+}
+
+// getTrashedBook returns a trashed book with the ETag that restoring it takes.
+func (h *Handler) getTrashedBook(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getTrashedBook", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.booksService.GetTrashedByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrBookNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logError("getTrashedBook", "getting trashed book", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", book.ETag())
+	writeJSON(w, "getTrashedBook", http.StatusOK, book)
+}
+
+func (h *Handler) restoreBook(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("restoreBook", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("restoreBook", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	book, err := h.booksService.Restore(r.Context(), userId, id, r.Header.Get("If-Match"))
+	if err != nil {
+		handleBookWriteError(w, "restoreBook", err)
+		return
+	}
+
+	w.Header().Set("ETag", book.ETag())
+	writeJSON(w, "restoreBook", http.StatusOK, book)
+}
+
+// updateBook replaces the book with the one in the body. Fields left out are
+// cleared.
 func (h *Handler) updateBook(w http.ResponseWriter, r *http.Request) {
 	id, err := getIdFromRequest(r)
 	if err != nil {
@@ -116,19 +250,186 @@ func (h *Handler) updateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var inp domain.UpdateBookInput
-	if err = json.Unmarshal(reqBytes, &inp); err != nil {
+	var book domain.Book
+	if err = json.Unmarshal(reqBytes, &book); err != nil {
 		logError("updateBook", "unmarshalling request body", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	err = h.booksService.Update(context.TODO(), id, inp)
+	if err := book.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	userId, err := getUserIdFromContext(r)
 	if err != nil {
-		logError("updateBook", "updating book", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		logError("updateBook", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	book, err = h.booksService.Replace(r.Context(), userId, id, book, r.Header.Get("If-Match"))
+	if err != nil {
+		handleBookWriteError(w, "updateBook", err)
 		return
 	}
 
+	w.Header().Set("ETag", book.ETag())
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// patchBook applies a JSON merge patch or a JSON patch to the book and
+// returns the patched book.
+func (h *Handler) patchBook(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("patchBook", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != domain.MediaTypeMergePatch && mediaType != domain.MediaTypeJSONPatch) {
+		w.Header().Set("Accept-Patch", domain.MediaTypeMergePatch+", "+domain.MediaTypeJSONPatch)
+		handleError(w, http.StatusUnsupportedMediaType, domain.ErrUnsupportedPatch)
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		logError("patchBook", "reading request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("patchBook", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	book, err := h.booksService.Patch(r.Context(), userId, id, mediaType, patch, r.Header.Get("If-Match"))
+	if err != nil {
+		handleBookWriteError(w, "patchBook", err)
+		return
+	}
+
+	w.Header().Set("ETag", book.ETag())
+	writeJSON(w, "patchBook", http.StatusOK, book)
+}
+
+func handleBookWriteError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrBookNotFound), errors.Is(err, domain.ErrRevisionNotFound):
+		handleNotFoundError(w, err)
+	case errors.Is(err, domain.ErrAuthorNotFound), errors.Is(err, domain.ErrGenreNotFound),
+		errors.Is(err, domain.ErrInvalidISBN), errors.Is(err, domain.ErrInvalidPatch):
+		handleError(w, http.StatusBadRequest, err)
+	case errors.Is(err, domain.ErrUnsupportedPatch):
+		handleError(w, http.StatusUnsupportedMediaType, err)
+	case errors.Is(err, domain.ErrISBNTaken), errors.Is(err, domain.ErrPatchTestFailed),
+		errors.Is(err, domain.ErrCopyOnLoan), errors.Is(err, domain.ErrCopyReserved):
+		handleError(w, http.StatusConflict, err)
+	case errors.Is(err, domain.ErrPreconditionFailed):
+		handleError(w, http.StatusPreconditionFailed, err)
+	case errors.Is(err, domain.ErrPreconditionRequired):
+		handleError(w, http.StatusPreconditionRequired, err)
+	default:
+		logError(handler, "writing book", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// enrichBook returns catalog metadata for an ISBN as a draft. Nothing is saved.
+func (h *Handler) enrichBook(w http.ResponseWriter, r *http.Request) {
+	isbn := r.URL.Query().Get("isbn")
+	if isbn == "" {
+		handleError(w, http.StatusBadRequest, errors.New("isbn is required"))
+		return
+	}
+
+	draft, err := h.booksService.Enrich(r.Context(), isbn)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidISBN):
+			handleError(w, http.StatusBadRequest, err)
+		case errors.Is(err, domain.ErrMetadataNotFound):
+			handleNotFoundError(w, err)
+		case errors.Is(err, domain.ErrMetadataUnavailable):
+			logError("enrichBook", "looking up metadata", err)
+			handleError(w, http.StatusServiceUnavailable, domain.ErrMetadataUnavailable)
+		default:
+			logError("enrichBook", "looking up metadata", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, "enrichBook", http.StatusOK, draft)
+}
+
+// getBookFacets returns counts for drill-down navigation over the books
+// matching the same filters as the book listing.
+func (h *Handler) getBookFacets(w http.ResponseWriter, r *http.Request) {
+	filter, err := getBookFilter(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	facets, err := h.booksService.Facets(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidISBN) {
+			handleError(w, http.StatusBadRequest, err)
+			return
+		}
+		logError("getBookFacets", "counting facets", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getBookFacets", http.StatusOK, facets)
+}
+
+func getBookFilter(r *http.Request) (domain.BookFilter, error) {
+	query := r.URL.Query()
+
+	filter := domain.BookFilter{
+		Query: query.Get("q"),
+		ISBN:  query.Get("isbn"),
+		Tag:   query.Get("tag"),
+	}
+
+	var err error
+	if genre := query.Get("genre"); genre != "" {
+		if filter.GenreID, err = strconv.ParseInt(genre, 10, 64); err != nil {
+			return filter, errors.New("invalid genre")
+		}
+	}
+
+	if author := query.Get("author"); author != "" {
+		if filter.AuthorID, err = strconv.ParseInt(author, 10, 64); err != nil {
+			return filter, errors.New("invalid author")
+		}
+	}
+
+	if decade := query.Get("decade"); decade != "" {
+		v, err := strconv.Atoi(decade)
+		if err != nil || v%10 != 0 {
+			return filter, errors.New("invalid decade")
+		}
+		filter.Decade = &v
+	}
+
+	if rating := query.Get("rating"); rating != "" {
+		v, err := strconv.Atoi(rating)
+		if err != nil {
+			return filter, errors.New("invalid rating")
+		}
+		filter.Rating = &v
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,310 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) createCopy(w http.ResponseWriter, r *http.Request) {
+	userId, bookId, ok := userAndIdRequest(w, r, "createCopy")
+	if !ok {
+		return
+	}
+
+	var inp domain.CreateCopyInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("createCopy", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := h.circulationService.CreateCopy(r.Context(), userId, bookId, inp)
+	if err != nil {
+		handleCirculationError(w, "createCopy", err)
+		return
+	}
+
+	writeJSON(w, "createCopy", http.StatusCreated, c)
+}
+
+func (h *Handler) getCopies(w http.ResponseWriter, r *http.Request) {
+	bookId, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getCopies", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	copies, err := h.circulationService.GetCopies(r.Context(), bookId)
+	if err != nil {
+		handleCirculationError(w, "getCopies", err)
+		return
+	}
+
+	writeJSON(w, "getCopies", http.StatusOK, copies)
+}
+
+func (h *Handler) getCopy(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getCopy", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c, err := h.circulationService.GetCopy(r.Context(), id)
+	if err != nil {
+		handleCirculationError(w, "getCopy", err)
+		return
+	}
+
+	writeJSON(w, "getCopy", http.StatusOK, c)
+}
+
+func (h *Handler) updateCopy(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "updateCopy")
+	if !ok {
+		return
+	}
+
+	var inp domain.UpdateCopyInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("updateCopy", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := h.circulationService.UpdateCopy(r.Context(), userId, id, inp)
+	if err != nil {
+		handleCirculationError(w, "updateCopy", err)
+		return
+	}
+
+	writeJSON(w, "updateCopy", http.StatusOK, c)
+}
+
+func (h *Handler) deleteCopy(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "deleteCopy")
+	if !ok {
+		return
+	}
+
+	if err := h.circulationService.DeleteCopy(r.Context(), userId, id); err != nil {
+		handleCirculationError(w, "deleteCopy", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkoutCopy lends the copy to the current user, or with a borrower_id in
+// the body to another member.
+func (h *Handler) checkoutCopy(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "checkoutCopy")
+	if !ok {
+		return
+	}
+
+	var inp domain.CheckoutInput
+	if err := decodeOptionalBody(r, &inp); err != nil {
+		logError("checkoutCopy", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	loan, err := h.circulationService.Checkout(r.Context(), userId, id, inp, hasOrgRole(r, domain.OrgRoleLibrarian))
+	if err != nil {
+		handleCirculationError(w, "checkoutCopy", err)
+		return
+	}
+
+	writeJSON(w, "checkoutCopy", http.StatusCreated, loan)
+}
+
+func (h *Handler) returnCopy(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "returnCopy")
+	if !ok {
+		return
+	}
+
+	var inp domain.ReturnInput
+	if err := decodeOptionalBody(r, &inp); err != nil {
+		logError("returnCopy", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	loan, err := h.circulationService.Return(r.Context(), userId, id, inp, hasOrgRole(r, domain.OrgRoleLibrarian))
+	if err != nil {
+		handleCirculationError(w, "returnCopy", err)
+		return
+	}
+
+	writeJSON(w, "returnCopy", http.StatusOK, loan)
+}
+
+// getLoans lists loans of the current user. Librarians see every loan and
+// can filter by borrower and copy.
+func (h *Handler) getLoans(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("getLoans", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := getLoanFilter(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !hasOrgRole(r, domain.OrgRoleLibrarian) {
+		filter.BorrowerID = userId
+	}
+
+	loans, err := h.circulationService.GetLoans(r.Context(), filter)
+	if err != nil {
+		handleCirculationError(w, "getLoans", err)
+		return
+	}
+
+	writeJSON(w, "getLoans", http.StatusOK, loans)
+}
+
+// getOverdueLoans lists open loans past their due date, longest overdue first.
+func (h *Handler) getOverdueLoans(w http.ResponseWriter, r *http.Request) {
+	filter := domain.LoanFilter{Overdue: true}
+
+	var err error
+	if filter.Pagination, err = getPagination(r); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	loans, err := h.circulationService.GetLoans(r.Context(), filter)
+	if err != nil {
+		handleCirculationError(w, "getOverdueLoans", err)
+		return
+	}
+
+	writeJSON(w, "getOverdueLoans", http.StatusOK, loans)
+}
+
+func (h *Handler) getLoan(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "getLoan")
+	if !ok {
+		return
+	}
+
+	loan, err := h.circulationService.GetLoan(r.Context(), userId, id, hasOrgRole(r, domain.OrgRoleLibrarian))
+	if err != nil {
+		handleCirculationError(w, "getLoan", err)
+		return
+	}
+
+	writeJSON(w, "getLoan", http.StatusOK, loan)
+}
+
+func (h *Handler) renewLoan(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "renewLoan")
+	if !ok {
+		return
+	}
+
+	loan, err := h.circulationService.Renew(r.Context(), userId, id, hasOrgRole(r, domain.OrgRoleLibrarian))
+	if err != nil {
+		handleCirculationError(w, "renewLoan", err)
+		return
+	}
+
+	writeJSON(w, "renewLoan", http.StatusOK, loan)
+}
+
+func getLoanFilter(r *http.Request) (domain.LoanFilter, error) {
+	query := r.URL.Query()
+
+	var filter domain.LoanFilter
+	var err error
+
+	if borrower := query.Get("borrower"); borrower != "" {
+		if filter.BorrowerID, err = strconv.ParseInt(borrower, 10, 64); err != nil {
+			return filter, errors.New("invalid borrower")
+		}
+	}
+
+	if copyId := query.Get("copy"); copyId != "" {
+		if filter.CopyID, err = strconv.ParseInt(copyId, 10, 64); err != nil {
+			return filter, errors.New("invalid copy")
+		}
+	}
+
+	switch query.Get("status") {
+	case "":
+	case "open":
+		filter.Open = true
+	case "overdue":
+		filter.Overdue = true
+	default:
+		return filter, errors.New("invalid status")
+	}
+
+	filter.Pagination, err = getPagination(r)
+
+	return filter, err
+}
+
+// decodeOptionalBody decodes a JSON body into v and leaves v alone when the
+// body is empty.
+func decodeOptionalBody(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+func handleCirculationError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrBookNotFound), errors.Is(err, domain.ErrCopyNotFound), errors.Is(err, domain.ErrLoanNotFound),
+		errors.Is(err, domain.ErrHoldNotFound):
+		handleNotFoundError(w, err)
+	case errors.Is(err, domain.ErrBarcodeTaken), errors.Is(err, domain.ErrCopyOnLoan), errors.Is(err, domain.ErrLoanReturned),
+		errors.Is(err, domain.ErrLoanLimitReached), errors.Is(err, domain.ErrRenewalLimitReached),
+		errors.Is(err, domain.ErrCopyReserved), errors.Is(err, domain.ErrHoldsWaiting), errors.Is(err, domain.ErrHoldExists),
+		errors.Is(err, domain.ErrHoldClosed), errors.Is(err, domain.ErrNoCopies), errors.Is(err, domain.ErrCopyAvailable),
+		errors.Is(err, domain.ErrAlreadyBorrowed):
+		handleError(w, http.StatusConflict, err)
+	case errors.Is(err, domain.ErrNotBorrower), errors.Is(err, domain.ErrLibrarianRequired):
+		handleError(w, http.StatusForbidden, err)
+	case errors.Is(err, domain.ErrNotOrgMember), errors.Is(err, domain.ErrInvalidDueDate):
+		handleError(w, http.StatusBadRequest, err)
+	default:
+		logError(handler, "circulation request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
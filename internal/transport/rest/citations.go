@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/citation"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// getCitationFormat reads the format parameter or, without one, picks the
+// preferred citation media type of the Accept header. It returns "" for the
+// JSON representation.
+func getCitationFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if format == "json" {
+			return "", nil
+		}
+
+		if _, ok := citation.MediaTypes[format]; !ok {
+			return "", domain.ErrUnsupportedCitation
+		}
+
+		return format, nil
+	}
+
+	best, bestQ := "", 0.0
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+
+			format, ok := citation.FormatOf(mediaType)
+			if !ok && mediaType != "application/json" && mediaType != "application/*" && mediaType != "*/*" {
+				continue
+			}
+
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+
+			if q > bestQ {
+				best, bestQ = format, q
+			}
+		}
+	}
+
+	return best, nil
+}
+
+func writeCitation(w http.ResponseWriter, handler, format string, books []domain.Book) {
+	var buf bytes.Buffer
+	if err := citation.Write(&buf, format, books); err != nil {
+		logError(handler, "rendering citations", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", citation.MediaTypes[format]+"; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// citationImportFormat returns the format of BibTeX and RIS uploads.
+func citationImportFormat(r *http.Request) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", false
+	}
+
+	format, ok := citation.FormatOf(mediaType)
+	if !ok || format != domain.CitationFormatBibTeX && format != domain.CitationFormatRIS {
+		return "", false
+	}
+
+	return format, true
+}
+
+// importCitations creates the books of a BibTeX or RIS upload, skipping the
+// ones already catalogued.
+func (h *Handler) importCitations(w http.ResponseWriter, r *http.Request, format string) {
+	var dryRun bool
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			handleError(w, http.StatusBadRequest, fmt.Errorf("invalid dry_run: %w", err))
+			return
+		}
+	}
+
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("importCitations", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	report, err := h.booksService.ImportCitations(r.Context(), userId, r.Body, format, dryRun)
+	if err != nil {
+		handleImportError(w, "importCitations", err)
+		return
+	}
+
+	writeJSON(w, "importCitations", http.StatusOK, report)
+}
@@ -0,0 +1,163 @@
+package rest
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var exportContentTypes = map[string]string{
+	domain.ExportFormatCSV:    "text/csv; charset=utf-8",
+	domain.ExportFormatNDJSON: "application/x-ndjson",
+	domain.ExportFormatJSON:   "application/json",
+	domain.ExportFormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportBooks streams the books matching the filters of getAllBooks. Once
+// the first bytes are sent a failure can no longer change the status, so the
+// response is aborted and the client sees a truncated download.
+func (h *Handler) exportBooks(w http.ResponseWriter, r *http.Request) {
+	opts, err := getExportOptions(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	out := &exportWriter{
+		w:           w,
+		contentType: exportContentTypes[opts.Format],
+		filename:    "books." + opts.Format,
+		// xlsx files are zip archives already
+		compress: opts.Format != domain.ExportFormatXLSX && acceptsGzip(r),
+	}
+
+	err = h.booksService.Export(r.Context(), out, opts)
+	if err == nil {
+		err = out.Close()
+	}
+
+	if err != nil {
+		if out.started {
+			logError("exportBooks", "streaming books", err)
+			panic(http.ErrAbortHandler)
+		}
+
+		if errors.Is(err, domain.ErrInvalidISBN) {
+			handleError(w, http.StatusBadRequest, err)
+			return
+		}
+		logError("exportBooks", "exporting books", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// getExportOptions reads the format, the filters of getBookFilter and the
+// related data to include, e.g. include=authors,tags.
+func getExportOptions(r *http.Request) (domain.ExportOptions, error) {
+	query := r.URL.Query()
+
+	opts := domain.ExportOptions{Format: query.Get("format")}
+	if opts.Format == "" {
+		opts.Format = domain.ExportFormatCSV
+	}
+
+	if _, ok := exportContentTypes[opts.Format]; !ok {
+		return opts, domain.ErrUnsupportedExport
+	}
+
+	var err error
+	if opts.Filter, err = getBookFilter(r); err != nil {
+		return opts, err
+	}
+
+	for _, include := range query["include"] {
+		for _, name := range strings.Split(include, ",") {
+			switch strings.TrimSpace(name) {
+			case "authors":
+				opts.Authors = true
+			case "genres":
+				opts.Genres = true
+			case "tags":
+				opts.Tags = true
+			case "reviews":
+				opts.Reviews = true
+			case "":
+			default:
+				return opts, fmt.Errorf("%w: unknown %q", domain.ErrInvalidExportInclude, name)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "gzip" && name != "*" {
+				continue
+			}
+
+			q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if !ok {
+				return true
+			}
+
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// exportWriter sends the headers of an export with its first bytes, so errors
+// before that can still be answered with a status code.
+type exportWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	compress    bool
+
+	gz      *gzip.Writer
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+
+		header := e.w.Header()
+		header.Set("Content-Type", e.contentType)
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, e.filename))
+		header.Add("Vary", "Accept-Encoding")
+		if e.compress {
+			header.Set("Content-Encoding", "gzip")
+			e.gz = gzip.NewWriter(e.w)
+		}
+
+		e.w.WriteHeader(http.StatusOK)
+	}
+
+	if e.gz != nil {
+		return e.gz.Write(p)
+	}
+
+	return e.w.Write(p)
+}
+
+func (e *exportWriter) Close() error {
+	if e.gz != nil {
+		return e.gz.Close()
+	}
+
+	return nil
+}
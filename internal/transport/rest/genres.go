@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+)
+
+func (h *Handler) createGenre(w http.ResponseWriter, r *http.Request) {
+	var inp domain.CreateGenreInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("createGenre", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	genre, err := h.genresService.Create(r.Context(), inp)
+	if err != nil {
+		handleGenreError(w, "createGenre", err)
+		return
+	}
+
+	writeJSON(w, "createGenre", http.StatusCreated, genre)
+}
+
+func (h *Handler) getGenres(w http.ResponseWriter, r *http.Request) {
+	genres, err := h.genresService.GetAll(r.Context())
+	if err != nil {
+		logError("getGenres", "getting genres", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getGenres", http.StatusOK, genres)
+}
+
+func (h *Handler) getGenreByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getGenreByID", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	genre, err := h.genresService.GetByID(r.Context(), id)
+	if err != nil {
+		handleGenreError(w, "getGenreByID", err)
+		return
+	}
+
+	writeJSON(w, "getGenreByID", http.StatusOK, genre)
+}
+
+func (h *Handler) updateGenre(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("updateGenre", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var inp domain.UpdateGenreInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("updateGenre", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	genre, err := h.genresService.Update(r.Context(), id, inp)
+	if err != nil {
+		handleGenreError(w, "updateGenre", err)
+		return
+	}
+
+	writeJSON(w, "updateGenre", http.StatusOK, genre)
+}
+
+func (h *Handler) deleteGenre(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("deleteGenre", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.genresService.Delete(r.Context(), id); err != nil {
+		handleGenreError(w, "deleteGenre", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.genresService.Tags(r.Context())
+	if err != nil {
+		logError("getTags", "getting tags", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getTags", http.StatusOK, tags)
+}
+
+func handleGenreError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrGenreNotFound):
+		handleNotFoundError(w, err)
+	case errors.Is(err, domain.ErrGenreSlugTaken), errors.Is(err, domain.ErrGenreCycle):
+		handleError(w, http.StatusConflict, err)
+	default:
+		logError(handler, "genre request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
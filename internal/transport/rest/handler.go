@@ -3,8 +3,10 @@ package rest
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/dewi911/cruda-app/internal/domain"
 	"github.com/gorilla/mux"
+	"io"
 	"net/http"
 	"strconv"
 )
@@ -12,65 +14,527 @@ import (
 type Books interface {
 	Create(ctx context.Context, book domain.Book) error
 	GetByID(ctx context.Context, id int64) (domain.Book, error)
-	GetAll(ctx context.Context) ([]domain.Book, error)
+	GetAll(ctx context.Context, filter domain.BookFilter) ([]domain.Book, error)
+	List(ctx context.Context, filter domain.BookFilter, order string, p domain.Pagination) (domain.BookList, error)
+	Delete(ctx context.Context, userId, id int64, ifMatch string) error
+	GetTrash(ctx context.Context, p domain.Pagination) (domain.BookList, error)
+	GetTrashedByID(ctx context.Context, id int64) (domain.Book, error)
+	Restore(ctx context.Context, userId, id int64, ifMatch string) (domain.Book, error)
+	Replace(ctx context.Context, userId, id int64, book domain.Book, ifMatch string) (domain.Book, error)
+	Patch(ctx context.Context, userId, id int64, mediaType string, patch []byte, ifMatch string) (domain.Book, error)
+	Enrich(ctx context.Context, isbn string) (domain.BookMetadata, error)
+	Facets(ctx context.Context, filter domain.BookFilter) (domain.BookFacets, error)
+	Export(ctx context.Context, w io.Writer, opts domain.ExportOptions) error
+	ImportCitations(ctx context.Context, userId int64, r io.Reader, format string, dryRun bool) (domain.CitationImport, error)
+
+	GetRevisions(ctx context.Context, bookId int64, p domain.Pagination) (domain.BookRevisionList, error)
+	GetRevision(ctx context.Context, bookId int64, revision int) (domain.BookRevision, error)
+	Diff(ctx context.Context, bookId int64, from, to int) (domain.BookDiff, error)
+	Revert(ctx context.Context, userId, id int64, revision int, ifMatch string) (domain.Book, error)
+}
+
+type Reviews interface {
+	Create(ctx context.Context, userId, bookId int64, inp domain.ReviewInput) (domain.Review, error)
+	List(ctx context.Context, bookId int64, filter domain.ReviewFilter) (domain.ReviewList, error)
+	Get(ctx context.Context, bookId, id int64, moderator bool) (domain.Review, error)
+	Update(ctx context.Context, userId, bookId, id int64, inp domain.ReviewInput) (domain.Review, error)
+	Delete(ctx context.Context, userId, bookId, id int64, moderator bool) error
+	Flag(ctx context.Context, bookId, id int64) error
+	Moderate(ctx context.Context, bookId, id int64, hidden bool) (domain.Review, error)
+}
+
+type Shelves interface {
+	Create(ctx context.Context, userId int64, inp domain.ShelfInput) (domain.Shelf, error)
+	GetAll(ctx context.Context, userId int64) ([]domain.Shelf, error)
+	GetByID(ctx context.Context, userId, id int64) (domain.Shelf, error)
+	Rename(ctx context.Context, userId, id int64, inp domain.ShelfInput) (domain.Shelf, error)
+	Delete(ctx context.Context, userId, id int64) error
+	AddBook(ctx context.Context, userId, id, bookId int64) error
+	RemoveBook(ctx context.Context, userId, id, bookId int64) error
+	GetBooks(ctx context.Context, userId, id int64, p domain.Pagination) (domain.ShelfBookList, error)
+
+	GetReading(ctx context.Context, userId, bookId int64) (domain.Reading, error)
+	ListReading(ctx context.Context, userId int64, filter domain.ReadingFilter) (domain.ReadingList, error)
+	SetReading(ctx context.Context, userId, bookId int64, inp domain.ReadingInput) (domain.Reading, error)
+	DeleteReading(ctx context.Context, userId, bookId int64) error
+	Stats(ctx context.Context, userId int64) (domain.ReadingStats, error)
+}
+
+type Circulation interface {
+	CreateCopy(ctx context.Context, userId, bookId int64, inp domain.CreateCopyInput) (domain.Copy, error)
+	GetCopy(ctx context.Context, id int64) (domain.Copy, error)
+	GetCopies(ctx context.Context, bookId int64) ([]domain.Copy, error)
+	UpdateCopy(ctx context.Context, userId, id int64, inp domain.UpdateCopyInput) (domain.Copy, error)
+	DeleteCopy(ctx context.Context, userId, id int64) error
+
+	Checkout(ctx context.Context, userId, copyId int64, inp domain.CheckoutInput, librarian bool) (domain.Loan, error)
+	Return(ctx context.Context, userId, copyId int64, inp domain.ReturnInput, librarian bool) (domain.Loan, error)
+	Renew(ctx context.Context, userId, id int64, librarian bool) (domain.Loan, error)
+	GetLoan(ctx context.Context, userId, id int64, librarian bool) (domain.Loan, error)
+	GetLoans(ctx context.Context, filter domain.LoanFilter) (domain.LoanList, error)
+
+	PlaceHold(ctx context.Context, userId int64, inp domain.HoldInput) (domain.Hold, error)
+	GetHold(ctx context.Context, userId, id int64, librarian bool) (domain.Hold, error)
+	GetHolds(ctx context.Context, filter domain.HoldFilter) (domain.HoldList, error)
+	CancelHold(ctx context.Context, userId, id int64, librarian bool) error
+}
+
+type Genres interface {
+	Create(ctx context.Context, inp domain.CreateGenreInput) (domain.Genre, error)
+	GetByID(ctx context.Context, id int64) (domain.Genre, error)
+	GetAll(ctx context.Context) ([]domain.Genre, error)
+	Update(ctx context.Context, id int64, inp domain.UpdateGenreInput) (domain.Genre, error)
+	Delete(ctx context.Context, id int64) error
+	Tags(ctx context.Context) ([]domain.TagCount, error)
+}
+
+type Authors interface {
+	Create(ctx context.Context, inp domain.CreateAuthorInput) (domain.Author, error)
+	GetByID(ctx context.Context, id int64) (domain.Author, error)
+	List(ctx context.Context, filter domain.AuthorFilter) (domain.AuthorList, error)
+	Update(ctx context.Context, id int64, inp domain.UpdateAuthorInput) (domain.Author, error)
 	Delete(ctx context.Context, id int64) error
-	Update(ctx context.Context, id int64, inp domain.UpdateBookInput) error
+	Books(ctx context.Context, id int64) ([]domain.Book, error)
 }
 
 type User interface {
 	SingUp(ctx context.Context, user domain.SingUpInput) error
-	SingIn(ctx context.Context, inp domain.SingInInput) (string, string, error)
-	ParseToken(ctx context.Context, accessToken string) (int64, error)
+	SingIn(ctx context.Context, inp domain.SingInInput) (domain.SingInResult, error)
+	Authenticate(ctx context.Context, email, password string) (int64, error)
+	VerifyMFA(ctx context.Context, inp domain.MFAVerifyInput) (string, string, error)
+	ParseToken(ctx context.Context, accessToken string) (domain.AccessClaims, error)
 	RefreshTokens(ctx context.Context, refreshToken string) (string, string, error)
+
+	GetByID(ctx context.Context, id int64) (domain.User, error)
+	Update(ctx context.Context, id int64, inp domain.UpdateUserInput) (domain.UpdateUserResult, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ChangePassword(ctx context.Context, id int64, inp domain.ChangePasswordInput) error
+	Delete(ctx context.Context, id int64, inp domain.DeleteUserInput) error
+}
+
+type MFA interface {
+	Enroll(ctx context.Context, userId int64) (domain.MFAEnrollment, error)
+	Confirm(ctx context.Context, userId int64, code string) (domain.RecoveryCodes, error)
+	Disable(ctx context.Context, userId int64, inp domain.MFADisableInput) error
+	RegenerateRecoveryCodes(ctx context.Context, userId int64, code string) (domain.RecoveryCodes, error)
+}
+
+type APIKeys interface {
+	Create(ctx context.Context, userId int64, inp domain.CreateAPIKeyInput) (domain.CreatedAPIKey, error)
+	List(ctx context.Context, userId int64) ([]domain.APIKey, error)
+	Revoke(ctx context.Context, userId, id int64) error
+	Authenticate(ctx context.Context, key string) (domain.APIKey, error)
+}
+
+type OIDC interface {
+	Begin(ctx context.Context, provider string) (string, string, error)
+	Complete(ctx context.Context, provider, signedState, state, code string) (domain.SingInResult, error)
+}
+
+type Admin interface {
+	ListUsers(ctx context.Context, filter domain.UserFilter) (domain.UserList, error)
+	GetUser(ctx context.Context, id int64) (domain.User, error)
+	DisableUser(ctx context.Context, actorId, id int64) error
+	EnableUser(ctx context.Context, actorId, id int64) error
+	LogoutUser(ctx context.Context, actorId, id int64) error
+	ResetMFA(ctx context.Context, actorId, id int64) error
+	SetRole(ctx context.Context, actorId, id int64, role string) error
+}
+
+type Privacy interface {
+	Export(ctx context.Context, userId int64) (domain.UserExport, error)
+	RequestErasure(ctx context.Context, userId int64, inp domain.ErasureRequestInput) (domain.ErasureJob, error)
+	GetErasureJob(ctx context.Context, id int64) (domain.ErasureJob, error)
+	GetErasureJobByToken(ctx context.Context, token string) (domain.ErasureJob, error)
+}
+
+type Imports interface {
+	Import(ctx context.Context, userId int64, r io.Reader, opts domain.ImportOptions) (domain.BookImport, error)
+	Get(ctx context.Context, id int64) (domain.BookImport, error)
+}
+
+type Scheduler interface {
+	Jobs(ctx context.Context) ([]domain.Job, error)
+	GetRuns(ctx context.Context, filter domain.JobRunFilter) (domain.JobRunList, error)
+	Trigger(ctx context.Context, actorId int64, name string) (domain.JobRun, error)
+}
+
+type Orgs interface {
+	Create(ctx context.Context, userId int64, inp domain.CreateOrgInput) (domain.Organization, error)
+	List(ctx context.Context, userId int64) ([]domain.Membership, error)
+	Get(ctx context.Context, userId, orgId int64) (domain.Membership, error)
+	Members(ctx context.Context, userId, orgId int64) ([]domain.OrgMember, error)
+	SetMemberRole(ctx context.Context, userId, orgId, memberId int64, role string) error
+	RemoveMember(ctx context.Context, userId, orgId, memberId int64) error
+	Invite(ctx context.Context, userId, orgId int64, inp domain.InviteInput) (domain.Invitation, error)
+	AcceptInvitation(ctx context.Context, userId int64, token string) (domain.Membership, error)
+	Switch(ctx context.Context, userId, orgId int64) (string, string, error)
+	ResolveActive(ctx context.Context, userId, orgId int64) (domain.Membership, error)
+}
+
+type Services struct {
+	Books       Books
+	Authors     Authors
+	Genres      Genres
+	Reviews     Reviews
+	Shelves     Shelves
+	Circulation Circulation
+	Users       User
+	MFA         MFA
+	APIKeys     APIKeys
+	OIDC        OIDC
+	Admin       Admin
+	Privacy     Privacy
+	Orgs        Orgs
+	Scheduler   Scheduler
+	Imports     Imports
 }
 
 type Handler struct {
-	booksService Books
-	usersService User
+	booksService       Books
+	authorsService     Authors
+	genresService      Genres
+	reviewsService     Reviews
+	shelvesService     Shelves
+	circulationService Circulation
+	usersService       User
+	mfaService         MFA
+	apiKeysService     APIKeys
+	oidcService        OIDC
+	adminService       Admin
+	privacyService     Privacy
+	orgsService        Orgs
+	scheduler          Scheduler
+	importsService     Imports
+
+	limiter   *RateLimiter
+	publicURL string
 }
 
-func NewHandler(books Books, users User) *Handler {
+func NewHandler(services Services, limiter *RateLimiter, publicURL string) *Handler {
 	return &Handler{
-		booksService: books,
-		usersService: users,
+		booksService:       services.Books,
+		authorsService:     services.Authors,
+		genresService:      services.Genres,
+		reviewsService:     services.Reviews,
+		shelvesService:     services.Shelves,
+		circulationService: services.Circulation,
+		usersService:       services.Users,
+		mfaService:         services.MFA,
+		apiKeysService:     services.APIKeys,
+		oidcService:        services.OIDC,
+		adminService:       services.Admin,
+		privacyService:     services.Privacy,
+		orgsService:        services.Orgs,
+		scheduler:          services.Scheduler,
+		importsService:     services.Imports,
+		limiter:            limiter,
+		publicURL:          publicURL,
 	}
 }
 
 func (h *Handler) InitRouter() *mux.Router {
 	r := mux.NewRouter()
-	r.Use(loggingMiddleware)
+	r.Use(loggingMiddleware, h.limiter.global())
 
 	auth := r.PathPrefix("/auth").Subrouter()
 	{
+		auth.Use(h.limiter.group("auth"))
+
 		auth.HandleFunc("/sing-up", h.SingUp).Methods(http.MethodPost)
 		auth.HandleFunc("/sing-in", h.SingIn).Methods(http.MethodGet)
 		auth.HandleFunc("/refresh", h.refresh).Methods(http.MethodGet)
+		auth.HandleFunc("/verify-email", h.verifyEmail).Methods(http.MethodPost)
+		auth.HandleFunc("/mfa/verify", h.verifyMFA).Methods(http.MethodPost)
+		auth.HandleFunc("/oidc/{provider}/login", h.oidcLogin).Methods(http.MethodGet)
+		auth.HandleFunc("/oidc/{provider}/callback", h.oidcCallback).Methods(http.MethodGet)
+
+		mfa := auth.PathPrefix("/mfa").Subrouter()
+		{
+			mfa.Use(h.authMiddleware, h.requireSession)
+
+			mfa.HandleFunc("/enroll", h.enrollMFA).Methods(http.MethodPost)
+			mfa.HandleFunc("/confirm", h.confirmMFA).Methods(http.MethodPost)
+			mfa.HandleFunc("/disable", h.disableMFA).Methods(http.MethodPost)
+			mfa.HandleFunc("/recovery-codes", h.regenerateRecoveryCodes).Methods(http.MethodPost)
+		}
+	}
+
+	// reviews are written by every member, so they are routed before the
+	// librarian-only book routes
+	reviews := r.PathPrefix("/books/{id:[0-9]+}/reviews").Subrouter()
+	{
+		reviews.Use(h.authMiddleware, h.limiter.group("books"), requireScopes(domain.ScopeBooksRead, domain.ScopeBooksWrite),
+			h.orgMiddleware)
+
+		reviews.HandleFunc("", h.createReview).Methods(http.MethodPost)
+		reviews.HandleFunc("", h.getReviews).Methods(http.MethodGet)
+		reviews.HandleFunc("/{reviewId:[0-9]+}", h.getReview).Methods(http.MethodGet)
+		reviews.HandleFunc("/{reviewId:[0-9]+}", h.updateReview).Methods(http.MethodPut)
+		reviews.HandleFunc("/{reviewId:[0-9]+}", h.deleteReview).Methods(http.MethodDelete)
+		reviews.HandleFunc("/{reviewId:[0-9]+}/flag", h.flagReview).Methods(http.MethodPost)
+		reviews.Handle("/{reviewId:[0-9]+}/moderation", requireOrgRole(domain.OrgRoleLibrarian)(http.HandlerFunc(h.moderateReview))).
+			Methods(http.MethodPut)
 	}
 
 	books := r.PathPrefix("/books").Subrouter()
 	{
-		books.Use(h.authMiddleware)
+		books.Use(h.authMiddleware, h.limiter.group("books"), requireScopes(domain.ScopeBooksRead, domain.ScopeBooksWrite),
+			h.orgMiddleware, requireOrgWriteRole(domain.OrgRoleLibrarian))
 
 		books.HandleFunc("", h.createBook).Methods(http.MethodPost)
 		books.HandleFunc("", h.getAllBooks).Methods(http.MethodGet)
+		books.HandleFunc("/enrich", h.enrichBook).Methods(http.MethodPost)
+		books.HandleFunc("/facets", h.getBookFacets).Methods(http.MethodGet)
+		books.HandleFunc("/export", h.exportBooks).Methods(http.MethodGet)
+		books.HandleFunc("/import", h.importBooks).Methods(http.MethodPost)
+		books.Handle("/imports/{id:[0-9]+}", requireOrgRole(domain.OrgRoleLibrarian)(http.HandlerFunc(h.getImport))).
+			Methods(http.MethodGet)
+		books.Handle("/trash", requireOrgRole(domain.OrgRoleLibrarian)(http.HandlerFunc(h.getTrash))).Methods(http.MethodGet)
+		books.Handle("/trash/{id:[0-9]+}", requireOrgRole(domain.OrgRoleLibrarian)(http.HandlerFunc(h.getTrashedBook))).
+			Methods(http.MethodGet)
 		books.HandleFunc("/{id:[0-9]+}", h.getBookByID).Methods(http.MethodGet)
 		books.HandleFunc("/{id:[0-9]+}", h.deleteBook).Methods(http.MethodDelete)
 		books.HandleFunc("/{id:[0-9]+}", h.updateBook).Methods(http.MethodPut)
+		books.HandleFunc("/{id:[0-9]+}", h.patchBook).Methods(http.MethodPatch)
+		books.HandleFunc("/{id:[0-9]+}/restore", h.restoreBook).Methods(http.MethodPost)
+		books.HandleFunc("/{id:[0-9]+}/revisions", h.getBookRevisions).Methods(http.MethodGet)
+		books.HandleFunc("/{id:[0-9]+}/revisions/diff", h.diffBookRevisions).Methods(http.MethodGet)
+		books.HandleFunc("/{id:[0-9]+}/revisions/{rev:[0-9]+}", h.getBookRevision).Methods(http.MethodGet)
+		books.HandleFunc("/{id:[0-9]+}/revert/{rev:[0-9]+}", h.revertBook).Methods(http.MethodPost)
+		books.HandleFunc("/{id:[0-9]+}/copies", h.createCopy).Methods(http.MethodPost)
+		books.HandleFunc("/{id:[0-9]+}/copies", h.getCopies).Methods(http.MethodGet)
+	}
+
+	// members check out and return copies themselves, so only managing copies
+	// and the overdue listing need a librarian
+	copies := r.PathPrefix("/copies").Subrouter()
+	{
+		copies.Use(h.authMiddleware, h.limiter.group("books"), requireScopes(domain.ScopeBooksRead, domain.ScopeBooksWrite),
+			h.orgMiddleware)
+
+		librarian := requireOrgRole(domain.OrgRoleLibrarian)
+
+		copies.HandleFunc("/{id:[0-9]+}", h.getCopy).Methods(http.MethodGet)
+		copies.Handle("/{id:[0-9]+}", librarian(http.HandlerFunc(h.updateCopy))).Methods(http.MethodPut)
+		copies.Handle("/{id:[0-9]+}", librarian(http.HandlerFunc(h.deleteCopy))).Methods(http.MethodDelete)
+		copies.HandleFunc("/{id:[0-9]+}/checkout", h.checkoutCopy).Methods(http.MethodPost)
+		copies.HandleFunc("/{id:[0-9]+}/return", h.returnCopy).Methods(http.MethodPost)
+	}
+
+	loans := r.PathPrefix("/loans").Subrouter()
+	{
+		loans.Use(h.authMiddleware, h.limiter.group("books"), requireScopes(domain.ScopeBooksRead, domain.ScopeBooksWrite),
+			h.orgMiddleware)
+
+		loans.HandleFunc("", h.getLoans).Methods(http.MethodGet)
+		loans.Handle("/overdue", requireOrgRole(domain.OrgRoleLibrarian)(http.HandlerFunc(h.getOverdueLoans))).
+			Methods(http.MethodGet)
+		loans.HandleFunc("/{id:[0-9]+}", h.getLoan).Methods(http.MethodGet)
+		loans.HandleFunc("/{id:[0-9]+}/renew", h.renewLoan).Methods(http.MethodPost)
+	}
+
+	holds := r.PathPrefix("/holds").Subrouter()
+	{
+		holds.Use(h.authMiddleware, h.limiter.group("books"), requireScopes(domain.ScopeBooksRead, domain.ScopeBooksWrite),
+			h.orgMiddleware)
+
+		holds.HandleFunc("", h.placeHold).Methods(http.MethodPost)
+		holds.HandleFunc("", h.getHolds).Methods(http.MethodGet)
+		holds.HandleFunc("/{id:[0-9]+}", h.getHold).Methods(http.MethodGet)
+		holds.HandleFunc("/{id:[0-9]+}", h.cancelHold).Methods(http.MethodDelete)
+	}
+
+	authors := r.PathPrefix("/authors").Subrouter()
+	{
+		authors.Use(h.authMiddleware, h.limiter.group("books"), requireScopes(domain.ScopeBooksRead, domain.ScopeBooksWrite),
+			h.orgMiddleware, requireOrgWriteRole(domain.OrgRoleLibrarian))
+
+		authors.HandleFunc("", h.createAuthor).Methods(http.MethodPost)
+		authors.HandleFunc("", h.getAuthors).Methods(http.MethodGet)
+		authors.HandleFunc("/{id:[0-9]+}", h.getAuthorByID).Methods(http.MethodGet)
+		authors.HandleFunc("/{id:[0-9]+}", h.updateAuthor).Methods(http.MethodPut)
+		authors.HandleFunc("/{id:[0-9]+}", h.deleteAuthor).Methods(http.MethodDelete)
+		authors.HandleFunc("/{id:[0-9]+}/books", h.getAuthorBooks).Methods(http.MethodGet)
+	}
+
+	genres := r.PathPrefix("/genres").Subrouter()
+	{
+		genres.Use(h.authMiddleware, h.limiter.group("books"), requireScopes(domain.ScopeBooksRead, domain.ScopeBooksWrite),
+			h.orgMiddleware, requireOrgWriteRole(domain.OrgRoleLibrarian))
+
+		genres.HandleFunc("", h.createGenre).Methods(http.MethodPost)
+		genres.HandleFunc("", h.getGenres).Methods(http.MethodGet)
+		genres.HandleFunc("/{id:[0-9]+}", h.getGenreByID).Methods(http.MethodGet)
+		genres.HandleFunc("/{id:[0-9]+}", h.updateGenre).Methods(http.MethodPut)
+		genres.HandleFunc("/{id:[0-9]+}", h.deleteGenre).Methods(http.MethodDelete)
+	}
+
+	// E-readers can't obtain tokens, so the catalog takes Basic credentials.
+	// Passwords are limited by the auth group inside basicAuthMiddleware.
+	catalog := r.PathPrefix("/opds").Subrouter()
+	{
+		catalog.Use(h.limiter.group("opds"), h.basicAuthMiddleware(opdsRealm),
+			requireScopes(domain.ScopeBooksRead, domain.ScopeBooksWrite), h.orgMiddleware)
+
+		catalog.HandleFunc("/opensearch.xml", h.opdsOpenSearch).Methods(http.MethodGet)
+		catalog.HandleFunc("/books/{id:[0-9]+}/copies", h.getCopies).Methods(http.MethodGet)
+		for _, c := range opdsCatalogs {
+			h.routeOPDS(catalog, c)
+		}
+	}
+
+	tags := r.PathPrefix("/tags").Subrouter()
+	{
+		tags.Use(h.authMiddleware, h.limiter.group("books"), requireScopes(domain.ScopeBooksRead, domain.ScopeBooksWrite),
+			h.orgMiddleware)
+
+		tags.HandleFunc("", h.getTags).Methods(http.MethodGet)
+	}
+
+	users := r.PathPrefix("/users").Subrouter()
+	{
+		users.Use(h.authMiddleware, h.requireSession)
+
+		users.HandleFunc("/me", h.getMe).Methods(http.MethodGet)
+		users.HandleFunc("/me", h.updateMe).Methods(http.MethodPatch)
+		users.HandleFunc("/me", h.deleteMe).Methods(http.MethodDelete)
+		users.HandleFunc("/me/password", h.changePassword).Methods(http.MethodPost)
+		users.HandleFunc("/me/export", h.exportMe).Methods(http.MethodGet)
+		users.HandleFunc("/me/erasure", h.requestErasure).Methods(http.MethodPost)
+
+		// shelves and reading status refer to books of the active organization
+		shelves := users.PathPrefix("/me").Subrouter()
+		{
+			shelves.Use(h.limiter.group("books"), h.orgMiddleware)
+
+			shelves.HandleFunc("/shelves", h.createShelf).Methods(http.MethodPost)
+			shelves.HandleFunc("/shelves", h.getShelves).Methods(http.MethodGet)
+			shelves.HandleFunc("/shelves/{id:[0-9]+}", h.getShelfByID).Methods(http.MethodGet)
+			shelves.HandleFunc("/shelves/{id:[0-9]+}", h.renameShelf).Methods(http.MethodPut)
+			shelves.HandleFunc("/shelves/{id:[0-9]+}", h.deleteShelf).Methods(http.MethodDelete)
+			shelves.HandleFunc("/shelves/{id:[0-9]+}/books", h.getShelfBooks).Methods(http.MethodGet)
+			shelves.HandleFunc("/shelves/{id:[0-9]+}/books/{bookId:[0-9]+}", h.addShelfBook).Methods(http.MethodPut)
+			shelves.HandleFunc("/shelves/{id:[0-9]+}/books/{bookId:[0-9]+}", h.removeShelfBook).Methods(http.MethodDelete)
+			shelves.HandleFunc("/reading", h.getReadingList).Methods(http.MethodGet)
+			shelves.HandleFunc("/reading/{bookId:[0-9]+}", h.getReading).Methods(http.MethodGet)
+			shelves.HandleFunc("/reading/{bookId:[0-9]+}", h.setReading).Methods(http.MethodPut)
+			shelves.HandleFunc("/reading/{bookId:[0-9]+}", h.deleteReading).Methods(http.MethodDelete)
+			shelves.HandleFunc("/stats", h.getReadingStats).Methods(http.MethodGet)
+		}
+	}
+
+	r.HandleFunc("/privacy/erasure/{token:[0-9a-f]+}", h.getErasureStatus).Methods(http.MethodGet)
+
+	admin := r.PathPrefix("/admin").Subrouter()
+	{
+		admin.Use(h.authMiddleware, h.requireSession, requireRole(domain.RoleAdmin))
+
+		admin.HandleFunc("/users", h.listUsers).Methods(http.MethodGet)
+		admin.HandleFunc("/users/{id:[0-9]+}", h.getUser).Methods(http.MethodGet)
+		admin.HandleFunc("/users/{id:[0-9]+}/disable", h.disableUser).Methods(http.MethodPost)
+		admin.HandleFunc("/users/{id:[0-9]+}/enable", h.enableUser).Methods(http.MethodPost)
+		admin.HandleFunc("/users/{id:[0-9]+}/logout", h.logoutUser).Methods(http.MethodPost)
+		admin.HandleFunc("/users/{id:[0-9]+}/mfa/reset", h.resetUserMFA).Methods(http.MethodPost)
+		admin.HandleFunc("/users/{id:[0-9]+}/role", h.setUserRole).Methods(http.MethodPut)
+		admin.HandleFunc("/erasure-jobs/{id:[0-9]+}", h.getErasureJob).Methods(http.MethodGet)
+		admin.HandleFunc("/jobs", h.getJobs).Methods(http.MethodGet)
+		admin.HandleFunc("/jobs/runs", h.getJobRuns).Methods(http.MethodGet)
+		admin.HandleFunc("/jobs/{name}/runs", h.getJobRuns).Methods(http.MethodGet)
+		admin.HandleFunc("/jobs/{name}/runs", h.triggerJob).Methods(http.MethodPost)
+	}
+
+	orgs := r.PathPrefix("/orgs").Subrouter()
+	{
+		orgs.Use(h.authMiddleware, h.requireSession)
+
+		orgs.HandleFunc("", h.createOrg).Methods(http.MethodPost)
+		orgs.HandleFunc("", h.getOrgs).Methods(http.MethodGet)
+		orgs.HandleFunc("/invitations/accept", h.acceptInvitation).Methods(http.MethodPost)
+		orgs.HandleFunc("/{id:[0-9]+}", h.getOrg).Methods(http.MethodGet)
+		orgs.HandleFunc("/{id:[0-9]+}/members", h.getOrgMembers).Methods(http.MethodGet)
+		orgs.HandleFunc("/{id:[0-9]+}/members/{userId:[0-9]+}", h.setOrgMemberRole).Methods(http.MethodPut)
+		orgs.HandleFunc("/{id:[0-9]+}/members/{userId:[0-9]+}", h.removeOrgMember).Methods(http.MethodDelete)
+		orgs.HandleFunc("/{id:[0-9]+}/invitations", h.inviteToOrg).Methods(http.MethodPost)
+		orgs.HandleFunc("/{id:[0-9]+}/switch", h.switchOrg).Methods(http.MethodPost)
+	}
+
+	apiKeys := r.PathPrefix("/api-keys").Subrouter()
+	{
+		apiKeys.Use(h.authMiddleware, h.requireSession)
+
+		apiKeys.HandleFunc("", h.createAPIKey).Methods(http.MethodPost)
+		apiKeys.HandleFunc("", h.getAPIKeys).Methods(http.MethodGet)
+		apiKeys.HandleFunc("/{id:[0-9]+}", h.revokeAPIKey).Methods(http.MethodDelete)
 	}
 
 	return r
 }
 
+// userAndIdRequest reads the current user and the id from the path, writing
+// the error response when either is missing.
+func userAndIdRequest(w http.ResponseWriter, r *http.Request, handler string) (int64, int64, bool) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError(handler, "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError(handler, "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return userId, id, true
+}
+
 func getIdFromRequest(r *http.Request) (int64, error) {
+	return getPathInt64(r, "id")
+}
+
+func getPathInt64(r *http.Request, name string) (int64, error) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	id, err := strconv.ParseInt(vars[name], 10, 64)
 	if err != nil {
 		return 0, err
 	}
 
 	if id == 0 {
-		return 0, errors.New("id can't be 0")
+		return 0, fmt.Errorf("%s can't be 0", name)
 	}
 
 	return id, nil
 }
+
+func getUserIdFromContext(r *http.Request) (int64, error) {
+	id, ok := r.Context().Value(ctxUserID).(int64)
+	if !ok {
+		return 0, errors.New("user id is missing in context")
+	}
+
+	return id, nil
+}
+
+func getPagination(r *http.Request) (domain.Pagination, error) {
+	var p domain.Pagination
+	var err error
+
+	if page := r.URL.Query().Get("page"); page != "" {
+		if p.Page, err = strconv.Atoi(page); err != nil {
+			return p, errors.New("invalid page")
+		}
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		if p.Limit, err = strconv.Atoi(limit); err != nil {
+			return p, errors.New("invalid limit")
+		}
+	}
+
+	p.Normalize()
+
+	return p, nil
+}
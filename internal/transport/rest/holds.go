@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) placeHold(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("placeHold", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.HoldInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("placeHold", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	hold, err := h.circulationService.PlaceHold(r.Context(), userId, inp)
+	if err != nil {
+		handleCirculationError(w, "placeHold", err)
+		return
+	}
+
+	writeJSON(w, "placeHold", http.StatusCreated, hold)
+}
+
+// getHolds lists holds of the current user. Librarians see every hold and
+// can filter by user and book; status=active leaves out closed holds.
+func (h *Handler) getHolds(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("getHolds", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := getHoldFilter(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !hasOrgRole(r, domain.OrgRoleLibrarian) {
+		filter.UserID = userId
+	}
+
+	holds, err := h.circulationService.GetHolds(r.Context(), filter)
+	if err != nil {
+		handleCirculationError(w, "getHolds", err)
+		return
+	}
+
+	writeJSON(w, "getHolds", http.StatusOK, holds)
+}
+
+func (h *Handler) getHold(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "getHold")
+	if !ok {
+		return
+	}
+
+	hold, err := h.circulationService.GetHold(r.Context(), userId, id, hasOrgRole(r, domain.OrgRoleLibrarian))
+	if err != nil {
+		handleCirculationError(w, "getHold", err)
+		return
+	}
+
+	writeJSON(w, "getHold", http.StatusOK, hold)
+}
+
+func (h *Handler) cancelHold(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "cancelHold")
+	if !ok {
+		return
+	}
+
+	if err := h.circulationService.CancelHold(r.Context(), userId, id, hasOrgRole(r, domain.OrgRoleLibrarian)); err != nil {
+		handleCirculationError(w, "cancelHold", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getHoldFilter(r *http.Request) (domain.HoldFilter, error) {
+	query := r.URL.Query()
+
+	var filter domain.HoldFilter
+	var err error
+
+	if user := query.Get("user"); user != "" {
+		if filter.UserID, err = strconv.ParseInt(user, 10, 64); err != nil {
+			return filter, errors.New("invalid user")
+		}
+	}
+
+	if book := query.Get("book"); book != "" {
+		if filter.BookID, err = strconv.ParseInt(book, 10, 64); err != nil {
+			return filter, errors.New("invalid book")
+		}
+	}
+
+	switch query.Get("status") {
+	case "":
+	case "active":
+		filter.Active = true
+	default:
+		return filter, errors.New("invalid status")
+	}
+
+	filter.Pagination, err = getPagination(r)
+
+	return filter, err
+}
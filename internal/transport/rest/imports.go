@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var importFormats = map[string]string{
+	"text/csv":             domain.ImportFormatCSV,
+	"application/json":     domain.ImportFormatJSON,
+	"application/x-ndjson": domain.ImportFormatNDJSON,
+	"application/ndjson":   domain.ImportFormatNDJSON,
+}
+
+// importBooks imports the books of a CSV, JSON array or NDJSON upload. Small
+// imports answer with the report, larger ones with 202 and the location of
+// the import to poll. BibTeX and RIS uploads are handled by importCitations.
+func (h *Handler) importBooks(w http.ResponseWriter, r *http.Request) {
+	if format, ok := citationImportFormat(r); ok {
+		h.importCitations(w, r, format)
+		return
+	}
+
+	opts, err := getImportOptions(r)
+	if err != nil {
+		if errors.Is(err, domain.ErrUnsupportedImport) {
+			handleError(w, http.StatusUnsupportedMediaType, err)
+			return
+		}
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("importBooks", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	imp, err := h.importsService.Import(r.Context(), userId, r.Body, opts)
+	if err != nil {
+		handleImportError(w, "importBooks", err)
+		return
+	}
+
+	if imp.ID != 0 {
+		w.Header().Set("Location", fmt.Sprintf("/books/imports/%d", imp.ID))
+		writeJSON(w, "importBooks", http.StatusAccepted, imp)
+		return
+	}
+
+	writeJSON(w, "importBooks", http.StatusOK, imp)
+}
+
+func (h *Handler) getImport(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getImport", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	imp, err := h.importsService.Get(r.Context(), id)
+	if err != nil {
+		handleImportError(w, "getImport", err)
+		return
+	}
+
+	writeJSON(w, "getImport", http.StatusOK, imp)
+}
+
+// getImportOptions reads the format from the content type and the options
+// from the query: dry_run, async, mode=atomic|best_effort and repeated
+// column=field:header mappings for CSV.
+func getImportOptions(r *http.Request) (domain.ImportOptions, error) {
+	opts := domain.ImportOptions{Atomic: true}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return opts, domain.ErrUnsupportedImport
+	}
+
+	format, ok := importFormats[mediaType]
+	if !ok {
+		return opts, domain.ErrUnsupportedImport
+	}
+	opts.Format = format
+
+	query := r.URL.Query()
+
+	if v := query.Get("dry_run"); v != "" {
+		if opts.DryRun, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid dry_run: %w", err)
+		}
+	}
+
+	if v := query.Get("async"); v != "" {
+		if opts.Async, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid async: %w", err)
+		}
+	}
+
+	switch query.Get("mode") {
+	case "", "atomic":
+	case "best_effort":
+		opts.Atomic = false
+	default:
+		return opts, errors.New("mode must be atomic or best_effort")
+	}
+
+	if columns := query["column"]; len(columns) > 0 {
+		opts.Columns = make(map[string]string, len(columns))
+		for _, column := range columns {
+			field, header, ok := strings.Cut(column, ":")
+			if !ok || field == "" || header == "" {
+				return opts, fmt.Errorf("%w: expected field:header, got %q", domain.ErrInvalidColumnMap, column)
+			}
+			opts.Columns[field] = header
+		}
+	}
+
+	return opts, nil
+}
+
+func handleImportError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrImportNotFound):
+		handleNotFoundError(w, err)
+	case errors.Is(err, domain.ErrUnsupportedImport):
+		handleError(w, http.StatusUnsupportedMediaType, err)
+	case errors.Is(err, domain.ErrImportTooLarge):
+		handleError(w, http.StatusRequestEntityTooLarge, err)
+	case errors.Is(err, domain.ErrInvalidImport), errors.Is(err, domain.ErrInvalidColumnMap),
+		errors.Is(err, domain.ErrInvalidCitation):
+		handleError(w, http.StatusBadRequest, err)
+	default:
+		logError(handler, "importing books", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
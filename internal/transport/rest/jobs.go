@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+func (h *Handler) getJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := h.scheduler.Jobs(r.Context())
+	if err != nil {
+		logError("getJobs", "listing jobs", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getJobs", http.StatusOK, jobs)
+}
+
+// getJobRuns lists the run history of one job or, without a job name in the
+// path, of every job. It can be filtered by status.
+func (h *Handler) getJobRuns(w http.ResponseWriter, r *http.Request) {
+	filter := domain.JobRunFilter{
+		Job:    mux.Vars(r)["name"],
+		Status: r.URL.Query().Get("status"),
+	}
+
+	var err error
+	if filter.Pagination, err = getPagination(r); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	runs, err := h.scheduler.GetRuns(r.Context(), filter)
+	if err != nil {
+		handleJobError(w, "getJobRuns", err)
+		return
+	}
+
+	writeJSON(w, "getJobRuns", http.StatusOK, runs)
+}
+
+// triggerJob starts a run right away. The run continues in the background,
+// its outcome is in the run history.
+func (h *Handler) triggerJob(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("triggerJob", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	run, err := h.scheduler.Trigger(r.Context(), userId, mux.Vars(r)["name"])
+	if err != nil {
+		handleJobError(w, "triggerJob", err)
+		return
+	}
+
+	writeJSON(w, "triggerJob", http.StatusAccepted, run)
+}
+
+func handleJobError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrJobNotFound):
+		handleNotFoundError(w, err)
+	case errors.Is(err, domain.ErrJobRunning):
+		handleError(w, http.StatusConflict, err)
+	default:
+		logError(handler, "running job", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
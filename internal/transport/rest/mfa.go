@@ -0,0 +1,208 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"io"
+	"net/http"
+)
+
+func (h *Handler) verifyMFA(w http.ResponseWriter, r *http.Request) {
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		logError("verifyMFA", "reading request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var inp domain.MFAVerifyInput
+	if err := json.Unmarshal(reqBytes, &inp); err != nil {
+		logError("verifyMFA", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		logError("verifyMFA", "validation request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	accessToken, refreshToken, err := h.usersService.VerifyMFA(r.Context(), inp)
+	if err != nil {
+		if errors.Is(err, domain.ErrMFALocked) {
+			handleError(w, http.StatusTooManyRequests, err)
+			return
+		}
+
+		if isMFAError(err) {
+			handleError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		if errors.Is(err, domain.ErrUserDisabled) {
+			handleError(w, http.StatusForbidden, err)
+			return
+		}
+
+		logError("verifyMFA", "verifying code", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, "verifyMFA", accessToken, refreshToken)
+}
+
+func (h *Handler) enrollMFA(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("enrollMFA", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.mfaService.Enroll(r.Context(), userId)
+	if err != nil {
+		if errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+			handleError(w, http.StatusConflict, err)
+			return
+		}
+
+		logError("enrollMFA", "enrolling", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "enrollMFA", http.StatusOK, enrollment)
+}
+
+func (h *Handler) confirmMFA(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("confirmMFA", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.MFACodeInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("confirmMFA", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		logError("confirmMFA", "validation request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.mfaService.Confirm(r.Context(), userId, inp.Code)
+	if err != nil {
+		if errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+			handleError(w, http.StatusConflict, err)
+			return
+		}
+
+		if isMFAError(err) {
+			handleError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		logError("confirmMFA", "confirming", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "confirmMFA", http.StatusOK, codes)
+}
+
+func (h *Handler) disableMFA(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("disableMFA", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.MFADisableInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("disableMFA", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		logError("disableMFA", "validation request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfaService.Disable(r.Context(), userId, inp); err != nil {
+		if errors.Is(err, domain.ErrMFALocked) {
+			handleError(w, http.StatusTooManyRequests, err)
+			return
+		}
+
+		if isMFAError(err) {
+			handleError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		logError("disableMFA", "disabling", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("regenerateRecoveryCodes", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.MFACodeInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("regenerateRecoveryCodes", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		logError("regenerateRecoveryCodes", "validation request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), userId, inp.Code)
+	if err != nil {
+		if errors.Is(err, domain.ErrMFALocked) {
+			handleError(w, http.StatusTooManyRequests, err)
+			return
+		}
+
+		if isMFAError(err) {
+			handleError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		logError("regenerateRecoveryCodes", "regenerating", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "regenerateRecoveryCodes", http.StatusOK, codes)
+}
+
+func isMFAError(err error) bool {
+	return errors.Is(err, domain.ErrInvalidMFACode) ||
+		errors.Is(err, domain.ErrInvalidMFAToken) ||
+		errors.Is(err, domain.ErrMFACodeAlreadyUsed) ||
+		errors.Is(err, domain.ErrMFANotEnrolled) ||
+		errors.Is(err, domain.ErrMFANotEnabled)
+}
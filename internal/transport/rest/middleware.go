@@ -3,8 +3,11 @@ package rest
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -12,6 +15,12 @@ type CtxValue int
 
 const (
 	ctxUserID CtxValue = iota
+	// ctxScopes is set only for requests authenticated with an API key.
+	ctxScopes
+	ctxUserRole
+	// ctxTokenOrgID is the active organization carried by the access token.
+	ctxTokenOrgID
+	ctxOrgRole
 )
 
 func loggingMiddleware(next http.Handler) http.Handler {
@@ -26,25 +35,159 @@ func loggingMiddleware(next http.Handler) http.Handler {
 
 func (h *Handler) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := getTokenFromRequest(r)
+		ctx := r.Context()
+
+		var userId int64
+		if key := apiKeyFromRequest(r); key != "" {
+			apiKey, err := h.apiKeysService.Authenticate(r.Context(), key)
+			if err != nil {
+				logError("authMiddleware", "api key authentication failed", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			userId = apiKey.UserID
+			ctx = context.WithValue(ctx, ctxScopes, apiKey.Scopes)
+		} else {
+			token, err := getTokenFromRequest(r)
+			if err != nil {
+				logError("authMiddleware", "token from request failed", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := h.usersService.ParseToken(r.Context(), token)
+			if err != nil {
+				logError("authMiddleware", "token parsing failed", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			userId = claims.UserID
+			ctx = context.WithValue(ctx, ctxTokenOrgID, claims.OrgID)
+		}
+
+		h.serveUser(w, r.WithContext(ctx), userId, next)
+	})
+}
+
+// basicAuthMiddleware authenticates HTTP Basic credentials for clients such
+// as e-readers that cannot obtain tokens. The password is either an API key,
+// with any user name, or the password of the user whose email is the user
+// name. Password attempts count against the auth rate limit like sign-ins.
+// Other requests go through authMiddleware.
+func (h *Handler) basicAuthMiddleware(realm string) func(http.Handler) http.Handler {
+	challenge := fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm)
+
+	return func(next http.Handler) http.Handler {
+		fallback := h.authMiddleware(next)
+
+		passwordAuth := h.limiter.group("auth")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, _ := r.BasicAuth()
+
+			userId, err := h.usersService.Authenticate(r.Context(), username, password)
+			if err != nil {
+				logError("basicAuthMiddleware", "password authentication failed", err)
+				w.Header().Set("WWW-Authenticate", challenge)
+				if errors.Is(err, domain.ErrMFARequired) || errors.Is(err, domain.ErrUserDisabled) {
+					handleError(w, http.StatusUnauthorized, err)
+					return
+				}
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			h.serveUser(w, r, userId, next)
+		}))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				w.Header().Set("WWW-Authenticate", challenge)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			_, password, ok := r.BasicAuth()
+			if !ok {
+				fallback.ServeHTTP(w, r)
+				return
+			}
+
+			apiKey, err := h.apiKeysService.Authenticate(r.Context(), password)
+			switch {
+			case err == nil:
+				ctx := context.WithValue(r.Context(), ctxScopes, apiKey.Scopes)
+				h.serveUser(w, r.WithContext(ctx), apiKey.UserID, next)
+			case errors.Is(err, domain.ErrInvalidAPIKey):
+				passwordAuth.ServeHTTP(w, r)
+			default:
+				logError("basicAuthMiddleware", "api key authentication failed", err)
+				w.Header().Set("WWW-Authenticate", challenge)
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// serveUser puts the authenticated user into the context. Tokens stay valid
+// until they expire, so disabled users are rejected here.
+func (h *Handler) serveUser(w http.ResponseWriter, r *http.Request, userId int64, next http.Handler) {
+	user, err := h.usersService.GetByID(r.Context(), userId)
+	if err != nil {
+		logError("authMiddleware", "getting user", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if user.Disabled() {
+		handleError(w, http.StatusUnauthorized, domain.ErrUserDisabled)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), ctxUserID, userId)
+	ctx = context.WithValue(ctx, ctxUserRole, user.Role)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// orgMiddleware resolves the active organization from the X-Org-ID header,
+// the access token claim or the user's first membership, and puts it into the
+// request context for org scoped repositories.
+func (h *Handler) orgMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, err := getUserIdFromContext(r)
 		if err != nil {
-			logError("authMiddleware", "token from request failed", err)
+			logError("orgMiddleware", "getting user id", err)
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		userId, err := h.usersService.ParseToken(r.Context(), token)
+		orgId, _ := r.Context().Value(ctxTokenOrgID).(int64)
+		if header := r.Header.Get("X-Org-ID"); header != "" {
+			if orgId, err = strconv.ParseInt(header, 10, 64); err != nil || orgId <= 0 {
+				handleError(w, http.StatusBadRequest, errors.New("invalid X-Org-ID header"))
+				return
+			}
+		}
+
+		membership, err := h.orgsService.ResolveActive(r.Context(), userId, orgId)
 		if err != nil {
-			logError("authMiddleware", "token parsing failed", err)
-			w.WriteHeader(http.StatusUnauthorized)
+			switch {
+			case errors.Is(err, domain.ErrNotOrgMember):
+				handleError(w, http.StatusForbidden, err)
+			case errors.Is(err, domain.ErrOrgRequired):
+				handleError(w, http.StatusBadRequest, err)
+			default:
+				logError("orgMiddleware", "resolving organization", err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), ctxUserID, userId)
-		r = r.WithContext(ctx)
-
-		next.ServeHTTP(w, r)
+		ctx := domain.WithOrgID(r.Context(), membership.ID)
+		ctx = context.WithValue(ctx, ctxOrgRole, membership.Role)
 
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -65,3 +208,93 @@ func getTokenFromRequest(r *http.Request) (string, error) {
 
 	return headerParts[1], nil
 }
+
+// requireScopes checks API key scopes: safe methods need the read scope,
+// everything else the write scope. Session tokens are not limited by scopes.
+func requireScopes(read, write string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, ok := r.Context().Value(ctxScopes).([]string)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			required := write
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				required = read
+			}
+
+			for _, scope := range scopes {
+				if scope == required {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			w.WriteHeader(http.StatusForbidden)
+		})
+	}
+}
+
+// requireSession rejects requests authenticated with an API key.
+func (h *Handler) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(ctxScopes).([]string); ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireOrgWriteRole lets through safe methods for every member of the active
+// organization and everything else for members with the role or a more privileged one.
+func requireOrgWriteRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requireOrgRole(role)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireOrgRole lets through members of the active organization with the
+// role or a more privileged one.
+func requireOrgRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasOrgRole(r, role) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func hasOrgRole(r *http.Request, role string) bool {
+	orgRole, _ := r.Context().Value(ctxOrgRole).(string)
+	return (domain.Membership{Role: orgRole}).HasRole(role)
+}
+
+// requireRole lets through users with the role or a more privileged one.
+func requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userRole, _ := r.Context().Value(ctxUserRole).(string)
+			if !(domain.User{Role: userRole}).HasRole(role) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+const oidcStateCookie = "oidc_state"
+
+func (h *Handler) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+
+	url, state, err := h.oidcService.Begin(r.Context(), provider)
+	if err != nil {
+		if errors.Is(err, domain.ErrUnknownProvider) {
+			handleNotFoundError(w, err)
+			return
+		}
+
+		logError("oidcLogin", "starting login", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+func (h *Handler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+
+	if errParam := r.URL.Query().Get("error"); errParam != "" {
+		handleError(w, http.StatusUnauthorized, errors.New(errParam))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, domain.ErrInvalidOIDCState)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	res, err := h.oidcService.Complete(r.Context(), provider, cookie.Value, r.URL.Query().Get("state"), r.URL.Query().Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUnknownProvider):
+			handleNotFoundError(w, err)
+		case errors.Is(err, domain.ErrInvalidOIDCState):
+			handleError(w, http.StatusBadRequest, err)
+		case errors.Is(err, domain.ErrEmailNotVerified), errors.Is(err, domain.ErrIdentityEmailMissing),
+			errors.Is(err, domain.ErrUserDisabled):
+			handleError(w, http.StatusForbidden, err)
+		default:
+			logError("oidcCallback", "completing login", err)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+		return
+	}
+
+	if res.MFARequired() {
+		writeJSON(w, "oidcCallback", http.StatusOK, map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    res.MFAToken,
+		})
+		return
+	}
+
+	writeTokens(w, "oidcCallback", res.AccessToken, res.RefreshToken)
+}
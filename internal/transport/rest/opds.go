@@ -0,0 +1,365 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/internal/opds"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const opdsRealm = "Library catalog"
+
+// opdsCatalog is one of the two trees of the catalog: OPDS 1.2 under /opds
+// and OPDS 2.0 under /opds/v2. Both serve the same feeds.
+type opdsCatalog struct {
+	base string
+	json bool
+}
+
+var opdsCatalogs = []opdsCatalog{
+	{base: "/opds/v2", json: true},
+	{base: "/opds"},
+}
+
+// routeOPDS registers the feeds of a catalog on the /opds subrouter.
+func (h *Handler) routeOPDS(r *mux.Router, c opdsCatalog) {
+	prefix := c.base[len("/opds"):]
+
+	r.HandleFunc(prefix, h.opdsRoot(c)).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/books", h.opdsBooks(c, domain.BookOrderTitle)).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/books/{id:[0-9]+}", h.opdsBook(c)).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/new", h.opdsBooks(c, domain.BookOrderNewest)).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/search", h.opdsSearch(c)).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/authors", h.opdsAuthors(c)).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/authors/{id:[0-9]+}", h.opdsAuthorBooks(c)).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/genres", h.opdsGenres(c)).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/genres/{id:[0-9]+}", h.opdsGenreBooks(c)).Methods(http.MethodGet)
+}
+
+func (c opdsCatalog) feedType(navigation bool) string {
+	switch {
+	case c.json:
+		return opds.TypeFeed
+	case navigation:
+		return opds.TypeNavigation
+	default:
+		return opds.TypeAcquisition
+	}
+}
+
+// links returns the links every feed of the catalog carries.
+func (c opdsCatalog) links(r *http.Request, navigation bool) []opds.Link {
+	links := []opds.Link{
+		{Rel: "self", Href: r.URL.RequestURI(), Type: c.feedType(navigation)},
+		{Rel: "start", Href: c.base, Type: c.feedType(true)},
+	}
+
+	if c.json {
+		return append(links, opds.Link{Rel: "search", Href: c.base + "/search{?query}", Type: opds.TypeFeed, Templated: true})
+	}
+
+	return append(links, opds.Link{Rel: "search", Href: "/opds/opensearch.xml", Type: opds.TypeOpenSearch})
+}
+
+// pageLinks links the first, previous, next and last pages of a paged feed.
+func pageLinks(r *http.Request, page, limit, total int, mediaType string) []opds.Link {
+	last := max(1, (total+limit-1)/limit)
+	href := func(page int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		return r.URL.Path + "?" + query.Encode()
+	}
+
+	links := []opds.Link{{Rel: "first", Href: href(1), Type: mediaType}}
+	if page > 1 {
+		links = append(links, opds.Link{Rel: "previous", Href: href(min(page-1, last)), Type: mediaType})
+	}
+	if page < last {
+		links = append(links, opds.Link{Rel: "next", Href: href(page + 1), Type: mediaType})
+	}
+
+	return append(links, opds.Link{Rel: "last", Href: href(last), Type: mediaType})
+}
+
+// publication links a book to its complete entry and to its copies, which
+// stand in for the acquisition link as the library lends printed books.
+func (c opdsCatalog) publication(book domain.Book) opds.Publication {
+	id := strconv.FormatInt(book.ID, 10)
+
+	entry := opds.Link{Rel: "alternate", Href: c.base + "/books/" + id, Type: opds.TypeEntry}
+	if c.json {
+		entry = opds.Link{Rel: "self", Href: c.base + "/books/" + id, Type: opds.TypePublication}
+	}
+
+	return opds.Publication{Book: book, Links: []opds.Link{
+		entry,
+		{Rel: opds.RelBorrow, Href: "/opds/books/" + id + "/copies", Type: "application/json", Title: "Copies"},
+	}}
+}
+
+func (c opdsCatalog) write(w http.ResponseWriter, handler string, feed opds.Feed) {
+	write := opds.WriteAtom
+	if c.json {
+		write = opds.WriteJSON
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf, feed); err != nil {
+		logError(handler, "writing feed", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", c.feedType(feed.Navigation != nil))
+	w.Write(buf.Bytes())
+}
+
+func (h *Handler) opdsRoot(c opdsCatalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		acquisition, navigation := c.feedType(false), c.feedType(true)
+
+		c.write(w, "opdsRoot", opds.Feed{
+			ID:      "urn:cruda:opds:root",
+			Title:   opdsRealm,
+			Updated: time.Now(),
+			Links:   c.links(r, true),
+			Navigation: []opds.Navigation{
+				{ID: "urn:cruda:opds:new", Title: "Newest additions", Summary: "The books added last",
+					Link: opds.Link{Rel: opds.RelSortNew, Href: c.base + "/new", Type: acquisition}},
+				{ID: "urn:cruda:opds:books", Title: "All books", Summary: "Every book by title",
+					Link: opds.Link{Rel: "subsection", Href: c.base + "/books", Type: acquisition}},
+				{ID: "urn:cruda:opds:authors", Title: "By author", Summary: "Books grouped by author",
+					Link: opds.Link{Rel: "subsection", Href: c.base + "/authors", Type: navigation}},
+				{ID: "urn:cruda:opds:genres", Title: "By genre", Summary: "Books grouped by genre",
+					Link: opds.Link{Rel: "subsection", Href: c.base + "/genres", Type: navigation}},
+			},
+		})
+	}
+}
+
+func (h *Handler) opdsBooks(c opdsCatalog, order string) http.HandlerFunc {
+	id, title := "urn:cruda:opds:books", "All books"
+	if order == domain.BookOrderNewest {
+		id, title = "urn:cruda:opds:new", "Newest additions"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.writeOPDSBooks(w, r, c, "opdsBooks", id, title, domain.BookFilter{}, order)
+	}
+}
+
+func (h *Handler) opdsSearch(c opdsCatalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// OpenSearch templates use q, OPDS 2.0 templates query
+		query := r.URL.Query().Get("q")
+		if query == "" {
+			query = r.URL.Query().Get("query")
+		}
+		if query == "" {
+			handleError(w, http.StatusBadRequest, errors.New("search query is required"))
+			return
+		}
+
+		h.writeOPDSBooks(w, r, c, "opdsSearch", "urn:cruda:opds:search", "Search: "+query,
+			domain.BookFilter{Query: query}, domain.BookOrderTitle)
+	}
+}
+
+func (h *Handler) opdsAuthorBooks(c opdsCatalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getIdFromRequest(r)
+		if err != nil {
+			logError("opdsAuthorBooks", "getting id from request", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		author, err := h.authorsService.GetByID(r.Context(), id)
+		if err != nil {
+			handleAuthorError(w, "opdsAuthorBooks", err)
+			return
+		}
+
+		h.writeOPDSBooks(w, r, c, "opdsAuthorBooks", "urn:cruda:opds:author:"+strconv.FormatInt(id, 10), author.Name,
+			domain.BookFilter{AuthorID: id}, domain.BookOrderTitle)
+	}
+}
+
+func (h *Handler) opdsGenreBooks(c opdsCatalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getIdFromRequest(r)
+		if err != nil {
+			logError("opdsGenreBooks", "getting id from request", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		genre, err := h.genresService.GetByID(r.Context(), id)
+		if err != nil {
+			handleGenreError(w, "opdsGenreBooks", err)
+			return
+		}
+
+		h.writeOPDSBooks(w, r, c, "opdsGenreBooks", "urn:cruda:opds:genre:"+strconv.FormatInt(id, 10), genre.Name,
+			domain.BookFilter{GenreID: id}, domain.BookOrderTitle)
+	}
+}
+
+// writeOPDSBooks writes a page of the books matching the filter as an
+// acquisition feed.
+func (h *Handler) writeOPDSBooks(w http.ResponseWriter, r *http.Request, c opdsCatalog, handler, id, title string,
+	filter domain.BookFilter, order string) {
+	p, err := getPagination(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	list, err := h.booksService.List(r.Context(), filter, order, p)
+	if err != nil {
+		logError(handler, "listing books", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	feed := opds.Feed{
+		ID:           id,
+		Title:        title,
+		Updated:      time.Now(),
+		Links:        append(c.links(r, false), pageLinks(r, list.Page, list.Limit, list.Total, c.feedType(false))...),
+		Publications: make([]opds.Publication, len(list.Books)),
+		Total:        list.Total,
+		Page:         list.Page,
+		Limit:        list.Limit,
+	}
+	for i, book := range list.Books {
+		feed.Publications[i] = c.publication(book)
+	}
+
+	c.write(w, handler, feed)
+}
+
+func (h *Handler) opdsAuthors(c opdsCatalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := getPagination(r)
+		if err != nil {
+			handleError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		list, err := h.authorsService.List(r.Context(), domain.AuthorFilter{Pagination: p})
+		if err != nil {
+			logError("opdsAuthors", "listing authors", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		feed := opds.Feed{
+			ID:         "urn:cruda:opds:authors",
+			Title:      "By author",
+			Updated:    time.Now(),
+			Links:      append(c.links(r, true), pageLinks(r, list.Page, list.Limit, list.Total, c.feedType(true))...),
+			Navigation: make([]opds.Navigation, len(list.Authors)),
+			Total:      list.Total,
+			Page:       list.Page,
+			Limit:      list.Limit,
+		}
+		for i, author := range list.Authors {
+			id := strconv.FormatInt(author.ID, 10)
+			feed.Navigation[i] = opds.Navigation{
+				ID:    "urn:cruda:opds:author:" + id,
+				Title: author.Name,
+				Link:  opds.Link{Rel: "subsection", Href: c.base + "/authors/" + id, Type: c.feedType(false)},
+			}
+		}
+
+		c.write(w, "opdsAuthors", feed)
+	}
+}
+
+func (h *Handler) opdsGenres(c opdsCatalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		genres, err := h.genresService.GetAll(r.Context())
+		if err != nil {
+			logError("opdsGenres", "getting genres", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		feed := opds.Feed{
+			ID:         "urn:cruda:opds:genres",
+			Title:      "By genre",
+			Updated:    time.Now(),
+			Links:      c.links(r, true),
+			Navigation: make([]opds.Navigation, len(genres)),
+		}
+		for i, genre := range genres {
+			id := strconv.FormatInt(genre.ID, 10)
+			feed.Navigation[i] = opds.Navigation{
+				ID:    "urn:cruda:opds:genre:" + id,
+				Title: genre.Name,
+				Link:  opds.Link{Rel: "subsection", Href: c.base + "/genres/" + id, Type: c.feedType(false)},
+			}
+		}
+
+		c.write(w, "opdsGenres", feed)
+	}
+}
+
+func (h *Handler) opdsBook(c opdsCatalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getIdFromRequest(r)
+		if err != nil {
+			logError("opdsBook", "getting id from request", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		book, err := h.booksService.GetByID(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, domain.ErrBookNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			logError("opdsBook", "getting book by id", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		mediaType := opds.TypeEntry
+		if c.json {
+			mediaType = opds.TypePublication
+			err = opds.WritePublication(&buf, c.publication(book))
+		} else {
+			err = opds.WriteAtomEntry(&buf, c.publication(book), time.Now())
+		}
+		if err != nil {
+			logError("opdsBook", "writing entry", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", mediaType)
+		w.Write(buf.Bytes())
+	}
+}
+
+// opdsOpenSearch describes the search of the OPDS 1.2 catalog. Readers need
+// an absolute template, so it is built from the public URL of the server.
+func (h *Handler) opdsOpenSearch(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	template := h.publicURL + "/opds/search?q={searchTerms}&page={startPage?}"
+	if err := opds.WriteOpenSearch(&buf, "Library", "Search the library catalog", template); err != nil {
+		logError("opdsOpenSearch", "writing description", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", opds.TypeOpenSearch)
+	w.Write(buf.Bytes())
+}
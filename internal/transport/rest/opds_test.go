@@ -0,0 +1,118 @@
+package rest
+
+import (
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/dewi911/cruda-app/internal/opds"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestPageLinks(t *testing.T) {
+	tests := []struct {
+		name  string
+		page  int
+		total int
+		want  []string
+	}{
+		{"single page", 1, 3, []string{"first 1", "last 1"}},
+		{"empty", 1, 0, []string{"first 1", "last 1"}},
+		{"first page", 1, 25, []string{"first 1", "next 2", "last 3"}},
+		{"middle page", 2, 25, []string{"first 1", "previous 1", "next 3", "last 3"}},
+		{"last page", 3, 30, []string{"first 1", "previous 2", "last 3"}},
+		{"past the end", 7, 25, []string{"first 1", "previous 3", "last 3"}},
+	}
+
+	for _, c := range opdsCatalogs {
+		mediaType := c.feedType(false)
+
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodGet, c.base+"/search?q=tolkien&limit=10&page=9", nil)
+
+			links := pageLinks(r, tt.page, 10, tt.total, mediaType)
+
+			var got []string
+			for _, link := range links {
+				u, err := url.Parse(link.Href)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// the other parameters of the request are kept
+				if q := u.Query(); u.Path != c.base+"/search" || q.Get("q") != "tolkien" || q.Get("limit") != "10" {
+					t.Errorf("%s %s: %s href = %s", c.base, tt.name, link.Rel, link.Href)
+				}
+				if link.Type != mediaType {
+					t.Errorf("%s %s: %s type = %s, want %s", c.base, tt.name, link.Rel, link.Type, mediaType)
+				}
+
+				got = append(got, link.Rel+" "+u.Query().Get("page"))
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s %s: links = %q, want %q", c.base, tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestOPDSCatalogLinks(t *testing.T) {
+	tests := []struct {
+		catalog     opdsCatalog
+		navigation  []opds.Link
+		acquisition []opds.Link
+		entry       opds.Link
+	}{
+		{
+			catalog: opdsCatalog{base: "/opds"},
+			navigation: []opds.Link{
+				{Rel: "self", Href: "/opds/authors?page=2", Type: opds.TypeNavigation},
+				{Rel: "start", Href: "/opds", Type: opds.TypeNavigation},
+				{Rel: "search", Href: "/opds/opensearch.xml", Type: opds.TypeOpenSearch},
+			},
+			acquisition: []opds.Link{
+				{Rel: "self", Href: "/opds/authors?page=2", Type: opds.TypeAcquisition},
+				{Rel: "start", Href: "/opds", Type: opds.TypeNavigation},
+				{Rel: "search", Href: "/opds/opensearch.xml", Type: opds.TypeOpenSearch},
+			},
+			entry: opds.Link{Rel: "alternate", Href: "/opds/books/7", Type: opds.TypeEntry},
+		},
+		{
+			catalog: opdsCatalog{base: "/opds/v2", json: true},
+			navigation: []opds.Link{
+				{Rel: "self", Href: "/opds/authors?page=2", Type: opds.TypeFeed},
+				{Rel: "start", Href: "/opds/v2", Type: opds.TypeFeed},
+				{Rel: "search", Href: "/opds/v2/search{?query}", Type: opds.TypeFeed, Templated: true},
+			},
+			acquisition: []opds.Link{
+				{Rel: "self", Href: "/opds/authors?page=2", Type: opds.TypeFeed},
+				{Rel: "start", Href: "/opds/v2", Type: opds.TypeFeed},
+				{Rel: "search", Href: "/opds/v2/search{?query}", Type: opds.TypeFeed, Templated: true},
+			},
+			entry: opds.Link{Rel: "self", Href: "/opds/v2/books/7", Type: opds.TypePublication},
+		},
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/opds/authors?page=2", nil)
+
+	for _, tt := range tests {
+		if got := tt.catalog.links(r, true); !reflect.DeepEqual(got, tt.navigation) {
+			t.Errorf("%s navigation links =\n%+v\nwant\n%+v", tt.catalog.base, got, tt.navigation)
+		}
+
+		if got := tt.catalog.links(r, false); !reflect.DeepEqual(got, tt.acquisition) {
+			t.Errorf("%s acquisition links =\n%+v\nwant\n%+v", tt.catalog.base, got, tt.acquisition)
+		}
+
+		// both catalogs borrow through the copies of the book
+		want := []opds.Link{
+			tt.entry,
+			{Rel: opds.RelBorrow, Href: "/opds/books/7/copies", Type: "application/json", Title: "Copies"},
+		}
+		if got := tt.catalog.publication(domain.Book{ID: 7}).Links; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s publication links =\n%+v\nwant\n%+v", tt.catalog.base, got, want)
+		}
+	}
+}
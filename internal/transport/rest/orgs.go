@@ -0,0 +1,245 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+)
+
+func (h *Handler) createOrg(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("createOrg", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.CreateOrgInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("createOrg", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	org, err := h.orgsService.Create(r.Context(), userId, inp)
+	if err != nil {
+		handleOrgError(w, "createOrg", err)
+		return
+	}
+
+	writeJSON(w, "createOrg", http.StatusCreated, org)
+}
+
+func (h *Handler) getOrgs(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("getOrgs", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	orgs, err := h.orgsService.List(r.Context(), userId)
+	if err != nil {
+		handleOrgError(w, "getOrgs", err)
+		return
+	}
+
+	writeJSON(w, "getOrgs", http.StatusOK, orgs)
+}
+
+func (h *Handler) getOrg(w http.ResponseWriter, r *http.Request) {
+	userId, orgId, ok := orgRequest(w, r, "getOrg")
+	if !ok {
+		return
+	}
+
+	org, err := h.orgsService.Get(r.Context(), userId, orgId)
+	if err != nil {
+		handleOrgError(w, "getOrg", err)
+		return
+	}
+
+	writeJSON(w, "getOrg", http.StatusOK, org)
+}
+
+func (h *Handler) getOrgMembers(w http.ResponseWriter, r *http.Request) {
+	userId, orgId, ok := orgRequest(w, r, "getOrgMembers")
+	if !ok {
+		return
+	}
+
+	members, err := h.orgsService.Members(r.Context(), userId, orgId)
+	if err != nil {
+		handleOrgError(w, "getOrgMembers", err)
+		return
+	}
+
+	writeJSON(w, "getOrgMembers", http.StatusOK, members)
+}
+
+func (h *Handler) setOrgMemberRole(w http.ResponseWriter, r *http.Request) {
+	userId, orgId, ok := orgRequest(w, r, "setOrgMemberRole")
+	if !ok {
+		return
+	}
+
+	memberId, err := getPathInt64(r, "userId")
+	if err != nil {
+		logError("setOrgMemberRole", "getting member id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var inp domain.SetOrgRoleInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("setOrgMemberRole", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.orgsService.SetMemberRole(r.Context(), userId, orgId, memberId, inp.Role); err != nil {
+		handleOrgError(w, "setOrgMemberRole", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) removeOrgMember(w http.ResponseWriter, r *http.Request) {
+	userId, orgId, ok := orgRequest(w, r, "removeOrgMember")
+	if !ok {
+		return
+	}
+
+	memberId, err := getPathInt64(r, "userId")
+	if err != nil {
+		logError("removeOrgMember", "getting member id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.orgsService.RemoveMember(r.Context(), userId, orgId, memberId); err != nil {
+		handleOrgError(w, "removeOrgMember", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) inviteToOrg(w http.ResponseWriter, r *http.Request) {
+	userId, orgId, ok := orgRequest(w, r, "inviteToOrg")
+	if !ok {
+		return
+	}
+
+	var inp domain.InviteInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("inviteToOrg", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	inv, err := h.orgsService.Invite(r.Context(), userId, orgId, inp)
+	if err != nil {
+		handleOrgError(w, "inviteToOrg", err)
+		return
+	}
+
+	writeJSON(w, "inviteToOrg", http.StatusCreated, inv)
+}
+
+func (h *Handler) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("acceptInvitation", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.AcceptInvitationInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("acceptInvitation", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	membership, err := h.orgsService.AcceptInvitation(r.Context(), userId, inp.Token)
+	if err != nil {
+		handleOrgError(w, "acceptInvitation", err)
+		return
+	}
+
+	writeJSON(w, "acceptInvitation", http.StatusOK, membership)
+}
+
+// switchOrg issues new tokens with the organization as the active one.
+func (h *Handler) switchOrg(w http.ResponseWriter, r *http.Request) {
+	userId, orgId, ok := orgRequest(w, r, "switchOrg")
+	if !ok {
+		return
+	}
+
+	accessToken, refreshToken, err := h.orgsService.Switch(r.Context(), userId, orgId)
+	if err != nil {
+		handleOrgError(w, "switchOrg", err)
+		return
+	}
+
+	writeTokens(w, "switchOrg", accessToken, refreshToken)
+}
+
+// orgRequest reads the current user and the organization from the path.
+func orgRequest(w http.ResponseWriter, r *http.Request, handler string) (int64, int64, bool) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError(handler, "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	orgId, err := getIdFromRequest(r)
+	if err != nil {
+		logError(handler, "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return userId, orgId, true
+}
+
+func handleOrgError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrOrgNotFound), errors.Is(err, domain.ErrNotOrgMember),
+		errors.Is(err, domain.ErrInvitationNotFound), errors.Is(err, domain.ErrUserNotFound):
+		handleNotFoundError(w, err)
+	case errors.Is(err, domain.ErrNotOrgOwner), errors.Is(err, domain.ErrInvitationEmail):
+		handleError(w, http.StatusForbidden, err)
+	case errors.Is(err, domain.ErrOrgSlugTaken), errors.Is(err, domain.ErrLastOwner),
+		errors.Is(err, domain.ErrAlreadyOrgMember):
+		handleError(w, http.StatusConflict, err)
+	default:
+		logError(handler, "organization request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,177 @@
+package rest
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+func (h *Handler) exportMe(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("exportMe", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		handleError(w, http.StatusBadRequest, errors.New("format must be json or zip"))
+		return
+	}
+
+	export, err := h.privacyService.Export(r.Context(), userId)
+	if err != nil {
+		logError("exportMe", "exporting user data", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("user-%d-export-%s", userId, export.ExportedAt.Format("20060102150405"))
+
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+
+		if err := writeExportZip(w, export); err != nil {
+			logError("exportMe", "writing zip", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+
+	if err := json.NewEncoder(w).Encode(export); err != nil {
+		logError("exportMe", "writing json", err)
+	}
+}
+
+// writeExportZip streams every section of the export as its own file.
+func writeExportZip(w http.ResponseWriter, export domain.UserExport) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"sessions.json", export.Sessions},
+		{"api_keys.json", export.APIKeys},
+		{"identities.json", export.Identities},
+		{"books.json", export.Books},
+		{"reviews.json", export.Reviews},
+		{"shelves.json", export.Shelves},
+		{"reading.json", export.Reading},
+		{"loans.json", export.Loans},
+		{"holds.json", export.Holds},
+		{"organizations.json", export.Organizations},
+		{"audit_events.json", export.AuditEvents},
+	}
+
+	for _, file := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (h *Handler) requestErasure(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("requestErasure", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.ErasureRequestInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("requestErasure", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job, err := h.privacyService.RequestErasure(r.Context(), userId, inp)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidPassword):
+			handleError(w, http.StatusForbidden, err)
+		case errors.Is(err, domain.ErrErasureInProgress):
+			handleError(w, http.StatusConflict, err)
+		default:
+			logError("requestErasure", "requesting erasure", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// the account is disabled now, the status stays reachable through the token
+	statusURL := "/privacy/erasure/" + job.StatusToken
+	w.Header().Set("Location", statusURL)
+
+	writeJSON(w, "requestErasure", http.StatusAccepted, map[string]interface{}{
+		"job":        job,
+		"status_url": statusURL,
+	})
+}
+
+func (h *Handler) getErasureStatus(w http.ResponseWriter, r *http.Request) {
+	job, err := h.privacyService.GetErasureJobByToken(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		if errors.Is(err, domain.ErrErasureJobNotFound) {
+			handleNotFoundError(w, err)
+			return
+		}
+
+		logError("getErasureStatus", "getting erasure job", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getErasureStatus", http.StatusOK, job)
+}
+
+func (h *Handler) getErasureJob(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getErasureJob", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.privacyService.GetErasureJob(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrErasureJobNotFound) {
+			handleNotFoundError(w, err)
+			return
+		}
+
+		logError("getErasureJob", "getting erasure job", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getErasureJob", http.StatusOK, job)
+}
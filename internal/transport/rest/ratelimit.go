@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/dewi911/cruda-app/pkg/ratelimit"
+	"github.com/gorilla/mux"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RateLimits struct {
+	Global ratelimit.Limit
+	Groups map[string]ratelimit.Limit
+
+	// TrustProxyHeaders makes the client IP come from X-Forwarded-For / X-Real-IP.
+	TrustProxyHeaders bool
+}
+
+type RateLimiter struct {
+	store  ratelimit.Store
+	limits RateLimits
+}
+
+func NewRateLimiter(store ratelimit.Store, limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		store:  store,
+		limits: limits,
+	}
+}
+
+// global limits every request before authentication, so it is keyed by client IP.
+func (l *RateLimiter) global() mux.MiddlewareFunc {
+	if l == nil {
+		return passThrough
+	}
+
+	return l.middleware("global", l.limits.Global)
+}
+
+// group limits a route group. Mounted after authMiddleware it is keyed by user.
+func (l *RateLimiter) group(name string) mux.MiddlewareFunc {
+	if l == nil {
+		return passThrough
+	}
+
+	return l.middleware(name, l.limits.Groups[name])
+}
+
+func (l *RateLimiter) middleware(name string, limit ratelimit.Limit) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if limit.IsZero() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := name + ":" + l.clientKey(r)
+
+			res, err := l.store.Take(r.Context(), key, limit)
+			if err != nil {
+				logError("rateLimitMiddleware", "taking token", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if userId, ok := r.Context().Value(ctxUserID).(int64); ok {
+		return fmt.Sprintf("user:%d", userId)
+	}
+
+	// an API key is not trusted before authMiddleware checked it, or a random
+	// key on every request would get a fresh bucket
+	return "ip:" + l.clientIP(r)
+}
+
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	if l.limits.TrustProxyHeaders {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+
+		if ip := r.Header.Get("X-Real-IP"); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func passThrough(next http.Handler) http.Handler {
+	return next
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "ApiKey ") {
+		return strings.TrimPrefix(header, "ApiKey ")
+	}
+
+	return ""
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
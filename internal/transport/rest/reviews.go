@@ -0,0 +1,199 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+)
+
+func (h *Handler) createReview(w http.ResponseWriter, r *http.Request) {
+	userId, bookId, ok := userAndIdRequest(w, r, "createReview")
+	if !ok {
+		return
+	}
+
+	var inp domain.ReviewInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("createReview", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	review, err := h.reviewsService.Create(r.Context(), userId, bookId, inp)
+	if err != nil {
+		handleReviewError(w, "createReview", err)
+		return
+	}
+
+	writeJSON(w, "createReview", http.StatusCreated, review)
+}
+
+// getReviews lists the reviews of a book. Moderators also see hidden ones.
+func (h *Handler) getReviews(w http.ResponseWriter, r *http.Request) {
+	bookId, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getReviews", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	filter := domain.ReviewFilter{IncludeHidden: hasOrgRole(r, domain.OrgRoleLibrarian)}
+	if filter.Pagination, err = getPagination(r); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	reviews, err := h.reviewsService.List(r.Context(), bookId, filter)
+	if err != nil {
+		handleReviewError(w, "getReviews", err)
+		return
+	}
+
+	writeJSON(w, "getReviews", http.StatusOK, reviews)
+}
+
+func (h *Handler) getReview(w http.ResponseWriter, r *http.Request) {
+	bookId, id, ok := reviewRequest(w, r, "getReview")
+	if !ok {
+		return
+	}
+
+	review, err := h.reviewsService.Get(r.Context(), bookId, id, hasOrgRole(r, domain.OrgRoleLibrarian))
+	if err != nil {
+		handleReviewError(w, "getReview", err)
+		return
+	}
+
+	writeJSON(w, "getReview", http.StatusOK, review)
+}
+
+func (h *Handler) updateReview(w http.ResponseWriter, r *http.Request) {
+	userId, _, ok := userAndIdRequest(w, r, "updateReview")
+	if !ok {
+		return
+	}
+
+	bookId, id, ok := reviewRequest(w, r, "updateReview")
+	if !ok {
+		return
+	}
+
+	var inp domain.ReviewInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("updateReview", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	review, err := h.reviewsService.Update(r.Context(), userId, bookId, id, inp)
+	if err != nil {
+		handleReviewError(w, "updateReview", err)
+		return
+	}
+
+	writeJSON(w, "updateReview", http.StatusOK, review)
+}
+
+func (h *Handler) deleteReview(w http.ResponseWriter, r *http.Request) {
+	userId, _, ok := userAndIdRequest(w, r, "deleteReview")
+	if !ok {
+		return
+	}
+
+	bookId, id, ok := reviewRequest(w, r, "deleteReview")
+	if !ok {
+		return
+	}
+
+	if err := h.reviewsService.Delete(r.Context(), userId, bookId, id, hasOrgRole(r, domain.OrgRoleLibrarian)); err != nil {
+		handleReviewError(w, "deleteReview", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) flagReview(w http.ResponseWriter, r *http.Request) {
+	bookId, id, ok := reviewRequest(w, r, "flagReview")
+	if !ok {
+		return
+	}
+
+	if err := h.reviewsService.Flag(r.Context(), bookId, id); err != nil {
+		handleReviewError(w, "flagReview", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) moderateReview(w http.ResponseWriter, r *http.Request) {
+	bookId, id, ok := reviewRequest(w, r, "moderateReview")
+	if !ok {
+		return
+	}
+
+	var inp domain.ModerateReviewInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("moderateReview", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	review, err := h.reviewsService.Moderate(r.Context(), bookId, id, *inp.Hidden)
+	if err != nil {
+		handleReviewError(w, "moderateReview", err)
+		return
+	}
+
+	writeJSON(w, "moderateReview", http.StatusOK, review)
+}
+
+// reviewRequest reads the book and the review from the path.
+func reviewRequest(w http.ResponseWriter, r *http.Request, handler string) (int64, int64, bool) {
+	bookId, err := getIdFromRequest(r)
+	if err != nil {
+		logError(handler, "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	id, err := getPathInt64(r, "reviewId")
+	if err != nil {
+		logError(handler, "getting review id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return bookId, id, true
+}
+
+func handleReviewError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrBookNotFound), errors.Is(err, domain.ErrReviewNotFound):
+		handleNotFoundError(w, err)
+	case errors.Is(err, domain.ErrNotReviewAuthor):
+		handleError(w, http.StatusForbidden, err)
+	case errors.Is(err, domain.ErrReviewExists):
+		handleError(w, http.StatusConflict, err)
+	default:
+		logError(handler, "review request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) getBookRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("getBookRevisions", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	p, err := getPagination(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	revisions, err := h.booksService.GetRevisions(r.Context(), id, p)
+	if err != nil {
+		handleRevisionError(w, "getBookRevisions", err)
+		return
+	}
+
+	writeJSON(w, "getBookRevisions", http.StatusOK, revisions)
+}
+
+// getBookRevision returns the book as it was after the revision.
+func (h *Handler) getBookRevision(w http.ResponseWriter, r *http.Request) {
+	id, rev, ok := revisionRequest(w, r, "getBookRevision")
+	if !ok {
+		return
+	}
+
+	revision, err := h.booksService.GetRevision(r.Context(), id, rev)
+	if err != nil {
+		handleRevisionError(w, "getBookRevision", err)
+		return
+	}
+
+	writeJSON(w, "getBookRevision", http.StatusOK, revision)
+}
+
+// diffBookRevisions compares the revisions in the from and to query
+// parameters. Without to the latest revision is used.
+func (h *Handler) diffBookRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError("diffBookRevisions", "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil || from <= 0 {
+		handleError(w, http.StatusBadRequest, errors.New("invalid from"))
+		return
+	}
+
+	var to int
+	if v := query.Get("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil || to <= 0 {
+			handleError(w, http.StatusBadRequest, errors.New("invalid to"))
+			return
+		}
+	}
+
+	diff, err := h.booksService.Diff(r.Context(), id, from, to)
+	if err != nil {
+		handleRevisionError(w, "diffBookRevisions", err)
+		return
+	}
+
+	writeJSON(w, "diffBookRevisions", http.StatusOK, diff)
+}
+
+func (h *Handler) revertBook(w http.ResponseWriter, r *http.Request) {
+	id, rev, ok := revisionRequest(w, r, "revertBook")
+	if !ok {
+		return
+	}
+
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("revertBook", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	book, err := h.booksService.Revert(r.Context(), userId, id, rev, r.Header.Get("If-Match"))
+	if err != nil {
+		handleBookWriteError(w, "revertBook", err)
+		return
+	}
+
+	w.Header().Set("ETag", book.ETag())
+	writeJSON(w, "revertBook", http.StatusOK, book)
+}
+
+func revisionRequest(w http.ResponseWriter, r *http.Request, handler string) (id int64, rev int, ok bool) {
+	id, err := getIdFromRequest(r)
+	if err != nil {
+		logError(handler, "getting id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	rev, err = strconv.Atoi(mux.Vars(r)["rev"])
+	if err != nil || rev <= 0 {
+		handleError(w, http.StatusBadRequest, errors.New("invalid revision"))
+		return 0, 0, false
+	}
+
+	return id, rev, true
+}
+
+func handleRevisionError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrBookNotFound), errors.Is(err, domain.ErrRevisionNotFound):
+		handleNotFoundError(w, err)
+	default:
+		logError(handler, "getting revisions", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,313 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+)
+
+func (h *Handler) createShelf(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("createShelf", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.ShelfInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("createShelf", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	shelf, err := h.shelvesService.Create(r.Context(), userId, inp)
+	if err != nil {
+		handleShelfError(w, "createShelf", err)
+		return
+	}
+
+	writeJSON(w, "createShelf", http.StatusCreated, shelf)
+}
+
+func (h *Handler) getShelves(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("getShelves", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	shelves, err := h.shelvesService.GetAll(r.Context(), userId)
+	if err != nil {
+		logError("getShelves", "getting shelves", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getShelves", http.StatusOK, shelves)
+}
+
+func (h *Handler) getShelfByID(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "getShelfByID")
+	if !ok {
+		return
+	}
+
+	shelf, err := h.shelvesService.GetByID(r.Context(), userId, id)
+	if err != nil {
+		handleShelfError(w, "getShelfByID", err)
+		return
+	}
+
+	writeJSON(w, "getShelfByID", http.StatusOK, shelf)
+}
+
+func (h *Handler) renameShelf(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "renameShelf")
+	if !ok {
+		return
+	}
+
+	var inp domain.ShelfInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("renameShelf", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	shelf, err := h.shelvesService.Rename(r.Context(), userId, id, inp)
+	if err != nil {
+		handleShelfError(w, "renameShelf", err)
+		return
+	}
+
+	writeJSON(w, "renameShelf", http.StatusOK, shelf)
+}
+
+func (h *Handler) deleteShelf(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "deleteShelf")
+	if !ok {
+		return
+	}
+
+	if err := h.shelvesService.Delete(r.Context(), userId, id); err != nil {
+		handleShelfError(w, "deleteShelf", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getShelfBooks(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "getShelfBooks")
+	if !ok {
+		return
+	}
+
+	p, err := getPagination(r)
+	if err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	books, err := h.shelvesService.GetBooks(r.Context(), userId, id, p)
+	if err != nil {
+		handleShelfError(w, "getShelfBooks", err)
+		return
+	}
+
+	writeJSON(w, "getShelfBooks", http.StatusOK, books)
+}
+
+func (h *Handler) addShelfBook(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "addShelfBook")
+	if !ok {
+		return
+	}
+
+	bookId, err := getPathInt64(r, "bookId")
+	if err != nil {
+		logError("addShelfBook", "getting book id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.shelvesService.AddBook(r.Context(), userId, id, bookId); err != nil {
+		handleShelfError(w, "addShelfBook", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) removeShelfBook(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := userAndIdRequest(w, r, "removeShelfBook")
+	if !ok {
+		return
+	}
+
+	bookId, err := getPathInt64(r, "bookId")
+	if err != nil {
+		logError("removeShelfBook", "getting book id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.shelvesService.RemoveBook(r.Context(), userId, id, bookId); err != nil {
+		handleShelfError(w, "removeShelfBook", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getReadingList lists the user's books, optionally with one reading status.
+func (h *Handler) getReadingList(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("getReadingList", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	filter := domain.ReadingFilter{Status: r.URL.Query().Get("status")}
+	switch filter.Status {
+	case "", domain.ReadingStatusWantToRead, domain.ReadingStatusReading, domain.ReadingStatusRead:
+	default:
+		handleError(w, http.StatusBadRequest, errors.New("invalid status"))
+		return
+	}
+
+	if filter.Pagination, err = getPagination(r); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	books, err := h.shelvesService.ListReading(r.Context(), userId, filter)
+	if err != nil {
+		handleShelfError(w, "getReadingList", err)
+		return
+	}
+
+	writeJSON(w, "getReadingList", http.StatusOK, books)
+}
+
+func (h *Handler) getReading(w http.ResponseWriter, r *http.Request) {
+	userId, bookId, ok := readingRequest(w, r, "getReading")
+	if !ok {
+		return
+	}
+
+	reading, err := h.shelvesService.GetReading(r.Context(), userId, bookId)
+	if err != nil {
+		handleShelfError(w, "getReading", err)
+		return
+	}
+
+	writeJSON(w, "getReading", http.StatusOK, reading)
+}
+
+func (h *Handler) setReading(w http.ResponseWriter, r *http.Request) {
+	userId, bookId, ok := readingRequest(w, r, "setReading")
+	if !ok {
+		return
+	}
+
+	var inp domain.ReadingInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("setReading", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	reading, err := h.shelvesService.SetReading(r.Context(), userId, bookId, inp)
+	if err != nil {
+		handleShelfError(w, "setReading", err)
+		return
+	}
+
+	writeJSON(w, "setReading", http.StatusOK, reading)
+}
+
+func (h *Handler) deleteReading(w http.ResponseWriter, r *http.Request) {
+	userId, bookId, ok := readingRequest(w, r, "deleteReading")
+	if !ok {
+		return
+	}
+
+	if err := h.shelvesService.DeleteReading(r.Context(), userId, bookId); err != nil {
+		handleShelfError(w, "deleteReading", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getReadingStats(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("getReadingStats", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	stats, err := h.shelvesService.Stats(r.Context(), userId)
+	if err != nil {
+		logError("getReadingStats", "getting reading stats", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getReadingStats", http.StatusOK, stats)
+}
+
+// readingRequest reads the current user and the book from the path.
+func readingRequest(w http.ResponseWriter, r *http.Request, handler string) (int64, int64, bool) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError(handler, "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	bookId, err := getPathInt64(r, "bookId")
+	if err != nil {
+		logError(handler, "getting book id from request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return userId, bookId, true
+}
+
+func handleShelfError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrShelfNotFound), errors.Is(err, domain.ErrBookNotFound),
+		errors.Is(err, domain.ErrReadingNotFound):
+		handleNotFoundError(w, err)
+	case errors.Is(err, domain.ErrShelfNameTaken):
+		handleError(w, http.StatusConflict, err)
+	case errors.Is(err, domain.ErrInvalidProgress), errors.Is(err, domain.ErrInvalidDates):
+		handleError(w, http.StatusBadRequest, err)
+	default:
+		logError(handler, "shelf request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,176 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dewi911/cruda-app/internal/domain"
+	"net/http"
+)
+
+func (h *Handler) getMe(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("getMe", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.usersService.GetByID(r.Context(), userId)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			handleNotFoundError(w, err)
+			return
+		}
+
+		logError("getMe", "getting user", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, "getMe", http.StatusOK, user)
+}
+
+func (h *Handler) updateMe(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("updateMe", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.UpdateUserInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("updateMe", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := h.usersService.Update(r.Context(), userId, inp)
+	if err != nil {
+		if errors.Is(err, domain.ErrEmailTaken) {
+			handleError(w, http.StatusConflict, err)
+			return
+		}
+
+		logError("updateMe", "updating user", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if res.PendingEmail != "" {
+		status = http.StatusAccepted
+	}
+
+	writeJSON(w, "updateMe", status, res)
+}
+
+func (h *Handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("changePassword", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.ChangePasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("changePassword", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.usersService.ChangePassword(r.Context(), userId, inp); err != nil {
+		if errors.Is(err, domain.ErrInvalidPassword) {
+			handleError(w, http.StatusForbidden, err)
+			return
+		}
+
+		logError("changePassword", "changing password", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) deleteMe(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromContext(r)
+	if err != nil {
+		logError("deleteMe", "getting user id", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var inp domain.DeleteUserInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("deleteMe", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.usersService.Delete(r.Context(), userId, inp); err != nil {
+		if errors.Is(err, domain.ErrInvalidPassword) {
+			handleError(w, http.StatusForbidden, err)
+			return
+		}
+
+		if errors.Is(err, domain.ErrUserHasLoans) || errors.Is(err, domain.ErrUserHasHolds) {
+			handleError(w, http.StatusConflict, err)
+			return
+		}
+
+		logError("deleteMe", "deleting user", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var inp domain.VerifyEmailInput
+	if err := json.NewDecoder(r.Body).Decode(&inp); err != nil {
+		logError("verifyEmail", "unmarshalling request body", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := inp.Validate(); err != nil {
+		handleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.usersService.VerifyEmail(r.Context(), inp.Token); err != nil {
+		if errors.Is(err, domain.ErrVerificationNotFound) {
+			handleNotFoundError(w, err)
+			return
+		}
+
+		if errors.Is(err, domain.ErrEmailTaken) {
+			handleError(w, http.StatusConflict, err)
+			return
+		}
+
+		logError("verifyEmail", "verifying email", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
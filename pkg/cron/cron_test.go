@@ -0,0 +1,91 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestNext(t *testing.T) {
+	// 1 January 2024 is a Monday
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", date(2024, 1, 1, 10, 7), date(2024, 1, 1, 10, 15)},
+		{"*/15 * * * *", date(2024, 1, 1, 10, 15), date(2024, 1, 1, 10, 30)},
+		{"5/15 * * * *", date(2024, 1, 1, 10, 7), date(2024, 1, 1, 10, 20)},
+		{"5/15 * * * *", date(2024, 1, 1, 10, 50), date(2024, 1, 1, 11, 5)},
+		{"0 */6 * * *", date(2024, 1, 1, 13, 0), date(2024, 1, 1, 18, 0)},
+		{"0 8-18/4 * * *", date(2024, 1, 1, 17, 0), date(2024, 1, 2, 8, 0)},
+		{"30 2 * * *", date(2024, 1, 1, 2, 30), date(2024, 1, 2, 2, 30)},
+		{"0 9 * * 1-5", date(2024, 1, 5, 10, 0), date(2024, 1, 8, 9, 0)},
+		{"0 9 * * mon,wed", date(2024, 1, 1, 10, 0), date(2024, 1, 3, 9, 0)},
+		{"0 0 1 jan-mar *", date(2024, 3, 2, 0, 0), date(2025, 1, 1, 0, 0)},
+
+		// 7 and 0 are both Sunday
+		{"0 0 * * 7", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 0, 0)},
+		{"0 0 * * 0", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 0, 0)},
+		{"0 0 * * sun", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 0, 0)},
+		{"0 0 * * 5-7", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+
+		// with both day fields restricted either one matches
+		{"0 0 13 * 5", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+		{"0 0 13 * 5", date(2024, 1, 5, 0, 0), date(2024, 1, 12, 0, 0)},
+		{"0 0 13 * 5", date(2024, 1, 12, 0, 0), date(2024, 1, 13, 0, 0)},
+		// with one of them a star only the other one counts
+		{"0 0 13 * *", date(2024, 1, 1, 0, 0), date(2024, 1, 13, 0, 0)},
+		{"0 0 * * 5", date(2024, 1, 5, 0, 0), date(2024, 1, 12, 0, 0)},
+		// as in Vixie cron a stepped star is still a star: the 1st, 11th, 21st or 31st that is a Friday
+		{"0 0 */10 * 5", date(2024, 1, 1, 0, 0), date(2024, 3, 1, 0, 0)},
+
+		{"0 0 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},
+
+		{"@daily", date(2024, 1, 1, 10, 0), date(2024, 1, 2, 0, 0)},
+		{"@HOURLY", date(2024, 1, 1, 10, 0), date(2024, 1, 1, 11, 0)},
+		{"@weekly", date(2024, 1, 1, 10, 0), date(2024, 1, 7, 0, 0)},
+		{"@monthly", date(2024, 1, 1, 10, 0), date(2024, 2, 1, 0, 0)},
+		{"@every 1h", date(2024, 1, 1, 10, 7), date(2024, 1, 1, 11, 0)},
+		{"@every 15m", date(2024, 1, 1, 10, 15), date(2024, 1, 1, 10, 30)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next(%s) = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every 500ms",
+		"@every soon",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// AESEncryptor seals values with AES-256-GCM. The key is derived from an
+// arbitrary length passphrase so it can come straight from configuration.
+type AESEncryptor struct {
+	aead cipher.AEAD
+}
+
+// SampleKey is the key the example configuration used to ship with. It is
+// public, so it is refused like an empty one.
+const SampleKey = "sample encryption key"
+
+func NewAESEncryptor(passphrase string) (*AESEncryptor, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty encryption key")
+	}
+
+	if passphrase == SampleKey {
+		return nil, errors.New("the sample encryption key must be replaced")
+	}
+
+	key := sha256.Sum256([]byte(passphrase))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AESEncryptor{aead: aead}, nil
+}
+
+func (e *AESEncryptor) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := e.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (e *AESEncryptor) Decrypt(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < e.aead.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := data[:e.aead.NonceSize()], data[e.aead.NonceSize():]
+
+	plaintext, err := e.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
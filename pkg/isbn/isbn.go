@@ -0,0 +1,132 @@
+// Package isbn validates and normalizes ISBN-10 and ISBN-13 numbers.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidLength   = errors.New("isbn must have 10 or 13 digits")
+	ErrInvalidChar     = errors.New("isbn contains invalid characters")
+	ErrInvalidChecksum = errors.New("isbn check digit does not match")
+	ErrInvalidPrefix   = errors.New("isbn-13 must start with 978 or 979")
+)
+
+// Normalize validates an ISBN-10 or ISBN-13, with or without hyphens and
+// spaces, and returns it as a bare ISBN-13.
+func Normalize(s string) (string, error) {
+	digits := strip(s)
+
+	switch len(digits) {
+	case 10:
+		if err := check10(digits); err != nil {
+			return "", err
+		}
+		return To13(digits), nil
+	case 13:
+		if err := check13(digits); err != nil {
+			return "", err
+		}
+		return digits, nil
+	default:
+		return "", ErrInvalidLength
+	}
+}
+
+// Valid reports whether s is a valid ISBN-10 or ISBN-13.
+func Valid(s string) bool {
+	_, err := Normalize(s)
+	return err == nil
+}
+
+// To13 converts a bare, valid ISBN-10 to ISBN-13.
+func To13(isbn10 string) string {
+	body := "978" + isbn10[:9]
+	return body + string(checkDigit13(body))
+}
+
+// To10 converts a bare ISBN-13 with the 978 prefix to ISBN-10. It returns
+// false for 979 numbers, which have no ISBN-10 form.
+func To10(isbn13 string) (string, bool) {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return "", false
+	}
+
+	body := isbn13[3:12]
+	return body + string(checkDigit10(body)), true
+}
+
+func strip(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '-' || r == ' ' {
+			continue
+		}
+		if r == 'x' {
+			r = 'X'
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func check10(s string) error {
+	for i, r := range s {
+		if (r < '0' || r > '9') && !(r == 'X' && i == 9) {
+			return ErrInvalidChar
+		}
+	}
+
+	if s[9] != checkDigit10(s[:9]) {
+		return ErrInvalidChecksum
+	}
+
+	return nil
+}
+
+func check13(s string) error {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return ErrInvalidChar
+		}
+	}
+
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return ErrInvalidPrefix
+	}
+
+	if s[12] != checkDigit13(s[:12]) {
+		return ErrInvalidChecksum
+	}
+
+	return nil
+}
+
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+
+	d := (11 - sum%11) % 11
+	if d == 10 {
+		return 'X'
+	}
+
+	return byte('0' + d)
+}
+
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		w := 1
+		if i%2 == 1 {
+			w = 3
+		}
+		sum += int(body[i]-'0') * w
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
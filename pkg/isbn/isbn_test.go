@@ -0,0 +1,86 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"9780306406157", "9780306406157", nil},
+		{"978-0-306-40615-7", "9780306406157", nil},
+		{"978 0 306 40615 7", "9780306406157", nil},
+		{"0306406152", "9780306406157", nil},
+		{"0-306-40615-2", "9780306406157", nil},
+		{"080442957X", "9780804429573", nil},
+		{"080442957x", "9780804429573", nil},
+		{"9791090636071", "9791090636071", nil},
+		{"0306406153", "", ErrInvalidChecksum},
+		{"9780306406158", "", ErrInvalidChecksum},
+		{"X306406152", "", ErrInvalidChar},
+		{"03064061X2", "", ErrInvalidChar},
+		{"978030640615X", "", ErrInvalidChar},
+		{"9770306406157", "", ErrInvalidPrefix},
+		{"030640615", "", ErrInvalidLength},
+		{"", "", ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Normalize(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	if !Valid("0-306-40615-2") {
+		t.Error("Valid(0-306-40615-2) = false")
+	}
+
+	if Valid("0-306-40615-3") {
+		t.Error("Valid(0-306-40615-3) = true")
+	}
+}
+
+func TestTo10(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"9780306406157", "0306406152", true},
+		{"9780804429573", "080442957X", true},
+		{"9791090636071", "", false},
+		{"978030640615", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := To10(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("To10(%q) = (%q, %v), want (%q, %v)", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTo13RoundTrip(t *testing.T) {
+	for _, isbn10 := range []string{"0306406152", "080442957X", "0140449132"} {
+		isbn13 := To13(isbn10)
+		if !Valid(isbn13) {
+			t.Errorf("To13(%q) = %q is not valid", isbn10, isbn13)
+		}
+
+		if back, ok := To10(isbn13); !ok || back != isbn10 {
+			t.Errorf("To10(To13(%q)) = (%q, %v)", isbn10, back, ok)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrTestFailed is returned when a test operation does not match the document.
+var ErrTestFailed = errors.New("jsonpatch: test failed")
+
+// MergePatch applies a JSON merge patch (RFC 7396) to the document. Null
+// members of the patch remove the member from the document, objects are
+// merged recursively and every other value replaces the target.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("jsonpatch: invalid document: %w", err)
+	}
+
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("jsonpatch: invalid patch: %w", err)
+	}
+
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+
+		t[key] = merge(t[key], value)
+	}
+
+	return t
+}
+
+// Apply applies a JSON patch (RFC 6902) to the document. The operations are
+// applied in order and the whole patch fails if any of them does.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("jsonpatch: invalid document: %w", err)
+	}
+
+	// members are kept raw to tell a null value from a missing one
+	var ops []map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("jsonpatch: invalid patch: %w", err)
+	}
+
+	for i, op := range ops {
+		var err error
+		if target, err = applyOp(target, op); err != nil {
+			if errors.Is(err, ErrTestFailed) {
+				return nil, fmt.Errorf("%w: operation %d", err, i)
+			}
+			return nil, fmt.Errorf("jsonpatch: operation %d: %w", i, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func applyOp(doc interface{}, op map[string]json.RawMessage) (interface{}, error) {
+	name, err := member(op, "op")
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := pointerMember(op, "path")
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "add", "replace", "test":
+		raw, ok := op["value"]
+		if !ok {
+			return nil, errors.New(`missing "value"`)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf(`invalid "value": %w`, err)
+		}
+
+		switch name {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		}
+
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("%w at %q", ErrTestFailed, "/"+strings.Join(path, "/"))
+		}
+
+		return doc, nil
+	case "remove":
+		return remove(doc, path)
+	case "move", "copy":
+		from, err := pointerMember(op, "from")
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "copy" {
+			return add(doc, path, deepCopy(value))
+		}
+
+		if isPrefix(from, path) {
+			if len(from) == len(path) {
+				return doc, nil
+			}
+			return nil, errors.New("cannot move a value into itself")
+		}
+
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+
+		return add(doc, path, value)
+	default:
+		return nil, fmt.Errorf("unknown op %q", name)
+	}
+}
+
+func member(op map[string]json.RawMessage, name string) (string, error) {
+	raw, ok := op[name]
+	if !ok {
+		return "", fmt.Errorf("missing %q", name)
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("invalid %q: %w", name, err)
+	}
+
+	return s, nil
+}
+
+func pointerMember(op map[string]json.RawMessage, name string) ([]string, error) {
+	s, err := member(op, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePointer(s)
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped tokens.
+func parsePointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", s)
+	}
+
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		var err error
+		if doc, err = child(doc, token); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return edit(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[token] = value
+			return p, nil
+		case []interface{}:
+			if token == "-" {
+				return append(p, value), nil
+			}
+
+			i, err := index(token, len(p)+1)
+			if err != nil {
+				return nil, err
+			}
+
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+
+			return p, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar", token)
+		}
+	})
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+
+	return edit(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		if _, err := child(parent, token); err != nil {
+			return nil, err
+		}
+
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			delete(p, token)
+			return p, nil
+		default:
+			s := p.([]interface{})
+			i, _ := index(token, len(s))
+
+			return append(s[:i:i], s[i+1:]...), nil
+		}
+	})
+}
+
+func replace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return edit(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		if _, err := child(parent, token); err != nil {
+			return nil, err
+		}
+
+		return set(parent, token, value), nil
+	})
+}
+
+// edit calls fn with the parent of the path and the last token of it and
+// stores what fn returns in place of the parent, since appending to an array
+// makes a new slice.
+func edit(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	c, err := child(doc, path[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if c, err = edit(c, path[1:], fn); err != nil {
+		return nil, err
+	}
+
+	return set(doc, path[0], c), nil
+}
+
+// child returns an existing member of an object or element of an array.
+func child(doc interface{}, token string) (interface{}, error) {
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		value, ok := d[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+		return value, nil
+	case []interface{}:
+		i, err := index(token, len(d))
+		if err != nil {
+			return nil, err
+		}
+		return d[i], nil
+	default:
+		return nil, fmt.Errorf("member %q not found", token)
+	}
+}
+
+// set stores the value under a token that child has already resolved.
+func set(doc interface{}, token string, value interface{}) interface{} {
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		d[token] = value
+	case []interface{}:
+		i, _ := index(token, len(d))
+		d[i] = value
+	}
+
+	return doc
+}
+
+// index parses an array index below n. Leading zeros are not allowed.
+func index(token string, n int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') || token[0] == '+' {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	if i >= n {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+
+	return i, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			c[key] = deepCopy(item)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(value))
+		for i, item := range value {
+			c[i] = deepCopy(item)
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,133 @@
+package oidc_test
+
+import (
+	"context"
+	"github.com/dewi911/cruda-app/pkg/oidc"
+	"github.com/dewi911/cruda-app/pkg/oidc/oidctest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	clientID    = "library"
+	redirectURL = "https://library.example/auth/oidc/mock/callback"
+)
+
+var alice = oidctest.User{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+
+func newProvider(t *testing.T) (*oidc.Provider, *oidctest.Server) {
+	t.Helper()
+
+	srv, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	return oidc.NewProvider(oidc.Config{Issuer: srv.URL, ClientID: clientID, RedirectURL: redirectURL}), srv
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p, srv := newProvider(t)
+
+	authURL, err := p.AuthCodeURL(context.Background(), "st", "nc", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if base := srv.URL + "/authorize"; !strings.HasPrefix(authURL, base+"?") {
+		t.Errorf("AuthCodeURL = %s, want it at %s", authURL, base)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             clientID,
+		"redirect_uri":          redirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "st",
+		"nonce":                 "nc",
+		"code_challenge":        oidc.Challenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if got := u.Query().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	p, srv := newProvider(t)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "st", "nc", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, err := srv.Authorize(authURL, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := p.Exchange(ctx, code, "verifier", "nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := oidc.Claims{Issuer: srv.URL, Subject: "alice-1", Nonce: "nc", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if claims != want {
+		t.Errorf("claims = %+v, want %+v", claims, want)
+	}
+
+	if v := srv.Verifiers(); len(v) != 1 || v[0] != "verifier" {
+		t.Errorf("token endpoint got verifiers %q, want [verifier]", v)
+	}
+
+	// codes are single use
+	if _, err := p.Exchange(ctx, code, "verifier", "nc"); err == nil {
+		t.Error("a code was redeemed twice")
+	}
+}
+
+func TestExchangeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		issued   string
+		err      string
+	}{
+		{"wrong verifier", "other", "nc", "", "400"},
+		{"nonce mismatch", "verifier", "other", "", "nonce mismatch"},
+		{"nonce replaced by the issuer", "verifier", "nc", "forged", "nonce mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, srv := newProvider(t)
+			srv.Nonce = tt.issued
+			ctx := context.Background()
+
+			authURL, err := p.AuthCodeURL(ctx, "st", "nc", "verifier")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			code, _, err := srv.Authorize(authURL, alice)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := p.Exchange(ctx, code, tt.verifier, tt.nonce); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Exchange error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
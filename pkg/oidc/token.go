@@ -0,0 +1,255 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Claims are the ID token claims the application cares about.
+type Claims struct {
+	Issuer        string
+	Subject       string
+	Nonce         string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+func newClaims(m jwt.MapClaims) Claims {
+	c := Claims{}
+	c.Issuer, _ = m["iss"].(string)
+	c.Subject, _ = m["sub"].(string)
+	c.Nonce, _ = m["nonce"].(string)
+	c.Email, _ = m["email"].(string)
+	c.Name, _ = m["name"].(string)
+
+	// some providers send email_verified as a string
+	switch v := m["email_verified"].(type) {
+	case bool:
+		c.EmailVerified = v
+	case string:
+		c.EmailVerified = v == "true"
+	}
+
+	return c
+}
+
+// NewVerifier returns a random PKCE code verifier (RFC 7636).
+func NewVerifier() (string, error) {
+	return randomString(32)
+}
+
+// NewNonce returns a random value for state and nonce parameters.
+func NewNonce() (string, error) {
+	return randomString(16)
+}
+
+// Challenge derives the S256 code challenge from a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type keySet struct {
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+const minKeysRefresh = time.Minute
+
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (Claims, error) {
+	mapClaims := jwt.MapClaims{}
+
+	t, err := jwt.ParseWithClaims(idToken, mapClaims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if !t.Valid {
+		return Claims{}, errors.New("invalid id token")
+	}
+
+	if !mapClaims.VerifyAudience(p.cfg.ClientID, true) {
+		return Claims{}, errors.New("unexpected audience")
+	}
+
+	if _, ok := mapClaims["exp"]; !ok {
+		return Claims{}, errors.New("id token has no expiry")
+	}
+
+	claims := newClaims(mapClaims)
+
+	if strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return Claims{}, fmt.Errorf("unexpected issuer: %s", claims.Issuer)
+	}
+
+	if claims.Nonce != nonce {
+		return Claims{}, errors.New("nonce mismatch")
+	}
+
+	if claims.Subject == "" {
+		return Claims{}, errors.New("empty subject")
+	}
+
+	return claims, nil
+}
+
+// key looks up a signing key, refetching the key set once if the kid is unknown.
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	if keys != nil {
+		if key, ok := keys.lookup(kid); ok {
+			return key, nil
+		}
+
+		if time.Since(keys.fetchedAt) < minKeysRefresh {
+			return nil, fmt.Errorf("unknown key id: %s", kid)
+		}
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, ok := keys.lookup(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key id: %s", kid)
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (*keySet, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &doc); err != nil {
+		return nil, err
+	}
+
+	set := &keySet{keys: make(map[string]interface{}), fetchedAt: time.Now()}
+	for _, k := range doc.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+
+		set.keys[k.Kid] = key
+	}
+
+	p.mu.Lock()
+	p.keys = set
+	p.mu.Unlock()
+
+	return set, nil
+}
+
+func (s *keySet) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
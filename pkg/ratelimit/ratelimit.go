@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket: Rate tokens are added per second up to Burst.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Every returns a limit that allows requests per period with the given burst.
+func Every(requests int, period time.Duration, burst int) Limit {
+	if burst <= 0 {
+		burst = requests
+	}
+
+	return Limit{
+		Rate:  float64(requests) / period.Seconds(),
+		Burst: burst,
+	}
+}
+
+func (l Limit) IsZero() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps buckets between requests. Replicas that must share limits
+// should use a store backed by a shared database instead of MemoryStore.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Bucket is the persisted state of a single token bucket.
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// NewBucket returns a full bucket.
+func NewBucket(limit Limit, now time.Time) Bucket {
+	return Bucket{Tokens: float64(limit.Burst), UpdatedAt: now}
+}
+
+// Take refills the bucket up to now and tries to consume a single token.
+func (b *Bucket) Take(limit Limit, now time.Time) Result {
+	elapsed := now.Sub(b.UpdatedAt).Seconds()
+	if elapsed > 0 {
+		b.Tokens = math.Min(float64(limit.Burst), b.Tokens+elapsed*limit.Rate)
+		b.UpdatedAt = now
+	}
+
+	res := Result{Limit: limit.Burst}
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.Tokens) / limit.Rate)
+	}
+
+	res.Remaining = int(math.Floor(b.Tokens))
+	res.ResetAfter = seconds((float64(limit.Burst) - b.Tokens) / limit.Rate)
+
+	return res
+}
+
+// Full reports whether the bucket would be full at the given time,
+// in which case it carries no information and can be dropped.
+func (b *Bucket) Full(limit Limit, now time.Time) bool {
+	return !now.Before(b.FullAt(limit))
+}
+
+// FullAt returns when the bucket will have refilled completely.
+func (b *Bucket) FullAt(limit Limit) time.Time {
+	return b.UpdatedAt.Add(seconds((float64(limit.Burst) - b.Tokens) / limit.Rate))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
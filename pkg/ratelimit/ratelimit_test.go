@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEvery(t *testing.T) {
+	tests := []struct {
+		requests int
+		period   time.Duration
+		burst    int
+		want     Limit
+	}{
+		{60, time.Minute, 10, Limit{Rate: 1, Burst: 10}},
+		{10, time.Second, 0, Limit{Rate: 10, Burst: 10}},
+		{30, time.Hour, -1, Limit{Rate: 30.0 / 3600, Burst: 30}},
+	}
+
+	for _, tt := range tests {
+		if got := Every(tt.requests, tt.period, tt.burst); got != tt.want {
+			t.Errorf("Every(%d, %s, %d) = %+v, want %+v", tt.requests, tt.period, tt.burst, got, tt.want)
+		}
+	}
+}
+
+func TestLimitIsZero(t *testing.T) {
+	for _, l := range []Limit{{}, {Rate: 1}, {Burst: 1}, {Rate: -1, Burst: 1}} {
+		if !l.IsZero() {
+			t.Errorf("%+v.IsZero() = false", l)
+		}
+	}
+
+	if (Limit{Rate: 1, Burst: 1}).IsZero() {
+		t.Error("{1 1}.IsZero() = true")
+	}
+}
+
+func TestBucketTake(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+	start := time.Unix(0, 0)
+
+	type take struct {
+		at         time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{"burst then empty", []take{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, 500 * time.Millisecond},
+		}},
+		{"refills at the rate", []take{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{250 * time.Millisecond, false, 0, 250 * time.Millisecond},
+			{500 * time.Millisecond, true, 0, 0},
+			{time.Second, true, 0, 0},
+		}},
+		{"refills up to the burst only", []take{
+			{0, true, 2, 0},
+			{time.Hour, true, 2, 0},
+			{time.Hour, true, 1, 0},
+			{time.Hour, true, 0, 0},
+			{time.Hour, false, 0, 500 * time.Millisecond},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBucket(limit, start)
+
+			for i, tk := range tt.takes {
+				res := b.Take(limit, start.Add(tk.at))
+
+				if res.Allowed != tk.allowed || res.Remaining != tk.remaining || res.RetryAfter != tk.retryAfter {
+					t.Errorf("take %d = %+v, want allowed %v, remaining %d, retry after %s",
+						i, res, tk.allowed, tk.remaining, tk.retryAfter)
+				}
+
+				if res.Limit != limit.Burst {
+					t.Errorf("take %d limit = %d, want %d", i, res.Limit, limit.Burst)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketResetAfter(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+	start := time.Unix(0, 0)
+
+	b := NewBucket(limit, start)
+	b.Take(limit, start)
+	res := b.Take(limit, start)
+
+	// two tokens short of the burst at two tokens a second
+	if res.ResetAfter != time.Second {
+		t.Errorf("ResetAfter = %s, want 1s", res.ResetAfter)
+	}
+
+	if want := start.Add(time.Second); !b.FullAt(limit).Equal(want) {
+		t.Errorf("FullAt = %s, want %s", b.FullAt(limit), want)
+	}
+
+	if b.Full(limit, start.Add(999*time.Millisecond)) {
+		t.Error("bucket is full before FullAt")
+	}
+
+	if !b.Full(limit, start.Add(time.Second)) {
+		t.Error("bucket is not full at FullAt")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Unix(0, 0)
+
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	s.lastSweep = now
+
+	ctx := context.Background()
+	for i, want := range []bool{true, true, false} {
+		res, err := s.Take(ctx, "a", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Allowed != want {
+			t.Errorf("take %d of a allowed = %v, want %v", i, res.Allowed, want)
+		}
+	}
+
+	// keys have buckets of their own
+	if res, _ := s.Take(ctx, "b", limit); !res.Allowed {
+		t.Error("take of b was not allowed")
+	}
+
+	now = now.Add(time.Second)
+	if res, _ := s.Take(ctx, "a", limit); !res.Allowed {
+		t.Error("take of a after a second was not allowed")
+	}
+
+	// after the sweep interval both buckets have refilled and are dropped
+	now = now.Add(SweepInterval)
+	if _, err := s.Take(ctx, "c", limit); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.buckets) != 1 {
+		t.Errorf("%d buckets after the sweep, want 1", len(s.buckets))
+	}
+
+	if _, ok := s.buckets["c"]; !ok {
+		t.Error("bucket of c was dropped")
+	}
+}
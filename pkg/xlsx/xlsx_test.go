@@ -0,0 +1,150 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type cell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+type row struct {
+	Ref   string `xml:"r,attr"`
+	Cells []cell `xml:"c"`
+}
+
+type worksheet struct {
+	Rows []row `xml:"sheetData>row"`
+}
+
+type workbookSheets struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// readPart decodes a part of the archive, failing on XML that is not well formed.
+func readPart(t *testing.T, zr *zip.Reader, name string, v interface{}) {
+	t.Helper()
+
+	f, err := zr.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := xml.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s: %v\n%s", name, err, data)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, "Books & <more>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := [][]interface{}{
+		{"ID", "Title", "Pages", "Price", "Available"},
+		{int64(7), "Tom & Jerry <1>", 310, 12.5, true},
+		{int64(8), "Bell\x07 and\x00 null\x1b", nil, -0.25, false},
+		{int64(9), "Tab\there\nnew line  ", "", 0, nil},
+	}
+	for _, r := range rows {
+		if err := w.WriteRow(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels"} {
+		var part struct{}
+		readPart(t, zr, name, &part)
+	}
+
+	var book workbookSheets
+	readPart(t, zr, "xl/workbook.xml", &book)
+	if len(book.Sheets) != 1 || book.Sheets[0].Name != "Books & <more>" {
+		t.Errorf("sheets = %+v", book.Sheets)
+	}
+
+	var sheet worksheet
+	readPart(t, zr, "xl/worksheets/sheet1.xml", &sheet)
+
+	text := func(ref, s string) cell { return cell{Ref: ref, Type: "inlineStr", Inline: s} }
+	want := []row{
+		{"1", []cell{text("A1", "ID"), text("B1", "Title"), text("C1", "Pages"), text("D1", "Price"), text("E1", "Available")}},
+		{"2", []cell{{Ref: "A2", Value: "7"}, text("B2", "Tom & Jerry <1>"), {Ref: "C2", Value: "310"},
+			{Ref: "D2", Value: "12.5"}, {Ref: "E2", Type: "b", Value: "1"}}},
+		// characters XML cannot hold are replaced
+		{"3", []cell{{Ref: "A3", Value: "8"}, text("B3", "Bell\ufffd and\ufffd null\ufffd"),
+			{Ref: "D3", Value: "-0.25"}, {Ref: "E3", Type: "b", Value: "0"}}},
+		{"4", []cell{{Ref: "A4", Value: "9"}, text("B4", "Tab\there\nnew line  "), {Ref: "D4", Value: "0"}}},
+	}
+	if !reflect.DeepEqual(sheet.Rows, want) {
+		t.Errorf("rows =\n%+v\nwant\n%+v", sheet.Rows, want)
+	}
+}
+
+func TestWriterTruncatesLongCells(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, "Sheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteRow(strings.Repeat("é", maxCellLength+10)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sheet worksheet
+	readPart(t, zr, "xl/worksheets/sheet1.xml", &sheet)
+
+	if n := len([]rune(sheet.Rows[0].Cells[0].Inline)); n != maxCellLength {
+		t.Errorf("cell has %d characters, want %d", n, maxCellLength)
+	}
+}
+
+func TestColumn(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+
+	for i, want := range tests {
+		if got := column(i); got != want {
+			t.Errorf("column(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'reader'
+    CHECK (role IN ('reader', 'librarian', 'admin'));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP;
+
+-- the first administrator is granted by hand:
+-- UPDATE users SET role = 'admin' WHERE email = '...';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS erasure_jobs;
+
+ALTER TABLE users DROP COLUMN IF EXISTS erased_at;
+
+ALTER TABLE books DROP COLUMN IF EXISTS created_by;
@@ -0,0 +1,20 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS created_by INT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS books_created_by_idx ON books (created_by);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS erased_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS erasure_jobs (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    step INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    status_token VARCHAR(64) UNIQUE NOT NULL,
+    locked_until TIMESTAMP,
+    requested_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS erasure_jobs_user_id_idx ON erasure_jobs (user_id);
@@ -0,0 +1,9 @@
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS org_id;
+
+ALTER TABLE books DROP COLUMN IF EXISTS org_id;
+
+DROP TABLE IF EXISTS org_invitations;
+
+DROP TABLE IF EXISTS org_members;
+
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS org_members (
+    org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(32) NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'librarian', 'owner')),
+    joined_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS org_members_user_id_idx ON org_members (user_id);
+
+CREATE TABLE IF NOT EXISTS org_invitations (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    invited_by INT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- existing catalog and users move into a default organization. Every user
+-- could edit the catalog before, so nobody becomes a read-only member.
+INSERT INTO organizations (name, slug) VALUES ('Default', 'default') ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO org_members (org_id, user_id, role)
+SELECT o.id, u.id, CASE WHEN u.role = 'admin' THEN 'owner' ELSE 'librarian' END
+FROM users u, organizations o WHERE o.slug = 'default'
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organizations(id) ON DELETE CASCADE;
+
+UPDATE books SET org_id = (SELECT id FROM organizations WHERE slug = 'default') WHERE org_id IS NULL;
+
+ALTER TABLE books ALTER COLUMN org_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS books_org_id_idx ON books (org_id);
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS org_id INT REFERENCES organizations(id) ON DELETE SET NULL;
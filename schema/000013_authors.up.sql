@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS authors (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    sort_name VARCHAR(255) NOT NULL,
+    bio TEXT NOT NULL DEFAULT '',
+    birth_date DATE,
+    death_date DATE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS authors_org_id_sort_name_idx ON authors (org_id, sort_name);
+
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    author_id INT NOT NULL REFERENCES authors(id) ON DELETE CASCADE,
+    role VARCHAR(32) NOT NULL DEFAULT 'author' CHECK (role IN ('author', 'editor', 'translator')),
+    position INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS book_authors_author_id_idx ON book_authors (author_id);
+
+-- existing free-text authors are split on ";", "&" and " and " into author records,
+-- one per distinct name within an organization
+CREATE TEMPORARY TABLE book_author_names AS
+SELECT b.id AS book_id, b.org_id, trim(s.name) AS name, s.position
+FROM books b, regexp_split_to_table(b.author, '\s*(;|&|\s+and\s+)\s*') WITH ORDINALITY AS s(name, position)
+WHERE trim(s.name) <> '';
+
+INSERT INTO authors (org_id, name, sort_name)
+SELECT DISTINCT org_id, name, regexp_replace(name, '^(.*\S)\s+(\S+)$', '\2, \1')
+FROM book_author_names;
+
+INSERT INTO book_authors (book_id, author_id, role, position)
+SELECT n.book_id, a.id, 'author', n.position - 1
+FROM book_author_names n
+JOIN authors a ON a.org_id = n.org_id AND a.name = n.name
+ON CONFLICT DO NOTHING;
+
+DROP TABLE book_author_names;
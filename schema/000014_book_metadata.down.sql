@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS books_org_id_isbn_key;
+
+ALTER TABLE books
+    DROP COLUMN IF EXISTS isbn,
+    DROP COLUMN IF EXISTS publisher,
+    DROP COLUMN IF EXISTS language,
+    DROP COLUMN IF EXISTS page_count,
+    DROP COLUMN IF EXISTS format,
+    DROP COLUMN IF EXISTS edition,
+    DROP COLUMN IF EXISTS series,
+    DROP COLUMN IF EXISTS series_position;
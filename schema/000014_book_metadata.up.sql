@@ -0,0 +1,12 @@
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS isbn VARCHAR(13),
+    ADD COLUMN IF NOT EXISTS publisher VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS language VARCHAR(35) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS page_count INT NOT NULL DEFAULT 0 CHECK (page_count >= 0),
+    ADD COLUMN IF NOT EXISTS format VARCHAR(16) NOT NULL DEFAULT '' CHECK (format IN ('', 'hardcover', 'paperback', 'ebook', 'audio')),
+    ADD COLUMN IF NOT EXISTS edition VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS series VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS series_position DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (series_position >= 0);
+
+-- isbn is kept as a bare ISBN-13, so ISBN-10 and hyphenated input collide as well
+CREATE UNIQUE INDEX IF NOT EXISTS books_org_id_isbn_key ON books (org_id, isbn) WHERE isbn IS NOT NULL;
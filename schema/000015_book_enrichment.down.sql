@@ -0,0 +1,3 @@
+ALTER TABLE books
+    DROP COLUMN IF EXISTS cover_url,
+    DROP COLUMN IF EXISTS description;
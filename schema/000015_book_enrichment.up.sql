@@ -0,0 +1,3 @@
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS cover_url VARCHAR(1024) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
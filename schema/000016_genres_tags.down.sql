@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS book_tags;
+
+DROP TABLE IF EXISTS tags;
+
+DROP TABLE IF EXISTS book_genres;
+
+DROP TABLE IF EXISTS genres;
@@ -0,0 +1,9 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS rating INT NOT NULL DEFAULT 0;
+
+UPDATE books SET rating = ROUND(rating_sum::numeric / rating_count) WHERE rating_count > 0;
+
+ALTER TABLE books
+    DROP COLUMN IF EXISTS rating_sum,
+    DROP COLUMN IF EXISTS rating_count;
+
+DROP TABLE IF EXISTS reviews;
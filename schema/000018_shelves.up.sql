@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS reading_status (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('want_to_read', 'reading', 'read')),
+    started_at DATE,
+    finished_at DATE,
+    progress_pages INT CHECK (progress_pages >= 0),
+    progress_percent SMALLINT CHECK (progress_percent BETWEEN 0 AND 100),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, book_id)
+);
+
+CREATE INDEX IF NOT EXISTS reading_status_book_id_idx ON reading_status (book_id);
+
+CREATE TABLE IF NOT EXISTS shelves (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS shelves_user_id_name_idx ON shelves (user_id, LOWER(name));
+
+CREATE TABLE IF NOT EXISTS shelf_books (
+    shelf_id INT NOT NULL REFERENCES shelves(id) ON DELETE CASCADE,
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    added_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (shelf_id, book_id)
+);
+
+CREATE INDEX IF NOT EXISTS shelf_books_book_id_idx ON shelf_books (book_id);
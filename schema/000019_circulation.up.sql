@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS copies (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    barcode VARCHAR(64) NOT NULL,
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    condition VARCHAR(16) NOT NULL DEFAULT 'good' CHECK (condition IN ('new', 'good', 'fair', 'poor', 'damaged')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, barcode)
+);
+
+CREATE INDEX IF NOT EXISTS copies_book_id_idx ON copies (book_id);
+
+CREATE TABLE IF NOT EXISTS loans (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    copy_id INT NOT NULL REFERENCES copies(id) ON DELETE CASCADE,
+    borrower_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    checked_out_by INT REFERENCES users(id) ON DELETE SET NULL,
+    checked_out_at TIMESTAMP NOT NULL,
+    due_at TIMESTAMP NOT NULL,
+    renewals INT NOT NULL DEFAULT 0,
+    returned_at TIMESTAMP,
+    returned_by INT REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- a copy can only be on one open loan
+CREATE UNIQUE INDEX IF NOT EXISTS loans_open_copy_id_idx ON loans (copy_id) WHERE returned_at IS NULL;
+CREATE INDEX IF NOT EXISTS loans_borrower_id_idx ON loans (borrower_id);
+CREATE INDEX IF NOT EXISTS loans_open_due_at_idx ON loans (org_id, due_at) WHERE returned_at IS NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE loans DROP COLUMN IF EXISTS overdue_at;
+
+DROP INDEX IF EXISTS refresh_tokens_expires_at_idx;
+
+DROP TABLE IF EXISTS job_runs;
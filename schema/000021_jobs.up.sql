@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS job_runs (
+    id SERIAL PRIMARY KEY,
+    job VARCHAR(64) NOT NULL,
+    trigger VARCHAR(16) NOT NULL CHECK (trigger IN ('schedule', 'manual')),
+    status VARCHAR(16) NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    triggered_by INT REFERENCES users(id) ON DELETE SET NULL,
+    scheduled_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    error TEXT NOT NULL DEFAULT '',
+    result JSONB
+);
+
+-- replicas fire at the same scheduled time, only the first one runs the job
+CREATE UNIQUE INDEX IF NOT EXISTS job_runs_scheduled_idx ON job_runs (job, scheduled_at) WHERE trigger = 'schedule';
+CREATE INDEX IF NOT EXISTS job_runs_job_id_idx ON job_runs (job, id);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_expires_at_idx ON refresh_tokens (expires_at);
+
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS overdue_at TIMESTAMP;
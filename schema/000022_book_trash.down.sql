@@ -0,0 +1,17 @@
+-- trashed books would come back to life without the column, and deleting
+-- them would take their copies and loan history along
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM books WHERE deleted_at IS NOT NULL) THEN
+        RAISE EXCEPTION 'books are in the trash: restore or purge them before rolling back';
+    END IF;
+END $$;
+
+DROP INDEX IF EXISTS books_org_id_isbn_key;
+CREATE UNIQUE INDEX IF NOT EXISTS books_org_id_isbn_key ON books (org_id, isbn) WHERE isbn IS NOT NULL;
+
+DROP INDEX IF EXISTS books_deleted_at_idx;
+
+ALTER TABLE books
+    DROP COLUMN IF EXISTS deleted_by,
+    DROP COLUMN IF EXISTS deleted_at;
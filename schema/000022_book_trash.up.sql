@@ -0,0 +1,9 @@
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS deleted_by INT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx ON books (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- trashed books keep their ISBN without blocking it for new books
+DROP INDEX IF EXISTS books_org_id_isbn_key;
+CREATE UNIQUE INDEX IF NOT EXISTS books_org_id_isbn_key ON books (org_id, isbn) WHERE isbn IS NOT NULL AND deleted_at IS NULL;
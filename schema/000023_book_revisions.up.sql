@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS book_revisions (
+    id SERIAL PRIMARY KEY,
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    action VARCHAR(16) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore', 'revert')),
+    actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+    changed TEXT[] NOT NULL DEFAULT '{}',
+    reverted_to INT,
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (book_id, revision)
+);
+
+-- revisions are immutable, only the erasure of the actor and purging the book touch them
+CREATE OR REPLACE FUNCTION book_revisions_immutable() RETURNS trigger AS $$
+BEGIN
+    IF NEW.actor_id IS NULL AND OLD.actor_id IS NOT NULL
+        AND (NEW.book_id, NEW.revision, NEW.action, NEW.changed, NEW.snapshot, NEW.created_at)
+            IS NOT DISTINCT FROM (OLD.book_id, OLD.revision, OLD.action, OLD.changed, OLD.snapshot, OLD.created_at) THEN
+        RETURN NEW;
+    END IF;
+
+    RAISE EXCEPTION 'book revisions are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER book_revisions_immutable BEFORE UPDATE ON book_revisions
+    FOR EACH ROW EXECUTE FUNCTION book_revisions_immutable();
@@ -0,0 +1 @@
+ALTER TABLE book_imports DROP COLUMN IF EXISTS locked_until;
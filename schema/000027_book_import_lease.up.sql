@@ -0,0 +1,2 @@
+-- running imports renew the lease as they progress; an expired one was interrupted
+ALTER TABLE book_imports ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
@@ -0,0 +1,12 @@
+-- the loans of deleted accounts have no borrower to put back
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM loans WHERE borrower_id IS NULL) THEN
+        RAISE EXCEPTION 'loans of deleted accounts exist: remove them before rolling back';
+    END IF;
+END $$;
+
+ALTER TABLE loans DROP CONSTRAINT IF EXISTS loans_open_borrower_check;
+ALTER TABLE loans DROP CONSTRAINT IF EXISTS loans_borrower_id_fkey;
+ALTER TABLE loans ALTER COLUMN borrower_id SET NOT NULL;
+ALTER TABLE loans ADD CONSTRAINT loans_borrower_id_fkey FOREIGN KEY (borrower_id) REFERENCES users(id) ON DELETE CASCADE;
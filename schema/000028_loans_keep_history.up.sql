@@ -0,0 +1,5 @@
+-- deleting an account keeps the loan history; an open loan blocks it
+ALTER TABLE loans ALTER COLUMN borrower_id DROP NOT NULL;
+ALTER TABLE loans DROP CONSTRAINT IF EXISTS loans_borrower_id_fkey;
+ALTER TABLE loans ADD CONSTRAINT loans_borrower_id_fkey FOREIGN KEY (borrower_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE loans ADD CONSTRAINT loans_open_borrower_check CHECK (borrower_id IS NOT NULL OR returned_at IS NOT NULL);
@@ -0,0 +1,12 @@
+-- the holds of deleted accounts have no user to put back
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM holds WHERE user_id IS NULL) THEN
+        RAISE EXCEPTION 'holds of deleted accounts exist: remove them before rolling back';
+    END IF;
+END $$;
+
+ALTER TABLE holds DROP CONSTRAINT IF EXISTS holds_active_user_check;
+ALTER TABLE holds DROP CONSTRAINT IF EXISTS holds_user_id_fkey;
+ALTER TABLE holds ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE holds ADD CONSTRAINT holds_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+-- deleting an account keeps closed holds; an active hold blocks it
+ALTER TABLE holds ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE holds DROP CONSTRAINT IF EXISTS holds_user_id_fkey;
+ALTER TABLE holds ADD CONSTRAINT holds_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE holds ADD CONSTRAINT holds_active_user_check CHECK (user_id IS NOT NULL OR status NOT IN ('waiting', 'ready'));
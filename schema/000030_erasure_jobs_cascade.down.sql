@@ -0,0 +1,2 @@
+ALTER TABLE erasure_jobs DROP CONSTRAINT IF EXISTS erasure_jobs_user_id_fkey;
+ALTER TABLE erasure_jobs ADD CONSTRAINT erasure_jobs_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
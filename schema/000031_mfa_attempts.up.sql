@@ -0,0 +1,3 @@
+-- codes tried since the last accepted one; too many lock verification for a while
+ALTER TABLE user_mfa ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE user_mfa ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;